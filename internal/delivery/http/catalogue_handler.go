@@ -0,0 +1,151 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+var spreadsheetContentTypes = map[string]string{
+	service.SpreadsheetCSV:  "text/csv",
+	service.SpreadsheetXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+type CatalogueHandlerClean struct {
+	catalogueUseCase usecase.CatalogueUseCase
+	userRepo         repository.UserRepository
+}
+
+// NewCatalogueHandlerClean creates a new catalogue handler
+func NewCatalogueHandlerClean(catalogueUseCase usecase.CatalogueUseCase, userRepo repository.UserRepository) *CatalogueHandlerClean {
+	return &CatalogueHandlerClean{
+		catalogueUseCase: catalogueUseCase,
+		userRepo:         userRepo,
+	}
+}
+
+// ImportCatalogue upserts the medicines of a CSV or XLSX file sent as the
+// "file" form field into the caller's pharmacy. With dryRun=true the file is
+// only validated and the changes it would make are reported.
+func (h *CatalogueHandlerClean) ImportCatalogue(c *gin.Context) {
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	dryRun := false
+	if value := c.Query("dryRun"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			response.BadRequest(c, "dryRun must be true or false")
+			return
+		}
+		dryRun = parsed
+	}
+
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, usecase.MaxCatalogueSize+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "A CSV or XLSX file of up to 10 MB is required")
+		return
+	}
+	defer file.Close()
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	if _, ok := spreadsheetContentTypes[format]; !ok {
+		response.BadRequest(c, "Only .csv and .xlsx files are supported")
+		return
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, usecase.MaxCatalogueSize+1))
+	if err != nil {
+		response.BadRequest(c, "Failed to read catalogue file")
+		return
+	}
+	if len(content) > usecase.MaxCatalogueSize {
+		response.BadRequest(c, "A CSV or XLSX file of up to 10 MB is required")
+		return
+	}
+
+	result, err := h.catalogueUseCase.ImportCatalogue(c.Request.Context(), pharmacyID, format, bytes.NewReader(content), dryRun)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidCatalogue) || errors.Is(err, service.ErrUnsupportedSpreadsheet) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		response.InternalServerError(c, "Failed to import catalogue")
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, response.Response{
+			Success: false,
+			Data:    result,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_ROWS",
+				Message: fmt.Sprintf("%d rows have errors; nothing was imported", len(result.Errors)),
+			},
+		})
+		return
+	}
+
+	message := "Catalogue imported successfully"
+	if dryRun {
+		message = "Catalogue is valid; nothing was imported"
+	}
+	response.Success(c, result, message)
+}
+
+// ExportCatalogue downloads the caller's pharmacy catalogue as CSV, or as
+// XLSX with format=xlsx
+func (h *CatalogueHandlerClean) ExportCatalogue(c *gin.Context) {
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", service.SpreadsheetCSV))
+	contentType, ok := spreadsheetContentTypes[format]
+	if !ok {
+		response.BadRequest(c, "format must be csv or xlsx")
+		return
+	}
+
+	content, err := h.catalogueUseCase.ExportCatalogue(c.Request.Context(), pharmacyID, format)
+	if err != nil {
+		response.InternalServerError(c, "Failed to export catalogue")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="catalogue-%s.%s"`, time.Now().Format("2006-01-02"), format))
+	c.Data(http.StatusOK, contentType, content)
+}
+
+func (h *CatalogueHandlerClean) callerPharmacy(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return uuid.Nil, false
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		response.NotFound(c, "No pharmacy associated with this user")
+		return uuid.Nil, false
+	}
+	return pharmacyID, true
+}
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type CouponHandlerClean struct {
+	couponUseCase usecase.CouponUseCase
+	userRepo      repository.UserRepository
+}
+
+// NewCouponHandlerClean creates a new coupon handler
+func NewCouponHandlerClean(couponUseCase usecase.CouponUseCase, userRepo repository.UserRepository) *CouponHandlerClean {
+	return &CouponHandlerClean{
+		couponUseCase: couponUseCase,
+		userRepo:      userRepo,
+	}
+}
+
+// AdminCreateCoupon creates a platform-wide coupon, or one for any pharmacy
+func (h *CouponHandlerClean) AdminCreateCoupon(c *gin.Context) {
+	h.createCoupon(c, false)
+}
+
+// PharmacyCreateCoupon creates a coupon for the caller's pharmacy
+func (h *CouponHandlerClean) PharmacyCreateCoupon(c *gin.Context) {
+	h.createCoupon(c, true)
+}
+
+func (h *CouponHandlerClean) AdminUpdateCoupon(c *gin.Context) {
+	h.updateCoupon(c, false)
+}
+
+func (h *CouponHandlerClean) PharmacyUpdateCoupon(c *gin.Context) {
+	h.updateCoupon(c, true)
+}
+
+func (h *CouponHandlerClean) AdminDeactivateCoupon(c *gin.Context) {
+	h.deactivateCoupon(c, false)
+}
+
+func (h *CouponHandlerClean) PharmacyDeactivateCoupon(c *gin.Context) {
+	h.deactivateCoupon(c, true)
+}
+
+func (h *CouponHandlerClean) AdminListCoupons(c *gin.Context) {
+	h.listCoupons(c, false)
+}
+
+func (h *CouponHandlerClean) PharmacyListCoupons(c *gin.Context) {
+	h.listCoupons(c, true)
+}
+
+// ApplyCoupon applies a coupon code to the caller's cart
+func (h *CouponHandlerClean) ApplyCoupon(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.ApplyCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	cart, err := h.couponUseCase.ApplyCouponToCart(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		writeCouponError(c, err)
+		return
+	}
+	response.Success(c, cart, "Coupon applied successfully")
+}
+
+// RemoveCoupon removes the coupon from the caller's cart
+func (h *CouponHandlerClean) RemoveCoupon(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	cart, err := h.couponUseCase.RemoveCouponFromCart(c.Request.Context(), userID)
+	if err != nil {
+		writeCouponError(c, err)
+		return
+	}
+	response.Success(c, cart, "Coupon removed successfully")
+}
+
+func (h *CouponHandlerClean) createCoupon(c *gin.Context, pharmacyScoped bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	pharmacyID, ok := h.pharmacyScope(c, userID, pharmacyScoped)
+	if !ok {
+		return
+	}
+
+	coupon, err := h.couponUseCase.CreateCoupon(c.Request.Context(), userID, pharmacyID, req)
+	if err != nil {
+		writeCouponError(c, err)
+		return
+	}
+	response.Created(c, coupon, "Coupon created successfully")
+}
+
+func (h *CouponHandlerClean) updateCoupon(c *gin.Context, pharmacyScoped bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	couponID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid coupon ID format")
+		return
+	}
+
+	var req types.CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	pharmacyID, ok := h.pharmacyScope(c, userID, pharmacyScoped)
+	if !ok {
+		return
+	}
+
+	coupon, err := h.couponUseCase.UpdateCoupon(c.Request.Context(), couponID, pharmacyID, req)
+	if err != nil {
+		writeCouponError(c, err)
+		return
+	}
+	response.Success(c, coupon, "Coupon updated successfully")
+}
+
+func (h *CouponHandlerClean) deactivateCoupon(c *gin.Context, pharmacyScoped bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	couponID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid coupon ID format")
+		return
+	}
+
+	pharmacyID, ok := h.pharmacyScope(c, userID, pharmacyScoped)
+	if !ok {
+		return
+	}
+
+	if err := h.couponUseCase.DeactivateCoupon(c.Request.Context(), couponID, pharmacyID); err != nil {
+		writeCouponError(c, err)
+		return
+	}
+	response.Success(c, nil, "Coupon deactivated successfully")
+}
+
+func (h *CouponHandlerClean) listCoupons(c *gin.Context, pharmacyScoped bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var filter types.ListCouponsFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	pharmacyID, ok := h.pharmacyScope(c, userID, pharmacyScoped)
+	if !ok {
+		return
+	}
+	filter.PharmacyID = pharmacyID
+
+	coupons, total, err := h.couponUseCase.ListCoupons(c.Request.Context(), filter)
+	if err != nil {
+		response.InternalServerError(c, "Failed to retrieve coupons")
+		return
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+	response.Paginated(c, coupons, filter.Page, filter.Limit, int(total), "Coupons retrieved successfully")
+}
+
+// pharmacyScope returns the caller's pharmacy ID when scoped and nil otherwise.
+// It writes the error response itself when ok is false.
+func (h *CouponHandlerClean) pharmacyScope(c *gin.Context, userID uuid.UUID, scoped bool) (*uuid.UUID, bool) {
+	if !scoped {
+		return nil, true
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		response.NotFound(c, "No pharmacy associated with this user")
+		return nil, false
+	}
+	return &pharmacyID, true
+}
+
+// writeCouponError maps coupon and cart errors to responses
+func writeCouponError(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	errorCode := "COUPON_ERROR"
+
+	switch {
+	case errors.Is(err, usecase.ErrCouponNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "COUPON_NOT_FOUND"
+	case errors.Is(err, usecase.ErrCouponNotApplicable):
+		statusCode = http.StatusUnprocessableEntity
+		errorCode = "COUPON_NOT_APPLICABLE"
+	case errors.Is(err, usecase.ErrCouponLimitReached):
+		statusCode = http.StatusUnprocessableEntity
+		errorCode = "COUPON_LIMIT_REACHED"
+	case errors.Is(err, usecase.ErrCouponCodeTaken):
+		statusCode = http.StatusConflict
+		errorCode = "COUPON_CODE_TAKEN"
+	case errors.Is(err, usecase.ErrInvalidCoupon), errors.Is(err, usecase.ErrInvalidCart):
+		statusCode = http.StatusBadRequest
+		errorCode = "BAD_REQUEST"
+	}
+
+	c.JSON(statusCode, response.Response{
+		Success: false,
+		Error: &response.ErrorInfo{
+			Code:    errorCode,
+			Message: err.Error(),
+		},
+	})
+}
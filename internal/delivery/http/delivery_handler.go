@@ -0,0 +1,289 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type DeliveryHandlerClean struct {
+	deliveryUseCase usecase.DeliveryUseCase
+	userRepo        repository.UserRepository
+}
+
+// NewDeliveryHandlerClean creates a new delivery handler
+func NewDeliveryHandlerClean(deliveryUseCase usecase.DeliveryUseCase, userRepo repository.UserRepository) *DeliveryHandlerClean {
+	return &DeliveryHandlerClean{
+		deliveryUseCase: deliveryUseCase,
+		userRepo:        userRepo,
+	}
+}
+
+// AssignDelivery hands one of the pharmacy's orders to a delivery partner
+func (h *DeliveryHandlerClean) AssignDelivery(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid order ID format")
+		return
+	}
+
+	var req types.AssignDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	delivery, err := h.deliveryUseCase.AssignDelivery(c.Request.Context(), pharmacyID, userID, orderID, req)
+	if err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Created(c, delivery, "Delivery partner assigned successfully")
+}
+
+// ListDeliveryPartners lists the delivery partners orders can be assigned to
+func (h *DeliveryHandlerClean) ListDeliveryPartners(c *gin.Context) {
+	if _, ok := h.callerPharmacy(c); !ok {
+		return
+	}
+
+	var req types.ListDeliveryPartnersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	partners, total, err := h.deliveryUseCase.ListDeliveryPartners(c.Request.Context(), req)
+	if err != nil {
+		response.InternalServerError(c, "Failed to list delivery partners")
+		return
+	}
+	response.Paginated(c, partners, req.Page, req.Limit, int(total), "Delivery partners retrieved successfully")
+}
+
+// GetPharmacyDelivery tracks the delivery of one of the pharmacy's orders
+func (h *DeliveryHandlerClean) GetPharmacyDelivery(c *gin.Context) {
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid order ID format")
+		return
+	}
+
+	tracking, err := h.deliveryUseCase.GetPharmacyDelivery(c.Request.Context(), pharmacyID, orderID)
+	if err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Success(c, tracking, "Delivery retrieved successfully")
+}
+
+// ListAssignments lists the calling partner's deliveries
+func (h *DeliveryHandlerClean) ListAssignments(c *gin.Context) {
+	partnerID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.ListDeliveriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	deliveries, total, err := h.deliveryUseCase.ListAssignments(c.Request.Context(), partnerID, req)
+	if err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Paginated(c, deliveries, req.Page, req.Limit, int(total), "Deliveries retrieved successfully")
+}
+
+// UpdateDeliveryStatus moves one of the calling partner's deliveries along
+func (h *DeliveryHandlerClean) UpdateDeliveryStatus(c *gin.Context) {
+	partnerID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid delivery ID format")
+		return
+	}
+
+	var req types.UpdateDeliveryStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	delivery, err := h.deliveryUseCase.UpdateDeliveryStatus(c.Request.Context(), partnerID, deliveryID, req)
+	if err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Success(c, delivery, "Delivery status updated successfully")
+}
+
+// RecordPing stores the calling partner's position during a delivery
+func (h *DeliveryHandlerClean) RecordPing(c *gin.Context) {
+	partnerID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid delivery ID format")
+		return
+	}
+
+	var req types.DeliveryPingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.deliveryUseCase.RecordPing(c.Request.Context(), partnerID, deliveryID, req); err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Success(c, nil, "Location recorded successfully")
+}
+
+// ConfirmDelivery completes one of the calling partner's deliveries with the
+// OTP the patient gives them
+func (h *DeliveryHandlerClean) ConfirmDelivery(c *gin.Context) {
+	partnerID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid delivery ID format")
+		return
+	}
+
+	var req types.ConfirmDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	delivery, err := h.deliveryUseCase.ConfirmDelivery(c.Request.Context(), partnerID, deliveryID, req)
+	if err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Success(c, delivery, "Delivery confirmed successfully")
+}
+
+// TrackOrder returns where the delivery of one of the user's orders is
+func (h *DeliveryHandlerClean) TrackOrder(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid order ID format")
+		return
+	}
+
+	tracking, err := h.deliveryUseCase.TrackOrder(c.Request.Context(), userID, orderID)
+	if err != nil {
+		writeDeliveryError(c, err)
+		return
+	}
+	response.Success(c, tracking, "Delivery tracking retrieved successfully")
+}
+
+// callerPharmacy returns the pharmacy of the calling user. It writes the error
+// response itself when ok is false.
+func (h *DeliveryHandlerClean) callerPharmacy(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return uuid.Nil, false
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		response.NotFound(c, "No pharmacy associated with this user")
+		return uuid.Nil, false
+	}
+	return pharmacyID, true
+}
+
+// writeDeliveryError maps delivery and order errors to responses
+func writeDeliveryError(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	errorCode := "DELIVERY_ERROR"
+
+	switch {
+	case errors.Is(err, usecase.ErrDeliveryNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "DELIVERY_NOT_FOUND"
+	case errors.Is(err, usecase.ErrOrderNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "ORDER_NOT_FOUND"
+	case errors.Is(err, usecase.ErrNotOrderOwner):
+		statusCode = http.StatusForbidden
+		errorCode = "FORBIDDEN"
+	case errors.Is(err, usecase.ErrNotDeliveryPartner):
+		statusCode = http.StatusBadRequest
+		errorCode = "NOT_DELIVERY_PARTNER"
+	case errors.Is(err, usecase.ErrInvalidDeliveryOTP):
+		statusCode = http.StatusBadRequest
+		errorCode = "INVALID_OTP"
+	case errors.Is(err, usecase.ErrDeliveryOTPLocked):
+		statusCode = http.StatusTooManyRequests
+		errorCode = "OTP_LOCKED"
+	case errors.Is(err, usecase.ErrOrderNotDeliverable):
+		statusCode = http.StatusConflict
+		errorCode = "ORDER_NOT_DELIVERABLE"
+	case errors.Is(err, usecase.ErrInvalidDeliveryTransition):
+		statusCode = http.StatusConflict
+		errorCode = "INVALID_STATUS_TRANSITION"
+	case errors.Is(err, usecase.ErrDeliveryNotActive):
+		statusCode = http.StatusConflict
+		errorCode = "DELIVERY_NOT_ACTIVE"
+	}
+
+	c.JSON(statusCode, response.Response{
+		Success: false,
+		Error: &response.ErrorInfo{
+			Code:    errorCode,
+			Message: err.Error(),
+		},
+	})
+}
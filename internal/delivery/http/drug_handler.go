@@ -0,0 +1,191 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type DrugHandlerClean struct {
+	drugUseCase usecase.DrugUseCase
+	userRepo    repository.UserRepository
+}
+
+// NewDrugHandlerClean creates a new drug handler
+func NewDrugHandlerClean(drugUseCase usecase.DrugUseCase, userRepo repository.UserRepository) *DrugHandlerClean {
+	return &DrugHandlerClean{
+		drugUseCase: drugUseCase,
+		userRepo:    userRepo,
+	}
+}
+
+// AdminCreateDrug adds a drug to the master catalogue
+func (h *DrugHandlerClean) AdminCreateDrug(c *gin.Context) {
+	var req types.DrugRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	drug, err := h.drugUseCase.CreateDrug(c.Request.Context(), req)
+	if err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Created(c, drug, "Drug created successfully")
+}
+
+// AdminUpdateDrug replaces the details of a drug
+func (h *DrugHandlerClean) AdminUpdateDrug(c *gin.Context) {
+	drugID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid drug ID format")
+		return
+	}
+
+	var req types.DrugRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	drug, err := h.drugUseCase.UpdateDrug(c.Request.Context(), drugID, req)
+	if err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Success(c, drug, "Drug updated successfully")
+}
+
+// AdminDeactivateDrug hides a drug from search; linked medicines keep their link
+func (h *DrugHandlerClean) AdminDeactivateDrug(c *gin.Context) {
+	drugID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid drug ID format")
+		return
+	}
+
+	if err := h.drugUseCase.DeactivateDrug(c.Request.Context(), drugID); err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Success(c, nil, "Drug deactivated successfully")
+}
+
+// AdminListDrugs lists the master catalogue, including inactive drugs
+func (h *DrugHandlerClean) AdminListDrugs(c *gin.Context) {
+	var filter types.ListDrugsFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	drugs, total, err := h.drugUseCase.ListDrugs(c.Request.Context(), filter)
+	if err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Paginated(c, drugs, filter.Page, filter.Limit, int(total), "Drugs retrieved successfully")
+}
+
+// SearchDrugs finds drugs by name or composition, each with the pharmacies
+// offering it
+func (h *DrugHandlerClean) SearchDrugs(c *gin.Context) {
+	var filter types.ListDrugsFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	results, total, err := h.drugUseCase.SearchDrugs(c.Request.Context(), filter)
+	if err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Paginated(c, results, filter.Page, filter.Limit, int(total), "Drugs retrieved successfully")
+}
+
+// GetDrugOffers returns a drug with every pharmacy offering it
+func (h *DrugHandlerClean) GetDrugOffers(c *gin.Context) {
+	drugID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid drug ID format")
+		return
+	}
+
+	result, err := h.drugUseCase.GetDrugOffers(c.Request.Context(), drugID)
+	if err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Success(c, result, "Drug retrieved successfully")
+}
+
+// LinkMedicine links one of the caller's pharmacy medicines to a master drug
+func (h *DrugHandlerClean) LinkMedicine(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	medicineID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid medicine ID format")
+		return
+	}
+
+	var req types.LinkDrugRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		response.NotFound(c, "No pharmacy associated with this user")
+		return
+	}
+
+	medicine, err := h.drugUseCase.LinkMedicine(c.Request.Context(), pharmacyID, medicineID, req.DrugID)
+	if err != nil {
+		writeDrugError(c, err)
+		return
+	}
+	response.Success(c, medicine, "Medicine linked successfully")
+}
+
+// writeDrugError maps drug catalogue errors to responses
+func writeDrugError(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	errorCode := "DRUG_ERROR"
+
+	switch {
+	case errors.Is(err, usecase.ErrDrugNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "DRUG_NOT_FOUND"
+	case errors.Is(err, usecase.ErrMedicineNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "MEDICINE_NOT_FOUND"
+	case errors.Is(err, usecase.ErrDrugExists):
+		statusCode = http.StatusConflict
+		errorCode = "DRUG_EXISTS"
+	case errors.Is(err, usecase.ErrDrugInactive):
+		statusCode = http.StatusUnprocessableEntity
+		errorCode = "DRUG_INACTIVE"
+	}
+
+	c.JSON(statusCode, response.Response{
+		Success: false,
+		Error: &response.ErrorInfo{
+			Code:    errorCode,
+			Message: err.Error(),
+		},
+	})
+}
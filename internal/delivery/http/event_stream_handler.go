@@ -0,0 +1,69 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type EventStreamHandlerClean struct {
+	eventStreamUseCase usecase.EventStreamUseCase
+	keepAlive          time.Duration
+}
+
+// NewEventStreamHandlerClean creates a new live event stream handler
+func NewEventStreamHandlerClean(eventStreamUseCase usecase.EventStreamUseCase, keepAlive time.Duration) *EventStreamHandlerClean {
+	return &EventStreamHandlerClean{
+		eventStreamUseCase: eventStreamUseCase,
+		keepAlive:          keepAlive,
+	}
+}
+
+// Stream sends the calling user's order and appointment events as
+// Server-Sent Events until the client disconnects. The token goes in the
+// Authorization header like on every other route, so browsers need a
+// fetch-based EventSource; tokens are kept out of URLs and access logs.
+// Idle streams get a comment line every keepAlive so proxies keep them open.
+func (h *EventStreamHandlerClean) Stream(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	ctx := c.Request.Context()
+	events := h.eventStreamUseCase.Subscribe(ctx, userID)
+
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+			return true
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
@@ -2,7 +2,6 @@ package http
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -44,11 +43,8 @@ func (h *MedicineHandlerClean) GetMedicines(c *gin.Context) {
 		return
 	}
 
-	lattitude := c.GetFloat64("lattitude")
-	longitude := c.GetFloat64("longitude")
-
 	var req types.MedicineRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.ErrorResponse{
 			Error:   "Bad Request",
 			Message: "Invalid request payload",
@@ -56,9 +52,8 @@ func (h *MedicineHandlerClean) GetMedicines(c *gin.Context) {
 		})
 		return
 	}
-	searchquery := req.SearchQuery
 
-	medicinedata, err := h.medicineUseCase.GetMedicines(c.Request.Context(), searchquery)
+	result, total, err := h.medicineUseCase.GetMedicines(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
 			Error:   "Failed to retrieve medicines",
@@ -67,12 +62,7 @@ func (h *MedicineHandlerClean) GetMedicines(c *gin.Context) {
 		})
 		return
 	}
-	log.Printf("%f,%f", lattitude, longitude)
-	c.JSON(http.StatusOK, response.Response{
-		Success: true,
-		Data:    medicinedata,
-		Message: "Medicines retrieved successfully",
-	})
+	response.Paginated(c, result, req.Page, req.Limit, int(total), "Medicines retrieved successfully")
 }
 
 const (
@@ -204,8 +194,17 @@ func (h *MedicineHandlerClean) AddMedicine(c *gin.Context) {
 		Description:          &req.Description,
 		PharmacyID:           req.PharmacyID,
 		PrescriptionRequired: req.PrescriptionRequired,
+		HSNCode:              req.HSNCode,
 		IsActive:             true,
 		ImageURL:             &imageURL,
+		ExpiryDate:           req.ExpiryDate,
+		ReorderLevel:         req.ReorderLevel,
+	}
+	if req.GSTRate != nil {
+		newMedicine.GSTRate = *req.GSTRate
+	}
+	if req.BatchNumber != "" {
+		newMedicine.BatchNumber = &req.BatchNumber
 	}
 
 	// Call use case to add medicine
@@ -533,11 +532,24 @@ func (h *MedicineHandlerClean) UpdateMedicine(c *gin.Context) {
 				medicine.Quantity = quantity
 			}
 		}
+		if reorderLevelStr := c.PostForm("reorder_level"); reorderLevelStr != "" {
+			if reorderLevel, err := strconv.Atoi(reorderLevelStr); err == nil && reorderLevel >= 0 {
+				medicine.ReorderLevel = reorderLevel
+			}
+		}
 		if prescriptionRequiredStr := c.PostForm("prescription_required"); prescriptionRequiredStr != "" {
 			if prescriptionRequired, err := strconv.ParseBool(prescriptionRequiredStr); err == nil {
 				medicine.PrescriptionRequired = prescriptionRequired
 			}
 		}
+		if hsnCode := c.PostForm("hsn_code"); hsnCode != "" {
+			medicine.HSNCode = hsnCode
+		}
+		if gstRateStr := c.PostForm("gst_rate"); gstRateStr != "" {
+			if gstRate, err := strconv.ParseFloat(gstRateStr, 64); err == nil && gstRate >= 0 && gstRate <= 28 {
+				medicine.GSTRate = gstRate
+			}
+		}
 		if isActiveStr := c.PostForm("is_active"); isActiveStr != "" {
 			if isActive, err := strconv.ParseBool(isActiveStr); err == nil {
 				medicine.IsActive = isActive
@@ -631,3 +643,163 @@ func (h *MedicineHandlerClean) UpdateMedicine(c *gin.Context) {
 		Data:    medicinedata,
 	})
 }
+
+// ListBatches returns the batches of one of the pharmacy's medicines
+func (h *MedicineHandlerClean) ListBatches(c *gin.Context) {
+	userID, medicineID, ok := medicineBatchParams(c)
+	if !ok {
+		return
+	}
+
+	batches, err := h.medicineUseCase.ListBatches(c.Request.Context(), userID, medicineID)
+	if err != nil {
+		writeBatchError(c, "Failed to retrieve batches", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Batches retrieved successfully",
+		Data:    batches,
+	})
+}
+
+// AddBatch receives a new batch of one of the pharmacy's medicines
+func (h *MedicineHandlerClean) AddBatch(c *gin.Context) {
+	userID, medicineID, ok := medicineBatchParams(c)
+	if !ok {
+		return
+	}
+
+	var req types.MedicineBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	batch, err := h.medicineUseCase.AddBatch(c.Request.Context(), userID, medicineID, &req)
+	if err != nil {
+		writeBatchError(c, "Failed to add batch", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response.Response{
+		Success: true,
+		Message: "Batch added successfully",
+		Data:    batch,
+	})
+}
+
+// UpdateBatch corrects the quantity, expiry or cost of a batch
+func (h *MedicineHandlerClean) UpdateBatch(c *gin.Context) {
+	userID, medicineID, ok := medicineBatchParams(c)
+	if !ok {
+		return
+	}
+	batchID, err := uuid.Parse(c.Param("batchId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Batch ID",
+			Message: "Batch ID format is invalid",
+		})
+		return
+	}
+
+	var req types.UpdateMedicineBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	batch, err := h.medicineUseCase.UpdateBatch(c.Request.Context(), userID, medicineID, batchID, &req)
+	if err != nil {
+		writeBatchError(c, "Failed to update batch", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Batch updated successfully",
+		Data:    batch,
+	})
+}
+
+// TraceBatch lists the order items a batch was sold in, for recalls
+func (h *MedicineHandlerClean) TraceBatch(c *gin.Context) {
+	userID, medicineID, ok := medicineBatchParams(c)
+	if !ok {
+		return
+	}
+	batchID, err := uuid.Parse(c.Param("batchId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Batch ID",
+			Message: "Batch ID format is invalid",
+		})
+		return
+	}
+
+	allocations, err := h.medicineUseCase.TraceBatch(c.Request.Context(), userID, medicineID, batchID)
+	if err != nil {
+		writeBatchError(c, "Failed to trace batch", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Batch orders retrieved successfully",
+		Data:    allocations,
+	})
+}
+
+// medicineBatchParams reads the caller and the medicine ID of a batch route,
+// writing the error response when either is invalid
+func medicineBatchParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User ID not found in context",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	medicineID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Medicine ID",
+			Message: "Medicine ID format is invalid",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, medicineID, true
+}
+
+func writeBatchError(c *gin.Context, title string, err error) {
+	statusCode := http.StatusInternalServerError
+	switch err.Error() {
+	case "medicine not found", "batch not found":
+		statusCode = http.StatusNotFound
+	case "unauthorized to manage this medicine":
+		statusCode = http.StatusForbidden
+	case "batch already exists":
+		statusCode = http.StatusConflict
+	case "medicine has already expired":
+		statusCode = http.StatusBadRequest
+	default:
+		if _, ok := err.(*time.ParseError); ok {
+			statusCode = http.StatusBadRequest
+		}
+	}
+
+	c.JSON(statusCode, types.ErrorResponse{
+		Error:   title,
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type NearbyHandlerClean struct {
+	nearbyUseCase usecase.NearbyUseCase
+}
+
+// NewNearbyHandlerClean creates a new nearby search handler
+func NewNearbyHandlerClean(nearbyUseCase usecase.NearbyUseCase) *NearbyHandlerClean {
+	return &NearbyHandlerClean{
+		nearbyUseCase: nearbyUseCase,
+	}
+}
+
+// FindNearbyPharmacies lists pharmacies within a radius, nearest first
+func (h *NearbyHandlerClean) FindNearbyPharmacies(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.NearbyPharmaciesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	pharmacies, total, err := h.nearbyUseCase.FindNearbyPharmacies(c.Request.Context(), userID, req)
+	if err != nil {
+		writeNearbyError(c, err)
+		return
+	}
+	response.Paginated(c, pharmacies, req.Page, req.Limit, int(total), "Pharmacies retrieved successfully")
+}
+
+// FindNearbyMedicines lists medicines at pharmacies within a radius, nearest
+// first
+func (h *NearbyHandlerClean) FindNearbyMedicines(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.NearbyMedicinesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	medicines, total, err := h.nearbyUseCase.FindNearbyMedicines(c.Request.Context(), userID, req)
+	if err != nil {
+		writeNearbyError(c, err)
+		return
+	}
+	response.Paginated(c, medicines, req.Page, req.Limit, int(total), "Medicines retrieved successfully")
+}
+
+// writeNearbyError maps nearby search errors to responses
+func writeNearbyError(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	errorCode := "NEARBY_SEARCH_ERROR"
+
+	if errors.Is(err, usecase.ErrLocationRequired) {
+		statusCode = http.StatusBadRequest
+		errorCode = "LOCATION_REQUIRED"
+	}
+
+	c.JSON(statusCode, response.Response{
+		Success: false,
+		Error: &response.ErrorInfo{
+			Code:    errorCode,
+			Message: err.Error(),
+		},
+	})
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -16,12 +18,14 @@ import (
 type OrderHandlerClean struct {
 	orderUseCase   usecase.OrderUseCase
 	paymentUseCase *usecase.PaymentUseCase
+	invoiceUseCase usecase.InvoiceUseCase
 }
 
-func NewOrderHandlerClean(orderUseCase usecase.OrderUseCase, paymentUseCase *usecase.PaymentUseCase) *OrderHandlerClean {
+func NewOrderHandlerClean(orderUseCase usecase.OrderUseCase, paymentUseCase *usecase.PaymentUseCase, invoiceUseCase usecase.InvoiceUseCase) *OrderHandlerClean {
 	return &OrderHandlerClean{
 		orderUseCase:   orderUseCase,
 		paymentUseCase: paymentUseCase,
+		invoiceUseCase: invoiceUseCase,
 	}
 }
 
@@ -545,6 +549,168 @@ func (o *OrderHandlerClean) GetPharmacyOrders(c *gin.Context) {
 	response.Paginated(c, orderResponses, filters.Page, filters.Limit, int(total), "Pharmacy orders retrieved successfully")
 }
 
+// GetOrderTimeline returns the status history of one of the user's orders
+func (o *OrderHandlerClean) GetOrderTimeline(c *gin.Context) {
+	userIDStr := c.GetString("userID")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "UNAUTHORIZED",
+				Message: "User ID not found in context",
+			},
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_USER_ID",
+				Message: "Invalid user ID format",
+			},
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_ORDER_ID",
+				Message: "Invalid order ID format",
+			},
+		})
+		return
+	}
+
+	timeline, err := o.orderUseCase.GetOrderTimeline(c.Request.Context(), orderID, userID)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorCode := "FETCH_ERROR"
+
+		switch err.Error() {
+		case "order not found":
+			statusCode = http.StatusNotFound
+			errorCode = "ORDER_NOT_FOUND"
+		case "unauthorized":
+			statusCode = http.StatusForbidden
+			errorCode = "FORBIDDEN"
+		}
+
+		c.JSON(statusCode, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    errorCode,
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Order timeline retrieved successfully",
+		Data:    timeline,
+	})
+}
+
+// CancelOrder cancels one of the user's orders
+func (o *OrderHandlerClean) CancelOrder(c *gin.Context) {
+	o.cancelOrder(c, o.paymentUseCase.CancelOrder)
+}
+
+// PharmacyCancelOrder cancels an order the caller's pharmacy cannot fulfil
+func (o *OrderHandlerClean) PharmacyCancelOrder(c *gin.Context) {
+	o.cancelOrder(c, o.paymentUseCase.PharmacyCancelOrder)
+}
+
+func (o *OrderHandlerClean) cancelOrder(c *gin.Context, cancel func(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, reason string) (*entity.Order, error)) {
+	userIDStr := c.GetString("userID")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "UNAUTHORIZED",
+				Message: "User ID not found in context",
+			},
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_USER_ID",
+				Message: "Invalid user ID format",
+			},
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_ORDER_ID",
+				Message: "Invalid order ID format",
+			},
+		})
+		return
+	}
+
+	var req types.CancelOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_PARAMETERS",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	order, err := cancel(c.Request.Context(), orderID, userID, req.Reason)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorCode := "CANCEL_ERROR"
+
+		switch {
+		case errors.Is(err, usecase.ErrOrderNotFound):
+			statusCode = http.StatusNotFound
+			errorCode = "ORDER_NOT_FOUND"
+		case errors.Is(err, usecase.ErrNotOrderOwner):
+			statusCode = http.StatusForbidden
+			errorCode = "FORBIDDEN"
+		case errors.Is(err, usecase.ErrOrderNotCancellable):
+			statusCode = http.StatusConflict
+			errorCode = "ORDER_NOT_CANCELLABLE"
+		}
+
+		c.JSON(statusCode, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    errorCode,
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Order cancelled successfully",
+		Data:    order,
+	})
+}
+
 // UpdateOrderStatus updates the status of an order
 func (o *OrderHandlerClean) UpdateOrderStatus(c *gin.Context) {
 	// Get user ID from context
@@ -587,9 +753,7 @@ func (o *OrderHandlerClean) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Parse request body
-	var req struct {
-		Status string `json:"status" binding:"required"`
-	}
+	var req types.UpdateOrderStatusRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, response.Response{
@@ -603,7 +767,7 @@ func (o *OrderHandlerClean) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Call use case
-	if err := o.orderUseCase.UpdateOrderStatus(c.Request.Context(), orderID, req.Status, userID); err != nil {
+	if err := o.orderUseCase.UpdateOrderStatus(c.Request.Context(), orderID, userID, req); err != nil {
 		statusCode := http.StatusInternalServerError
 		errorCode := "UPDATE_ERROR"
 
@@ -614,9 +778,18 @@ func (o *OrderHandlerClean) UpdateOrderStatus(c *gin.Context) {
 		case "unauthorized":
 			statusCode = http.StatusForbidden
 			errorCode = "FORBIDDEN"
-		case "invalid status":
+		case "invalid status", "cash can only be collected on delivery", "use the cancel endpoint to cancel an order":
 			statusCode = http.StatusBadRequest
 			errorCode = "INVALID_STATUS"
+		case "invalid status transition":
+			statusCode = http.StatusConflict
+			errorCode = "INVALID_STATUS_TRANSITION"
+		case "order is out with a delivery partner":
+			statusCode = http.StatusConflict
+			errorCode = "DELIVERY_IN_PROGRESS"
+		case "prescription not approved":
+			statusCode = http.StatusConflict
+			errorCode = "PRESCRIPTION_NOT_APPROVED"
 		}
 
 		c.JSON(statusCode, response.Response{
@@ -694,3 +867,60 @@ func (o *OrderHandlerClean) GetTotalRevenue(c *gin.Context) {
 		},
 	})
 }
+
+// DownloadInvoice returns the GST invoice PDF for one of the user's orders
+func (o *OrderHandlerClean) DownloadInvoice(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "UNAUTHORIZED",
+				Message: "User ID not found in context",
+			},
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    "INVALID_ORDER_ID",
+				Message: "Invalid order ID format",
+			},
+		})
+		return
+	}
+
+	invoice, pdf, err := o.invoiceUseCase.GetInvoicePDF(c.Request.Context(), orderID, userID)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorCode := "INVOICE_ERROR"
+
+		switch {
+		case errors.Is(err, usecase.ErrOrderNotFound):
+			statusCode = http.StatusNotFound
+			errorCode = "ORDER_NOT_FOUND"
+		case errors.Is(err, usecase.ErrNotOrderOwner):
+			statusCode = http.StatusForbidden
+			errorCode = "FORBIDDEN"
+		case errors.Is(err, usecase.ErrInvoiceNotAvailable):
+			statusCode = http.StatusConflict
+			errorCode = "INVOICE_NOT_AVAILABLE"
+		}
+
+		c.JSON(statusCode, response.Response{
+			Success: false,
+			Error: &response.ErrorInfo{
+				Code:    errorCode,
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+invoice.InvoiceNumber+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
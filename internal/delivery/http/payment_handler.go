@@ -2,8 +2,13 @@
 package http
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -75,10 +80,7 @@ func (h *PaymentHandler) CreateOrder(c *gin.Context) {
 	// Create order
 	orderResp, err := h.paymentUseCase.CreateOrder(c.Request.Context(), userID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "Failed to create order",
-			Message: err.Error(),
-		})
+		checkoutErrorResponse(c, err)
 		return
 	}
 
@@ -89,6 +91,80 @@ func (h *PaymentHandler) CreateOrder(c *gin.Context) {
 	})
 }
 
+// checkoutErrorResponse writes the response for a checkout that could not be
+// placed, online or cash on delivery
+func checkoutErrorResponse(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, usecase.ErrAmountMismatch):
+		statusCode = http.StatusConflict
+	case errors.Is(err, usecase.ErrMedicineUnavailable),
+		errors.Is(err, usecase.ErrInsufficientStock),
+		errors.Is(err, usecase.ErrInvalidCart):
+		statusCode = http.StatusBadRequest
+	case errors.Is(err, usecase.ErrCouponNotFound):
+		statusCode = http.StatusNotFound
+	case errors.Is(err, usecase.ErrCouponNotApplicable),
+		errors.Is(err, usecase.ErrCouponLimitReached):
+		statusCode = http.StatusUnprocessableEntity
+	case errors.Is(err, usecase.ErrPrescriptionRequired):
+		statusCode = http.StatusBadRequest
+	case errors.Is(err, usecase.ErrPrescriptionNotFound):
+		statusCode = http.StatusNotFound
+	}
+
+	c.JSON(statusCode, types.ErrorResponse{
+		Error:   "Failed to create order",
+		Message: err.Error(),
+	})
+}
+
+// CreateCODOrder places a cash on delivery order without going through the gateway
+func (h *PaymentHandler) CreateCODOrder(c *gin.Context) {
+	userIDStr := c.GetString("userID")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User ID not found in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid User ID",
+			Message: "User ID format is invalid",
+		})
+		return
+	}
+
+	var req types.CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Validation Error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if req.Currency == "" {
+		req.Currency = "INR"
+	}
+
+	checkout, err := h.paymentUseCase.CreateCODOrder(c.Request.Context(), userID, req)
+	if err != nil {
+		checkoutErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response.Response{
+		Success: true,
+		Message: "Cash on delivery order placed successfully",
+		Data:    checkout,
+	})
+}
+
 // VerifyPayment verifies the payment signature
 func (h *PaymentHandler) VerifyPayment(c *gin.Context) {
 	var req types.VerifyPaymentRequest
@@ -116,6 +192,56 @@ func (h *PaymentHandler) VerifyPayment(c *gin.Context) {
 	})
 }
 
+// maxWebhookBodySize caps the body of a gateway event, which is read before
+// its signature can be checked
+const maxWebhookBodySize = 1 << 20
+
+// RazorpayWebhook receives gateway events. It is public: authenticity comes from
+// the X-Razorpay-Signature header, which is computed over the raw body.
+func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, types.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Request body is too large",
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "Failed to read request body",
+		})
+		return
+	}
+
+	err = h.paymentUseCase.HandleWebhook(
+		c.Request.Context(),
+		body,
+		c.GetHeader("X-Razorpay-Signature"),
+		c.GetHeader("X-Razorpay-Event-Id"),
+	)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, usecase.ErrInvalidWebhookSignature) {
+			statusCode = http.StatusUnauthorized
+		}
+
+		c.JSON(statusCode, types.ErrorResponse{
+			Error:   "Webhook processing failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Webhook processed",
+	})
+}
+
 // GetPaymentStatus gets the status of a payment
 func (h *PaymentHandler) GetPaymentStatus(c *gin.Context) {
 	orderID := c.Param("orderId")
@@ -192,3 +318,255 @@ func (h *PaymentHandler) GetUserPayments(c *gin.Context) {
 
 	response.Paginated(c, payments, page, limit, int(total), "Payments retrieved successfully")
 }
+
+// PharmacyRefundOrder lets a pharmacy refund its own items of an order
+func (h *PaymentHandler) PharmacyRefundOrder(c *gin.Context) {
+	h.refundOrder(c, true)
+}
+
+// AdminRefundOrder refunds any order in full or for selected items
+func (h *PaymentHandler) AdminRefundOrder(c *gin.Context) {
+	h.refundOrder(c, false)
+}
+
+// PharmacyListRefunds lists the refunds issued by the caller's pharmacy
+func (h *PaymentHandler) PharmacyListRefunds(c *gin.Context) {
+	h.listRefunds(c, true)
+}
+
+// AdminListRefunds lists all refunds
+func (h *PaymentHandler) AdminListRefunds(c *gin.Context) {
+	h.listRefunds(c, false)
+}
+
+func (h *PaymentHandler) refundOrder(c *gin.Context, pharmacyScoped bool) {
+	userIDStr := c.GetString("userID")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User ID not found in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid User ID",
+			Message: "User ID format is invalid",
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Order ID",
+			Message: "Order ID format is invalid",
+		})
+		return
+	}
+
+	var req types.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Validation Error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	pharmacyID, ok := h.pharmacyScope(c, userID, pharmacyScoped)
+	if !ok {
+		return
+	}
+
+	refund, err := h.paymentUseCase.RefundOrder(c.Request.Context(), orderID, userID, pharmacyID, req)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, usecase.ErrOrderNotFound):
+			statusCode = http.StatusNotFound
+		case errors.Is(err, usecase.ErrOrderNotRefundable), errors.Is(err, usecase.ErrInvalidRefundItems):
+			statusCode = http.StatusBadRequest
+		case err.Error() == "unauthorized":
+			statusCode = http.StatusForbidden
+		}
+
+		c.JSON(statusCode, types.ErrorResponse{
+			Error:   "Failed to refund order",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response.Response{
+		Success: true,
+		Message: "Refund initiated successfully",
+		Data:    refund,
+	})
+}
+
+func (h *PaymentHandler) listRefunds(c *gin.Context, pharmacyScoped bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User ID not found in context",
+		})
+		return
+	}
+
+	var filter types.ListRefundsFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Validation Error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	pharmacyID, ok := h.pharmacyScope(c, userID, pharmacyScoped)
+	if !ok {
+		return
+	}
+	filter.PharmacyID = pharmacyID
+
+	refunds, total, err := h.paymentUseCase.ListRefunds(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "Failed to retrieve refunds",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+	response.Paginated(c, refunds, filter.Page, filter.Limit, int(total), "Refunds retrieved successfully")
+}
+
+// pharmacyScope returns the caller's pharmacy ID when scoped and nil otherwise.
+// It writes the error response itself when ok is false.
+func (h *PaymentHandler) pharmacyScope(c *gin.Context, userID uuid.UUID, scoped bool) (*uuid.UUID, bool) {
+	if !scoped {
+		return nil, true
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "Pharmacy not found",
+			Message: "No pharmacy associated with this user",
+		})
+		return nil, false
+	}
+	return &pharmacyID, true
+}
+
+// AdminListReconciliationReports lists daily reconciliation report summaries
+func (h *PaymentHandler) AdminListReconciliationReports(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	reports, total, err := h.paymentUseCase.ListReconciliationReports(c.Request.Context(), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "Failed to retrieve reconciliation reports",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response.Paginated(c, reports, page, limit, int(total), "Reconciliation reports retrieved successfully")
+}
+
+// AdminGenerateReconciliationReport (re)builds the report for a YYYY-MM-DD date
+func (h *PaymentHandler) AdminGenerateReconciliationReport(c *gin.Context) {
+	day, err := time.ParseInLocation(time.DateOnly, c.Param("date"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Date",
+			Message: "Date must be in YYYY-MM-DD format",
+		})
+		return
+	}
+	if !day.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Date",
+			Message: "Date must not be in the future",
+		})
+		return
+	}
+
+	report, err := h.paymentUseCase.GenerateReconciliationReport(c.Request.Context(), day)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, types.ErrorResponse{
+			Error:   "Failed to generate reconciliation report",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response.Success(c, report, "Reconciliation report generated successfully")
+}
+
+// AdminDownloadReconciliationReport returns a report's mismatches as CSV
+func (h *PaymentHandler) AdminDownloadReconciliationReport(c *gin.Context) {
+	reportDate := c.Param("date")
+	if _, err := time.Parse(time.DateOnly, reportDate); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid Date",
+			Message: "Date must be in YYYY-MM-DD format",
+		})
+		return
+	}
+
+	report, err := h.paymentUseCase.GetReconciliationReport(c.Request.Context(), reportDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "Failed to retrieve reconciliation report",
+			Message: err.Error(),
+		})
+		return
+	}
+	if report == nil {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "Report not found",
+			Message: "No reconciliation report for " + reportDate,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="reconciliation-%s.csv"`, report.ReportDate))
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{
+		"type", "payment_order_id", "razorpay_order_id", "razorpay_payment_id",
+		"local_status", "gateway_status", "local_amount", "gateway_amount",
+	})
+	for _, m := range report.Mismatches {
+		w.Write([]string{
+			m.Type,
+			m.PaymentOrderID,
+			m.RazorpayOrderID,
+			m.RazorpayPaymentID,
+			m.LocalStatus,
+			m.GatewayStatus,
+			strconv.FormatFloat(m.LocalAmount, 'f', 2, 64),
+			strconv.FormatFloat(m.GatewayAmount, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,350 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type PrescriptionHandlerClean struct {
+	prescriptionUseCase usecase.PrescriptionUseCase
+	userRepo            repository.UserRepository
+}
+
+// NewPrescriptionHandlerClean creates a new prescription handler
+func NewPrescriptionHandlerClean(prescriptionUseCase usecase.PrescriptionUseCase, userRepo repository.UserRepository) *PrescriptionHandlerClean {
+	return &PrescriptionHandlerClean{
+		prescriptionUseCase: prescriptionUseCase,
+		userRepo:            userRepo,
+	}
+}
+
+// UploadPrescription stores a prescription scan sent as the "file" form field
+func (h *PrescriptionHandlerClean) UploadPrescription(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, usecase.MaxPrescriptionSize+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "A PDF or image file of up to 10 MB is required")
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, usecase.MaxPrescriptionSize+1))
+	if err != nil {
+		response.BadRequest(c, "Failed to read prescription file")
+		return
+	}
+
+	prescription, err := h.prescriptionUseCase.UploadPrescription(c.Request.Context(), userID, header.Filename, content)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	response.Created(c, prescription, "Prescription uploaded successfully")
+}
+
+// LinkConsultation uses the prescription from one of the patient's consultations
+func (h *PrescriptionHandlerClean) LinkConsultation(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.LinkPrescriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	prescription, err := h.prescriptionUseCase.LinkConsultation(c.Request.Context(), userID, req.AppointmentID)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	response.Created(c, prescription, "Prescription linked successfully")
+}
+
+// ListPrescriptions lists the patient's prescriptions, newest first
+func (h *PrescriptionHandlerClean) ListPrescriptions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	prescriptions, total, err := h.prescriptionUseCase.ListPrescriptions(c.Request.Context(), userID, page, limit)
+	if err != nil {
+		response.InternalServerError(c, "Failed to retrieve prescriptions")
+		return
+	}
+	response.Paginated(c, prescriptions, page, limit, int(total), "Prescriptions retrieved successfully")
+}
+
+// DownloadPrescription returns the file of one of the patient's prescriptions
+func (h *PrescriptionHandlerClean) DownloadPrescription(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	prescriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid prescription ID format")
+		return
+	}
+
+	prescription, content, err := h.prescriptionUseCase.GetPrescriptionFile(c.Request.Context(), prescriptionID, userID)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, prescription.ContentType, content)
+}
+
+// ResubmitPrescription replaces the prescription of one of the patient's orders
+func (h *PrescriptionHandlerClean) ResubmitPrescription(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid order ID format")
+		return
+	}
+
+	var req types.ResubmitPrescriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	order, err := h.prescriptionUseCase.ResubmitPrescription(c.Request.Context(), orderID, userID, req.PrescriptionID)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	response.Success(c, order, "Prescription submitted for review")
+}
+
+// GetEPrescription returns the structured prescription of one of the patient's consultations
+func (h *PrescriptionHandlerClean) GetEPrescription(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	appointmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid appointment ID format")
+		return
+	}
+
+	prescription, err := h.prescriptionUseCase.GetEPrescription(c.Request.Context(), userID, appointmentID)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	response.Success(c, prescription, "Prescription retrieved successfully")
+}
+
+// AddEPrescriptionToCart fills the patient's cart from a consultation's e-prescription
+func (h *PrescriptionHandlerClean) AddEPrescriptionToCart(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	appointmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid appointment ID format")
+		return
+	}
+
+	// The body is optional; without it pharmacies near the patient's address are used
+	var req types.PrescriptionToCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		response.BadRequest(c, "latitude and longitude must be given together")
+		return
+	}
+
+	result, err := h.prescriptionUseCase.AddEPrescriptionToCart(c.Request.Context(), userID, appointmentID, req)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+
+	message := "Prescription added to cart"
+	if len(result.Matched) == 0 {
+		message = "No nearby pharmacy stocks the prescribed medicines"
+	} else if len(result.Unmatched) > 0 {
+		message = "Prescription partly added to cart; some medicines are not available nearby"
+	}
+	response.Success(c, result, message)
+}
+
+// ListReviews returns the pharmacy's prescription review queue
+func (h *PrescriptionHandlerClean) ListReviews(c *gin.Context) {
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	var filter types.ListPrescriptionReviewsFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	filter.PharmacyID = pharmacyID
+
+	orders, total, err := h.prescriptionUseCase.ListReviews(c.Request.Context(), filter)
+	if err != nil {
+		response.InternalServerError(c, "Failed to retrieve prescription reviews")
+		return
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+	response.Paginated(c, orders, filter.Page, filter.Limit, int(total), "Prescription reviews retrieved successfully")
+}
+
+// DownloadOrderPrescription returns the prescription file of one of the pharmacy's orders
+func (h *PrescriptionHandlerClean) DownloadOrderPrescription(c *gin.Context) {
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid order ID format")
+		return
+	}
+
+	prescription, content, err := h.prescriptionUseCase.GetOrderPrescriptionFile(c.Request.Context(), orderID, pharmacyID)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, prescription.ContentType, content)
+}
+
+// ReviewPrescription approves or rejects the prescription of one of the pharmacy's orders
+func (h *PrescriptionHandlerClean) ReviewPrescription(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	pharmacyID, ok := h.callerPharmacy(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid order ID format")
+		return
+	}
+
+	var req types.ReviewPrescriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	order, err := h.prescriptionUseCase.ReviewPrescription(c.Request.Context(), orderID, pharmacyID, userID, req)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	response.Success(c, order, "Prescription "+req.Status)
+}
+
+// callerPharmacy returns the pharmacy of the calling user. It writes the error
+// response itself when ok is false.
+func (h *PrescriptionHandlerClean) callerPharmacy(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return uuid.Nil, false
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		response.NotFound(c, "No pharmacy associated with this user")
+		return uuid.Nil, false
+	}
+	return pharmacyID, true
+}
+
+// writePrescriptionError maps prescription and order errors to responses
+func writePrescriptionError(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	errorCode := "PRESCRIPTION_ERROR"
+
+	switch {
+	case errors.Is(err, usecase.ErrPrescriptionNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "PRESCRIPTION_NOT_FOUND"
+	case errors.Is(err, usecase.ErrOrderNotFound):
+		statusCode = http.StatusNotFound
+		errorCode = "ORDER_NOT_FOUND"
+	case errors.Is(err, usecase.ErrNotOrderOwner):
+		statusCode = http.StatusForbidden
+		errorCode = "FORBIDDEN"
+	case errors.Is(err, usecase.ErrInvalidPrescription):
+		statusCode = http.StatusBadRequest
+		errorCode = "INVALID_PRESCRIPTION"
+	case errors.Is(err, usecase.ErrPrescriptionNotPending):
+		statusCode = http.StatusConflict
+		errorCode = "PRESCRIPTION_NOT_PENDING"
+	}
+
+	c.JSON(statusCode, response.Response{
+		Success: false,
+		Error: &response.ErrorInfo{
+			Code:    errorCode,
+			Message: err.Error(),
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type PriceComparisonHandlerClean struct {
+	comparisonUseCase usecase.PriceComparisonUseCase
+}
+
+// NewPriceComparisonHandlerClean creates a new price comparison handler
+func NewPriceComparisonHandlerClean(comparisonUseCase usecase.PriceComparisonUseCase) *PriceComparisonHandlerClean {
+	return &PriceComparisonHandlerClean{
+		comparisonUseCase: comparisonUseCase,
+	}
+}
+
+// CompareMedicines groups the listings matching a search into equivalent
+// medicines with each pharmacy's price, stock and distance
+func (h *PriceComparisonHandlerClean) CompareMedicines(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req types.CompareMedicinesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	comparisons, total, err := h.comparisonUseCase.CompareMedicines(c.Request.Context(), userID, req)
+	if err != nil {
+		response.InternalServerError(c, err.Error())
+		return
+	}
+	response.Paginated(c, comparisons, req.Page, req.Limit, int(total), "Medicines compared successfully")
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/skryfon/collex/internal/delivery/http/middleware"
 	"github.com/skryfon/collex/internal/infrastructure/container"
+	"github.com/skryfon/collex/shared"
 )
 
 // SetupCleanRoutes configures all routes using clean architecture
@@ -44,6 +45,7 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 	orderHandler := NewOrderHandlerClean(
 		container.OrderUsecase,
 		container.PaymentUseCase,
+		container.InvoiceUseCase,
 	)
 	paymentHandler := NewPaymentHandlerClean(
 		container.PaymentUseCase,
@@ -53,6 +55,46 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 		container.AppoinmentUseCase,
 		container.UserRepository,
 	)
+	couponHandler := NewCouponHandlerClean(
+		container.CouponUseCase,
+		container.UserRepository,
+	)
+	prescriptionHandler := NewPrescriptionHandlerClean(
+		container.PrescriptionUseCase,
+		container.UserRepository,
+	)
+	stockAlertHandler := NewStockAlertHandlerClean(
+		container.StockAlertUseCase,
+		container.UserRepository,
+	)
+	catalogueHandler := NewCatalogueHandlerClean(
+		container.CatalogueUseCase,
+		container.UserRepository,
+	)
+	drugHandler := NewDrugHandlerClean(
+		container.DrugUseCase,
+		container.UserRepository,
+	)
+	comparisonHandler := NewPriceComparisonHandlerClean(
+		container.ComparisonUseCase,
+	)
+	substituteHandler := NewSubstituteHandlerClean(
+		container.SubstituteUseCase,
+	)
+	nearbyHandler := NewNearbyHandlerClean(
+		container.NearbyUseCase,
+	)
+	suggestHandler := NewSearchSuggestHandlerClean(
+		container.SuggestUseCase,
+	)
+	deliveryHandler := NewDeliveryHandlerClean(
+		container.DeliveryUseCase,
+		container.UserRepository,
+	)
+	eventStreamHandler := NewEventStreamHandlerClean(
+		container.EventStreamUseCase,
+		container.Config.Events.StreamKeepAlive,
+	)
 
 	// Authentication routes (public)
 	authRoutes := api.Group("/auth")
@@ -66,25 +108,50 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 		authRoutes.POST("/reset-password", authHandler.ResetPassword)
 	}
 
+	// Payment gateway webhooks (public, verified by signature)
+	api.POST("/payment/webhook", paymentHandler.RazorpayWebhook)
+
 	// Protected routes (require authentication)
 	protectedRoutes := api.Group("/")
 	protectedRoutes.Use(middleware.JWTAuth(container.TokenService))
 	{
+		// Search box suggestions (any authenticated user)
+		protectedRoutes.GET("/search/suggest", suggestHandler.Suggest)
+
+		// Live order and appointment events (any authenticated user)
+		protectedRoutes.GET("/events/stream", eventStreamHandler.Stream)
+
 		// User profile and account management routes (authenticated users)
 		patientRoutes := protectedRoutes.Group("/user")
 		{
 			patientRoutes.GET("/medicines", medicineHanler.GetMedicines)
 			patientRoutes.POST("/doctors", doctorHanler.GetDoctors)
 			patientRoutes.POST("/medicines", medicineHanler.GetMedicines)
+			patientRoutes.GET("/medicines/compare", comparisonHandler.CompareMedicines)
+			patientRoutes.GET("/medicines/nearby", nearbyHandler.FindNearbyMedicines)
+			patientRoutes.GET("/pharmacies/nearby", nearbyHandler.FindNearbyPharmacies)
+			patientRoutes.GET("/medicines/:id", substituteHandler.GetMedicineDetail)
+			patientRoutes.GET("/medicines/:id/substitutes", substituteHandler.ListSubstitutes)
+			patientRoutes.GET("/drugs", drugHandler.SearchDrugs)
+			patientRoutes.GET("/drugs/:id", drugHandler.GetDrugOffers)
 			patientRoutes.PUT("/update-cart", orderHandler.UpdateCart)
 			patientRoutes.POST("/add-cart", orderHandler.AddToCart)
 			patientRoutes.GET("/view-cart", orderHandler.GetCart)
 			patientRoutes.DELETE("/remove-cart", orderHandler.RemoveFromCart)
+			patientRoutes.POST("/cart/coupon", couponHandler.ApplyCoupon)
+			patientRoutes.DELETE("/cart/coupon", couponHandler.RemoveCoupon)
+
+			patientRoutes.POST("/prescriptions", prescriptionHandler.UploadPrescription)
+			patientRoutes.POST("/prescriptions/consultation", prescriptionHandler.LinkConsultation)
+			patientRoutes.GET("/prescriptions", prescriptionHandler.ListPrescriptions)
+			patientRoutes.GET("/prescriptions/:id/file", prescriptionHandler.DownloadPrescription)
 
 			patientRoutes.POST("/book-appointment", appoinmentHandler.BookAppointment)
 			patientRoutes.GET("/confirmed-appointment-slots", appoinmentHandler.ConfirmedAppionmentSlot)
 
 			patientRoutes.GET("/consultations", appoinmentHandler.FetchPatientConsultations)
+			patientRoutes.GET("/consultations/:id/prescription", prescriptionHandler.GetEPrescription)
+			patientRoutes.POST("/consultations/:id/prescription/cart", prescriptionHandler.AddEPrescriptionToCart)
 
 			patientRoutes.GET("/profile", userHandler.GetUserProfile)
 			patientRoutes.PUT("/profile", userHandler.UpdateUserProfile)
@@ -95,6 +162,11 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 			{
 				orderRoutes.GET("", orderHandler.GetUserOrders)    // /user/orders
 				orderRoutes.GET("/:id", orderHandler.GetOrderByID) // /user/orders/:id
+				orderRoutes.GET("/:id/timeline", orderHandler.GetOrderTimeline)
+				orderRoutes.GET("/:id/tracking", deliveryHandler.TrackOrder)
+				orderRoutes.POST("/:id/cancel", orderHandler.CancelOrder)
+				orderRoutes.GET("/:id/invoice", orderHandler.DownloadInvoice)
+				orderRoutes.PUT("/:id/prescription", prescriptionHandler.ResubmitPrescription)
 			}
 		}
 		//User Order Routed
@@ -106,10 +178,33 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 			pharmacyRoutes.PUT("/update-medicine/:id", medicineHanler.UpdateMedicine)
 			pharmacyRoutes.GET("/get-medicine/:id", medicineHanler.GetMedicineByID)
 			pharmacyRoutes.DELETE("/delete-medicine/:id", medicineHanler.DeleteMedicine)
+			pharmacyRoutes.POST("/medicines/import", catalogueHandler.ImportCatalogue)
+			pharmacyRoutes.GET("/medicines/export", catalogueHandler.ExportCatalogue)
+			pharmacyRoutes.PUT("/medicines/:id/drug", drugHandler.LinkMedicine)
+			pharmacyRoutes.GET("/medicines/:id/batches", medicineHanler.ListBatches)
+			pharmacyRoutes.POST("/medicines/:id/batches", medicineHanler.AddBatch)
+			pharmacyRoutes.PUT("/medicines/:id/batches/:batchId", medicineHanler.UpdateBatch)
+			pharmacyRoutes.GET("/medicines/:id/batches/:batchId/orders", medicineHanler.TraceBatch)
+			pharmacyRoutes.GET("/alerts", stockAlertHandler.GetStockAlerts)
 
 			pharmacyRoutes.GET("/orders", orderHandler.GetPharmacyOrders)
 			pharmacyRoutes.PUT("/orders/:id", orderHandler.UpdateOrderStatus)
+			pharmacyRoutes.POST("/orders/:id/cancel", orderHandler.PharmacyCancelOrder)
 			pharmacyRoutes.GET("/orders/revenue", orderHandler.GetTotalRevenue)
+			pharmacyRoutes.POST("/orders/:id/refund", paymentHandler.PharmacyRefundOrder)
+			pharmacyRoutes.GET("/refunds", paymentHandler.PharmacyListRefunds)
+			pharmacyRoutes.GET("/delivery-partners", deliveryHandler.ListDeliveryPartners)
+			pharmacyRoutes.POST("/orders/:id/delivery", deliveryHandler.AssignDelivery)
+			pharmacyRoutes.GET("/orders/:id/delivery", deliveryHandler.GetPharmacyDelivery)
+
+			pharmacyRoutes.GET("/prescriptions", prescriptionHandler.ListReviews)
+			pharmacyRoutes.GET("/orders/:id/prescription", prescriptionHandler.DownloadOrderPrescription)
+			pharmacyRoutes.POST("/orders/:id/prescription/review", prescriptionHandler.ReviewPrescription)
+
+			pharmacyRoutes.POST("/coupons", couponHandler.PharmacyCreateCoupon)
+			pharmacyRoutes.GET("/coupons", couponHandler.PharmacyListCoupons)
+			pharmacyRoutes.PUT("/coupons/:id", couponHandler.PharmacyUpdateCoupon)
+			pharmacyRoutes.DELETE("/coupons/:id", couponHandler.PharmacyDeactivateCoupon)
 
 			/*
 				pharmacyRoutes.GET("/orders/:id", orderHandler.GetOrderByID)
@@ -120,10 +215,20 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 		paymentRoutes := protectedRoutes.Group("/payment")
 		{
 			paymentRoutes.POST("/create-order", paymentHandler.CreateOrder)
+			paymentRoutes.POST("/cod", paymentHandler.CreateCODOrder)
 			paymentRoutes.POST("/verify", paymentHandler.VerifyPayment)
 			paymentRoutes.GET("/status/:orderId", paymentHandler.GetPaymentStatus)
 			paymentRoutes.GET("/history", paymentHandler.GetUserPayments)
 		}
+		// Delivery partner app (delivery partners only)
+		deliveryRoutes := protectedRoutes.Group("/delivery")
+		deliveryRoutes.Use(middleware.RoleBasedAccess(string(shared.UserRoleDriver)))
+		{
+			deliveryRoutes.GET("/assignments", deliveryHandler.ListAssignments)
+			deliveryRoutes.PUT("/assignments/:id/status", deliveryHandler.UpdateDeliveryStatus)
+			deliveryRoutes.POST("/assignments/:id/location", deliveryHandler.RecordPing)
+			deliveryRoutes.POST("/assignments/:id/confirm", deliveryHandler.ConfirmDelivery)
+		}
 		doctorRoutes := protectedRoutes.Group("/doctor")
 		{
 			doctorRoutes.GET("/schedule", appoinmentHandler.GetDoctorSchedule)
@@ -151,6 +256,37 @@ func SetupCleanRoutes(router *gin.Engine, container *container.Container) {
 				// Apply SuperAdmin middleware only to this specific route
 				adminUserRoutes.PUT("/:id/status", userHandler.UpdateUserStatus)
 			}
+
+			// Payment operations (admin only)
+			adminPaymentRoutes := adminRoutes.Group("")
+			adminPaymentRoutes.Use(middleware.RoleBasedAccess(string(shared.UserRoleAdmin), string(shared.UserRoleSuperAdmin)))
+			{
+				adminPaymentRoutes.POST("/orders/:id/refund", paymentHandler.AdminRefundOrder)
+				adminPaymentRoutes.GET("/refunds", paymentHandler.AdminListRefunds)
+				adminPaymentRoutes.GET("/reconciliation-reports", paymentHandler.AdminListReconciliationReports)
+				adminPaymentRoutes.POST("/reconciliation-reports/:date", paymentHandler.AdminGenerateReconciliationReport)
+				adminPaymentRoutes.GET("/reconciliation-reports/:date/download", paymentHandler.AdminDownloadReconciliationReport)
+			}
+
+			// Coupon management (admin only)
+			adminCouponRoutes := adminRoutes.Group("/coupons")
+			adminCouponRoutes.Use(middleware.RoleBasedAccess(string(shared.UserRoleAdmin), string(shared.UserRoleSuperAdmin)))
+			{
+				adminCouponRoutes.POST("", couponHandler.AdminCreateCoupon)
+				adminCouponRoutes.GET("", couponHandler.AdminListCoupons)
+				adminCouponRoutes.PUT("/:id", couponHandler.AdminUpdateCoupon)
+				adminCouponRoutes.DELETE("/:id", couponHandler.AdminDeactivateCoupon)
+			}
+
+			// Master drug catalogue (admin only)
+			adminDrugRoutes := adminRoutes.Group("/drugs")
+			adminDrugRoutes.Use(middleware.RoleBasedAccess(string(shared.UserRoleAdmin), string(shared.UserRoleSuperAdmin)))
+			{
+				adminDrugRoutes.POST("", drugHandler.AdminCreateDrug)
+				adminDrugRoutes.GET("", drugHandler.AdminListDrugs)
+				adminDrugRoutes.PUT("/:id", drugHandler.AdminUpdateDrug)
+				adminDrugRoutes.DELETE("/:id", drugHandler.AdminDeactivateDrug)
+			}
 		}
 	}
 }
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type SearchSuggestHandlerClean struct {
+	suggestUseCase usecase.SearchSuggestUseCase
+}
+
+// NewSearchSuggestHandlerClean creates a new search suggestion handler
+func NewSearchSuggestHandlerClean(suggestUseCase usecase.SearchSuggestUseCase) *SearchSuggestHandlerClean {
+	return &SearchSuggestHandlerClean{
+		suggestUseCase: suggestUseCase,
+	}
+}
+
+// Suggest completes a search box query with medicine names, drug generics,
+// doctors and specializations
+func (h *SearchSuggestHandlerClean) Suggest(c *gin.Context) {
+	var req types.SearchSuggestRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	suggestions, err := h.suggestUseCase.Suggest(c.Request.Context(), req)
+	if err != nil {
+		response.InternalServerError(c, "Failed to get search suggestions")
+		return
+	}
+	response.Success(c, suggestions, "Suggestions retrieved successfully")
+}
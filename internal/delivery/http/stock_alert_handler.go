@@ -0,0 +1,46 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type StockAlertHandlerClean struct {
+	stockAlertUseCase usecase.StockAlertUseCase
+	userRepo          repository.UserRepository
+}
+
+// NewStockAlertHandlerClean creates a new stock alert handler
+func NewStockAlertHandlerClean(stockAlertUseCase usecase.StockAlertUseCase, userRepo repository.UserRepository) *StockAlertHandlerClean {
+	return &StockAlertHandlerClean{
+		stockAlertUseCase: stockAlertUseCase,
+		userRepo:          userRepo,
+	}
+}
+
+// GetStockAlerts lists the caller's pharmacy stock that has expired, expires
+// soon or is below its reorder level
+func (h *StockAlertHandlerClean) GetStockAlerts(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		response.Unauthorized(c, "User ID not found in context")
+		return
+	}
+
+	pharmacyID := h.userRepo.GetPharmacyByUserID(c.Request.Context(), userID)
+	if pharmacyID == uuid.Nil {
+		response.NotFound(c, "No pharmacy associated with this user")
+		return
+	}
+
+	alerts, err := h.stockAlertUseCase.GetStockAlerts(c.Request.Context(), pharmacyID)
+	if err != nil {
+		response.InternalServerError(c, "Failed to retrieve stock alerts")
+		return
+	}
+
+	response.Success(c, alerts, "Stock alerts retrieved successfully")
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/delivery/http/response"
+	"github.com/skryfon/collex/internal/usecase"
+)
+
+type SubstituteHandlerClean struct {
+	substituteUseCase usecase.SubstituteUseCase
+}
+
+// NewSubstituteHandlerClean creates a new substitute handler
+func NewSubstituteHandlerClean(substituteUseCase usecase.SubstituteUseCase) *SubstituteHandlerClean {
+	return &SubstituteHandlerClean{
+		substituteUseCase: substituteUseCase,
+	}
+}
+
+// GetMedicineDetail returns a medicine with cheaper equivalents of the same
+// salt combination
+func (h *SubstituteHandlerClean) GetMedicineDetail(c *gin.Context) {
+	medicineID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid medicine ID format")
+		return
+	}
+
+	medicine, err := h.substituteUseCase.GetMedicineDetail(c.Request.Context(), medicineID)
+	if err != nil {
+		writeSubstituteError(c, err)
+		return
+	}
+	response.Success(c, medicine, "Medicine retrieved successfully")
+}
+
+// ListSubstitutes returns cheaper equivalents of a medicine
+func (h *SubstituteHandlerClean) ListSubstitutes(c *gin.Context) {
+	medicineID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "Invalid medicine ID format")
+		return
+	}
+
+	substitutes, err := h.substituteUseCase.ListSubstitutes(c.Request.Context(), medicineID)
+	if err != nil {
+		writeSubstituteError(c, err)
+		return
+	}
+	response.Success(c, substitutes, "Substitutes retrieved successfully")
+}
+
+// writeSubstituteError maps substitute lookup errors to responses
+func writeSubstituteError(c *gin.Context, err error) {
+	if errors.Is(err, usecase.ErrMedicineNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	response.InternalServerError(c, err.Error())
+}
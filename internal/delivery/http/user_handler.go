@@ -243,6 +243,7 @@ func (h *UserHandlerClean) createPharmacy(ctx context.Context, userID uuid.UUID,
 		UserID:        userID,
 		Name:          req.PharmacyName,
 		LicenseNumber: req.LicenseNumber,
+		GSTIN:         req.GSTNumber,
 		Email:         &req.Email,
 		PhoneNumber:   req.PharmacyPhone,
 		Address:       req.PharmacyAddress,
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -111,6 +113,56 @@ type OpChart struct {
 	Prescription string `gorm:"type:text" json:"prescription"`
 	DoctorNotes  string `gorm:"type:text" json:"doctorNotes"`
 
+	// Structured e-prescription; Prescription holds its text form
+	PrescriptionItems []PrescriptionItem `gorm:"foreignKey:OpChartID;constraint:OnDelete:CASCADE" json:"prescriptionItems,omitempty"`
+
 	// Audit field: Record exactly when the record was finalized
 	ConsultedAt time.Time `gorm:"autoCreateTime" json:"consultedAt"`
 }
+
+// PrescriptionItem is one medicine prescribed in a consultation
+type PrescriptionItem struct {
+	BaseModel
+	OpChartID    uuid.UUID `gorm:"type:uuid;not null;index" json:"opChartId"`
+	MedicineName string    `gorm:"type:varchar(200);not null" json:"medicineName"`
+	Dose         string    `gorm:"type:varchar(100)" json:"dose"`      // e.g. "500 mg"
+	Frequency    string    `gorm:"type:varchar(100)" json:"frequency"` // e.g. "1-0-1"
+	Duration     string    `gorm:"type:varchar(100)" json:"duration"`  // e.g. "5 days"
+	Quantity     int       `gorm:"not null;default:1" json:"quantity"` // units to dispense
+	Instructions string    `gorm:"type:text" json:"instructions,omitempty"`
+
+	// Units ordered against the item so far; it cannot be refilled past Quantity
+	DispensedQuantity int `gorm:"not null;default:0" json:"dispensedQuantity"`
+}
+
+// Remaining returns the units of the item that have not been dispensed yet
+func (i *PrescriptionItem) Remaining() int {
+	return max(i.Quantity-i.DispensedQuantity, 0)
+}
+
+// String renders the item as a line of a written prescription
+func (i *PrescriptionItem) String() string {
+	parts := []string{i.MedicineName}
+	for _, part := range []string{i.Dose, i.Frequency, i.Duration} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	line := strings.Join(parts, " - ")
+	if i.Quantity > 0 {
+		line += fmt.Sprintf(" (qty %d)", i.Quantity)
+	}
+	if i.Instructions != "" {
+		line += ", " + i.Instructions
+	}
+	return line
+}
+
+// PrescriptionText is the written form of the structured prescription items
+func (c *OpChart) PrescriptionText() string {
+	lines := make([]string, 0, len(c.PrescriptionItems))
+	for i := range c.PrescriptionItems {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, c.PrescriptionItems[i].String()))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -58,6 +59,41 @@ type GeoLocation struct {
 	PostalCode string  `gorm:"type:varchar(20)" json:"postalCode"`
 }
 
+// HasCoordinates reports whether the location has been geocoded
+func (g GeoLocation) HasCoordinates() bool {
+	return g.Latitude != 0 || g.Longitude != 0
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm returns the great-circle distance between two points in kilometres
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BoundingBox returns the latitude and longitude ranges holding every point
+// within radiusKm of the location. Near the poles, or where the box would
+// cross the antimeridian, the longitude range covers the whole globe.
+func (g GeoLocation) BoundingBox(radiusKm float64) (minLat, maxLat, minLng, maxLng float64) {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	minLat = math.Max(g.Latitude-dLat, -90)
+	maxLat = math.Min(g.Latitude+dLat, 90)
+
+	minLng, maxLng = -180, 180
+	if minLat > -90 && maxLat < 90 {
+		dLng := dLat / math.Cos(g.Latitude*math.Pi/180)
+		if g.Longitude-dLng >= -180 && g.Longitude+dLng <= 180 {
+			minLng, maxLng = g.Longitude-dLng, g.Longitude+dLng
+		}
+	}
+	return minLat, maxLat, minLng, maxLng
+}
+
 // tygo:emit
 // ContactInfo represents contact information
 type ContactInfo struct {
@@ -9,12 +9,23 @@ type CartMedicine struct {
 	MedicineID uuid.UUID `json:"medicine_id" gorm:"type:uuid"`
 	Quantity   int       `json:"quantity"`
 	Medicine   Medicine  `gorm:"foreignKey:MedicineID" json:"medicine"`
+
+	// E-prescription item the medicine was added for; such lines count as
+	// prescribed when checking out with the cart's prescription
+	PrescriptionItemID *uuid.UUID        `json:"prescription_item_id,omitempty" gorm:"type:uuid"`
+	PrescriptionItem   *PrescriptionItem `json:"prescription_item,omitempty" gorm:"foreignKey:PrescriptionItemID"`
 }
 
 func (CartMedicine) TableName() string {
 	return "cart_medicines"
 }
 
+// Prescribed reports whether what is left to dispense of the e-prescription
+// item the line was added for covers the quantity in the cart
+func (m *CartMedicine) Prescribed() bool {
+	return m.PrescriptionItem != nil && m.Quantity <= m.PrescriptionItem.Remaining()
+}
+
 // Cart represents a user's shopping cart
 type Cart struct {
 	BaseModel
@@ -22,6 +33,22 @@ type Cart struct {
 	User        User           `gorm:"foreignKey:UserID" json:"-"` // json:"-" excludes from response
 	Medicines   []CartMedicine `gorm:"foreignKey:CartID" json:"medicines"`
 	TotalAmount float64        `json:"total_amount" gorm:"type:decimal(10,2)"`
+
+	// Coupon applied to the cart. The discount is worked out when the cart is
+	// read, and CouponError says why it currently does not apply.
+	CouponID       *uuid.UUID `json:"coupon_id,omitempty" gorm:"type:uuid"`
+	Coupon         *Coupon    `json:"coupon,omitempty" gorm:"foreignKey:CouponID"`
+	DiscountAmount float64    `json:"discount_amount" gorm:"-"`
+	PayableAmount  float64    `json:"payable_amount" gorm:"-"`
+	CouponError    string     `json:"coupon_error,omitempty" gorm:"-"`
+
+	// E-prescription the cart was filled from, used at checkout unless
+	// another prescription is given
+	PrescriptionID *uuid.UUID `json:"prescription_id,omitempty" gorm:"type:uuid"`
+
+	// Set when the cart holds prescription-only medicines, which need a
+	// prescription at checkout
+	PrescriptionRequired bool `json:"prescription_required" gorm:"-"`
 }
 
 func (Cart) TableName() string {
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Checkout groups the per-pharmacy orders created from one payment
+type Checkout struct {
+	BaseModel
+	CheckoutNumber string    `json:"checkoutNumber" gorm:"uniqueIndex;not null"` // Payment.OrderID
+	UserID         uuid.UUID `json:"userId" gorm:"type:uuid;not null;index"`
+	PaymentID      uuid.UUID `json:"paymentId" gorm:"type:uuid;not null;index"`
+	Payment        *Payment  `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
+	TotalAmount    float64   `json:"totalAmount" gorm:"type:decimal(10,2);not null"`
+	Orders         []Order   `json:"orders" gorm:"foreignKey:CheckoutID"`
+}
+
+func (Checkout) TableName() string {
+	return "checkouts"
+}
+
+// NumberOrders gives each order the checkout number, suffixed with its
+// position when the checkout was split across several pharmacies
+func (c *Checkout) NumberOrders() {
+	for i := range c.Orders {
+		c.Orders[i].OrderNumber = c.CheckoutNumber
+		if len(c.Orders) > 1 {
+			c.Orders[i].OrderNumber = fmt.Sprintf("%s-%d", c.CheckoutNumber, i+1)
+		}
+	}
+}
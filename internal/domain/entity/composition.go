@@ -0,0 +1,217 @@
+package entity
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Salt is one active ingredient of a composition with its normalised
+// strength, e.g. {paracetamol 500mg} or {amoxicillin 50mg/ml}
+type Salt struct {
+	Name     string `json:"name"`
+	Strength string `json:"strength"`
+}
+
+var (
+	// compositionSeparator splits a composition into its ingredients
+	compositionSeparator = regexp.MustCompile(`\s*(?:\+|,|;|&|\band\b|\bwith\b)\s*`)
+	// strengthPattern matches an amount and unit, optionally per a volume or
+	// mass, e.g. 500mg, 0.5 g, 250mg/5ml, 1% w/v
+	strengthPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(mcg|mg|gm|g|iu|ml|%)(?:\s*(?:/|per)\s*(\d+(?:\.\d+)?)?\s*(ml|gm|g)\b)?`)
+	// saltNameCleaner drops everything but letters and digits from an
+	// ingredient name
+	saltNameCleaner = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// pharmacopoeiaWords are labels and qualifiers that do not change what an
+// ingredient is
+var pharmacopoeiaWords = map[string]bool{
+	"ip": true, "bp": true, "usp": true, "ph": true, "eur": true,
+	"w": true, "v": true, "each": true, "contains": true,
+	"tablet": true, "tablets": true, "tab": true, "tabs": true,
+	"capsule": true, "capsules": true, "cap": true, "caps": true,
+}
+
+// hydrateForms are the water of crystallisation of an ingredient, which
+// labels mention inconsistently and which does not change the medicine. Salt
+// forms such as sodium or potassium are kept, as diclofenac sodium and
+// diclofenac potassium are different medicines.
+var hydrateForms = map[string]bool{
+	"hydrate": true, "monohydrate": true, "dihydrate": true, "trihydrate": true,
+	"anhydrous": true,
+}
+
+// saltFormSpellings maps other spellings of a salt form to the one used here
+var saltFormSpellings = map[string]string{
+	"hcl":      "hydrochloride",
+	"sulfate":  "sulphate",
+	"besilate": "besylate",
+}
+
+// dosageForms maps the words medicine names use for a dosage form to the form
+var dosageForms = map[string]string{
+	"tablet": "tablet", "tablets": "tablet", "tab": "tablet", "tabs": "tablet",
+	"capsule": "capsule", "capsules": "capsule", "cap": "capsule", "caps": "capsule",
+	"syrup": "syrup", "syp": "syrup",
+	"suspension": "suspension", "susp": "suspension",
+	"injection": "injection", "inj": "injection",
+	"drop": "drops", "drops": "drops",
+	"cream": "cream", "ointment": "ointment", "oint": "ointment", "gel": "gel",
+	"lotion": "lotion", "spray": "spray", "inhaler": "inhaler",
+	"solution": "solution", "soln": "solution", "powder": "powder", "sachet": "sachet",
+}
+
+// releaseTypes maps the words medicine names use for how a dose is released
+// to the release type
+var releaseTypes = map[string]string{
+	"sr": "sr", "sustained": "sr", "retard": "sr",
+	"er": "er", "xr": "er", "xl": "er", "extended": "er",
+	"cr": "cr", "controlled": "cr",
+	"pr": "pr", "prolonged": "pr",
+	"mr": "mr", "modified": "mr",
+	"dr": "dr", "delayed": "dr", "ec": "dr", "enteric": "dr",
+	"od": "od",
+}
+
+// saltAliases maps alternative names of an ingredient to the one used here
+var saltAliases = map[string]string{
+	"acetaminophen":         "paracetamol",
+	"amoxycillin":           "amoxicillin",
+	"clavulanate":           "clavulanic acid",
+	"clavulanate potassium": "clavulanic acid",
+	"potassium clavulanate": "clavulanic acid",
+	"albuterol":             "salbutamol",
+	"ascorbic acid":         "vitamin c",
+}
+
+// ParseComposition reads the active ingredients and strengths out of
+// composition text such as "Amoxycillin IP 500mg + Clavulanate Potassium
+// 125mg". Ingredient names are lowercased and stripped of pharmacopoeia
+// labels and hydrates, and strengths are converted to mg (or per ml), so
+// differently written labels of the same medicine parse the same.
+func ParseComposition(text string) []Salt {
+	text = strings.ReplaceAll(strings.ToLower(text), "µg", "mcg")
+
+	var salts []Salt
+	for _, part := range compositionSeparator.Split(text, -1) {
+		strength := ""
+		if match := strengthPattern.FindStringSubmatch(part); match != nil {
+			strength = normalizeStrength(match[1], match[2], match[3], match[4])
+			part = strings.Replace(part, match[0], " ", 1)
+		}
+
+		name := normalizeSaltName(part)
+		if name == "" {
+			continue
+		}
+		salts = append(salts, Salt{Name: name, Strength: strength})
+	}
+
+	sort.Slice(salts, func(i, j int) bool {
+		if salts[i].Name != salts[j].Name {
+			return salts[i].Name < salts[j].Name
+		}
+		return salts[i].Strength < salts[j].Strength
+	})
+	return salts
+}
+
+// CompositionKey is the salt combination of a composition as one comparable
+// string, e.g. "amoxicillin 500mg+clavulanic acid 125mg". It is empty when any
+// ingredient has no strength, as equivalence cannot be told then.
+func CompositionKey(text string) string {
+	salts := ParseComposition(text)
+	if len(salts) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(salts))
+	for _, salt := range salts {
+		if salt.Strength == "" {
+			return ""
+		}
+		parts = append(parts, salt.Name+" "+salt.Strength)
+	}
+	return strings.Join(parts, "+")
+}
+
+// MedicineKey identifies the medicines that can stand in for one another: the
+// same salt combination in the same dosage form with the same release type,
+// e.g. "diclofenac sodium 100mg|tablet|sr". The form and release type come
+// from the medicine's name; a name naming neither only matches names that
+// name neither. It is empty when the composition has no key.
+func MedicineKey(name, composition string) string {
+	key := CompositionKey(composition)
+	if key == "" {
+		return ""
+	}
+
+	form, release := "", ""
+	for _, word := range strings.Fields(saltNameCleaner.ReplaceAllString(strings.ToLower(name), " ")) {
+		if f, ok := dosageForms[word]; ok && form == "" {
+			form = f
+		}
+		if r, ok := releaseTypes[word]; ok && release == "" {
+			release = r
+		}
+	}
+	return key + "|" + form + "|" + release
+}
+
+// normalizeSaltName reduces an ingredient to the words naming it
+func normalizeSaltName(text string) string {
+	var words []string
+	for _, word := range strings.Fields(saltNameCleaner.ReplaceAllString(text, " ")) {
+		if pharmacopoeiaWords[word] || hydrateForms[word] || strings.Trim(word, "0123456789") == "" {
+			continue
+		}
+		if spelling, ok := saltFormSpellings[word]; ok {
+			word = spelling
+		}
+		words = append(words, word)
+	}
+
+	name := strings.Join(words, " ")
+	if alias, ok := saltAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// normalizeStrength converts an amount to mg, or mg per ml or g when it is a
+// concentration; other units are kept as written
+func normalizeStrength(amount, unit, perAmount, perUnit string) string {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return ""
+	}
+
+	switch unit {
+	case "g", "gm":
+		value, unit = value*1000, "mg"
+	case "mcg":
+		value, unit = value/1000, "mg"
+	}
+
+	if perUnit != "" {
+		per := 1.0
+		if perAmount != "" {
+			if per, err = strconv.ParseFloat(perAmount, 64); err != nil || per == 0 {
+				return ""
+			}
+		}
+		if perUnit == "gm" {
+			perUnit = "g"
+		}
+		return formatStrength(value/per) + unit + "/" + perUnit
+	}
+	return formatStrength(value) + unit
+}
+
+// formatStrength writes an amount without float noise or trailing zeros
+func formatStrength(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e4)/1e4, 'f', -1, 64)
+}
@@ -0,0 +1,136 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Coupon discount types
+const (
+	CouponDiscountPercentage = "percentage"
+	CouponDiscountFlat       = "flat"
+)
+
+// Coupon redemption statuses
+const (
+	CouponRedemptionReserved = "reserved" // held by a checkout awaiting payment
+	CouponRedemptionRedeemed = "redeemed"
+	CouponRedemptionReleased = "released" // the checkout was never paid
+)
+
+// MinPayableAmount is the smallest amount the payment gateway accepts. Coupons
+// never discount a checkout below it.
+const MinPayableAmount = 1.00
+
+// Coupon is a discount code. Platform coupons have no PharmacyID and apply to
+// the whole cart; pharmacy coupons only discount that pharmacy's items.
+type Coupon struct {
+	BaseModel
+	Code          string     `json:"code" gorm:"type:varchar(40);uniqueIndex;not null"` // stored upper case
+	Description   string     `json:"description" gorm:"type:varchar(255)"`
+	DiscountType  string     `json:"discountType" gorm:"type:varchar(20);not null"` // percentage or flat
+	DiscountValue float64    `json:"discountValue" gorm:"type:decimal(10,2);not null"`
+	MaxDiscount   *float64   `json:"maxDiscount,omitempty" gorm:"type:decimal(10,2)"` // cap for percentage coupons
+	PharmacyID    *uuid.UUID `json:"pharmacyId,omitempty" gorm:"type:uuid;index"`
+	Pharmacy      *Pharmacy  `json:"pharmacy,omitempty" gorm:"foreignKey:PharmacyID"`
+	MinCartValue  float64    `json:"minCartValue" gorm:"type:decimal(10,2);default:0"` // of the items the coupon applies to
+	PerUserLimit  int        `json:"perUserLimit" gorm:"default:1"`                    // 0 means unlimited
+	UsageLimit    int        `json:"usageLimit" gorm:"default:0"`                      // across all users; 0 means unlimited
+	ValidFrom     *time.Time `json:"validFrom,omitempty"`
+	ValidUntil    *time.Time `json:"validUntil,omitempty"`
+	IsActive      bool       `json:"isActive" gorm:"default:true;index"`
+	CreatedBy     uuid.UUID  `json:"createdBy" gorm:"type:uuid"`
+}
+
+func (Coupon) TableName() string {
+	return "coupons"
+}
+
+// CheckValidity reports why the coupon cannot be used at now, if it cannot
+func (c *Coupon) CheckValidity(now time.Time) error {
+	switch {
+	case !c.IsActive:
+		return errors.New("coupon is inactive")
+	case c.ValidFrom != nil && now.Before(*c.ValidFrom):
+		return errors.New("coupon is not valid yet")
+	case c.ValidUntil != nil && now.After(*c.ValidUntil):
+		return errors.New("coupon has expired")
+	}
+	return nil
+}
+
+// AppliesTo reports whether the coupon discounts a line
+func (c *Coupon) AppliesTo(line PaymentLineItem) bool {
+	return c.PharmacyID == nil || *c.PharmacyID == line.PharmacyID
+}
+
+// ApplyDiscount sets the discount on each line the coupon applies to and
+// returns the total. The discount is shared across those lines in proportion
+// to their subtotals, with any rounding remainder on the last one. It is
+// capped so that at least MinPayableAmount is left to pay.
+func (c *Coupon) ApplyDiscount(lines PaymentLineItems) (float64, error) {
+	var eligible []int
+	var base, total float64
+	for i := range lines {
+		lines[i].Discount = 0
+		total += lines[i].Subtotal
+		if c.AppliesTo(lines[i]) {
+			eligible = append(eligible, i)
+			base += lines[i].Subtotal
+		}
+	}
+	if len(eligible) == 0 {
+		return 0, errors.New("coupon does not apply to any item in the cart")
+	}
+	if base < c.MinCartValue {
+		return 0, fmt.Errorf("coupon needs a minimum of %.2f of eligible items", c.MinCartValue)
+	}
+
+	var discount float64
+	switch c.DiscountType {
+	case CouponDiscountPercentage:
+		discount = base * c.DiscountValue / 100
+		if c.MaxDiscount != nil && discount > *c.MaxDiscount {
+			discount = *c.MaxDiscount
+		}
+	case CouponDiscountFlat:
+		discount = c.DiscountValue
+	default:
+		return 0, fmt.Errorf("unknown discount type %q", c.DiscountType)
+	}
+	discount = math.Min(math.Round(discount*100)/100, base)
+	discount = math.Min(discount, math.Round((total-MinPayableAmount)*100)/100)
+	if discount <= 0 {
+		return 0, fmt.Errorf("coupon needs a checkout of more than %.2f", MinPayableAmount)
+	}
+
+	remaining := discount
+	for n, i := range eligible {
+		share := remaining
+		if n < len(eligible)-1 {
+			share = math.Round(discount*lines[i].Subtotal/base*100) / 100
+			remaining -= share
+		}
+		lines[i].Discount = share
+	}
+	return discount, nil
+}
+
+// CouponRedemption is one use of a coupon by a checkout
+type CouponRedemption struct {
+	BaseModel
+	CouponID       uuid.UUID  `json:"couponId" gorm:"type:uuid;not null;index"`
+	UserID         uuid.UUID  `json:"userId" gorm:"type:uuid;not null;index"`
+	PaymentOrderID string     `json:"paymentOrderId" gorm:"type:varchar(100);uniqueIndex;not null"` // Payment.OrderID
+	DiscountAmount float64    `json:"discountAmount" gorm:"type:decimal(10,2);not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	RedeemedAt     *time.Time `json:"redeemedAt,omitempty"`
+}
+
+func (CouponRedemption) TableName() string {
+	return "coupon_redemptions"
+}
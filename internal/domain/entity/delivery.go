@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery statuses
+const (
+	DeliveryStatusAssigned  = "assigned"   // partner assigned, order not yet collected
+	DeliveryStatusPickedUp  = "picked_up"  // order collected from the pharmacy
+	DeliveryStatusInTransit = "in_transit" // on the way to the patient
+	DeliveryStatusDelivered = "delivered"  // handed over, confirmed with the patient's OTP
+	DeliveryStatusFailed    = "failed"     // the partner could not deliver
+	DeliveryStatusCancelled = "cancelled"  // the pharmacy assigned someone else
+)
+
+// deliveryTransitions lists, for every status, the statuses the delivery
+// partner may move a delivery to. Delivered is reached only by confirming the
+// OTP and cancelled only by reassigning.
+var deliveryTransitions = map[string][]string{
+	DeliveryStatusAssigned:  {DeliveryStatusPickedUp, DeliveryStatusFailed},
+	DeliveryStatusPickedUp:  {DeliveryStatusInTransit, DeliveryStatusFailed},
+	DeliveryStatusInTransit: {DeliveryStatusFailed},
+	DeliveryStatusDelivered: {},
+	DeliveryStatusFailed:    {},
+	DeliveryStatusCancelled: {},
+}
+
+// CanTransitionDelivery reports whether a delivery partner may move a
+// delivery from one status to another
+func CanTransitionDelivery(from, to string) bool {
+	for _, allowed := range deliveryTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is the hand-over of an order to the patient by a delivery partner.
+// An order has at most one active delivery; reassigning cancels it.
+type Delivery struct {
+	BaseModel
+	OrderID    uuid.UUID `json:"orderId" gorm:"type:uuid;not null;index"`
+	Order      *Order    `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	PharmacyID uuid.UUID `json:"pharmacyId" gorm:"type:uuid;not null;index"`
+	Pharmacy   *Pharmacy `json:"pharmacy,omitempty" gorm:"foreignKey:PharmacyID"`
+	PartnerID  uuid.UUID `json:"partnerId" gorm:"type:uuid;not null;index"`
+	Partner    *User     `json:"partner,omitempty" gorm:"foreignKey:PartnerID"`
+	AssignedBy uuid.UUID `json:"assignedBy" gorm:"type:uuid;not null"`
+	Status     string    `json:"status" gorm:"type:varchar(20);not null;index"`
+
+	// Where the order is taken, copied from the patient's address
+	Destination GeoLocation `json:"destination" gorm:"embedded;embeddedPrefix:destination_"`
+
+	// Last position reported by the partner
+	Latitude   *float64   `json:"latitude,omitempty" gorm:"type:decimal(10,8)"`
+	Longitude  *float64   `json:"longitude,omitempty" gorm:"type:decimal(11,8)"`
+	LastPingAt *time.Time `json:"lastPingAt,omitempty"`
+
+	// One-time code the patient gives the partner on hand-over
+	OTP         string `json:"-" gorm:"column:otp;type:varchar(10);not null"`
+	OTPAttempts int    `json:"-" gorm:"column:otp_attempts;default:0"`
+
+	PickedUpAt    *time.Time `json:"pickedUpAt,omitempty"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"`
+	FailedAt      *time.Time `json:"failedAt,omitempty"`
+	FailureReason string     `json:"failureReason,omitempty" gorm:"type:text"`
+}
+
+func (Delivery) TableName() string {
+	return "deliveries"
+}
+
+// IsActive reports whether the delivery is still under way
+func (d *Delivery) IsActive() bool {
+	switch d.Status {
+	case DeliveryStatusAssigned, DeliveryStatusPickedUp, DeliveryStatusInTransit:
+		return true
+	}
+	return false
+}
+
+// HasPosition reports whether the partner has reported where they are
+func (d *Delivery) HasPosition() bool {
+	return d.Latitude != nil && d.Longitude != nil
+}
+
+// DeliveryPing is a GPS position reported by the partner during a delivery
+type DeliveryPing struct {
+	BaseModel
+	DeliveryID uuid.UUID `json:"deliveryId" gorm:"type:uuid;not null;index"`
+	Latitude   float64   `json:"latitude" gorm:"type:decimal(10,8);not null"`
+	Longitude  float64   `json:"longitude" gorm:"type:decimal(11,8);not null"`
+	Accuracy   *float64  `json:"accuracy,omitempty"` // metres, as reported by the device
+	RecordedAt time.Time `json:"recordedAt" gorm:"not null"`
+}
+
+func (DeliveryPing) TableName() string {
+	return "delivery_pings"
+}
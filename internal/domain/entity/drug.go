@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"strings"
+)
+
+// Drug schedules under the Drugs and Cosmetics Rules
+const (
+	DrugScheduleOTC = "OTC"
+	DrugScheduleG   = "G"
+	DrugScheduleH   = "H"
+	DrugScheduleH1  = "H1"
+	DrugScheduleX   = "X"
+)
+
+// Drug is an entry of the platform's master catalogue. Pharmacy medicines
+// that are the same product link to one drug, so their listings can be
+// grouped whatever each pharmacy calls them.
+type Drug struct {
+	BaseModel
+	GenericName  string  `json:"genericName" gorm:"type:varchar(200);not null;index"`
+	BrandName    *string `json:"brandName,omitempty" gorm:"type:varchar(200);index"`
+	Strength     string  `json:"strength" gorm:"type:varchar(100);not null"` // e.g. 500mg, 5mg/5ml
+	Form         string  `json:"form" gorm:"type:varchar(30);not null"`      // tablet, capsule, syrup, ...
+	Schedule     string  `json:"schedule" gorm:"type:varchar(5);default:'OTC'"`
+	Manufacturer *string `json:"manufacturer,omitempty" gorm:"type:varchar(200)"`
+	Composition  *string `json:"composition,omitempty" gorm:"type:text"`
+	IsActive     bool    `json:"isActive" gorm:"default:true;index"`
+}
+
+func (Drug) TableName() string {
+	return "drugs"
+}
+
+// DisplayName is the brand, or the generic name, with strength and form
+func (d *Drug) DisplayName() string {
+	name := d.GenericName
+	if d.BrandName != nil && *d.BrandName != "" {
+		name = *d.BrandName
+	}
+	return strings.Join([]string{name, d.Strength, d.Form}, " ")
+}
+
+// RequiresPrescription reports whether the drug's schedule restricts its sale
+// to patients with a prescription
+func (d *Drug) RequiresPrescription() bool {
+	switch d.Schedule {
+	case DrugScheduleH, DrugScheduleH1, DrugScheduleX:
+		return true
+	}
+	return false
+}
@@ -17,6 +17,8 @@ const (
 	EmailTypeAccountActivation EmailType = "account_activation"
 	EmailTypeNotification      EmailType = "notification"
 	EmailTypeInvoice           EmailType = "invoice"
+	EmailTypeOrderCancelled    EmailType = "order_cancelled"
+	EmailTypeStockAlert        EmailType = "stock_alert"
 	EmailTypeGeneral           EmailType = "general"
 )
 
@@ -0,0 +1,161 @@
+package entity
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invoice is the GST tax invoice issued for a paid order. The rendered PDF is
+// kept in document storage at FilePath. Amounts are in rupees.
+//
+// Invoice numbers run consecutively per pharmacy and financial year, see
+// FormatInvoiceNumber; they are unique per pharmacy, see CreateIndexes.
+// Invoices issued before that carry "INV-" and the order number.
+type Invoice struct {
+	BaseModel
+	InvoiceNumber  string     `json:"invoiceNumber" gorm:"type:varchar(50);not null"`
+	OrderID        uuid.UUID  `json:"orderId" gorm:"type:uuid;uniqueIndex;not null"`
+	Order          *Order     `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	UserID         uuid.UUID  `json:"userId" gorm:"type:uuid;not null;index"`
+	PharmacyID     uuid.UUID  `json:"pharmacyId" gorm:"type:uuid;index"`
+	PlaceOfSupply  string     `json:"placeOfSupply,omitempty" gorm:"type:varchar(100)"` // state the medicines are delivered to
+	Interstate     bool       `json:"interstate" gorm:"default:false"`                  // taxed as IGST rather than CGST and SGST
+	TaxableAmount  float64    `json:"taxableAmount" gorm:"type:decimal(10,2);not null"`
+	CGSTAmount     float64    `json:"cgstAmount" gorm:"type:decimal(10,2);not null"`
+	SGSTAmount     float64    `json:"sgstAmount" gorm:"type:decimal(10,2);not null"`
+	IGSTAmount     float64    `json:"igstAmount" gorm:"type:decimal(10,2);default:0"`
+	DiscountAmount float64    `json:"discountAmount" gorm:"type:decimal(10,2);default:0"`
+	TotalAmount    float64    `json:"totalAmount" gorm:"type:decimal(10,2);not null"`
+	FilePath       string     `json:"-" gorm:"type:varchar(500);not null"`
+	IssuedAt       time.Time  `json:"issuedAt" gorm:"not null"`
+	EmailedAt      *time.Time `json:"emailedAt,omitempty"`
+}
+
+func (Invoice) TableName() string {
+	return "invoices"
+}
+
+// InvoiceSequence is the last invoice number a pharmacy issued in a financial
+// year, locked while the next one is allocated
+type InvoiceSequence struct {
+	PharmacyID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	FinancialYear string    `gorm:"type:varchar(7);primaryKey"` // e.g. 2026-27
+	LastNumber    int       `gorm:"not null;default:0"`
+	UpdatedAt     time.Time
+}
+
+func (InvoiceSequence) TableName() string {
+	return "invoice_sequences"
+}
+
+// indianTime is the time zone financial years are reckoned in
+var indianTime = time.FixedZone("IST", 5*60*60+30*60)
+
+// FinancialYear returns the April to March financial year t falls in, such as
+// "2026-27"
+func FinancialYear(t time.Time) string {
+	t = t.In(indianTime)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// FormatInvoiceNumber returns the number of the sequence'th invoice of a
+// financial year, such as "2026-27/000042". GST allows at most 16
+// characters, which holds up to 99,999,999 invoices a year.
+func FormatInvoiceNumber(financialYear string, sequence int) string {
+	return fmt.Sprintf("%s/%06d", financialYear, sequence)
+}
+
+// IsInterstateSupply reports whether goods sent from one state to another,
+// which are taxed as IGST. An unknown state is taken to be the same state.
+func IsInterstateSupply(fromState, toState string) bool {
+	fromState, toState = strings.TrimSpace(fromState), strings.TrimSpace(toState)
+	if fromState == "" || toState == "" {
+		return false
+	}
+	return !strings.EqualFold(fromState, toState)
+}
+
+// InvoiceLine is one order item on an invoice with its GST split. Prices are
+// GST inclusive, so the taxable value is worked back from the line total
+// after discount.
+type InvoiceLine struct {
+	Name         string
+	HSNCode      string
+	Quantity     int
+	UnitPrice    float64
+	Discount     float64
+	GSTRate      float64
+	TaxableValue float64
+	CGST         float64
+	SGST         float64
+	IGST         float64
+	Total        float64
+}
+
+// NewInvoiceLines builds the invoice lines for the items of an order, taxed at
+// the HSN code and rate they were sold with. Tax is split equally between
+// CGST and SGST for supplies within the state and is IGST otherwise.
+func NewInvoiceLines(order *Order, interstate bool) []InvoiceLine {
+	lines := make([]InvoiceLine, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		line := InvoiceLine{
+			Quantity:  item.Quantity,
+			UnitPrice: item.Price,
+			Discount:  roundPaise(item.Discount),
+			Total:     roundPaise(item.Subtotal - item.Discount),
+			HSNCode:   item.HSNCode,
+			GSTRate:   item.GSTRate,
+		}
+		if item.Medicine != nil {
+			line.Name = item.Medicine.Name
+			// Items ordered before tax was recorded on them
+			if item.HSNCode == "" {
+				line.HSNCode = item.Medicine.HSNCode
+				line.GSTRate = item.Medicine.GSTRate
+			}
+		}
+
+		line.TaxableValue = roundPaise(line.Total / (1 + line.GSTRate/100))
+		tax := roundPaise(line.Total - line.TaxableValue)
+		if interstate {
+			line.IGST = tax
+		} else {
+			line.CGST = roundPaise(tax / 2)
+			line.SGST = roundPaise(tax - line.CGST)
+		}
+
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ApplyTotals sets the invoice amounts from its lines
+func (inv *Invoice) ApplyTotals(lines []InvoiceLine) {
+	inv.TaxableAmount, inv.CGSTAmount, inv.SGSTAmount, inv.IGSTAmount, inv.DiscountAmount, inv.TotalAmount = 0, 0, 0, 0, 0, 0
+	for _, line := range lines {
+		inv.TaxableAmount += line.TaxableValue
+		inv.CGSTAmount += line.CGST
+		inv.SGSTAmount += line.SGST
+		inv.IGSTAmount += line.IGST
+		inv.DiscountAmount += line.Discount
+		inv.TotalAmount += line.Total
+	}
+	inv.DiscountAmount = roundPaise(inv.DiscountAmount)
+	inv.TaxableAmount = roundPaise(inv.TaxableAmount)
+	inv.CGSTAmount = roundPaise(inv.CGSTAmount)
+	inv.SGSTAmount = roundPaise(inv.SGSTAmount)
+	inv.IGSTAmount = roundPaise(inv.IGSTAmount)
+	inv.TotalAmount = roundPaise(inv.TotalAmount)
+}
+
+func roundPaise(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
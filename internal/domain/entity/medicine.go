@@ -18,15 +18,37 @@ type Medicine struct {
 	ExpiryDate           *time.Time `json:"expiryDate,omitempty"`
 	Price                float64    `gorm:"not null" json:"price"`
 	Quantity             int        `gorm:"default:0" json:"quantity"`
+	ReorderLevel         int        `gorm:"default:0" json:"reorderLevel"` // low-stock alert threshold; 0 disables it
 	PrescriptionRequired bool       `gorm:"default:false" json:"prescriptionRequired"`
+	HSNCode              string     `gorm:"type:varchar(8);default:'3004'" json:"hsnCode"` // HSN code printed on GST invoices
+	GSTRate              float64    `gorm:"type:decimal(5,2);default:12" json:"gstRate"`   // GST percentage included in Price
 	ImageURL             *string    `gorm:"type:varchar(500)" json:"image,omitempty"`
+	CompositionKey       *string    `gorm:"type:varchar(500);index" json:"compositionKey,omitempty"` // salts parsed from Content with the form and release type in Name; empty when it cannot be parsed
 
 	// Relations
-	PharmacyID uuid.UUID `gorm:"type:uuid;index;not null" json:"pharmacyId"`
-	Pharmacy   *Pharmacy `gorm:"foreignKey:PharmacyID" json:"pharmacy,omitempty"`
+	PharmacyID uuid.UUID  `gorm:"type:uuid;index;not null" json:"pharmacyId"`
+	Pharmacy   *Pharmacy  `gorm:"foreignKey:PharmacyID" json:"pharmacy,omitempty"`
+	DrugID     *uuid.UUID `gorm:"type:uuid;index" json:"drugId,omitempty"` // master catalogue entry the listing is for
+	Drug       *Drug      `gorm:"foreignKey:DrugID" json:"drug,omitempty"`
+
+	Batches []MedicineBatch `gorm:"foreignKey:MedicineID" json:"batches,omitempty"`
+
+	// Cheaper listings with the same salt combination, worked out when the
+	// medicine is shown to a patient
+	Substitutes []*Medicine `gorm:"-" json:"substitutes,omitempty"`
 
 	// Audit fields
 	IsActive      bool       `gorm:"default:true;index" json:"isActive"`
 	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
 	DeactivatedBy *uuid.UUID `gorm:"type:uuid" json:"deactivatedBy,omitempty"`
 }
+
+// IndexComposition sets the composition key from the medicine's name and
+// content
+func (m *Medicine) IndexComposition() {
+	key := ""
+	if m.Content != nil {
+		key = MedicineKey(m.Name, *m.Content)
+	}
+	m.CompositionKey = &key
+}
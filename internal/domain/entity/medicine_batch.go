@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultBatchNumber labels stock that was recorded without a batch number
+const DefaultBatchNumber = "UNBATCHED"
+
+// MedicineBatch is one received lot of a medicine. The medicine's Quantity,
+// BatchNumber and ExpiryDate are derived from its sellable batches.
+type MedicineBatch struct {
+	BaseModel
+	MedicineID  uuid.UUID  `json:"medicineId" gorm:"type:uuid;not null;uniqueIndex:idx_medicine_batches_number"`
+	Medicine    *Medicine  `json:"medicine,omitempty" gorm:"foreignKey:MedicineID"`
+	BatchNumber string     `json:"batchNumber" gorm:"type:varchar(100);not null;uniqueIndex:idx_medicine_batches_number"`
+	ExpiryDate  *time.Time `json:"expiryDate,omitempty" gorm:"index"`
+	Quantity    int        `json:"quantity" gorm:"not null;default:0"`            // units left on the shelf
+	CostPrice   float64    `json:"costPrice" gorm:"type:decimal(10,2);default:0"` // purchase price per unit
+	ReceivedAt  time.Time  `json:"receivedAt"`
+}
+
+func (MedicineBatch) TableName() string {
+	return "medicine_batches"
+}
+
+// Expired reports whether the batch can no longer be sold at now
+func (b *MedicineBatch) Expired(now time.Time) bool {
+	return b.ExpiryDate != nil && !b.ExpiryDate.After(now)
+}
+
+// OrderItemBatch records how many units of a batch went into an order item,
+// so a recalled batch can be traced to the orders it was sold in.
+// Allocations are made when the payment's stock is committed and linked to
+// the order item once the order exists.
+type OrderItemBatch struct {
+	BaseModel
+	PaymentOrderID   string         `json:"paymentOrderId" gorm:"type:varchar(50);not null;index"` // Payment.OrderID the units were committed for
+	OrderItemID      *uuid.UUID     `json:"orderItemId,omitempty" gorm:"type:uuid;index"`
+	OrderItem        *OrderItem     `json:"orderItem,omitempty" gorm:"foreignKey:OrderItemID"`
+	MedicineID       uuid.UUID      `json:"medicineId" gorm:"type:uuid;not null;index"`
+	BatchID          uuid.UUID      `json:"batchId" gorm:"type:uuid;not null;index"`
+	Batch            *MedicineBatch `json:"batch,omitempty" gorm:"foreignKey:BatchID"`
+	Quantity         int            `json:"quantity" gorm:"not null"`
+	ReturnedQuantity int            `json:"returnedQuantity" gorm:"default:0"` // units put back on the batch by refunds and cancellations
+}
+
+func (OrderItemBatch) TableName() string {
+	return "order_item_batches"
+}
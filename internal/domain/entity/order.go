@@ -1,6 +1,9 @@
 package entity
 
 import (
+	"math"
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -11,19 +14,77 @@ type Order struct {
 	UserID          uuid.UUID   `json:"userId" gorm:"type:uuid;not null"`
 	User            *User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	PaymentID       uuid.UUID   `json:"paymentId" gorm:"type:uuid;not null"`
+	CheckoutID      *uuid.UUID  `json:"checkoutId,omitempty" gorm:"type:uuid;index"`     // parent checkout when a cart was split by pharmacy
 	PharmacyID      uuid.UUID   `json:"pharmacyId" gorm:"type:uuid;index"`               // ADD THIS
 	Pharmacy        *Pharmacy   `json:"pharmacy,omitempty" gorm:"foreignKey:PharmacyID"` // ADD THIS
 	Payment         *Payment    `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
 	TotalAmount     float64     `json:"totalAmount" gorm:"type:decimal(10,2);not null"`
-	Status          string      `json:"status" gorm:"default:'pending'"` // pending, confirmed, processing, shipped, delivered, cancelled
+	RefundedAmount  float64     `json:"refundedAmount" gorm:"type:decimal(10,2);default:0"`
+	DiscountAmount  float64     `json:"discountAmount" gorm:"type:decimal(10,2);default:0"`
+	CouponCode      string      `json:"couponCode,omitempty" gorm:"type:varchar(40)"`
+	Status          string      `json:"status" gorm:"default:'pending'"` // pending, confirmed, processing, shipped, delivered, cancellation_pending, cancelled, refunded
 	DeliveryAddress string      `json:"deliveryAddress"`
 	OrderItems      []OrderItem `json:"orderItems" gorm:"foreignKey:OrderID"`
+
+	CancellationReason string     `json:"cancellationReason,omitempty" gorm:"type:text"`
+	CancelledAt        *time.Time `json:"cancelledAt,omitempty"`
+
+	// Cash on delivery collected for this order. A cash payment covering
+	// several orders is settled once the last of them is collected.
+	CashCollectedAt *time.Time `json:"cashCollectedAt,omitempty"`
+	CashCollectedBy *uuid.UUID `json:"cashCollectedBy,omitempty" gorm:"type:uuid"`
+
+	// Prescription review, set for orders with prescription-only items. The
+	// order is held at confirmed until the pharmacy approves the prescription.
+	PrescriptionID         *uuid.UUID    `json:"prescriptionId,omitempty" gorm:"type:uuid;index"`
+	Prescription           *Prescription `json:"prescription,omitempty" gorm:"foreignKey:PrescriptionID"`
+	PrescriptionStatus     string        `json:"prescriptionStatus,omitempty" gorm:"type:varchar(20);index"`
+	PrescriptionNote       string        `json:"prescriptionNote,omitempty" gorm:"type:text"`
+	PrescriptionReviewedBy *uuid.UUID    `json:"prescriptionReviewedBy,omitempty" gorm:"type:uuid"`
+	PrescriptionReviewedAt *time.Time    `json:"prescriptionReviewedAt,omitempty"`
 }
 
 func (Order) TableName() string {
 	return "orders"
 }
 
+// BelongsToPharmacy reports whether the pharmacy fulfils this order. Orders
+// placed before carts were split by pharmacy have no PharmacyID and belong to
+// every pharmacy with an item in them.
+func (o *Order) BelongsToPharmacy(pharmacyID uuid.UUID) bool {
+	if o.PharmacyID != uuid.Nil {
+		return o.PharmacyID == pharmacyID
+	}
+	for i := range o.OrderItems {
+		if o.OrderItems[i].SoldBy(pharmacyID) {
+			return true
+		}
+	}
+	return false
+}
+
+// PharmacyIDs returns the pharmacies fulfilling this order, which for orders
+// placed before carts were split by pharmacy are those of its items
+func (o *Order) PharmacyIDs() []uuid.UUID {
+	if o.PharmacyID != uuid.Nil {
+		return []uuid.UUID{o.PharmacyID}
+	}
+
+	var ids []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for i := range o.OrderItems {
+		id := o.OrderItems[i].PharmacyID
+		if id == uuid.Nil && o.OrderItems[i].Medicine != nil {
+			id = o.OrderItems[i].Medicine.PharmacyID
+		}
+		if id != uuid.Nil && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // OrderItem represents individual items in an order
 type OrderItem struct {
 	BaseModel
@@ -36,8 +97,37 @@ type OrderItem struct {
 	Quantity   int       `json:"quantity" gorm:"not null"`
 	Price      float64   `json:"price" gorm:"type:decimal(10,2);not null"` // Price at time of order
 	Subtotal   float64   `json:"subtotal" gorm:"type:decimal(10,2);not null"`
+	Discount   float64   `json:"discount" gorm:"type:decimal(10,2);default:0"` // coupon discount on Subtotal
+
+	// E-prescription item the units were dispensed against
+	PrescriptionItemID *uuid.UUID `json:"prescriptionItemId,omitempty" gorm:"type:uuid;index"`
+
+	// Tax the item was sold with, as printed on its invoice
+	HSNCode string  `json:"hsnCode,omitempty" gorm:"type:varchar(8)"`
+	GSTRate float64 `json:"gstRate" gorm:"type:decimal(5,2);default:0"`
+
+	RefundedQuantity int `json:"refundedQuantity" gorm:"default:0"`
+
+	Batches []OrderItemBatch `json:"batches,omitempty" gorm:"foreignKey:OrderItemID"` // batches the units were picked from
 }
 
 func (OrderItem) TableName() string {
 	return "order_items"
 }
+
+// NetAmount returns what was paid for quantity units of the item, after its
+// share of any discount
+func (i *OrderItem) NetAmount(quantity int) float64 {
+	if i.Quantity == 0 {
+		return 0
+	}
+	return math.Round((i.Subtotal-i.Discount)*float64(quantity)/float64(i.Quantity)*100) / 100
+}
+
+// SoldBy reports whether the item was sold by the pharmacy
+func (i *OrderItem) SoldBy(pharmacyID uuid.UUID) bool {
+	if i.PharmacyID != uuid.Nil {
+		return i.PharmacyID == pharmacyID
+	}
+	return i.Medicine != nil && i.Medicine.PharmacyID == pharmacyID
+}
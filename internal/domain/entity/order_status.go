@@ -0,0 +1,96 @@
+package entity
+
+import (
+	"github.com/google/uuid"
+)
+
+// Order statuses
+const (
+	OrderStatusPending    = "pending"
+	OrderStatusConfirmed  = "confirmed"
+	OrderStatusProcessing = "processing"
+	OrderStatusShipped    = "shipped"
+	OrderStatusDelivered  = "delivered"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusRefunded   = "refunded"
+
+	// OrderStatusCancellationPending holds an order whose cancellation was
+	// asked for until it is refunded or restocked. Cancelling it again
+	// resumes the cancellation.
+	OrderStatusCancellationPending = "cancellation_pending"
+)
+
+// OrderActor is the kind of party moving an order between statuses
+type OrderActor string
+
+const (
+	OrderActorCustomer OrderActor = "customer"
+	OrderActorPharmacy OrderActor = "pharmacy"
+	OrderActorAdmin    OrderActor = "admin"
+	OrderActorDelivery OrderActor = "delivery_partner"
+	OrderActorSystem   OrderActor = "system" // payments, refunds and background jobs
+)
+
+// orderTransitions lists, for every status, the statuses it may move to and
+// the actors allowed to make that move. Customers and pharmacies cancel
+// through the cancellation flow, which refunds or restocks the order while it
+// is cancellation_pending.
+var orderTransitions = map[string]map[string][]OrderActor{
+	OrderStatusPending: {
+		OrderStatusConfirmed:           {OrderActorPharmacy, OrderActorAdmin, OrderActorSystem},
+		OrderStatusCancellationPending: {OrderActorCustomer, OrderActorPharmacy, OrderActorSystem},
+	},
+	OrderStatusConfirmed: {
+		OrderStatusProcessing:          {OrderActorPharmacy, OrderActorAdmin},
+		OrderStatusCancellationPending: {OrderActorCustomer, OrderActorPharmacy, OrderActorSystem},
+		OrderStatusRefunded:            {OrderActorSystem},
+	},
+	OrderStatusProcessing: {
+		OrderStatusShipped:             {OrderActorPharmacy, OrderActorAdmin, OrderActorDelivery},
+		OrderStatusCancellationPending: {OrderActorPharmacy, OrderActorSystem},
+		OrderStatusRefunded:            {OrderActorSystem},
+	},
+	OrderStatusCancellationPending: {
+		OrderStatusCancelled: {OrderActorCustomer, OrderActorPharmacy, OrderActorSystem},
+	},
+	OrderStatusShipped: {
+		OrderStatusDelivered: {OrderActorPharmacy, OrderActorAdmin, OrderActorDelivery, OrderActorSystem},
+		OrderStatusRefunded:  {OrderActorSystem},
+	},
+	OrderStatusDelivered: {
+		OrderStatusRefunded: {OrderActorSystem},
+	},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+// IsValidOrderStatus reports whether status is a known order status
+func IsValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransitionOrder reports whether actor may move an order from one status to another
+func CanTransitionOrder(from, to string, actor OrderActor) bool {
+	for _, allowed := range orderTransitions[from][to] {
+		if allowed == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusHistory records a single status change of an order
+type OrderStatusHistory struct {
+	BaseModel
+	OrderID    uuid.UUID  `json:"orderId" gorm:"type:uuid;not null;index"`
+	FromStatus string     `json:"fromStatus" gorm:"type:varchar(20)"` // empty for the status the order was placed with
+	ToStatus   string     `json:"toStatus" gorm:"type:varchar(20);not null"`
+	ActorID    *uuid.UUID `json:"actorId,omitempty" gorm:"type:uuid"`
+	ActorRole  OrderActor `json:"actorRole" gorm:"type:varchar(20);not null"`
+	Note       string     `json:"note,omitempty" gorm:"type:text"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_histories"
+}
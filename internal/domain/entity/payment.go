@@ -1,6 +1,12 @@
 package entity
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -27,13 +33,17 @@ type Payment struct {
 	Quantity   *int       `json:"quantity" gorm:"not null"`
 
 	// Razorpay details
-	RazorpayOrderID   string `json:"razorpayOrderId" gorm:"uniqueIndex"`
+	RazorpayOrderID   string `json:"razorpayOrderId"` // unique when set, see CreateIndexes; empty for cash
 	RazorpayPaymentID string `json:"razorpayPaymentId" gorm:"index"`
 	RazorpaySignature string `json:"razorpaySignature"`
 
 	// Payment status
-	Status        string `json:"status" gorm:"default:'pending'"` // pending, success, failed, refunded
-	PaymentMethod string `json:"paymentMethod"`                   // card, netbanking, wallet, upi
+	Status        string `json:"status" gorm:"default:'pending'"` // pending, success, failed, partially_refunded, refunded
+	PaymentMethod string `json:"paymentMethod"`                   // card, netbanking, wallet, upi, cash
+
+	// Cash on delivery collection
+	CollectedAt *time.Time `json:"collectedAt,omitempty"`
+	CollectedBy *uuid.UUID `json:"collectedBy,omitempty" gorm:"type:uuid"`
 
 	// Additional info
 	Description   string `json:"description"`
@@ -42,6 +52,80 @@ type Payment struct {
 
 	// Delivery address (if needed)
 	DeliveryAddress string `json:"deliveryAddress"`
+
+	// Priced quote the payment was raised for; the order is created from it
+	LineItems PaymentLineItems `json:"lineItems,omitempty" gorm:"type:jsonb"`
+
+	// Coupon applied to the quote
+	CouponCode     string  `json:"couponCode,omitempty" gorm:"type:varchar(40)"`
+	DiscountAmount float64 `json:"discountAmount" gorm:"type:decimal(10,2);default:0"`
+
+	// Prescription supplied for prescription-only medicines in the quote
+	PrescriptionID *uuid.UUID `json:"prescriptionId,omitempty" gorm:"type:uuid"`
+}
+
+// PaymentLineItem is one priced line of the quote a payment was raised for
+type PaymentLineItem struct {
+	MedicineID uuid.UUID `json:"medicineId"`
+	PharmacyID uuid.UUID `json:"pharmacyId"`
+	Name       string    `json:"name"`
+	Quantity   int       `json:"quantity"`
+	UnitPrice  float64   `json:"unitPrice"`
+	Subtotal   float64   `json:"subtotal"`
+	Discount   float64   `json:"discount,omitempty"` // coupon discount on this line
+	HSNCode    string    `json:"hsnCode,omitempty"`
+	GSTRate    float64   `json:"gstRate,omitempty"`
+
+	PrescriptionRequired bool `json:"prescriptionRequired,omitempty"`
+	PrescriptionVerified bool `json:"prescriptionVerified,omitempty"` // prescribed in the e-prescription checked out with
+
+	PrescriptionItemID *uuid.UUID `json:"prescriptionItemId,omitempty"` // e-prescription item the line is dispensed against
+}
+
+// PaymentLineItems is stored as a jsonb column
+type PaymentLineItems []PaymentLineItem
+
+func (l PaymentLineItems) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *PaymentLineItems) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for PaymentLineItems")
+	}
+	return json.Unmarshal(data, l)
+}
+
+// Total returns the amount payable: the sum of all line subtotals less discounts
+func (l PaymentLineItems) Total() float64 {
+	var total float64
+	for _, item := range l {
+		total += item.Subtotal - item.Discount
+	}
+	return math.Round(total*100) / 100
+}
+
+// Discount returns the sum of all line discounts
+func (l PaymentLineItems) Discount() float64 {
+	var discount float64
+	for _, item := range l {
+		discount += item.Discount
+	}
+	return math.Round(discount*100) / 100
 }
 
 func (p *Payment) BeforeCreate(tx *gorm.DB) error {
@@ -54,3 +138,31 @@ func (p *Payment) BeforeCreate(tx *gorm.DB) error {
 func (Payment) TableName() string {
 	return "payments"
 }
+
+// IsSettled reports whether the payment was captured, including when part or
+// all of it was refunded since
+func (p *Payment) IsSettled() bool {
+	switch p.Status {
+	case "success", "partially_refunded", "refunded":
+		return true
+	}
+	return false
+}
+
+// PaymentWebhookEvent records every gateway webhook delivery by its event ID so
+// that a repeated delivery of the same event is processed only once.
+type PaymentWebhookEvent struct {
+	BaseModel
+
+	EventID   string `json:"eventId" gorm:"type:varchar(100);uniqueIndex;not null"`
+	EventType string `json:"eventType" gorm:"type:varchar(100);index;not null"`
+	Payload   string `json:"payload" gorm:"type:jsonb"`
+
+	Status      string     `json:"status" gorm:"type:varchar(20);default:'received'"` // received, processed, failed
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
+
+func (PaymentWebhookEvent) TableName() string {
+	return "payment_webhook_events"
+}
@@ -16,6 +16,7 @@ type Pharmacy struct {
 	Email         *string `gorm:"type:varchar(100);uniqueIndex" json:"email,omitempty"`
 	PhoneNumber   string  `gorm:"type:varchar(20);not null" json:"phoneNumber"`
 	LicenseNumber string  `json:"licenseNumber,omitempty"`
+	GSTIN         string  `gorm:"type:varchar(15)" json:"gstin,omitempty"`
 
 	// Location fields
 	Address    string  `gorm:"type:varchar(500)" json:"address"`
@@ -34,3 +35,8 @@ type Pharmacy struct {
 	// Relations
 	Medicines []Medicine `gorm:"foreignKey:PharmacyID" json:"medicines,omitempty"`
 }
+
+// HasCoordinates reports whether the pharmacy has been geocoded
+func (p *Pharmacy) HasCoordinates() bool {
+	return p.Latitude != 0 || p.Longitude != 0
+}
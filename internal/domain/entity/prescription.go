@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"github.com/google/uuid"
+)
+
+// Prescription sources
+const (
+	PrescriptionSourceUpload       = "upload"       // scan or photo uploaded by the patient
+	PrescriptionSourceConsultation = "consultation" // op chart of one of the patient's consultations
+)
+
+// Prescription review statuses, kept per order as each pharmacy reviews the
+// prescription for its own items
+const (
+	PrescriptionStatusPending  = "pending"
+	PrescriptionStatusApproved = "approved"
+	PrescriptionStatusRejected = "rejected"
+)
+
+// Prescription is a prescription a patient supplies when buying
+// prescription-only medicines
+type Prescription struct {
+	BaseModel
+	UserID uuid.UUID `json:"userId" gorm:"type:uuid;not null;index"`
+	Source string    `json:"source" gorm:"type:varchar(20);not null"`
+
+	// Uploaded file, kept in the document store
+	FileName    string `json:"fileName,omitempty" gorm:"type:varchar(255)"`
+	ContentType string `json:"contentType,omitempty" gorm:"type:varchar(100)"`
+	FileSize    int64  `json:"fileSize,omitempty"`
+	FilePath    string `json:"-" gorm:"type:varchar(255)"`
+
+	// Consultation the prescription was written in
+	OpChartID *uuid.UUID `json:"opChartId,omitempty" gorm:"type:uuid;index"`
+	OpChart   *OpChart   `json:"opChart,omitempty" gorm:"foreignKey:OpChartID"`
+}
+
+func (Prescription) TableName() string {
+	return "prescriptions"
+}
+
+// HasFile reports whether the prescription is an uploaded file
+func (p *Prescription) HasFile() bool {
+	return p.FilePath != ""
+}
+
+// AwaitingPrescription reports whether the order has prescription-only items
+// whose prescription has not been approved yet
+func (o *Order) AwaitingPrescription() bool {
+	return o.PrescriptionStatus != "" && o.PrescriptionStatus != PrescriptionStatusApproved
+}
+
+// HeldForPrescription reports whether the order may not move to status until
+// its prescription is approved. Orders can be confirmed and cancelled, but
+// not prepared or handed over.
+func (o *Order) HeldForPrescription(status string) bool {
+	switch status {
+	case OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered:
+		return o.AwaitingPrescription()
+	}
+	return false
+}
+
+// RequiresPrescription reports whether any medicine in the cart is prescription-only
+func (c *Cart) RequiresPrescription() bool {
+	for i := range c.Medicines {
+		if c.Medicines[i].Medicine.PrescriptionRequired {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresPrescription reports whether any line is a prescription-only medicine
+func (l PaymentLineItems) RequiresPrescription() bool {
+	for _, line := range l {
+		if line.PrescriptionRequired {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reconciliation mismatch types
+const (
+	MismatchMissingLocally   = "missing_locally"    // captured on the gateway, no payment row
+	MismatchMissingOnGateway = "missing_on_gateway" // successful locally, nothing captured on the gateway
+	MismatchStatus           = "status_mismatch"    // captured on the gateway, not successful locally
+	MismatchAmount           = "amount_mismatch"    // captured amount differs from the payment amount
+)
+
+// ReconciliationReport compares one day of payments against the gateway
+type ReconciliationReport struct {
+	BaseModel
+	ReportDate    string    `json:"reportDate" gorm:"type:varchar(10);uniqueIndex;not null"` // YYYY-MM-DD
+	PeriodStart   time.Time `json:"periodStart" gorm:"not null"`
+	PeriodEnd     time.Time `json:"periodEnd" gorm:"not null"`
+	GatewayCount  int       `json:"gatewayCount"`  // payments captured on the gateway
+	LocalCount    int       `json:"localCount"`    // gateway payments recorded locally
+	MismatchCount int       `json:"mismatchCount"` // number of Mismatches
+
+	Mismatches []ReconciliationMismatch `json:"mismatches,omitempty" gorm:"foreignKey:ReportID"`
+}
+
+func (ReconciliationReport) TableName() string {
+	return "reconciliation_reports"
+}
+
+// ReconciliationMismatch is one difference found while reconciling a day.
+// Amounts are in rupees.
+type ReconciliationMismatch struct {
+	BaseModel
+	ReportID          uuid.UUID `json:"reportId" gorm:"type:uuid;not null;index"`
+	Type              string    `json:"type" gorm:"type:varchar(30);not null"`
+	PaymentOrderID    string    `json:"paymentOrderId,omitempty"` // Payment.OrderID
+	RazorpayOrderID   string    `json:"razorpayOrderId,omitempty"`
+	RazorpayPaymentID string    `json:"razorpayPaymentId,omitempty"`
+	LocalStatus       string    `json:"localStatus,omitempty"`
+	GatewayStatus     string    `json:"gatewayStatus,omitempty"`
+	LocalAmount       float64   `json:"localAmount" gorm:"type:decimal(10,2)"`
+	GatewayAmount     float64   `json:"gatewayAmount" gorm:"type:decimal(10,2)"`
+}
+
+func (ReconciliationMismatch) TableName() string {
+	return "reconciliation_mismatches"
+}
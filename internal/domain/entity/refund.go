@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refund statuses
+const (
+	RefundStatusInitiated = "initiated" // units set aside, gateway not yet asked
+	RefundStatusPending   = "pending"
+	RefundStatusProcessed = "processed"
+	RefundStatusFailed    = "failed"
+)
+
+// Refund represents money returned against a captured payment, either for a
+// whole order or for some of its items
+type Refund struct {
+	BaseModel
+	PaymentID  uuid.UUID  `json:"paymentId" gorm:"type:uuid;not null;index"`
+	Payment    *Payment   `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
+	OrderID    uuid.UUID  `json:"orderId" gorm:"type:uuid;not null;index"`
+	Order      *Order     `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	PharmacyID *uuid.UUID `json:"pharmacyId,omitempty" gorm:"type:uuid;index"` // set when a pharmacy issued the refund
+
+	Amount    float64 `json:"amount" gorm:"type:decimal(10,2);not null"`
+	Currency  string  `json:"currency" gorm:"default:'INR'"`
+	IsPartial bool    `json:"isPartial" gorm:"default:false"`
+	Reason    string  `json:"reason" gorm:"type:text"`
+
+	// Gateway details
+	RazorpayRefundID string     `json:"razorpayRefundId" gorm:"type:varchar(100);index"`
+	Status           string     `json:"status" gorm:"type:varchar(20);default:'pending';index"` // initiated, pending, processed, failed
+	FailureReason    string     `json:"failureReason,omitempty" gorm:"type:text"`
+	ProcessedAt      *time.Time `json:"processedAt,omitempty"`
+
+	InitiatedBy uuid.UUID    `json:"initiatedBy" gorm:"type:uuid;not null"`
+	Items       []RefundItem `json:"items" gorm:"foreignKey:RefundID"`
+}
+
+func (Refund) TableName() string {
+	return "refunds"
+}
+
+// RefundItem records how many units of an order item a refund covers
+type RefundItem struct {
+	BaseModel
+	RefundID    uuid.UUID  `json:"refundId" gorm:"type:uuid;not null;index"`
+	OrderItemID uuid.UUID  `json:"orderItemId" gorm:"type:uuid;not null;index"`
+	OrderItem   *OrderItem `json:"orderItem,omitempty" gorm:"foreignKey:OrderItemID"`
+	MedicineID  uuid.UUID  `json:"medicineId" gorm:"type:uuid;not null"`
+	Quantity    int        `json:"quantity" gorm:"not null"`
+	Amount      float64    `json:"amount" gorm:"type:decimal(10,2);not null"`
+}
+
+func (RefundItem) TableName() string {
+	return "refund_items"
+}
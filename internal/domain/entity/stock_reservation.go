@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StockReservation holds units of a medicine for a checkout until its payment
+// is verified, fails or the reservation expires
+type StockReservation struct {
+	BaseModel
+	PaymentOrderID string     `json:"paymentOrderId" gorm:"type:varchar(50);not null;index"` // Payment.OrderID the units are held for
+	MedicineID     uuid.UUID  `json:"medicineId" gorm:"type:uuid;not null;index"`
+	Medicine       *Medicine  `json:"medicine,omitempty" gorm:"foreignKey:MedicineID"`
+	Quantity       int        `json:"quantity" gorm:"not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);default:'active';index"` // active, committed, released
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null;index"`
+	CommittedAt    *time.Time `json:"committedAt,omitempty"`
+	ReleasedAt     *time.Time `json:"releasedAt,omitempty"`
+}
+
+func (StockReservation) TableName() string {
+	return "stock_reservations"
+}
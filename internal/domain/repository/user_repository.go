@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
@@ -42,16 +43,65 @@ type SecurityEventRepository interface {
 	SendPasswordResetEmail(ctx context.Context, email string, resetoken string) error
 }
 type MedicineRepository interface {
-	GetMedicines(ctx context.Context, searchQuery string) ([]*entity.Medicine, error)
+	// GetMedicines returns a page of the active, unexpired, in-stock medicines
+	// of active pharmacies matching the search, best match first.
+	GetMedicines(ctx context.Context, req types.MedicineRequest) ([]*entity.Medicine, int64, error)
+	// GetMedicineFacets counts the medicines GetMedicines matches, ignoring
+	// its manufacturer, prescription and price filters.
+	GetMedicineFacets(ctx context.Context, req types.MedicineRequest) (*types.MedicineSearchFacets, error)
 	AddMedicine(ctx context.Context, userId uuid.UUID, medicine *entity.Medicine) (*entity.Medicine, error)
 	ListMedicines(ctx context.Context, filters types.MedicineFilters) ([]*entity.Medicine, int64, error)
 	GetMedicineByID(ctx context.Context, medicineID uuid.UUID) (*entity.Medicine, error)
 	DeleteMedicine(ctx context.Context, medicineID uuid.UUID) error
 	UpdateMedicine(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, updatedMedicine *entity.Medicine) error
+	// FindInStock returns active, unexpired medicines of active pharmacies
+	// whose name or composition contains the search text, with their pharmacy.
+	FindInStock(ctx context.Context, search string, limit int) ([]*entity.Medicine, error)
+	// CompareListings finds active, unexpired medicines of active pharmacies
+	// whose name or composition, or whose master drug's name, contains the
+	// search text, and groups those that are the same medicine. It returns a
+	// page of groups, best offer first, with their listings, pharmacy and
+	// drug loaded, and the number of groups. Distances are measured from
+	// origin when it is set.
+	CompareListings(ctx context.Context, req types.CompareMedicinesRequest, origin *entity.GeoLocation) ([]types.ListingGroup, int64, error)
+	// FindSubstitutes returns in-stock listings of active pharmacies with the
+	// medicine's composition key that cost less, cheapest first.
+	FindSubstitutes(ctx context.Context, medicine *entity.Medicine, limit int) ([]*entity.Medicine, error)
+	// FindNearby returns active, unexpired medicines matching the search at
+	// active pharmacies within the radius of origin, nearest then cheapest
+	// first, with the distance to their pharmacy.
+	FindNearby(ctx context.Context, origin entity.GeoLocation, req types.NearbyMedicinesRequest) ([]types.NearbyMedicine, int64, error)
+	// SuggestNames returns the distinct names of medicines GetMedicines can
+	// find that start with, or have a word starting with, the prefix.
+	SuggestNames(ctx context.Context, prefix string, limit int) ([]string, error)
+	// ListLowStock returns active medicines at or below their reorder level,
+	// with their pharmacy; a nil pharmacyID covers every pharmacy.
+	ListLowStock(ctx context.Context, pharmacyID *uuid.UUID) ([]*entity.Medicine, error)
+	// ImportCatalogue upserts the rows into the pharmacy's catalogue by
+	// medicine name and batch number in one transaction, counting what was
+	// created and updated. A dry run is rolled back, as is an import with
+	// rows that clear the prescription requirement of a medicine linked to a
+	// prescription-only drug; those rows are added to the result's errors.
+	ImportCatalogue(ctx context.Context, pharmacyID uuid.UUID, rows []types.CatalogueRow, result *types.CatalogueImportResult) error
+	// ListCatalogue returns the pharmacy's medicines by name with their batches.
+	ListCatalogue(ctx context.Context, pharmacyID uuid.UUID) ([]*entity.Medicine, error)
+}
+type PharmacyRepository interface {
+	// FindNearby returns active pharmacies within the radius of origin,
+	// nearest first, with their distance.
+	FindNearby(ctx context.Context, origin entity.GeoLocation, req types.NearbyPharmaciesRequest) ([]types.NearbyPharmacy, int64, error)
+	// ListUserIDs returns the users who run the given pharmacies.
+	ListUserIDs(ctx context.Context, pharmacyIDs []uuid.UUID) ([]uuid.UUID, error)
 }
 type DoctorRepository interface {
 	GetDoctors(ctx context.Context, searchQuery string) ([]*entity.Doctor, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*entity.Doctor, error)
+	// SuggestDoctors returns active doctors whose name starts with, or has a
+	// word starting with, the prefix.
+	SuggestDoctors(ctx context.Context, prefix string, limit int) ([]types.DoctorSuggestion, error)
+	// SuggestSpecializations returns the distinct specializations of active
+	// doctors that start with, or have a word starting with, the prefix.
+	SuggestSpecializations(ctx context.Context, prefix string, limit int) ([]string, error)
 }
 type OrderRepository interface {
 	//User Cart Managment
@@ -59,31 +109,215 @@ type OrderRepository interface {
 	GetCartByUserID(ctx context.Context, userID uuid.UUID) (*entity.Cart, error)
 	UpdateCart(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, quantity int) (*entity.Cart, error)
 	GetCartByID(ctx context.Context, cartID uuid.UUID) (*entity.Cart, error)
+	// FillCartFromPrescription adds the medicines picked for an e-prescription
+	// to the user's cart and links the cart to the prescription.
+	FillCartFromPrescription(ctx context.Context, userID uuid.UUID, prescriptionID uuid.UUID, medicines []entity.CartMedicine) error
 
 	RemoveFromCart(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) error
 	CreateOrderFromCart(ctx context.Context, cart *entity.Cart, paymentID uuid.UUID, deliveryAddress string) (*entity.Order, error)
 	ClearCart(ctx context.Context, userID uuid.UUID) error
 	GetOrderByID(ctx context.Context, orderID uuid.UUID) (*entity.Order, error)
+	GetOrdersByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*entity.Order, error)
 	GetUserOrders(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Order, int64, error)
 	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error
+	// HasActiveDelivery reports whether a delivery of the order is under way.
+	HasActiveDelivery(ctx context.Context, orderID uuid.UUID) (bool, error)
+	// TransitionOrderStatus moves the order from history.FromStatus to history.ToStatus
+	// and records the change. It reports false when the order was not in FromStatus,
+	// or when the pharmacy ships or delivers an order with an active delivery.
+	TransitionOrderStatus(ctx context.Context, history *entity.OrderStatusHistory) (bool, error)
+	GetOrderStatusHistory(ctx context.Context, orderID uuid.UUID) ([]*entity.OrderStatusHistory, error)
+	// CompleteCancellation puts the units of the order that were not refunded
+	// back on the shelf, gives back the e-prescription units it dispensed and
+	// moves it as history describes, in one transaction. It reports false when the order was not in
+	// history.FromStatus and nothing was done.
+	CompleteCancellation(ctx context.Context, history *entity.OrderStatusHistory) (bool, error)
 
 	GetPharmacyByUserID(ctx context.Context, userID uuid.UUID) (*entity.Pharmacy, error)
 	GetTotalRevenue(ctx context.Context, pharmacyID uuid.UUID) (float64, error)
 	GetPharmacyOrders(ctx context.Context, pharmacyID uuid.UUID, filter types.ListPharmacyOrders) ([]*entity.Order, int64, error)
 
 	CreateOrder(ctx context.Context, order *entity.Order) error
+	// CreateCheckout stores a checkout together with its orders and their items.
+	CreateCheckout(ctx context.Context, checkout *entity.Checkout) error
 	CreateOrderItem(ctx context.Context, orderItems *entity.OrderItem) error
 }
 type PaymentRepository interface {
 	Create(ctx context.Context, payment *entity.Payment) error
 	GetByOrderID(ctx context.Context, orderID string) (*entity.Payment, error)
 	GetByRazorpayOrderID(ctx context.Context, razorpayOrderID string) (*entity.Payment, error)
+	GetByRazorpayPaymentID(ctx context.Context, razorpayPaymentID string) (*entity.Payment, error)
 	UpdateStatus(ctx context.Context, orderID string, status string, razorpayPaymentID, razorpaySignature, paymentMethod, failureReason string) error
+	// UpdateStatusFrom only updates the payment when its current status is one of fromStatuses
+	// and reports whether a row was changed.
+	UpdateStatusFrom(ctx context.Context, orderID string, fromStatuses []string, status string, razorpayPaymentID, razorpaySignature, paymentMethod, failureReason string) (bool, error)
+	// CompletePayment marks the payment successful, commits its stock, redeems its coupon and
+	// creates its checkout, if given, in one transaction. It reports false when the payment
+	// was not in one of fromStatuses and nothing was done.
+	CompletePayment(ctx context.Context, orderID string, fromStatuses []string, razorpayPaymentID, razorpaySignature, paymentMethod string, checkout *entity.Checkout) (bool, error)
 	GetUserPayments(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Payment, int64, error)
+	// GetStalePendingPayments returns gateway payments still pending that were created before olderThan.
+	GetStalePendingPayments(ctx context.Context, olderThan time.Time, limit int) ([]*entity.Payment, error)
+	// GetGatewayPaymentsCreatedBetween returns non-cash payments created in [from, to).
+	GetGatewayPaymentsCreatedBetween(ctx context.Context, from, to time.Time) ([]*entity.Payment, error)
+	GetByRazorpayOrderIDs(ctx context.Context, razorpayOrderIDs []string) ([]*entity.Payment, error)
+	// MarkCashCollected records the cash of an order paid on delivery as
+	// collected and reports whether it was still owed. The payment is settled
+	// once none of its open orders owes cash.
+	MarkCashCollected(ctx context.Context, orderID uuid.UUID, collectedBy uuid.UUID) (bool, error)
+
+	//Webhook event log
+	CreateWebhookEvent(ctx context.Context, event *entity.PaymentWebhookEvent) (bool, error)
+	GetWebhookEvent(ctx context.Context, eventID string) (*entity.PaymentWebhookEvent, error)
+	UpdateWebhookEventStatus(ctx context.Context, eventID string, status string, errMsg string) error
 
 	//User Order Management
 
 }
+type CouponRepository interface {
+	Create(ctx context.Context, coupon *entity.Coupon) error
+	Update(ctx context.Context, coupon *entity.Coupon) error
+	GetByID(ctx context.Context, id uuid.UUID) (*entity.Coupon, error)
+	GetByCode(ctx context.Context, code string) (*entity.Coupon, error)
+	List(ctx context.Context, filter types.ListCouponsFilter) ([]*entity.Coupon, int64, error)
+	// CountRedemptions counts the uses of a coupon, reserved or redeemed, that
+	// have not been released. When userID is set only that user's uses count.
+	CountRedemptions(ctx context.Context, couponID uuid.UUID, userID *uuid.UUID) (int64, error)
+	// Reserve records a use of the coupon for a checkout unless that would
+	// exceed its usage limits, and reports whether it was recorded. The
+	// user's earlier reservations of the coupon whose payment failed or whose
+	// checkout expired are released first.
+	Reserve(ctx context.Context, redemption *entity.CouponRedemption) (bool, error)
+	// Redeem confirms the use reserved for a checkout once it is paid. A use
+	// released before the payment came through is only confirmed while the
+	// coupon's limits allow it.
+	Redeem(ctx context.Context, paymentOrderID string) error
+	// Release gives back the use reserved for a checkout that was not paid.
+	Release(ctx context.Context, paymentOrderID string) error
+	SetCartCoupon(ctx context.Context, cartID uuid.UUID, couponID *uuid.UUID) error
+}
+type PrescriptionRepository interface {
+	Create(ctx context.Context, prescription *entity.Prescription) error
+	GetByID(ctx context.Context, id uuid.UUID) (*entity.Prescription, error)
+	GetByOpChartID(ctx context.Context, userID uuid.UUID, opChartID uuid.UUID) (*entity.Prescription, error)
+	ListByUser(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Prescription, int64, error)
+	// ListReviews returns a pharmacy's orders whose prescription has the
+	// filter status, oldest first.
+	ListReviews(ctx context.Context, filter types.ListPrescriptionReviewsFilter) ([]*entity.Order, int64, error)
+	// ReviewOrder records the pharmacy's decision on an order's pending
+	// prescription and reports whether it was still pending.
+	ReviewOrder(ctx context.Context, orderID uuid.UUID, status string, reviewerID uuid.UUID, note string) (bool, error)
+	// ResubmitOrder puts a new prescription up for review on an order whose
+	// prescription has not been approved, and reports whether it was accepted.
+	ResubmitOrder(ctx context.Context, orderID uuid.UUID, prescriptionID uuid.UUID) (bool, error)
+}
+type InvoiceRepository interface {
+	// CreateNumbered gives the invoice the next number of its pharmacy's
+	// financial year and saves it. store runs with the number set, before
+	// the number is committed, so a number is only used by an invoice that
+	// was stored and the series has no gaps.
+	CreateNumbered(ctx context.Context, invoice *entity.Invoice, store func(invoice *entity.Invoice) error) error
+	GetByOrderID(ctx context.Context, orderID uuid.UUID) (*entity.Invoice, error)
+	MarkEmailed(ctx context.Context, invoiceID uuid.UUID, emailedAt time.Time) error
+}
+type RefundRepository interface {
+	// ReserveRefund stores a refund before the gateway is asked for it and marks its units
+	// refunded on the order items. It reports false, storing nothing, when another refund
+	// already took some of those units.
+	ReserveRefund(ctx context.Context, refund *entity.Refund) (bool, error)
+	// CompleteRefund records the gateway refund on a reserved refund and applies it to the
+	// order, the payment and medicine stock in one transaction. It reports whether the order
+	// moved to refunded.
+	CompleteRefund(ctx context.Context, refund *entity.Refund) (bool, error)
+	// ReleaseRefund fails a reserved refund the gateway did not accept and frees its units.
+	ReleaseRefund(ctx context.Context, refund *entity.Refund, failureReason string) error
+	GetByRazorpayRefundID(ctx context.Context, razorpayRefundID string) (*entity.Refund, error)
+	UpdateStatus(ctx context.Context, refundID uuid.UUID, status string, failureReason string) error
+	ListRefunds(ctx context.Context, filter types.ListRefundsFilter) ([]*entity.Refund, int64, error)
+}
+type ReconciliationRepository interface {
+	// SaveReport stores the report, replacing any earlier report for the same date.
+	SaveReport(ctx context.Context, report *entity.ReconciliationReport) error
+	GetReportByDate(ctx context.Context, reportDate string) (*entity.ReconciliationReport, error)
+	ListReports(ctx context.Context, page, limit int) ([]*entity.ReconciliationReport, int64, error)
+}
+type StockReservationRepository interface {
+	// Reserve locks the medicines and holds the requested units until expiresAt.
+	// It returns false without reserving anything when any medicine is short.
+	Reserve(ctx context.Context, paymentOrderID string, items []entity.PaymentLineItem, expiresAt time.Time) (bool, error)
+	// Commit turns the reservations of a payment into stock decrements, picking
+	// units from the batches that expire first.
+	Commit(ctx context.Context, paymentOrderID string) error
+	// Release frees the active reservations of a payment.
+	Release(ctx context.Context, paymentOrderID string) error
+	// ReleaseExpired frees every active reservation past its expiry.
+	ReleaseExpired(ctx context.Context, now time.Time) (int64, error)
+}
+type MedicineBatchRepository interface {
+	// ListBatches returns the batches of a medicine in first-expiry-first-out order.
+	ListBatches(ctx context.Context, medicineID uuid.UUID) ([]*entity.MedicineBatch, error)
+	GetBatchByID(ctx context.Context, batchID uuid.UUID) (*entity.MedicineBatch, error)
+	GetBatchByNumber(ctx context.Context, medicineID uuid.UUID, batchNumber string) (*entity.MedicineBatch, error)
+	// CreateBatch adds a batch and refreshes the medicine's stock.
+	CreateBatch(ctx context.Context, batch *entity.MedicineBatch) error
+	// UpdateBatch saves the quantity, expiry and cost of a batch and refreshes
+	// the medicine's stock.
+	UpdateBatch(ctx context.Context, batch *entity.MedicineBatch) error
+	// SyncStock recomputes the medicine's stock from its batches.
+	SyncStock(ctx context.Context, medicineID uuid.UUID) error
+	// ListAllocations returns the order items a batch was sold in.
+	ListAllocations(ctx context.Context, batchID uuid.UUID) ([]*entity.OrderItemBatch, error)
+	// ListExpiringBatches returns the batches of active medicines that still
+	// hold units and expire before the given time, soonest first, with their
+	// medicine and pharmacy; a nil pharmacyID covers every pharmacy.
+	ListExpiringBatches(ctx context.Context, pharmacyID *uuid.UUID, before time.Time) ([]*entity.MedicineBatch, error)
+	// SyncExpired refreshes the stock of medicines whose next batch has
+	// expired by now and returns how many were refreshed.
+	SyncExpired(ctx context.Context, now time.Time) (int64, error)
+}
+type DrugRepository interface {
+	Create(ctx context.Context, drug *entity.Drug) error
+	// Update saves the drug, marking the medicines linked to it prescription
+	// only when its schedule requires a prescription.
+	Update(ctx context.Context, drug *entity.Drug) error
+	GetByID(ctx context.Context, drugID uuid.UUID) (*entity.Drug, error)
+	// GetByProduct finds the drug with the same names, strength and form,
+	// ignoring case.
+	GetByProduct(ctx context.Context, drug *entity.Drug) (*entity.Drug, error)
+	List(ctx context.Context, filter types.ListDrugsFilter) ([]*entity.Drug, int64, error)
+	// ListOffers returns the active, unexpired medicines of active pharmacies
+	// linked to the drugs, cheapest first, with their pharmacy.
+	ListOffers(ctx context.Context, drugIDs []uuid.UUID) ([]*entity.Medicine, error)
+	// SuggestGenericNames returns the distinct generic names of active drugs
+	// that start with, or have a word starting with, the prefix.
+	SuggestGenericNames(ctx context.Context, prefix string, limit int) ([]string, error)
+	// LinkMedicine points a medicine at a drug, or clears the link when drugID
+	// is nil, marking it prescription only when requiresPrescription is set.
+	LinkMedicine(ctx context.Context, medicineID uuid.UUID, drugID *uuid.UUID, requiresPrescription bool) error
+}
+type DeliveryRepository interface {
+	// Assign creates the delivery, cancelling the order's active one if any.
+	// It reports false when the order is no longer being prepared or shipped.
+	Assign(ctx context.Context, delivery *entity.Delivery) (bool, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*entity.Delivery, error)
+	// GetLatestForOrder returns the order's most recent delivery that was not cancelled.
+	GetLatestForOrder(ctx context.Context, orderID uuid.UUID) (*entity.Delivery, error)
+	// ListForPartner returns the partner's deliveries with their order and
+	// pharmacy, and only the name and phone number of the patient.
+	ListForPartner(ctx context.Context, partnerID uuid.UUID, filter types.ListDeliveriesRequest) ([]*entity.Delivery, int64, error)
+	// Transition saves the status, timestamps and failure reason of a delivery
+	// still in fromStatus and, when history is set, moves its order along in
+	// the same transaction. It reports false when either had moved on.
+	Transition(ctx context.Context, delivery *entity.Delivery, fromStatus string, history *entity.OrderStatusHistory) (bool, error)
+	// ClaimOTPAttempt counts an OTP entered for the delivery, reporting false
+	// without counting it when maxAttempts were entered already.
+	ClaimOTPAttempt(ctx context.Context, deliveryID uuid.UUID, maxAttempts int) (bool, error)
+	// RecordPing stores a position and makes it the delivery's last known one
+	// unless a later one was already recorded.
+	RecordPing(ctx context.Context, ping *entity.DeliveryPing) error
+	// ListRecentPings returns the latest positions of a delivery, oldest first.
+	ListRecentPings(ctx context.Context, deliveryID uuid.UUID, limit int) ([]*entity.DeliveryPing, error)
+}
 type AppoinmentRepository interface {
 	BookAppointment(ctx context.Context, appointment *entity.Appointment) (*entity.Appointment, error)
 	IsSlotBooked(ctx context.Context, doctorID uuid.UUID, appointmentDate string, appointmentTime string) (bool, error)
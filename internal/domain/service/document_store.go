@@ -0,0 +1,11 @@
+// internal/domain/service/document_store.go
+package service
+
+import "context"
+
+// DocumentStore keeps generated documents such as invoices. Paths are
+// relative, slash separated keys.
+type DocumentStore interface {
+	Save(ctx context.Context, path string, content []byte) error
+	Load(ctx context.Context, path string) ([]byte, error)
+}
@@ -0,0 +1,32 @@
+// internal/domain/service/event_bus.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is a change pushed to one user's live stream
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	UserID    uuid.UUID       `json:"userId"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// EventBus carries events from where a change happens to the streams of the
+// users it concerns. Implementations shared between API replicas deliver an
+// event published on one replica to subscribers on every replica.
+type EventBus interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe returns the events published for userID until ctx is done,
+	// when the channel is closed. Events are not replayed; a subscriber too
+	// slow to keep up misses events rather than holding up others.
+	Subscribe(ctx context.Context, userID uuid.UUID) <-chan Event
+	// Close stops delivering events and releases the bus's connections
+	Close() error
+}
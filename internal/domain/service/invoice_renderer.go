@@ -0,0 +1,18 @@
+// internal/domain/service/invoice_renderer.go
+package service
+
+import "github.com/skryfon/collex/internal/domain/entity"
+
+// InvoiceDocument is everything printed on a tax invoice
+type InvoiceDocument struct {
+	Invoice  *entity.Invoice
+	Order    *entity.Order
+	Pharmacy *entity.Pharmacy
+	Customer *entity.User
+	Lines    []entity.InvoiceLine
+}
+
+// InvoiceRenderer renders tax invoices as PDF
+type InvoiceRenderer interface {
+	Render(doc *InvoiceDocument) ([]byte, error)
+}
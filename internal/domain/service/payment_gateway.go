@@ -0,0 +1,63 @@
+// internal/domain/service/payment_gateway.go
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// GatewayOrder is an order created on the payment gateway. Amounts are in the
+// smallest currency unit (paise).
+type GatewayOrder struct {
+	ID       string
+	Amount   int64
+	Currency string
+	Receipt  string
+}
+
+// GatewayPayment is a payment attempt as reported by the gateway
+type GatewayPayment struct {
+	ID        string
+	OrderID   string
+	Amount    int64
+	Currency  string
+	Status    string // created, authorized, captured, refunded, failed
+	Method    string
+	CreatedAt time.Time
+}
+
+// GatewayRefund is a refund as reported by the gateway
+type GatewayRefund struct {
+	ID        string
+	PaymentID string
+	Amount    int64
+	Status    string // pending, processed, failed
+}
+
+// PaymentGateway defines the operations checkout and refunds need from a
+// payment provider
+type PaymentGateway interface {
+	// KeyID returns the public key the client checkout is opened with
+	KeyID() string
+
+	// CreateOrder creates an order the customer can pay against
+	CreateOrder(ctx context.Context, amount int64, currency, receipt string, notes map[string]interface{}) (*GatewayOrder, error)
+
+	// FetchPayment gets a payment attempt by its gateway ID
+	FetchPayment(ctx context.Context, paymentID string) (*GatewayPayment, error)
+
+	// FetchOrderPayments lists every payment attempt made against an order
+	FetchOrderPayments(ctx context.Context, orderID string) ([]*GatewayPayment, error)
+
+	// ListPayments lists payment attempts created in [from, to)
+	ListPayments(ctx context.Context, from, to time.Time) ([]*GatewayPayment, error)
+
+	// Refund returns amount of a captured payment to the customer
+	Refund(ctx context.Context, paymentID string, amount int64, notes map[string]interface{}) (*GatewayRefund, error)
+
+	// VerifyPaymentSignature checks the signature the checkout returned for a payment
+	VerifyPaymentSignature(orderID, paymentID, signature string) bool
+
+	// VerifyWebhookSignature checks the signature of a webhook body
+	VerifyWebhookSignature(body []byte, signature string) bool
+}
@@ -0,0 +1,27 @@
+// internal/domain/service/spreadsheet_codec.go
+package service
+
+import (
+	"errors"
+	"io"
+)
+
+// Spreadsheet formats understood by SpreadsheetCodec
+const (
+	SpreadsheetCSV  = "csv"
+	SpreadsheetXLSX = "xlsx"
+)
+
+var (
+	ErrUnsupportedSpreadsheet = errors.New("unsupported spreadsheet format")
+	ErrSpreadsheetTooLarge    = errors.New("spreadsheet is too large")
+)
+
+// SpreadsheetCodec reads and writes tables of text cells. Only the first
+// sheet of a workbook is used; the first row is usually the header.
+type SpreadsheetCodec interface {
+	// Decode reads the table, stopping with ErrSpreadsheetTooLarge once it
+	// holds more than maxRows rows that are not blank
+	Decode(format string, r io.Reader, maxRows int) ([][]string, error)
+	Encode(format string, rows [][]string) ([]byte, error)
+}
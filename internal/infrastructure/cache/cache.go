@@ -94,8 +94,9 @@ func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
 		return nil, fmt.Errorf("key not found: %s", key)
 	}
 
+	// Expired items are left for DeleteExpired, as the map cannot be
+	// written under the read lock
 	if time.Now().After(item.expiration) {
-		delete(c.data, key)
 		return nil, fmt.Errorf("key expired: %s", key)
 	}
 
@@ -149,12 +150,7 @@ func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
 		return false, nil
 	}
 
-	if time.Now().After(item.expiration) {
-		delete(c.data, key)
-		return false, nil
-	}
-
-	return true, nil
+	return !time.Now().After(item.expiration), nil
 }
 
 // Flush clears all keys from memory cache
@@ -166,6 +162,20 @@ func (c *MemoryCache) Flush(ctx context.Context) error {
 	return nil
 }
 
+// DeleteExpired removes the expired keys from memory cache
+func (c *MemoryCache) DeleteExpired(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, item := range c.data {
+		if now.After(item.expiration) {
+			delete(c.data, key)
+		}
+	}
+	return nil
+}
+
 // CacheKey generates a consistent cache key
 func CacheKey(prefix string, parts ...interface{}) string {
 	key := prefix
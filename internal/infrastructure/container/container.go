@@ -2,11 +2,20 @@
 package container
 
 import (
+	"time"
+
 	"github.com/skryfon/collex/internal/domain/repository"
 	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/internal/infrastructure/cache"
 	"github.com/skryfon/collex/internal/infrastructure/database"
+	"github.com/skryfon/collex/internal/infrastructure/events"
+	"github.com/skryfon/collex/internal/infrastructure/invoice"
+	"github.com/skryfon/collex/internal/infrastructure/payment"
 	"github.com/skryfon/collex/internal/infrastructure/persistence"
+	"github.com/skryfon/collex/internal/infrastructure/scheduler"
 	infraService "github.com/skryfon/collex/internal/infrastructure/service"
+	"github.com/skryfon/collex/internal/infrastructure/spreadsheet"
+	"github.com/skryfon/collex/internal/infrastructure/storage"
 	"github.com/skryfon/collex/internal/usecase"
 	"github.com/skryfon/collex/pkg/config"
 )
@@ -18,30 +27,61 @@ type Container struct {
 
 	// Infrastructure Layer
 	Database *database.Database
+	Cache    *cache.MemoryCache
 
 	// Repository Layer (Infrastructure -> Domain)
-	UserRepository       repository.UserRepository
-	AuditLogRepository   repository.AuditLogRepository
-	SecurityRepository   repository.SecurityEventRepository
-	MedicineRepository   repository.MedicineRepository
-	DoctorRepository     repository.DoctorRepository
-	OrderRepository      repository.OrderRepository
-	PaymentRepository    repository.PaymentRepository // ✅ Keep as interface
-	AppoinmentRepository repository.AppoinmentRepository
+	UserRepository         repository.UserRepository
+	AuditLogRepository     repository.AuditLogRepository
+	SecurityRepository     repository.SecurityEventRepository
+	MedicineRepository     repository.MedicineRepository
+	BatchRepository        repository.MedicineBatchRepository
+	DrugRepository         repository.DrugRepository
+	PharmacyRepository     repository.PharmacyRepository
+	DoctorRepository       repository.DoctorRepository
+	OrderRepository        repository.OrderRepository
+	PaymentRepository      repository.PaymentRepository // ✅ Keep as interface
+	RefundRepository       repository.RefundRepository
+	ReservationRepository  repository.StockReservationRepository
+	ReconRepository        repository.ReconciliationRepository
+	InvoiceRepository      repository.InvoiceRepository
+	CouponRepository       repository.CouponRepository
+	PrescriptionRepository repository.PrescriptionRepository
+	DeliveryRepository     repository.DeliveryRepository
+	AppoinmentRepository   repository.AppoinmentRepository
 
 	// Domain Services
-	AuthService  service.AuthService
-	TokenService service.TokenService
-	EmailService service.EmailService
+	AuthService     service.AuthService
+	TokenService    service.TokenService
+	EmailService    service.EmailService
+	PaymentGateway  service.PaymentGateway
+	InvoiceRenderer service.InvoiceRenderer
+	DocumentStore   service.DocumentStore
+	Spreadsheet     service.SpreadsheetCodec
+	EventBus        service.EventBus
 
 	// Use Cases (Application Layer)
-	AuthUseCase       usecase.AuthUseCase
-	UserUseCase       usecase.UserUseCase
-	MedicineUseCase   usecase.MedicineUseCase
-	DoctorUseCase     usecase.DoctorUseCase
-	OrderUsecase      usecase.OrderUseCase
-	PaymentUseCase    *usecase.PaymentUseCase // ✅ Keep as pointer
-	AppoinmentUseCase usecase.AppoinmentUseCase
+	AuthUseCase         usecase.AuthUseCase
+	UserUseCase         usecase.UserUseCase
+	MedicineUseCase     usecase.MedicineUseCase
+	DoctorUseCase       usecase.DoctorUseCase
+	OrderUsecase        usecase.OrderUseCase
+	PaymentUseCase      *usecase.PaymentUseCase // ✅ Keep as pointer
+	AppoinmentUseCase   usecase.AppoinmentUseCase
+	InvoiceUseCase      usecase.InvoiceUseCase
+	CouponUseCase       usecase.CouponUseCase
+	PrescriptionUseCase usecase.PrescriptionUseCase
+	StockAlertUseCase   usecase.StockAlertUseCase
+	CatalogueUseCase    usecase.CatalogueUseCase
+	DrugUseCase         usecase.DrugUseCase
+	ComparisonUseCase   usecase.PriceComparisonUseCase
+	SubstituteUseCase   usecase.SubstituteUseCase
+	NearbyUseCase       usecase.NearbyUseCase
+	SuggestUseCase      usecase.SearchSuggestUseCase
+	DeliveryUseCase     usecase.DeliveryUseCase
+	EventStreamUseCase  usecase.EventStreamUseCase
+
+	// Background jobs
+	Scheduler *scheduler.Scheduler
 }
 
 // NewContainer creates a new dependency injection container
@@ -49,6 +89,7 @@ func NewContainer(config *config.Config, db *database.Database) *Container {
 	container := &Container{
 		Config:   config,
 		Database: db,
+		Cache:    cache.NewMemoryCache(),
 	}
 
 	// Initialize repositories (Infrastructure Layer)
@@ -60,6 +101,9 @@ func NewContainer(config *config.Config, db *database.Database) *Container {
 	// Initialize use cases (Application Layer)
 	container.initUseCases()
 
+	// Register background jobs
+	container.initScheduler()
+
 	return container
 }
 
@@ -69,10 +113,20 @@ func (c *Container) initRepositories() {
 	c.AuditLogRepository = persistence.NewAuditLogRepository(c.Database.DB)
 	c.SecurityRepository = persistence.NewSecurityEventRepository(c.Database.DB)
 	c.MedicineRepository = persistence.NewMedicineRepository(c.Database.DB)
+	c.BatchRepository = persistence.NewMedicineBatchRepository(c.Database.DB)
+	c.DrugRepository = persistence.NewDrugRepository(c.Database.DB)
+	c.PharmacyRepository = persistence.NewPharmacyRepository(c.Database.DB)
 	c.DoctorRepository = persistence.NewDoctorRepository(c.Database.DB)
 	c.OrderRepository = persistence.NewOrderRepository(c.Database.DB)
 	c.PaymentRepository = persistence.NewPaymentRepository(c.Database.DB)       // ✅ Initialize Payment Repository
 	c.AppoinmentRepository = persistence.NewAppoinmentRepository(c.Database.DB) // ✅ ADD THIS LINE
+	c.RefundRepository = persistence.NewRefundRepository(c.Database.DB)
+	c.ReservationRepository = persistence.NewStockReservationRepository(c.Database.DB)
+	c.ReconRepository = persistence.NewReconciliationRepository(c.Database.DB)
+	c.InvoiceRepository = persistence.NewInvoiceRepository(c.Database.DB)
+	c.CouponRepository = persistence.NewCouponRepository(c.Database.DB)
+	c.PrescriptionRepository = persistence.NewPrescriptionRepository(c.Database.DB)
+	c.DeliveryRepository = persistence.NewDeliveryRepository(c.Database.DB)
 
 }
 
@@ -81,10 +135,26 @@ func (c *Container) initDomainServices() {
 	c.TokenService = infraService.NewTokenService(c.Config)
 	c.AuthService = infraService.NewAuthService(c.UserRepository)
 	c.EmailService = infraService.NewEmailService(c.Config)
+	c.PaymentGateway = payment.NewGateway(c.Config)
+	c.InvoiceRenderer = invoice.NewPDFRenderer()
+	c.DocumentStore = storage.NewLocalStore(c.Config.Storage.DocumentPath)
+	c.Spreadsheet = spreadsheet.NewCodec()
+	c.EventBus = events.NewBus(c.Config, c.Database.DB)
 }
 
 // initUseCases initializes all use cases
 func (c *Container) initUseCases() {
+	c.SuggestUseCase = usecase.NewSearchSuggestUseCase(
+		c.MedicineRepository,
+		c.DrugRepository,
+		c.DoctorRepository,
+		c.Cache,
+	)
+	c.EventStreamUseCase = usecase.NewEventStreamUseCase(
+		c.EventBus,
+		c.OrderRepository,
+		c.PharmacyRepository,
+	)
 	c.AuthUseCase = usecase.NewAuthUseCase(
 		c.UserRepository,
 		c.AuditLogRepository,
@@ -97,30 +167,115 @@ func (c *Container) initUseCases() {
 	c.UserUseCase = usecase.NewUserUseCase(
 		c.UserRepository,
 		c.EmailService,
+		c.SuggestUseCase,
 	)
 	c.MedicineUseCase = usecase.NewMedicineUseCase(
 		c.MedicineRepository,
+		c.BatchRepository,
 		c.UserRepository,
+		c.SuggestUseCase,
 	)
 	c.DoctorUseCase = usecase.NewDoctorUseCase(
 		c.DoctorRepository,
 	)
+	c.InvoiceUseCase = usecase.NewInvoiceUseCase(
+		c.InvoiceRepository,
+		c.OrderRepository,
+		c.UserRepository,
+		c.InvoiceRenderer,
+		c.DocumentStore,
+		c.EmailService,
+	)
+	c.SubstituteUseCase = usecase.NewSubstituteUseCase(
+		c.MedicineRepository,
+	)
 	c.OrderUsecase = usecase.NewOrderUseCase(
 		c.OrderRepository,
 		c.MedicineRepository,
+		c.PaymentRepository,
+		c.CouponRepository,
+		c.InvoiceUseCase,
+		c.SubstituteUseCase,
+		c.EventStreamUseCase,
+	)
+	c.CouponUseCase = usecase.NewCouponUseCase(
+		c.CouponRepository,
+		c.OrderRepository,
 	)
 	// ✅ CRITICAL FIX: Don't dereference the pointer
 	c.PaymentUseCase = usecase.NewPaymentUseCase(
 		c.PaymentRepository,
 		c.OrderRepository,
 		c.MedicineRepository,
-		c.Config.Payment.RazorpayKey,
-		c.Config.Payment.RazorpaySecret,
+		c.RefundRepository,
+		c.ReservationRepository,
+		c.ReconRepository,
+		c.CouponRepository,
+		c.PrescriptionRepository,
+		c.PaymentGateway,
+		c.EmailService,
+		c.InvoiceUseCase,
+		c.EventStreamUseCase,
+		c.Config.Payment,
 	)
 	c.AppoinmentUseCase = usecase.NewAppoinmentUseCase(
 		c.AppoinmentRepository,
 		c.DoctorRepository,
+		c.EventStreamUseCase,
+	)
+	c.PrescriptionUseCase = usecase.NewPrescriptionUseCase(
+		c.PrescriptionRepository,
+		c.OrderRepository,
+		c.AppoinmentRepository,
+		c.MedicineRepository,
+		c.CouponRepository,
+		c.UserRepository,
+		c.DocumentStore,
+	)
+	c.StockAlertUseCase = usecase.NewStockAlertUseCase(
+		c.MedicineRepository,
+		c.BatchRepository,
+		c.EmailService,
+		c.Config.Inventory.ExpiryAlertWindow,
 	)
+	c.CatalogueUseCase = usecase.NewCatalogueUseCase(
+		c.MedicineRepository,
+		c.Spreadsheet,
+		c.SuggestUseCase,
+	)
+	c.DrugUseCase = usecase.NewDrugUseCase(
+		c.DrugRepository,
+		c.MedicineRepository,
+		c.SuggestUseCase,
+	)
+	c.ComparisonUseCase = usecase.NewPriceComparisonUseCase(
+		c.MedicineRepository,
+		c.UserRepository,
+	)
+	c.NearbyUseCase = usecase.NewNearbyUseCase(
+		c.PharmacyRepository,
+		c.MedicineRepository,
+		c.UserRepository,
+	)
+	c.DeliveryUseCase = usecase.NewDeliveryUseCase(
+		c.DeliveryRepository,
+		c.OrderRepository,
+		c.UserRepository,
+		c.PaymentRepository,
+		c.InvoiceUseCase,
+		c.EventStreamUseCase,
+	)
+}
+
+// initScheduler registers the background jobs
+func (c *Container) initScheduler() {
+	c.Scheduler = scheduler.NewScheduler()
+	c.Scheduler.Every("release-expired-reservations", time.Minute, c.PaymentUseCase.ReleaseExpiredReservations)
+	c.Scheduler.Every("reconcile-pending-payments", c.Config.Payment.ReconcileInterval, c.PaymentUseCase.ReconcilePendingPayments)
+	c.Scheduler.Every("daily-reconciliation-report", time.Hour, c.PaymentUseCase.GenerateDailyReconciliationReport)
+	c.Scheduler.Every("expire-stock", time.Hour, c.StockAlertUseCase.ExpireStock)
+	c.Scheduler.Every("stock-alert-digest", c.Config.Inventory.AlertInterval, c.StockAlertUseCase.SendStockAlertDigests)
+	c.Scheduler.Every("purge-expired-cache", 10*time.Minute, c.Cache.DeleteExpired)
 }
 
 // GetPaymentUseCase returns the payment use case
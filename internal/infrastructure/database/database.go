@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -160,16 +161,35 @@ func (d *Database) Migrate() error {
 		&entity.DataRetentionPolicy{},
 		&entity.Doctor{},
 		&entity.Pharmacy{},
+		&entity.Drug{},
 		&entity.Medicine{},
+		&entity.MedicineBatch{},
+		&entity.Coupon{},
 		&entity.Cart{},
 		&entity.CartMedicine{},
+		&entity.Prescription{},
 		&entity.Payment{},
+		&entity.PaymentWebhookEvent{},
+		&entity.Checkout{},
 		&entity.Order{},
+		&entity.OrderStatusHistory{},
 		&entity.OrderItem{},
+		&entity.OrderItemBatch{},
+		&entity.Delivery{},
+		&entity.DeliveryPing{},
+		&entity.Refund{},
+		&entity.RefundItem{},
+		&entity.StockReservation{},
+		&entity.CouponRedemption{},
+		&entity.Invoice{},
+		&entity.InvoiceSequence{},
+		&entity.ReconciliationReport{},
+		&entity.ReconciliationMismatch{},
 		&entity.Appointment{},
 		&entity.AppointmentSlot{},
 		&entity.BookedSlot{},
 		&entity.OpChart{},
+		&entity.PrescriptionItem{},
 		//&entity.AppointmentScheduled{},
 	}
 
@@ -178,6 +198,66 @@ func (d *Database) Migrate() error {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// Stock recorded on medicines before batches existed becomes their first batch
+	if err := d.DB.Exec(`
+		INSERT INTO medicine_batches (medicine_id, batch_number, expiry_date, quantity, received_at, created_at, updated_at)
+		SELECT m.id, COALESCE(NULLIF(m.batch_number, ''), ?), m.expiry_date, m.quantity, m.created_at, NOW(), NOW()
+		FROM medicines m
+		WHERE m.quantity > 0 AND m.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM medicine_batches b WHERE b.medicine_id = m.id)`,
+		entity.DefaultBatchNumber).Error; err != nil {
+		return fmt.Errorf("failed to backfill medicine batches: %w", err)
+	}
+
+	// Medicines listed before compositions were parsed, or keyed before keys
+	// held the dosage form and release type, get their key
+	var medicines []entity.Medicine
+	if err := d.DB.Select("id", "name", "content").
+		Where("composition_key IS NULL OR (composition_key <> '' AND composition_key NOT LIKE '%|%')").
+		FindInBatches(&medicines, 500, func(_ *gorm.DB, _ int) error {
+			for i := range medicines {
+				medicines[i].IndexComposition()
+				if err := d.DB.Model(&medicines[i]).
+					UpdateColumn("composition_key", *medicines[i].CompositionKey).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error; err != nil {
+		return fmt.Errorf("failed to backfill composition keys: %w", err)
+	}
+
+	// Orders placed before checkouts were split by pharmacy are attributed to
+	// their pharmacy when all their items came from one
+	if err := d.DB.Exec(`
+		UPDATE orders SET pharmacy_id = single.pharmacy_id
+		FROM (
+			SELECT order_items.order_id, MIN(medicines.pharmacy_id::text)::uuid AS pharmacy_id
+			FROM order_items JOIN medicines ON medicines.id = order_items.medicine_id
+			GROUP BY order_items.order_id
+			HAVING COUNT(DISTINCT medicines.pharmacy_id) = 1
+		) AS single
+		WHERE single.order_id = orders.id AND (orders.pharmacy_id IS NULL OR orders.pharmacy_id = ?)`,
+		uuid.Nil).Error; err != nil {
+		return fmt.Errorf("failed to backfill order pharmacies: %w", err)
+	}
+
+	// Medicine search ranks a weighted document of the text fields, and falls
+	// back to trigram similarity on the name for misspellings
+	if err := d.DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return fmt.Errorf("failed to enable pg_trgm: %w", err)
+	}
+	if err := d.DB.Exec(`
+		ALTER TABLE medicines ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+			setweight(to_tsvector('english', COALESCE(content, '')), 'B') ||
+			setweight(to_tsvector('english', COALESCE(manufacturer, '')), 'C') ||
+			setweight(to_tsvector('english', COALESCE(description, '')), 'D')
+		) STORED`).Error; err != nil {
+		return fmt.Errorf("failed to add medicine search vector: %w", err)
+	}
+
 	log.Println("Database migration completed successfully")
 	return nil
 }
@@ -222,6 +302,14 @@ func (d *Database) CreateIndexes() error {
 		"CREATE INDEX IF NOT EXISTS idx_medicines_pharmacy_id ON medicines(pharmacy_id) WHERE deleted_at IS NULL",
 		"CREATE INDEX IF NOT EXISTS idx_medicines_name ON medicines(name) WHERE deleted_at IS NULL",
 		"CREATE INDEX IF NOT EXISTS idx_medicines_category ON medicines(category) WHERE deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_medicines_search_vector ON medicines USING GIN(search_vector)",
+		"CREATE INDEX IF NOT EXISTS idx_medicines_name_trgm ON medicines USING GIN(name gin_trgm_ops)",
+
+		// Drug master indexes; one entry per product
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_drugs_product ON drugs(LOWER(generic_name), LOWER(COALESCE(brand_name, '')), LOWER(strength), form) WHERE deleted_at IS NULL",
+
+		// Pharmacy location index for the bounding box of nearby searches
+		"CREATE INDEX IF NOT EXISTS idx_pharmacies_location ON pharmacies(latitude, longitude) WHERE deleted_at IS NULL AND is_active",
 
 		// Cart indexes
 		"CREATE INDEX IF NOT EXISTS idx_carts_user_id ON carts(user_id) WHERE deleted_at IS NULL",
@@ -230,6 +318,20 @@ func (d *Database) CreateIndexes() error {
 		"CREATE INDEX IF NOT EXISTS idx_cart_medicines_cart_id ON cart_medicines(cart_id) WHERE deleted_at IS NULL",
 		"CREATE INDEX IF NOT EXISTS idx_cart_medicines_medicine_id ON cart_medicines(medicine_id) WHERE deleted_at IS NULL",
 		"CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_medicines_cart_medicine ON cart_medicines(cart_id, medicine_id) WHERE deleted_at IS NULL",
+
+		// Payment indexes; cash payments have no gateway order, so the old
+		// unique index over every row is replaced by one over gateway orders only
+		"DROP INDEX IF EXISTS idx_payments_razorpay_order_id",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_gateway_order_id ON payments(razorpay_order_id) WHERE razorpay_order_id <> ''",
+
+		// Invoice indexes; numbers run per pharmacy, so the old unique index
+		// over every invoice number is replaced by one per pharmacy
+		"DROP INDEX IF EXISTS idx_invoices_invoice_number",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_pharmacy_number ON invoices(pharmacy_id, invoice_number)",
+
+		// Delivery indexes; an order is with one partner at a time
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_deliveries_active_order ON deliveries(order_id) WHERE deleted_at IS NULL AND status IN ('assigned', 'picked_up', 'in_transit')",
+		"CREATE INDEX IF NOT EXISTS idx_delivery_pings_delivery_recorded ON delivery_pings(delivery_id, recorded_at DESC)",
 	}
 
 	for _, indexSQL := range indexes {
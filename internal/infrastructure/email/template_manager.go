@@ -72,6 +72,21 @@ func (tm *TemplateManager) loadTemplatesFromFiles() {
 			htmlFile: "notification.html",
 			textFile: "notification.txt",
 		},
+		entity.EmailTypeOrderCancelled: {
+			subject:  "Order {{.OrderNumber}} Cancelled - {{.AppName}}",
+			htmlFile: "order_cancelled.html",
+			textFile: "order_cancelled.txt",
+		},
+		entity.EmailTypeInvoice: {
+			subject:  "Invoice {{.InvoiceNumber}} for Order {{.OrderNumber}} - {{.AppName}}",
+			htmlFile: "invoice.html",
+			textFile: "invoice.txt",
+		},
+		entity.EmailTypeStockAlert: {
+			subject:  "Stock Alerts for {{.PharmacyName}} - {{.AppName}}",
+			htmlFile: "stock_alert.html",
+			textFile: "stock_alert.txt",
+		},
 	}
 
 	// Load templates from files
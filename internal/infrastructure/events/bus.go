@@ -0,0 +1,23 @@
+package events
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/pkg/config"
+	"gorm.io/gorm"
+)
+
+// NewBus returns the event bus selected by configuration
+func NewBus(cfg *config.Config, db *gorm.DB) service.EventBus {
+	switch cfg.Events.Backend {
+	case config.EventBusPostgres:
+		dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.DBName, cfg.Database.SSLMode)
+		return NewPostgresBus(db, dsn)
+	default:
+		log.Println("Using in-process event bus")
+		return NewMemoryBus()
+	}
+}
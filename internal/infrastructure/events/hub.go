@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// further events for it are dropped
+const subscriberBuffer = 32
+
+// hub fans events out to the subscribers connected to this replica
+type hub struct {
+	mu          sync.RWMutex
+	subscribers map[uuid.UUID]map[chan service.Event]struct{}
+	closed      bool
+}
+
+func newHub() *hub {
+	return &hub{
+		subscribers: make(map[uuid.UUID]map[chan service.Event]struct{}),
+	}
+}
+
+// subscribe registers a subscriber for userID that is removed, and its
+// channel closed, once ctx is done or the hub is closed
+func (h *hub) subscribe(ctx context.Context, userID uuid.UUID) <-chan service.Event {
+	ch := make(chan service.Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(ch)
+		return ch
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan service.Event]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.unsubscribe(userID, ch)
+	}()
+	return ch
+}
+
+func (h *hub) unsubscribe(userID uuid.UUID, ch chan service.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[userID][ch]; !ok {
+		return
+	}
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+	close(ch)
+}
+
+// deliver hands the event to every subscriber of its user without waiting on
+// any of them
+func (h *hub) deliver(event service.Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropped %s event %s for slow subscriber of user %s", event.Type, event.ID, event.UserID)
+		}
+	}
+}
+
+// close ends every subscription
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for userID, channels := range h.subscribers {
+		for ch := range channels {
+			close(ch)
+		}
+		delete(h.subscribers, userID)
+	}
+}
@@ -0,0 +1,33 @@
+package events
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// MemoryBus delivers events to subscribers of this process only. It suits a
+// single API replica and local development.
+type MemoryBus struct {
+	hub *hub
+}
+
+// NewMemoryBus creates an in-process event bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{hub: newHub()}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, event service.Event) error {
+	b.hub.deliver(event)
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, userID uuid.UUID) <-chan service.Event {
+	return b.hub.subscribe(ctx, userID)
+}
+
+func (b *MemoryBus) Close() error {
+	b.hub.close()
+	return nil
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/skryfon/collex/internal/domain/service"
+	"gorm.io/gorm"
+)
+
+const (
+	// notifyChannel is the Postgres channel events travel on between replicas
+	notifyChannel = "collex_events"
+	// maxNotifyPayload is the largest payload Postgres accepts for a NOTIFY
+	maxNotifyPayload = 8000
+
+	listenMinBackoff = time.Second
+	listenMaxBackoff = 30 * time.Second
+)
+
+// PostgresBus shares events between API replicas through Postgres
+// LISTEN/NOTIFY. Every replica publishes with pg_notify and keeps one
+// dedicated connection listening, handing what arrives to its own
+// subscribers. Events published while a replica is reconnecting are missed
+// by that replica's subscribers.
+type PostgresBus struct {
+	db     *gorm.DB
+	dsn    string
+	hub    *hub
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPostgresBus creates a Postgres backed event bus and starts listening
+func NewPostgresBus(db *gorm.DB, dsn string) *PostgresBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &PostgresBus{
+		db:     db,
+		dsn:    dsn,
+		hub:    newHub(),
+		cancel: cancel,
+	}
+
+	b.wg.Add(1)
+	go b.listen(ctx)
+	return b
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, event service.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("event %s is %d bytes, over the %d byte notify limit", event.Type, len(payload), maxNotifyPayload)
+	}
+
+	if err := b.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", notifyChannel, string(payload)).Error; err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBus) Subscribe(ctx context.Context, userID uuid.UUID) <-chan service.Event {
+	return b.hub.subscribe(ctx, userID)
+}
+
+// Close stops listening and ends every subscription
+func (b *PostgresBus) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	b.hub.close()
+	return nil
+}
+
+// listen keeps a listening connection open until ctx is done, reconnecting
+// with backoff when it drops
+func (b *PostgresBus) listen(ctx context.Context) {
+	defer b.wg.Done()
+
+	backoff := listenMinBackoff
+	for {
+		connected, err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = listenMinBackoff
+		}
+
+		log.Printf("Event listener disconnected: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenMaxBackoff)
+	}
+}
+
+// listenOnce delivers notifications until the connection fails. connected
+// reports whether listening had started.
+func (b *PostgresBus) listenOnce(ctx context.Context) (connected bool, err error) {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{notifyChannel}.Sanitize()); err != nil {
+		return false, err
+	}
+	log.Printf("Listening for events on %s", notifyChannel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		var event service.Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Ignored malformed event notification: %v", err)
+			continue
+		}
+		b.hub.deliver(event)
+	}
+}
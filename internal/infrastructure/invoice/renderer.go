@@ -0,0 +1,376 @@
+// internal/infrastructure/invoice/renderer.go
+package invoice
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+const (
+	marginLeft   = 40.0
+	marginRight  = pageWidth - 40.0
+	marginBottom = pageHeight - 60.0
+)
+
+// invoiceColumn is one column of the line item table; right aligned columns
+// are positioned by their right edge.
+type invoiceColumn struct {
+	title string
+	x     float64
+	right bool
+}
+
+var lineColumns = []invoiceColumn{
+	{"#", marginLeft, false},
+	{"Item", marginLeft + 20, false},
+	{"HSN", 235, false},
+	{"Qty", 295, true},
+	{"Rate", 345, true},
+	{"Taxable", 405, true},
+	{"GST %", 445, true},
+	{"CGST", 490, true},
+	{"SGST", 530, true},
+	{"Amount", marginRight, true},
+}
+
+// interstateLineColumns replaces CGST and SGST with IGST for supplies to
+// another state
+var interstateLineColumns = []invoiceColumn{
+	{"#", marginLeft, false},
+	{"Item", marginLeft + 20, false},
+	{"HSN", 235, false},
+	{"Qty", 295, true},
+	{"Rate", 345, true},
+	{"Taxable", 405, true},
+	{"GST %", 455, true},
+	{"IGST", 510, true},
+	{"Amount", marginRight, true},
+}
+
+func columnsFor(inv *entity.Invoice) []invoiceColumn {
+	if inv.Interstate {
+		return interstateLineColumns
+	}
+	return lineColumns
+}
+
+type pdfRenderer struct{}
+
+// NewPDFRenderer creates an invoice renderer producing A4 PDFs
+func NewPDFRenderer() service.InvoiceRenderer {
+	return &pdfRenderer{}
+}
+
+func (r *pdfRenderer) Render(doc *service.InvoiceDocument) ([]byte, error) {
+	if doc.Invoice == nil || doc.Order == nil || doc.Pharmacy == nil {
+		return nil, fmt.Errorf("invoice, order and pharmacy are required")
+	}
+
+	pdf := newPDFDocument()
+	y := r.header(pdf, doc)
+	y = r.lineItems(pdf, doc, y)
+	y = r.totals(pdf, doc, y)
+	r.hsnSummary(pdf, doc, y)
+
+	return pdf.Bytes(), nil
+}
+
+// header draws the seller, invoice and buyer details and returns the next y
+func (r *pdfRenderer) header(pdf *pdfDocument, doc *service.InvoiceDocument) float64 {
+	inv, pharmacy, order := doc.Invoice, doc.Pharmacy, doc.Order
+
+	pdf.text(marginLeft, 50, 16, true, "TAX INVOICE")
+	pdf.line(marginLeft, 60, marginRight, 60)
+
+	// Seller
+	y := 80.0
+	pdf.text(marginLeft, y, 12, true, pharmacy.Name)
+	for _, line := range wrapText(joinNonEmpty(", ", pharmacy.Address, pharmacy.City, pharmacy.State, pharmacy.PostalCode), 9, 260) {
+		y += 13
+		pdf.text(marginLeft, y, 9, false, line)
+	}
+	if pharmacy.PhoneNumber != "" {
+		y += 13
+		pdf.text(marginLeft, y, 9, false, "Phone: "+pharmacy.PhoneNumber)
+	}
+	if pharmacy.GSTIN != "" {
+		y += 13
+		pdf.text(marginLeft, y, 9, false, "GSTIN: "+pharmacy.GSTIN)
+	}
+	y += 13
+	pdf.text(marginLeft, y, 9, false, "Drug Licence No: "+valueOr(pharmacy.LicenseNumber, "-"))
+
+	// Invoice details
+	metaY := 80.0
+	for _, row := range [][2]string{
+		{"Invoice No:", inv.InvoiceNumber},
+		{"Invoice Date:", inv.IssuedAt.Format("02 Jan 2006")},
+		{"Order No:", order.OrderNumber},
+		{"Payment:", paymentLabel(doc)},
+		{"Place of Supply:", valueOr(inv.PlaceOfSupply, "-")},
+	} {
+		pdf.text(340, metaY, 9, true, row[0])
+		pdf.text(420, metaY, 9, false, row[1])
+		metaY += 13
+	}
+
+	// Buyer
+	y += 25
+	pdf.text(marginLeft, y, 10, true, "Bill To")
+	if doc.Customer != nil {
+		y += 13
+		pdf.text(marginLeft, y, 9, false, doc.Customer.GetFullName())
+		if doc.Customer.PhoneNumber != "" {
+			y += 13
+			pdf.text(marginLeft, y, 9, false, "Phone: "+doc.Customer.PhoneNumber)
+		}
+	}
+	for _, line := range wrapText(order.DeliveryAddress, 9, marginRight-marginLeft) {
+		y += 13
+		pdf.text(marginLeft, y, 9, false, line)
+	}
+
+	return y + 25
+}
+
+// lineItems draws the item table, continuing on new pages as needed
+func (r *pdfRenderer) lineItems(pdf *pdfDocument, doc *service.InvoiceDocument, y float64) float64 {
+	columns := columnsFor(doc.Invoice)
+	y = r.tableHeader(pdf, columns, y)
+
+	for i, line := range doc.Lines {
+		nameLines := wrapText(line.Name, 8, 170)
+		if len(nameLines) == 0 {
+			nameLines = []string{"-"}
+		}
+		if y+float64(len(nameLines))*11 > marginBottom {
+			pdf.addPage()
+			y = r.tableHeader(pdf, columns, 50)
+		}
+
+		cells := []string{
+			fmt.Sprintf("%d", i+1),
+			nameLines[0],
+			valueOr(line.HSNCode, "-"),
+			fmt.Sprintf("%d", line.Quantity),
+			formatAmount(line.UnitPrice),
+			formatAmount(line.TaxableValue),
+			formatRate(line.GSTRate),
+		}
+		if doc.Invoice.Interstate {
+			cells = append(cells, formatAmount(line.IGST))
+		} else {
+			cells = append(cells, formatAmount(line.CGST), formatAmount(line.SGST))
+		}
+		cells = append(cells, formatAmount(line.Total))
+		for c, col := range columns {
+			if col.right {
+				pdf.textRight(col.x, y, 8, false, cells[c])
+			} else {
+				pdf.text(col.x, y, 8, false, cells[c])
+			}
+		}
+		for _, extra := range nameLines[1:] {
+			y += 11
+			pdf.text(columns[1].x, y, 8, false, extra)
+		}
+		y += 14
+	}
+
+	pdf.line(marginLeft, y-8, marginRight, y-8)
+	return y + 6
+}
+
+func (r *pdfRenderer) tableHeader(pdf *pdfDocument, columns []invoiceColumn, y float64) float64 {
+	pdf.line(marginLeft, y-11, marginRight, y-11)
+	for _, col := range columns {
+		if col.right {
+			pdf.textRight(col.x, y, 8, true, col.title)
+		} else {
+			pdf.text(col.x, y, 8, true, col.title)
+		}
+	}
+	pdf.line(marginLeft, y+5, marginRight, y+5)
+	return y + 18
+}
+
+// totals draws the invoice totals and returns the next y
+func (r *pdfRenderer) totals(pdf *pdfDocument, doc *service.InvoiceDocument, y float64) float64 {
+	inv := doc.Invoice
+	var rows [][2]string
+	if inv.DiscountAmount > 0 {
+		rows = append(rows,
+			[2]string{"Gross Amount", formatAmount(inv.TotalAmount + inv.DiscountAmount)},
+			[2]string{"Less: Discount", formatAmount(inv.DiscountAmount)},
+		)
+	}
+	rows = append(rows, [2]string{"Taxable Value", formatAmount(inv.TaxableAmount)})
+	if inv.Interstate {
+		rows = append(rows, [2]string{"IGST", formatAmount(inv.IGSTAmount)})
+	} else {
+		rows = append(rows,
+			[2]string{"CGST", formatAmount(inv.CGSTAmount)},
+			[2]string{"SGST", formatAmount(inv.SGSTAmount)},
+		)
+	}
+	rows = append(rows, [2]string{"Invoice Total (INR)", formatAmount(inv.TotalAmount)})
+	if y+float64(len(rows))*14 > marginBottom {
+		pdf.addPage()
+		y = 50
+	}
+
+	for i, row := range rows {
+		bold := i == len(rows)-1
+		pdf.textRight(460, y, 9, bold, row[0])
+		pdf.textRight(marginRight, y, 9, bold, row[1])
+		y += 14
+	}
+	return y + 16
+}
+
+// hsnSummary draws tax totals grouped by HSN code and rate
+func (r *pdfRenderer) hsnSummary(pdf *pdfDocument, doc *service.InvoiceDocument, y float64) {
+	type hsnKey struct {
+		code string
+		rate float64
+	}
+	type hsnTotal struct {
+		taxable, cgst, sgst, igst float64
+	}
+
+	totals := make(map[hsnKey]*hsnTotal)
+	var keys []hsnKey
+	for _, line := range doc.Lines {
+		key := hsnKey{valueOr(line.HSNCode, "-"), line.GSTRate}
+		if totals[key] == nil {
+			totals[key] = &hsnTotal{}
+			keys = append(keys, key)
+		}
+		totals[key].taxable += line.TaxableValue
+		totals[key].cgst += line.CGST
+		totals[key].sgst += line.SGST
+		totals[key].igst += line.IGST
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].code != keys[j].code {
+			return keys[i].code < keys[j].code
+		}
+		return keys[i].rate < keys[j].rate
+	})
+
+	needed := 60 + float64(len(keys))*12
+	if y+needed > marginBottom {
+		pdf.addPage()
+		y = 50
+	}
+
+	pdf.text(marginLeft, y, 10, true, "HSN Summary")
+	y += 16
+	interstate := doc.Invoice.Interstate
+	headers := []string{"Taxable", "GST %", "CGST", "SGST", "Total Tax"}
+	xs := []float64{260, 320, 390, 460, marginRight}
+	if interstate {
+		headers = []string{"Taxable", "GST %", "IGST", "Total Tax"}
+		xs = []float64{260, 320, 460, marginRight}
+	}
+	pdf.text(marginLeft, y, 8, true, "HSN")
+	for i, h := range headers {
+		pdf.textRight(xs[i], y, 8, true, h)
+	}
+	pdf.line(marginLeft, y+5, marginRight, y+5)
+	y += 16
+
+	for _, key := range keys {
+		t := totals[key]
+		pdf.text(marginLeft, y, 8, false, key.code)
+		cells := []string{
+			formatAmount(t.taxable),
+			formatRate(key.rate),
+			formatAmount(t.cgst),
+			formatAmount(t.sgst),
+			formatAmount(t.cgst + t.sgst),
+		}
+		if interstate {
+			cells = []string{
+				formatAmount(t.taxable),
+				formatRate(key.rate),
+				formatAmount(t.igst),
+				formatAmount(t.igst),
+			}
+		}
+		for i, cell := range cells {
+			pdf.textRight(xs[i], y, 8, false, cell)
+		}
+		y += 12
+	}
+
+	y += 20
+	if interstate {
+		pdf.text(marginLeft, y, 8, false, "Prices are inclusive of GST. IGST applies to supplies to another state.")
+	} else {
+		pdf.text(marginLeft, y, 8, false, "Prices are inclusive of GST. CGST and SGST apply to supplies within the state.")
+	}
+	pdf.text(marginLeft, y+12, 8, false, "This is a computer generated invoice and does not require a signature.")
+}
+
+func paymentLabel(doc *service.InvoiceDocument) string {
+	payment := doc.Order.Payment
+	if payment == nil || payment.PaymentMethod == "" {
+		return "Prepaid"
+	}
+	if payment.PaymentMethod == "cash" {
+		return "Cash on delivery"
+	}
+	return "Online (" + payment.PaymentMethod + ")"
+}
+
+// formatAmount formats rupees with two decimals and Indian digit grouping
+func formatAmount(amount float64) string {
+	s := fmt.Sprintf("%.2f", amount)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s[:len(s)-3], s[len(s)-3:]
+	if len(whole) > 3 {
+		head, tail := whole[:len(whole)-3], whole[len(whole)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		if head != "" {
+			groups = append([]string{head}, groups...)
+		}
+		whole = strings.Join(groups, ",") + "," + tail
+	}
+	return sign + whole + frac
+}
+
+func formatRate(rate float64) string {
+	if rate == float64(int64(rate)) {
+		return fmt.Sprintf("%d%%", int64(rate))
+	}
+	return fmt.Sprintf("%.2f%%", rate)
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+func valueOr(s, fallback string) string {
+	if strings.TrimSpace(s) == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,215 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// FakeKeyID is the checkout key reported by the fake gateway
+const FakeKeyID = "rzp_test_fake"
+
+// FakeGateway is a deterministic in-memory PaymentGateway for local development
+// and integration tests. IDs are sequential and signatures are computed with
+// the configured secrets exactly as Razorpay does, so the normal verify and
+// webhook paths work unchanged.
+type FakeGateway struct {
+	mu            sync.Mutex
+	keySecret     string
+	webhookSecret string
+	orders        map[string]*service.GatewayOrder
+	payments      map[string]*service.GatewayPayment
+	refunds       map[string]*service.GatewayRefund
+	seq           int
+}
+
+// NewFakeGateway creates an empty fake gateway
+func NewFakeGateway(keySecret, webhookSecret string) *FakeGateway {
+	return &FakeGateway{
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		orders:        make(map[string]*service.GatewayOrder),
+		payments:      make(map[string]*service.GatewayPayment),
+		refunds:       make(map[string]*service.GatewayRefund),
+	}
+}
+
+func (g *FakeGateway) nextID(prefix string) string {
+	g.seq++
+	return fmt.Sprintf("%s_fake%08d", prefix, g.seq)
+}
+
+func (g *FakeGateway) KeyID() string {
+	return FakeKeyID
+}
+
+func (g *FakeGateway) CreateOrder(ctx context.Context, amount int64, currency, receipt string, notes map[string]interface{}) (*service.GatewayOrder, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order := &service.GatewayOrder{
+		ID:       g.nextID("order"),
+		Amount:   amount,
+		Currency: currency,
+		Receipt:  receipt,
+	}
+	g.orders[order.ID] = order
+
+	copied := *order
+	return &copied, nil
+}
+
+// Pay captures the full amount of an order with the given method and returns
+// the payment ID together with the checkout signature a client would send to
+// the verify endpoint.
+func (g *FakeGateway) Pay(orderID, method string) (string, string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, ok := g.orders[orderID]
+	if !ok {
+		return "", "", fmt.Errorf("fake gateway: order %s not found", orderID)
+	}
+
+	payment := &service.GatewayPayment{
+		ID:        g.nextID("pay"),
+		OrderID:   order.ID,
+		Amount:    order.Amount,
+		Currency:  order.Currency,
+		Status:    "captured",
+		Method:    method,
+		CreatedAt: time.Now(),
+	}
+	g.payments[payment.ID] = payment
+
+	return payment.ID, sign(g.keySecret, []byte(order.ID+"|"+payment.ID)), nil
+}
+
+// FetchPayment returns a payment made through Pay. Unknown IDs are treated as
+// a captured card payment so a client stub can complete checkout by signing
+// any payment ID itself.
+func (g *FakeGateway) FetchPayment(ctx context.Context, paymentID string) (*service.GatewayPayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		payment = &service.GatewayPayment{
+			ID:        paymentID,
+			Status:    "captured",
+			Method:    "card",
+			CreatedAt: time.Now(),
+		}
+		g.payments[paymentID] = payment
+	}
+
+	copied := *payment
+	return &copied, nil
+}
+
+// Fail records a failed attempt against an order
+func (g *FakeGateway) Fail(orderID, method string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, ok := g.orders[orderID]
+	if !ok {
+		return "", fmt.Errorf("fake gateway: order %s not found", orderID)
+	}
+
+	payment := &service.GatewayPayment{
+		ID:        g.nextID("pay"),
+		OrderID:   order.ID,
+		Amount:    order.Amount,
+		Currency:  order.Currency,
+		Status:    "failed",
+		Method:    method,
+		CreatedAt: time.Now(),
+	}
+	g.payments[payment.ID] = payment
+	return payment.ID, nil
+}
+
+func (g *FakeGateway) FetchOrderPayments(ctx context.Context, orderID string) ([]*service.GatewayPayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var payments []*service.GatewayPayment
+	for _, payment := range g.sortedPayments() {
+		if payment.OrderID == orderID {
+			copied := *payment
+			payments = append(payments, &copied)
+		}
+	}
+	return payments, nil
+}
+
+func (g *FakeGateway) ListPayments(ctx context.Context, from, to time.Time) ([]*service.GatewayPayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var payments []*service.GatewayPayment
+	for _, payment := range g.sortedPayments() {
+		if !payment.CreatedAt.Before(from) && payment.CreatedAt.Before(to) {
+			copied := *payment
+			payments = append(payments, &copied)
+		}
+	}
+	return payments, nil
+}
+
+// sortedPayments returns the payments in creation order
+func (g *FakeGateway) sortedPayments() []*service.GatewayPayment {
+	payments := make([]*service.GatewayPayment, 0, len(g.payments))
+	for _, payment := range g.payments {
+		payments = append(payments, payment)
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		if payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].ID < payments[j].ID
+		}
+		return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+	})
+	return payments
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, paymentID string, amount int64, notes map[string]interface{}) (*service.GatewayRefund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: payment %s not found", paymentID)
+	}
+	if payment.Amount > 0 && amount > payment.Amount {
+		return nil, fmt.Errorf("fake gateway: refund of %d exceeds payment amount %d", amount, payment.Amount)
+	}
+
+	refund := &service.GatewayRefund{
+		ID:        g.nextID("rfnd"),
+		PaymentID: paymentID,
+		Amount:    amount,
+		Status:    "processed",
+	}
+	g.refunds[refund.ID] = refund
+
+	copied := *refund
+	return &copied, nil
+}
+
+func (g *FakeGateway) VerifyPaymentSignature(orderID, paymentID, signature string) bool {
+	return verify(g.keySecret, []byte(orderID+"|"+paymentID), signature)
+}
+
+func (g *FakeGateway) VerifyWebhookSignature(body []byte, signature string) bool {
+	return verify(g.webhookSecret, body, signature)
+}
+
+// SignWebhook signs a webhook body the way the gateway would
+func (g *FakeGateway) SignWebhook(body []byte) string {
+	return sign(g.webhookSecret, body)
+}
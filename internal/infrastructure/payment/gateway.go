@@ -0,0 +1,36 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/pkg/config"
+)
+
+// NewGateway returns the payment gateway selected by config.Payment.Gateway
+func NewGateway(cfg *config.Config) service.PaymentGateway {
+	switch cfg.Payment.Gateway {
+	case config.PaymentGatewayFake:
+		log.Println("Using in-memory fake payment gateway")
+		return NewFakeGateway(cfg.Payment.RazorpaySecret, cfg.Payment.RazorpayWebhookSecret)
+	default:
+		return NewRazorpayGateway(cfg.Payment.RazorpayKey, cfg.Payment.RazorpaySecret, cfg.Payment.RazorpayWebhookSecret)
+	}
+}
+
+// sign returns the hex HMAC-SHA256 of message, as Razorpay signs payloads
+func sign(secret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verify(secret string, message []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(sign(secret, message)), []byte(signature))
+}
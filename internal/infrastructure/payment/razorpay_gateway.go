@@ -0,0 +1,162 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	razorpay "github.com/razorpay/razorpay-go"
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// razorpayGateway implements PaymentGateway on top of the Razorpay API
+type razorpayGateway struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	client        *razorpay.Client
+}
+
+// NewRazorpayGateway creates a Razorpay backed payment gateway
+func NewRazorpayGateway(keyID, keySecret, webhookSecret string) service.PaymentGateway {
+	return &razorpayGateway{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		client:        razorpay.NewClient(keyID, keySecret),
+	}
+}
+
+func (g *razorpayGateway) KeyID() string {
+	return g.keyID
+}
+
+func (g *razorpayGateway) CreateOrder(ctx context.Context, amount int64, currency, receipt string, notes map[string]interface{}) (*service.GatewayOrder, error) {
+	data := map[string]interface{}{
+		"amount":   amount,
+		"currency": currency,
+		"receipt":  receipt,
+	}
+	if notes != nil {
+		data["notes"] = notes
+	}
+
+	body, err := g.client.Order.Create(data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := body["id"].(string)
+	if id == "" {
+		return nil, errors.New("razorpay returned an order without id")
+	}
+
+	return &service.GatewayOrder{
+		ID:       id,
+		Amount:   amount,
+		Currency: currency,
+		Receipt:  receipt,
+	}, nil
+}
+
+func (g *razorpayGateway) FetchPayment(ctx context.Context, paymentID string) (*service.GatewayPayment, error) {
+	body, err := g.client.Payment.Fetch(paymentID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return toGatewayPayment(body), nil
+}
+
+func (g *razorpayGateway) FetchOrderPayments(ctx context.Context, orderID string) ([]*service.GatewayPayment, error) {
+	body, err := g.client.Order.Payments(orderID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return toGatewayPayments(body), nil
+}
+
+// listPageSize is the largest page the Razorpay list APIs return
+const listPageSize = 100
+
+func (g *razorpayGateway) ListPayments(ctx context.Context, from, to time.Time) ([]*service.GatewayPayment, error) {
+	var payments []*service.GatewayPayment
+	for skip := 0; ; skip += listPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Razorpay treats "to" as inclusive
+		body, err := g.client.Payment.All(map[string]interface{}{
+			"from":  from.Unix(),
+			"to":    to.Unix() - 1,
+			"count": listPageSize,
+			"skip":  skip,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		page := toGatewayPayments(body)
+		payments = append(payments, page...)
+		if len(page) < listPageSize {
+			return payments, nil
+		}
+	}
+}
+
+func (g *razorpayGateway) Refund(ctx context.Context, paymentID string, amount int64, notes map[string]interface{}) (*service.GatewayRefund, error) {
+	var data map[string]interface{}
+	if notes != nil {
+		data = map[string]interface{}{"notes": notes}
+	}
+
+	body, err := g.client.Payment.Refund(paymentID, int(amount), data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	refund := &service.GatewayRefund{
+		PaymentID: paymentID,
+		Amount:    amount,
+	}
+	refund.ID, _ = body["id"].(string)
+	refund.Status, _ = body["status"].(string)
+	return refund, nil
+}
+
+func (g *razorpayGateway) VerifyPaymentSignature(orderID, paymentID, signature string) bool {
+	return verify(g.keySecret, []byte(orderID+"|"+paymentID), signature)
+}
+
+func (g *razorpayGateway) VerifyWebhookSignature(body []byte, signature string) bool {
+	return verify(g.webhookSecret, body, signature)
+}
+
+// toGatewayPayment maps a Razorpay payment entity
+func toGatewayPayment(body map[string]interface{}) *service.GatewayPayment {
+	payment := &service.GatewayPayment{}
+	payment.ID, _ = body["id"].(string)
+	payment.OrderID, _ = body["order_id"].(string)
+	payment.Currency, _ = body["currency"].(string)
+	payment.Status, _ = body["status"].(string)
+	payment.Method, _ = body["method"].(string)
+	if amount, ok := body["amount"].(float64); ok {
+		payment.Amount = int64(amount)
+	}
+	if createdAt, ok := body["created_at"].(float64); ok {
+		payment.CreatedAt = time.Unix(int64(createdAt), 0)
+	}
+	return payment
+}
+
+// toGatewayPayments maps a Razorpay collection of payment entities
+func toGatewayPayments(body map[string]interface{}) []*service.GatewayPayment {
+	items, _ := body["items"].([]interface{})
+	payments := make([]*service.GatewayPayment, 0, len(items))
+	for _, item := range items {
+		if entity, ok := item.(map[string]interface{}); ok {
+			payments = append(payments, toGatewayPayment(entity))
+		}
+	}
+	return payments
+}
@@ -56,7 +56,7 @@ func (r *AppoinmentRepository) GetByID(ctx context.Context, id uuid.UUID) (*enti
 		Preload("Doctor").
 		Preload("Patient").
 		Preload("BookedSlots").
-		Preload("OpChart").
+		Preload("OpChart.PrescriptionItems").
 		Where("id = ?", id).
 		First(&appointment).Error
 	if err != nil {
@@ -180,7 +180,7 @@ func (r *AppoinmentRepository) GetAppointmentHistory(ctx context.Context, doctor
 
 	err := r.db.WithContext(ctx).
 		Preload("Patient").
-		Preload("OpChart"). // ✅ Add this to load the relationship
+		Preload("OpChart.PrescriptionItems"). // ✅ Add this to load the relationship
 		Preload("Doctor").
 		Preload("BookedSlots", func(db *gorm.DB) *gorm.DB {
 			return db.Where("appointment_date < ? OR status IN ?",
@@ -367,7 +367,7 @@ func (r *AppoinmentRepository) GetAppointmentHistoryByPatient(ctx context.Contex
 		Preload("Doctor").
 		Preload("Patient").
 		Preload("Doctor.User").
-		Preload("OpChart"). // ✅ Add this to load the relationship
+		Preload("OpChart.PrescriptionItems"). // ✅ Add this to load the relationship
 
 		Preload("BookedSlots", func(db *gorm.DB) *gorm.DB {
 			return db.Where("appointment_date < ? OR status IN ?",
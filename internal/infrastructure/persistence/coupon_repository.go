@@ -0,0 +1,243 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CouponRepository struct {
+	db *gorm.DB
+}
+
+// NewCouponRepository creates a new coupon repository.
+func NewCouponRepository(db *gorm.DB) repository.CouponRepository {
+	return &CouponRepository{
+		db: db,
+	}
+}
+
+func (r *CouponRepository) Create(ctx context.Context, coupon *entity.Coupon) error {
+	return r.db.WithContext(ctx).Create(coupon).Error
+}
+
+func (r *CouponRepository) Update(ctx context.Context, coupon *entity.Coupon) error {
+	// Save writes zero values too, so limits and flags can be cleared
+	return r.db.WithContext(ctx).Omit("Pharmacy").Save(coupon).Error
+}
+
+func (r *CouponRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Coupon, error) {
+	var coupon entity.Coupon
+	err := r.db.WithContext(ctx).First(&coupon, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepository) GetByCode(ctx context.Context, code string) (*entity.Coupon, error) {
+	var coupon entity.Coupon
+	err := r.db.WithContext(ctx).
+		Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).
+		First(&coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepository) List(ctx context.Context, filter types.ListCouponsFilter) ([]*entity.Coupon, int64, error) {
+	var coupons []*entity.Coupon
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.Coupon{})
+	if filter.PharmacyID != nil {
+		query = query.Where("pharmacy_id = ?", *filter.PharmacyID)
+	} else if filter.PlatformOnly {
+		query = query.Where("pharmacy_id IS NULL")
+	}
+	if filter.Active != nil {
+		query = query.Where("is_active = ?", *filter.Active)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Preload("Pharmacy").
+		Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&coupons).Error
+	return coupons, total, err
+}
+
+func (r *CouponRepository) CountRedemptions(ctx context.Context, couponID uuid.UUID, userID *uuid.UUID) (int64, error) {
+	return countRedemptions(r.db.WithContext(ctx), couponID, userID)
+}
+
+func countRedemptions(db *gorm.DB, couponID uuid.UUID, userID *uuid.UUID) (int64, error) {
+	var count int64
+	query := db.Model(&entity.CouponRedemption{}).
+		Where("coupon_id = ? AND status <> ?", couponID, entity.CouponRedemptionReleased)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (r *CouponRepository) Reserve(ctx context.Context, redemption *entity.CouponRedemption) (bool, error) {
+	reserved := true
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the coupon so concurrent checkouts count each other's uses
+		var coupon entity.Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "per_user_limit", "usage_limit").
+			First(&coupon, "id = ?", redemption.CouponID).Error; err != nil {
+			return err
+		}
+
+		// A checkout the user started earlier should not hold back this one
+		// once its payment has failed or its stock hold has run out. Holds of
+		// checkouts still being paid keep counting.
+		now := time.Now()
+		failed := tx.Model(&entity.Payment{}).
+			Select("order_id").
+			Where("status = ?", "failed")
+		live := tx.Model(&entity.StockReservation{}).
+			Select("1").
+			Where("stock_reservations.payment_order_id = coupon_redemptions.payment_order_id AND stock_reservations.status = ? AND stock_reservations.expires_at > ?", "active", now)
+		if err := tx.Model(&entity.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ? AND status = ?", coupon.ID, redemption.UserID, entity.CouponRedemptionReserved).
+			Where("payment_order_id IN (?) OR NOT EXISTS (?)", failed, live).
+			Update("status", entity.CouponRedemptionReleased).Error; err != nil {
+			return err
+		}
+
+		if coupon.PerUserLimit > 0 {
+			used, err := countRedemptions(tx, coupon.ID, &redemption.UserID)
+			if err != nil {
+				return err
+			}
+			if used >= int64(coupon.PerUserLimit) {
+				reserved = false
+				return nil
+			}
+		}
+		if coupon.UsageLimit > 0 {
+			used, err := countRedemptions(tx, coupon.ID, nil)
+			if err != nil {
+				return err
+			}
+			if used >= int64(coupon.UsageLimit) {
+				reserved = false
+				return nil
+			}
+		}
+
+		redemption.Status = entity.CouponRedemptionReserved
+		return tx.Create(redemption).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return reserved, nil
+}
+
+func (r *CouponRepository) Redeem(ctx context.Context, paymentOrderID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return redeemCoupon(tx, paymentOrderID)
+	})
+}
+
+// redeemCoupon marks the coupon held for a payment as used. A hold released
+// before the payment came through, because it failed or ran out, is only
+// redeemed if the coupon's limits still allow it; otherwise it stays released
+// and the discount given on the payment goes uncounted.
+func redeemCoupon(tx *gorm.DB, paymentOrderID string) error {
+	var redemption entity.CouponRedemption
+	err := tx.Select("id", "coupon_id", "user_id").
+		Where("payment_order_id = ? AND status <> ?", paymentOrderID, entity.CouponRedemptionRedeemed).
+		First(&redemption).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Lock the coupon so a concurrent Reserve cannot release the hold or
+	// count against the limits while it is redeemed
+	var coupon entity.Coupon
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "per_user_limit", "usage_limit").
+		First(&coupon, "id = ?", redemption.CouponID).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Select("id", "status").
+		First(&redemption, "id = ?", redemption.ID).Error; err != nil {
+		return err
+	}
+	switch redemption.Status {
+	case entity.CouponRedemptionRedeemed:
+		return nil
+	case entity.CouponRedemptionReleased:
+		// Released holds are not counted, so the counts leave this one out
+		if coupon.PerUserLimit > 0 {
+			used, err := countRedemptions(tx, coupon.ID, &redemption.UserID)
+			if err != nil {
+				return err
+			}
+			if used >= int64(coupon.PerUserLimit) {
+				return nil
+			}
+		}
+		if coupon.UsageLimit > 0 {
+			used, err := countRedemptions(tx, coupon.ID, nil)
+			if err != nil {
+				return err
+			}
+			if used >= int64(coupon.UsageLimit) {
+				return nil
+			}
+		}
+	}
+
+	return tx.Model(&entity.CouponRedemption{}).
+		Where("id = ?", redemption.ID).
+		Updates(map[string]interface{}{
+			"status":      entity.CouponRedemptionRedeemed,
+			"redeemed_at": time.Now(),
+		}).Error
+}
+
+func (r *CouponRepository) Release(ctx context.Context, paymentOrderID string) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.CouponRedemption{}).
+		Where("payment_order_id = ? AND status = ?", paymentOrderID, entity.CouponRedemptionReserved).
+		Update("status", entity.CouponRedemptionReleased).Error
+}
+
+func (r *CouponRepository) SetCartCoupon(ctx context.Context, cartID uuid.UUID, couponID *uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.Cart{}).
+		Where("id = ?", cartID).
+		Update("coupon_id", couponID).Error
+}
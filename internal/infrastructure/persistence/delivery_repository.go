@@ -0,0 +1,241 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// activeDeliveryStatuses are the statuses of a delivery still under way
+var activeDeliveryStatuses = []string{
+	entity.DeliveryStatusAssigned,
+	entity.DeliveryStatusPickedUp,
+	entity.DeliveryStatusInTransit,
+}
+
+// errTransitionLost rolls back a delivery transition whose order had moved on
+var errTransitionLost = errors.New("order status changed")
+
+type DeliveryRepository struct {
+	db *gorm.DB
+}
+
+// NewDeliveryRepository creates a new delivery repository.
+func NewDeliveryRepository(db *gorm.DB) repository.DeliveryRepository {
+	return &DeliveryRepository{
+		db: db,
+	}
+}
+
+func (r *DeliveryRepository) Assign(ctx context.Context, delivery *entity.Delivery) (bool, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the order keeps the pharmacy from shipping or delivering it
+		// while the delivery is created
+		var order entity.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status").
+			First(&order, "id = ?", delivery.OrderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errTransitionLost
+			}
+			return err
+		}
+		if order.Status != entity.OrderStatusProcessing && order.Status != entity.OrderStatusShipped {
+			return errTransitionLost
+		}
+
+		if err := tx.Model(&entity.Delivery{}).
+			Where("order_id = ? AND status IN ?", delivery.OrderID, activeDeliveryStatuses).
+			Update("status", entity.DeliveryStatusCancelled).Error; err != nil {
+			return fmt.Errorf("failed to cancel previous delivery: %w", err)
+		}
+		if err := tx.Create(delivery).Error; err != nil {
+			return fmt.Errorf("failed to create delivery: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errTransitionLost) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *DeliveryRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Delivery, error) {
+	var delivery entity.Delivery
+	err := r.db.WithContext(ctx).
+		Preload("Order").
+		Preload("Pharmacy").
+		First(&delivery, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+func (r *DeliveryRepository) GetLatestForOrder(ctx context.Context, orderID uuid.UUID) (*entity.Delivery, error) {
+	var delivery entity.Delivery
+	err := r.db.WithContext(ctx).
+		Preload("Pharmacy").
+		Preload("Partner").
+		Where("order_id = ? AND status <> ?", orderID, entity.DeliveryStatusCancelled).
+		Order("created_at DESC").
+		First(&delivery).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get order delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+func (r *DeliveryRepository) ListForPartner(ctx context.Context, partnerID uuid.UUID, filter types.ListDeliveriesRequest) ([]*entity.Delivery, int64, error) {
+	// The partner needs no more of the patient than who to hand the order to
+	patient := func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "first_name", "last_name", "phone_number")
+	}
+
+	query := r.db.WithContext(ctx).Model(&entity.Delivery{}).Where("partner_id = ?", partnerID)
+	if filter.Active {
+		query = query.Where("status IN ?", activeDeliveryStatuses)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count deliveries: %w", err)
+	}
+
+	var deliveries []*entity.Delivery
+	if err := query.
+		Preload("Order").
+		Preload("Order.User", patient).
+		Preload("Pharmacy").
+		Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&deliveries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	return deliveries, total, nil
+}
+
+func (r *DeliveryRepository) Transition(ctx context.Context, delivery *entity.Delivery, fromStatus string, history *entity.OrderStatusHistory) (bool, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Delivery{}).
+			Where("id = ? AND status = ?", delivery.ID, fromStatus).
+			Updates(map[string]interface{}{
+				"status":         delivery.Status,
+				"picked_up_at":   delivery.PickedUpAt,
+				"delivered_at":   delivery.DeliveredAt,
+				"failed_at":      delivery.FailedAt,
+				"failure_reason": delivery.FailureReason,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTransitionLost
+		}
+
+		if history != nil {
+			moved, err := transitionOrderStatus(tx, history)
+			if err != nil {
+				return err
+			}
+			if !moved {
+				return errTransitionLost
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errTransitionLost) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update delivery: %w", err)
+	}
+	return true, nil
+}
+
+func (r *DeliveryRepository) ClaimOTPAttempt(ctx context.Context, deliveryID uuid.UUID, maxAttempts int) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.Delivery{}).
+		Where("id = ? AND otp_attempts < ?", deliveryID, maxAttempts).
+		Update("otp_attempts", gorm.Expr("otp_attempts + 1"))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record OTP attempt: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// orderHasActiveDelivery locks the order within tx and reports whether a
+// delivery of it is under way
+func orderHasActiveDelivery(tx *gorm.DB, orderID uuid.UUID) (bool, error) {
+	var order entity.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&order, "id = ?", orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var count int64
+	err := tx.Model(&entity.Delivery{}).
+		Where("order_id = ? AND status IN ?", orderID, activeDeliveryStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *DeliveryRepository) RecordPing(ctx context.Context, ping *entity.DeliveryPing) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ping).Error; err != nil {
+			return fmt.Errorf("failed to record delivery ping: %w", err)
+		}
+
+		// Pings sent late over a poor connection do not move the partner back
+		if err := tx.Model(&entity.Delivery{}).
+			Where("id = ? AND (last_ping_at IS NULL OR last_ping_at < ?)", ping.DeliveryID, ping.RecordedAt).
+			Updates(map[string]interface{}{
+				"latitude":     ping.Latitude,
+				"longitude":    ping.Longitude,
+				"last_ping_at": ping.RecordedAt,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to update delivery position: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *DeliveryRepository) ListRecentPings(ctx context.Context, deliveryID uuid.UUID, limit int) ([]*entity.DeliveryPing, error) {
+	var pings []*entity.DeliveryPing
+	if err := r.db.WithContext(ctx).
+		Where("delivery_id = ?", deliveryID).
+		Order("recorded_at DESC").
+		Limit(limit).
+		Find(&pings).Error; err != nil {
+		return nil, fmt.Errorf("failed to list delivery pings: %w", err)
+	}
+
+	for i, j := 0, len(pings)-1; i < j; i, j = i+1, j-1 {
+		pings[i], pings[j] = pings[j], pings[i]
+	}
+	return pings, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
 	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
 	"gorm.io/gorm"
 )
 
@@ -77,3 +78,40 @@ func (r *DoctorRepository) GetByID(ctx context.Context, userID uuid.UUID) (*enti
 
 	return &doctor, nil
 }
+
+// doctorNameSQL is the name a doctor is shown with
+const doctorNameSQL = "COALESCE(NULLIF(users.display_name, ''), CONCAT(users.first_name, ' ', users.last_name))"
+
+func (r *DoctorRepository) SuggestDoctors(ctx context.Context, prefix string, limit int) ([]types.DoctorSuggestion, error) {
+	lower := "LOWER(" + doctorNameSQL + ")"
+	start := escapeLike(strings.ToLower(strings.TrimSpace(prefix))) + "%"
+
+	suggestions := []types.DoctorSuggestion{}
+	err := r.activeDoctors(ctx).
+		Select("doctors.user_id AS id, "+doctorNameSQL+" AS name").
+		Where("("+lower+" LIKE ? OR "+lower+" LIKE ?)", start, "% "+start).
+		Order(gorm.Expr(lower+" LIKE ? DESC, "+lower, start)).
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest doctors: %w", err)
+	}
+	return suggestions, nil
+}
+
+func (r *DoctorRepository) SuggestSpecializations(ctx context.Context, prefix string, limit int) ([]string, error) {
+	names, err := suggestNames(r.activeDoctors(ctx).Where("COALESCE(doctors.specialization_id, '') <> ''"), "doctors.specialization_id", prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest specializations: %w", err)
+	}
+	return names, nil
+}
+
+// activeDoctors scopes a query to the doctors patients can book, joined to
+// their user
+func (r *DoctorRepository) activeDoctors(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).
+		Model(&entity.Doctor{}).
+		Joins("JOIN users ON users.id = doctors.user_id AND users.status = ? AND users.deleted_at IS NULL", "active").
+		Where("doctors.is_active")
+}
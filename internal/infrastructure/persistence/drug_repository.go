@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"gorm.io/gorm"
+)
+
+type DrugRepository struct {
+	db *gorm.DB
+}
+
+// NewDrugRepository creates a new drug repository.
+func NewDrugRepository(db *gorm.DB) repository.DrugRepository {
+	return &DrugRepository{
+		db: db,
+	}
+}
+
+func (r *DrugRepository) Create(ctx context.Context, drug *entity.Drug) error {
+	return r.db.WithContext(ctx).Create(drug).Error
+}
+
+func (r *DrugRepository) Update(ctx context.Context, drug *entity.Drug) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(drug).Error; err != nil {
+			return err
+		}
+		if !drug.RequiresPrescription() {
+			return nil
+		}
+		return tx.Model(&entity.Medicine{}).
+			Where("drug_id = ? AND NOT prescription_required", drug.ID).
+			Update("prescription_required", true).Error
+	})
+}
+
+func (r *DrugRepository) GetByID(ctx context.Context, drugID uuid.UUID) (*entity.Drug, error) {
+	var drug entity.Drug
+	err := r.db.WithContext(ctx).First(&drug, "id = ?", drugID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &drug, nil
+}
+
+func (r *DrugRepository) GetByProduct(ctx context.Context, drug *entity.Drug) (*entity.Drug, error) {
+	brandName := ""
+	if drug.BrandName != nil {
+		brandName = *drug.BrandName
+	}
+
+	var existing entity.Drug
+	err := r.db.WithContext(ctx).
+		Where("LOWER(generic_name) = LOWER(?) AND LOWER(COALESCE(brand_name, '')) = LOWER(?) AND LOWER(strength) = LOWER(?) AND form = ?",
+			drug.GenericName, brandName, drug.Strength, drug.Form).
+		First(&existing).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *DrugRepository) List(ctx context.Context, filter types.ListDrugsFilter) ([]*entity.Drug, int64, error) {
+	var drugs []*entity.Drug
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.Drug{})
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		pattern := "%" + search + "%"
+		query = query.Where("(generic_name ILIKE ? OR brand_name ILIKE ? OR composition ILIKE ?)", pattern, pattern, pattern)
+	}
+	if filter.Form != "" {
+		query = query.Where("form = ?", filter.Form)
+	}
+	if filter.Schedule != "" {
+		query = query.Where("schedule = ?", filter.Schedule)
+	}
+	if filter.Active != nil {
+		query = query.Where("is_active = ?", *filter.Active)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Order("generic_name ASC, brand_name ASC, strength ASC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&drugs).Error
+	return drugs, total, err
+}
+
+func (r *DrugRepository) ListOffers(ctx context.Context, drugIDs []uuid.UUID) ([]*entity.Medicine, error) {
+	var medicines []*entity.Medicine
+	if len(drugIDs) == 0 {
+		return medicines, nil
+	}
+
+	err := r.db.WithContext(ctx).
+		Joins("JOIN pharmacies ON pharmacies.id = medicines.pharmacy_id AND pharmacies.is_active AND pharmacies.deleted_at IS NULL").
+		Where("medicines.drug_id IN ? AND medicines.is_active", drugIDs).
+		Where("(medicines.expiry_date IS NULL OR medicines.expiry_date > NOW())").
+		Order("medicines.price ASC").
+		Preload("Pharmacy").
+		Find(&medicines).Error
+	return medicines, err
+}
+
+func (r *DrugRepository) SuggestGenericNames(ctx context.Context, prefix string, limit int) ([]string, error) {
+	return suggestNames(r.db.WithContext(ctx).Model(&entity.Drug{}).Where("is_active"), "generic_name", prefix, limit)
+}
+
+func (r *DrugRepository) LinkMedicine(ctx context.Context, medicineID uuid.UUID, drugID *uuid.UUID, requiresPrescription bool) error {
+	updates := map[string]interface{}{
+		"drug_id": drugID,
+	}
+	if requiresPrescription {
+		updates["prescription_required"] = true
+	}
+	return r.db.WithContext(ctx).
+		Model(&entity.Medicine{}).
+		Where("id = ?", medicineID).
+		Updates(updates).Error
+}
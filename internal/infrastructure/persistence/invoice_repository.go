@@ -0,0 +1,75 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InvoiceRepository struct {
+	db *gorm.DB
+}
+
+// NewInvoiceRepository creates a new invoice repository.
+func NewInvoiceRepository(db *gorm.DB) repository.InvoiceRepository {
+	return &InvoiceRepository{
+		db: db,
+	}
+}
+
+func (r *InvoiceRepository) CreateNumbered(ctx context.Context, invoice *entity.Invoice, store func(invoice *entity.Invoice) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sequence := entity.InvoiceSequence{
+			PharmacyID:    invoice.PharmacyID,
+			FinancialYear: entity.FinancialYear(invoice.IssuedAt),
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&sequence).Error; err != nil {
+			return err
+		}
+
+		// The lock holds other invoices of the pharmacy back until this one
+		// is stored or abandoned
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&sequence, "pharmacy_id = ? AND financial_year = ?", sequence.PharmacyID, sequence.FinancialYear).Error; err != nil {
+			return err
+		}
+		sequence.LastNumber++
+		if err := tx.Model(&sequence).Update("last_number", sequence.LastNumber).Error; err != nil {
+			return err
+		}
+
+		invoice.InvoiceNumber = entity.FormatInvoiceNumber(sequence.FinancialYear, sequence.LastNumber)
+		if err := store(invoice); err != nil {
+			return err
+		}
+		return tx.Create(invoice).Error
+	})
+}
+
+func (r *InvoiceRepository) GetByOrderID(ctx context.Context, orderID uuid.UUID) (*entity.Invoice, error) {
+	var invoice entity.Invoice
+	err := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		First(&invoice).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *InvoiceRepository) MarkEmailed(ctx context.Context, invoiceID uuid.UUID, emailedAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.Invoice{}).
+		Where("id = ?", invoiceID).
+		Update("emailed_at", emailedAt).Error
+}
@@ -0,0 +1,288 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fefoOrder sorts batches first-expiry-first-out; batches without an expiry
+// go last and ties go to the oldest stock
+const fefoOrder = "expiry_date ASC NULLS LAST, received_at ASC"
+
+type MedicineBatchRepository struct {
+	db *gorm.DB
+}
+
+// NewMedicineBatchRepository creates a new medicine batch repository.
+func NewMedicineBatchRepository(db *gorm.DB) repository.MedicineBatchRepository {
+	return &MedicineBatchRepository{
+		db: db,
+	}
+}
+
+func (r *MedicineBatchRepository) ListBatches(ctx context.Context, medicineID uuid.UUID) ([]*entity.MedicineBatch, error) {
+	var batches []*entity.MedicineBatch
+	err := r.db.WithContext(ctx).
+		Where("medicine_id = ?", medicineID).
+		Order(fefoOrder).
+		Find(&batches).Error
+	return batches, err
+}
+
+func (r *MedicineBatchRepository) GetBatchByID(ctx context.Context, batchID uuid.UUID) (*entity.MedicineBatch, error) {
+	var batch entity.MedicineBatch
+	err := r.db.WithContext(ctx).First(&batch, "id = ?", batchID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (r *MedicineBatchRepository) GetBatchByNumber(ctx context.Context, medicineID uuid.UUID, batchNumber string) (*entity.MedicineBatch, error) {
+	var batch entity.MedicineBatch
+	err := r.db.WithContext(ctx).
+		Where("medicine_id = ? AND batch_number = ?", medicineID, batchNumber).
+		First(&batch).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (r *MedicineBatchRepository) CreateBatch(ctx context.Context, batch *entity.MedicineBatch) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Medicine").Create(batch).Error; err != nil {
+			return err
+		}
+		return syncMedicineStock(tx, batch.MedicineID)
+	})
+}
+
+func (r *MedicineBatchRepository) UpdateBatch(ctx context.Context, batch *entity.MedicineBatch) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.MedicineBatch{}).
+			Where("id = ?", batch.ID).
+			Updates(map[string]interface{}{
+				"quantity":    batch.Quantity,
+				"expiry_date": batch.ExpiryDate,
+				"cost_price":  batch.CostPrice,
+			}).Error; err != nil {
+			return err
+		}
+		return syncMedicineStock(tx, batch.MedicineID)
+	})
+}
+
+func (r *MedicineBatchRepository) SyncStock(ctx context.Context, medicineID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return syncMedicineStock(tx, medicineID)
+	})
+}
+
+func (r *MedicineBatchRepository) ListAllocations(ctx context.Context, batchID uuid.UUID) ([]*entity.OrderItemBatch, error) {
+	var allocations []*entity.OrderItemBatch
+	err := r.db.WithContext(ctx).
+		Preload("OrderItem.Order").
+		Where("batch_id = ?", batchID).
+		Order("created_at ASC").
+		Find(&allocations).Error
+	return allocations, err
+}
+
+func (r *MedicineBatchRepository) ListExpiringBatches(ctx context.Context, pharmacyID *uuid.UUID, before time.Time) ([]*entity.MedicineBatch, error) {
+	var batches []*entity.MedicineBatch
+
+	query := r.db.WithContext(ctx).
+		Joins("JOIN medicines ON medicines.id = medicine_batches.medicine_id AND medicines.is_active AND medicines.deleted_at IS NULL").
+		Where("medicine_batches.quantity > 0 AND medicine_batches.expiry_date <= ?", before)
+	if pharmacyID != nil {
+		query = query.Where("medicines.pharmacy_id = ?", *pharmacyID)
+	}
+	err := query.
+		Preload("Medicine.Pharmacy").
+		Order("medicine_batches.expiry_date ASC").
+		Find(&batches).Error
+	return batches, err
+}
+
+func (r *MedicineBatchRepository) SyncExpired(ctx context.Context, now time.Time) (int64, error) {
+	var medicineIDs []uuid.UUID
+	if err := r.db.WithContext(ctx).
+		Model(&entity.Medicine{}).
+		Where("expiry_date <= ? AND quantity > 0", now).
+		Pluck("id", &medicineIDs).Error; err != nil {
+		return 0, err
+	}
+
+	for _, medicineID := range medicineIDs {
+		if err := r.SyncStock(ctx, medicineID); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(medicineIDs)), nil
+}
+
+// sellableBatches scopes a query to the batches of a medicine that still have
+// units and have not expired at now
+func sellableBatches(tx *gorm.DB, medicineID uuid.UUID, now time.Time) *gorm.DB {
+	return tx.Where("medicine_id = ? AND quantity > 0 AND (expiry_date IS NULL OR expiry_date > ?)", medicineID, now)
+}
+
+// sellableQuantity returns the units of a medicine that can still be sold
+func sellableQuantity(tx *gorm.DB, medicineID uuid.UUID, now time.Time) (int64, error) {
+	var total int64
+	err := sellableBatches(tx.Model(&entity.MedicineBatch{}), medicineID, now).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// syncMedicineStock sets the medicine's quantity to the units of its sellable
+// batches, and its batch number and expiry to the batch sold next.
+func syncMedicineStock(tx *gorm.DB, medicineID uuid.UUID) error {
+	now := time.Now()
+	total, err := sellableQuantity(tx, medicineID, now)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"quantity": total,
+	}
+
+	var next entity.MedicineBatch
+	err = sellableBatches(tx, medicineID, now).Order(fefoOrder).First(&next).Error
+	if err == nil {
+		updates["batch_number"] = next.BatchNumber
+		updates["expiry_date"] = next.ExpiryDate
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return tx.Model(&entity.Medicine{}).
+		Where("id = ?", medicineID).
+		UpdateColumns(updates).Error
+}
+
+// allocateBatches takes quantity units of a medicine from its sellable batches
+// first-expiry-first-out and records the allocations for the payment. Units
+// the batches cannot cover are left unallocated, as the payment has already
+// been captured.
+func allocateBatches(tx *gorm.DB, paymentOrderID string, medicineID uuid.UUID, quantity int) error {
+	var batches []entity.MedicineBatch
+	if err := sellableBatches(tx.Clauses(clause.Locking{Strength: "UPDATE"}), medicineID, time.Now()).
+		Order(fefoOrder).
+		Find(&batches).Error; err != nil {
+		return err
+	}
+
+	remaining := quantity
+	for _, batch := range batches {
+		if remaining == 0 {
+			break
+		}
+		take := min(remaining, batch.Quantity)
+
+		if err := tx.Model(&entity.MedicineBatch{}).
+			Where("id = ?", batch.ID).
+			UpdateColumn("quantity", gorm.Expr("quantity - ?", take)).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&entity.OrderItemBatch{
+			PaymentOrderID: paymentOrderID,
+			MedicineID:     medicineID,
+			BatchID:        batch.ID,
+			Quantity:       take,
+		}).Error; err != nil {
+			return err
+		}
+		remaining -= take
+	}
+
+	return syncMedicineStock(tx, medicineID)
+}
+
+// linkBatchAllocations points the batch allocations of a payment at the order
+// items created for it
+func linkBatchAllocations(tx *gorm.DB, paymentOrderID string, orders []entity.Order) error {
+	for _, order := range orders {
+		for _, item := range order.OrderItems {
+			if err := tx.Model(&entity.OrderItemBatch{}).
+				Where("payment_order_id = ? AND medicine_id = ? AND order_item_id IS NULL", paymentOrderID, item.MedicineID).
+				Update("order_item_id", item.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restockBatches puts quantity units of an order item back on the batches
+// they were picked from, latest allocation first. Units with no allocation
+// left go to the medicine's most recently received batch.
+func restockBatches(tx *gorm.DB, orderItemID, medicineID uuid.UUID, quantity int) error {
+	var allocations []entity.OrderItemBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_item_id = ? AND returned_quantity < quantity", orderItemID).
+		Order("created_at DESC").
+		Find(&allocations).Error; err != nil {
+		return err
+	}
+
+	remaining := quantity
+	for _, allocation := range allocations {
+		if remaining == 0 {
+			break
+		}
+		give := min(remaining, allocation.Quantity-allocation.ReturnedQuantity)
+
+		if err := tx.Model(&entity.OrderItemBatch{}).
+			Where("id = ?", allocation.ID).
+			UpdateColumn("returned_quantity", gorm.Expr("returned_quantity + ?", give)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.MedicineBatch{}).
+			Where("id = ?", allocation.BatchID).
+			UpdateColumn("quantity", gorm.Expr("quantity + ?", give)).Error; err != nil {
+			return err
+		}
+		remaining -= give
+	}
+
+	if remaining > 0 {
+		var batch entity.MedicineBatch
+		err := tx.Where("medicine_id = ?", medicineID).Order("received_at DESC").First(&batch).Error
+		switch {
+		case err == nil:
+			if err := tx.Model(&batch).UpdateColumn("quantity", gorm.Expr("quantity + ?", remaining)).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&entity.MedicineBatch{
+				MedicineID:  medicineID,
+				BatchNumber: entity.DefaultBatchNumber,
+				Quantity:    remaining,
+				ReceivedAt:  time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
+	return syncMedicineStock(tx, medicineID)
+}
@@ -5,14 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
 	"github.com/skryfon/collex/internal/domain/repository"
 	"github.com/skryfon/collex/internal/types"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// maxManufacturerFacets caps the manufacturers counted for search facets
+const maxManufacturerFacets = 20
+
+// medicinePriceBands are the price ranges search results are counted in; a
+// zero max leaves the band open-ended
+var medicinePriceBands = []struct {
+	label    string
+	min, max float64
+}{
+	{label: "0-100", min: 0, max: 100},
+	{label: "100-250", min: 100, max: 250},
+	{label: "250-500", min: 250, max: 500},
+	{label: "500-1000", min: 500, max: 1000},
+	{label: "1000+", min: 1000},
+}
+
 // auditLogRepository implements repository.AuditLogRepository using GORM.
 type MedicineRepository struct {
 	db *gorm.DB
@@ -24,32 +42,399 @@ func NewMedicineRepository(db *gorm.DB) repository.MedicineRepository {
 		db: db,
 	}
 }
-func (r *MedicineRepository) GetMedicines(ctx context.Context, searchQuery string) ([]*entity.Medicine, error) {
+func (r *MedicineRepository) GetMedicines(ctx context.Context, req types.MedicineRequest) ([]*entity.Medicine, int64, error) {
+	query := r.searchMedicines(ctx, req.SearchQuery)
+	if req.Manufacturer != "" {
+		query = query.Where("LOWER(medicines.manufacturer) = LOWER(?)", req.Manufacturer)
+	}
+	if req.PrescriptionRequired != nil {
+		query = query.Where("medicines.prescription_required = ?", *req.PrescriptionRequired)
+	}
+	if req.MinPrice != nil {
+		query = query.Where("medicines.price >= ?", *req.MinPrice)
+	}
+	if req.MaxPrice != nil {
+		query = query.Where("medicines.price < ?", *req.MaxPrice)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count medicines: %w", err)
+	}
+
+	search := strings.TrimSpace(req.SearchQuery)
+	if search != "" {
+		query = query.
+			Select("medicines.*, ts_rank_cd(medicines.search_vector, websearch_to_tsquery('english', ?)) + word_similarity(?, medicines.name) AS rank", search, search).
+			Order("rank DESC")
+	}
+
 	var medicines []*entity.Medicine
+	if err := query.
+		Preload("Pharmacy").
+		Order("medicines.price ASC, medicines.name ASC").
+		Offset((req.Page - 1) * req.Limit).
+		Limit(req.Limit).
+		Find(&medicines).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch medicines: %w", err)
+	}
+	return medicines, total, nil
+}
+
+func (r *MedicineRepository) GetMedicineFacets(ctx context.Context, req types.MedicineRequest) (*types.MedicineSearchFacets, error) {
+	facets := &types.MedicineSearchFacets{
+		Manufacturers:        []types.FacetCount{},
+		PrescriptionRequired: []types.FacetCount{},
+		PriceBands:           make([]types.PriceBandCount, 0, len(medicinePriceBands)),
+	}
+
+	if err := r.searchMedicines(ctx, req.SearchQuery).
+		Select("medicines.manufacturer AS value, COUNT(*) AS count").
+		Where("COALESCE(medicines.manufacturer, '') <> ''").
+		Group("medicines.manufacturer").
+		Order("count DESC, value ASC").
+		Limit(maxManufacturerFacets).
+		Scan(&facets.Manufacturers).Error; err != nil {
+		return nil, fmt.Errorf("failed to count manufacturers: %w", err)
+	}
+
+	if err := r.searchMedicines(ctx, req.SearchQuery).
+		Select("CASE WHEN medicines.prescription_required THEN 'true' ELSE 'false' END AS value, COUNT(*) AS count").
+		Group("medicines.prescription_required").
+		Order("value ASC").
+		Scan(&facets.PrescriptionRequired).Error; err != nil {
+		return nil, fmt.Errorf("failed to count prescription requirements: %w", err)
+	}
+
+	columns := make([]string, 0, len(medicinePriceBands))
+	var args []interface{}
+	for _, band := range medicinePriceBands {
+		if band.max == 0 {
+			columns = append(columns, "COUNT(*) FILTER (WHERE medicines.price >= ?)")
+			args = append(args, band.min)
+			continue
+		}
+		columns = append(columns, "COUNT(*) FILTER (WHERE medicines.price >= ? AND medicines.price < ?)")
+		args = append(args, band.min, band.max)
+	}
+	counts := make([]int64, len(medicinePriceBands))
+	dest := make([]interface{}, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	if err := r.searchMedicines(ctx, req.SearchQuery).
+		Select(strings.Join(columns, ", "), args...).
+		Row().Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to count price bands: %w", err)
+	}
+	for i, band := range medicinePriceBands {
+		bandCount := types.PriceBandCount{
+			Label:    band.label,
+			MinPrice: band.min,
+			Count:    counts[i],
+		}
+		if band.max > 0 {
+			maxPrice := band.max
+			bandCount.MaxPrice = &maxPrice
+		}
+		facets.PriceBands = append(facets.PriceBands, bandCount)
+	}
+	return facets, nil
+}
+
+// suggestNames returns the distinct values of a text column, ignoring case,
+// that start with the prefix or have a word starting with it. Values starting
+// with it come first, shortest first.
+func suggestNames(query *gorm.DB, column, prefix string, limit int) ([]string, error) {
+	lower := "LOWER(" + column + ")"
+	start := escapeLike(strings.ToLower(strings.TrimSpace(prefix))) + "%"
+
+	names := []string{}
+	err := query.
+		Select("MIN("+column+")").
+		Where("("+lower+" LIKE ? OR "+lower+" LIKE ?)", start, "% "+start).
+		Group(lower).
+		Order(gorm.Expr(lower+" LIKE ? DESC, LENGTH("+lower+"), "+lower, start)).
+		Limit(limit).
+		Scan(&names).Error
+	return names, err
+}
+
+// escapeLike escapes the wildcards of LIKE in text
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
+
+// searchMedicines scopes a query to the medicines patients can buy that match
+// the search, by full-text search over name, content, manufacturer and
+// description, or by trigram similarity to the name so misspellings and
+// partly typed names still match. An empty search matches everything.
+func (r *MedicineRepository) searchMedicines(ctx context.Context, search string) *gorm.DB {
+	query := r.db.WithContext(ctx).
+		Model(&entity.Medicine{}).
+		Joins("JOIN pharmacies ON pharmacies.id = medicines.pharmacy_id AND pharmacies.is_active AND pharmacies.deleted_at IS NULL").
+		Where("medicines.is_active AND medicines.quantity > 0").
+		Where("(medicines.expiry_date IS NULL OR medicines.expiry_date > NOW())")
+
+	if search = strings.TrimSpace(search); search != "" {
+		query = query.Where("(medicines.search_vector @@ websearch_to_tsquery('english', ?) OR ? <% medicines.name)", search, search)
+	}
+	return query
+}
+
+func (r *MedicineRepository) FindInStock(ctx context.Context, search string, limit int) ([]*entity.Medicine, error) {
+	var medicines []*entity.Medicine
+
+	pattern := "%" + escapeLike(strings.ToLower(strings.TrimSpace(search))) + "%"
+	err := r.db.WithContext(ctx).
+		Joins("JOIN pharmacies ON pharmacies.id = medicines.pharmacy_id AND pharmacies.is_active AND pharmacies.deleted_at IS NULL").
+		Where("medicines.is_active AND medicines.quantity > 0").
+		Where("(medicines.expiry_date IS NULL OR medicines.expiry_date > NOW())").
+		Where("(LOWER(medicines.name) LIKE ? OR LOWER(medicines.content) LIKE ?)", pattern, pattern).
+		Order("medicines.price ASC").
+		Limit(limit).
+		Preload("Pharmacy").
+		Find(&medicines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find medicines: %w", err)
+	}
+	return medicines, nil
+}
+
+// comparisonKeySQL names the listings that are the same medicine: those
+// linked to one master drug, and unlinked ones with the same name and
+// composition once lowercased and stripped to letters and digits
+const comparisonKeySQL = `CASE WHEN medicines.drug_id IS NOT NULL THEN 'drug:' || medicines.drug_id::text
+	ELSE 'name:' || LOWER(REGEXP_REPLACE(medicines.name, '[^[:alnum:]]', '', 'g')) ||
+		COALESCE(':' || LOWER(REGEXP_REPLACE(medicines.content, '[^[:alnum:]]', '', 'g')), '') END`
+
+// comparisonHit is a listing found by a comparison search before it is loaded
+type comparisonHit struct {
+	ID       uuid.UUID
+	GroupKey string
+}
+
+func (r *MedicineRepository) CompareListings(ctx context.Context, req types.CompareMedicinesRequest, origin *entity.GeoLocation) ([]types.ListingGroup, int64, error) {
+	// Pharmacies that were never geocoded have no distance
+	distance, distanceArgs := "CAST(NULL AS float8)", []interface{}{}
+	if origin != nil {
+		distance = "CASE WHEN pharmacies.latitude = 0 AND pharmacies.longitude = 0 THEN NULL ELSE " + pharmacyDistanceSQL + " END"
+		distanceArgs = []interface{}{origin.Latitude, origin.Latitude, origin.Longitude}
+	}
+
+	pattern := "%" + escapeLike(strings.ToLower(strings.TrimSpace(req.Search))) + "%"
+	listings := r.db.Model(&entity.Medicine{}).
+		Joins("JOIN pharmacies ON pharmacies.id = medicines.pharmacy_id AND pharmacies.is_active AND pharmacies.deleted_at IS NULL").
+		Select("medicines.id, medicines.price, medicines.quantity > 0 AS in_stock, "+comparisonKeySQL+" AS group_key, "+distance+" AS distance_km", distanceArgs...).
+		Where("medicines.is_active").
+		Where("(medicines.expiry_date IS NULL OR medicines.expiry_date > NOW())").
+		Where("(LOWER(medicines.name) LIKE ? OR LOWER(medicines.content) LIKE ? OR medicines.drug_id IN (?))",
+			pattern, pattern,
+			r.db.Model(&entity.Drug{}).
+				Select("id").
+				Where("LOWER(generic_name) LIKE ? OR LOWER(brand_name) LIKE ?", pattern, pattern))
+	if req.InStock {
+		listings = listings.Where("medicines.quantity > 0")
+	}
+
+	// A group ranks by its best offer: in stock first, then the nearest when
+	// sorting by distance, then the cheapest
+	order := "NOT in_stock, price ASC, id"
+	if req.Sort == "distance" {
+		order = "NOT in_stock, distance_km ASC NULLS LAST, price ASC, id"
+	}
+	ranked := r.db.Table("(?) AS listings", listings).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY group_key ORDER BY " + order + ") AS offer_rank")
+	groups := func() *gorm.DB {
+		return r.db.WithContext(ctx).Table("(?) AS ranked", ranked).Where("offer_rank = 1")
+	}
+
+	var total int64
+	if err := groups().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count medicine comparisons: %w", err)
+	}
+
+	var keys []string
+	if err := groups().
+		Order(order).
+		Offset((req.Page-1)*req.Limit).
+		Limit(req.Limit).
+		Pluck("group_key", &keys).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to compare medicines: %w", err)
+	}
+	if len(keys) == 0 {
+		return []types.ListingGroup{}, total, nil
+	}
+
+	var hits []comparisonHit
+	if err := r.db.WithContext(ctx).
+		Table("(?) AS listings", listings).
+		Select("id, group_key").
+		Where("group_key IN ?", keys).
+		Order("price ASC, id").
+		Scan(&hits).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to compare medicines: %w", err)
+	}
+
+	var medicines []*entity.Medicine
+	if err := r.db.WithContext(ctx).
+		Preload("Pharmacy").
+		Preload("Drug").
+		Where("id IN ?", comparisonHitIDs(hits)).
+		Find(&medicines).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load compared medicines: %w", err)
+	}
+	byID := make(map[uuid.UUID]*entity.Medicine, len(medicines))
+	for _, medicine := range medicines {
+		byID[medicine.ID] = medicine
+	}
+
+	results := make([]types.ListingGroup, len(keys))
+	index := make(map[string]int, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		index[key] = i
+	}
+	for _, hit := range hits {
+		if medicine, ok := byID[hit.ID]; ok {
+			group := &results[index[hit.GroupKey]]
+			group.Listings = append(group.Listings, medicine)
+		}
+	}
+	return results, total, nil
+}
+
+// comparisonHitIDs returns the IDs of comparison search hits in order
+func comparisonHitIDs(hits []comparisonHit) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func (r *MedicineRepository) FindSubstitutes(ctx context.Context, medicine *entity.Medicine, limit int) ([]*entity.Medicine, error) {
+	var medicines []*entity.Medicine
+	if medicine.CompositionKey == nil || *medicine.CompositionKey == "" {
+		return medicines, nil
+	}
+
+	err := r.db.WithContext(ctx).
+		Joins("JOIN pharmacies ON pharmacies.id = medicines.pharmacy_id AND pharmacies.is_active AND pharmacies.deleted_at IS NULL").
+		Where("medicines.composition_key = ? AND medicines.id <> ?", *medicine.CompositionKey, medicine.ID).
+		Where("medicines.is_active AND medicines.quantity > 0 AND medicines.price < ?", medicine.Price).
+		Where("(medicines.expiry_date IS NULL OR medicines.expiry_date > NOW())").
+		Order("medicines.price ASC").
+		Limit(limit).
+		Preload("Pharmacy").
+		Find(&medicines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find substitutes: %w", err)
+	}
+	return medicines, nil
+}
+
+func (r *MedicineRepository) FindNearby(ctx context.Context, origin entity.GeoLocation, req types.NearbyMedicinesRequest) ([]types.NearbyMedicine, int64, error) {
+	pattern := "%" + escapeLike(strings.ToLower(strings.TrimSpace(req.Search))) + "%"
+	inner := withinBoundingBox(r.db.Model(&entity.Medicine{}), origin, req.RadiusKm).
+		Joins("JOIN pharmacies ON pharmacies.id = medicines.pharmacy_id AND pharmacies.is_active AND pharmacies.deleted_at IS NULL").
+		Select("medicines.id, medicines.price, "+pharmacyDistanceSQL+" AS distance_km", origin.Latitude, origin.Latitude, origin.Longitude).
+		Where("medicines.is_active").
+		Where("(medicines.expiry_date IS NULL OR medicines.expiry_date > NOW())").
+		Where("(LOWER(medicines.name) LIKE ? OR LOWER(medicines.content) LIKE ?)", pattern, pattern)
+	if req.InStock {
+		inner = inner.Where("medicines.quantity > 0")
+	}
+	nearby := func() *gorm.DB {
+		return r.db.WithContext(ctx).Table("(?) AS nearby", inner).Where("distance_km <= ?", req.RadiusKm)
+	}
+
+	var total int64
+	if err := nearby().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count nearby medicines: %w", err)
+	}
+
+	var hits []nearbyHit
+	if err := nearby().
+		Select("id, distance_km").
+		Order("distance_km ASC, price ASC").
+		Offset((req.Page - 1) * req.Limit).
+		Limit(req.Limit).
+		Scan(&hits).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to find nearby medicines: %w", err)
+	}
 
-	query := r.db.WithContext(ctx).Preload("Pharmacy")
+	var medicines []*entity.Medicine
+	if err := r.db.WithContext(ctx).
+		Preload("Pharmacy").
+		Where("id IN ?", hitIDs(hits)).
+		Find(&medicines).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load nearby medicines: %w", err)
+	}
+	byID := make(map[uuid.UUID]*entity.Medicine, len(medicines))
+	for _, medicine := range medicines {
+		byID[medicine.ID] = medicine
+	}
 
-	// If search query is provided, search in both name and content
-	if searchQuery != "" {
-		searchPattern := "%" + strings.ToLower(searchQuery) + "%"
-		query = query.Where(
-			"LOWER(name) LIKE ? OR LOWER(content) LIKE ?",
-			searchPattern,
-			searchPattern,
-		)
+	results := make([]types.NearbyMedicine, 0, len(hits))
+	for _, hit := range hits {
+		if medicine, ok := byID[hit.ID]; ok {
+			results = append(results, types.NearbyMedicine{Medicine: medicine, DistanceKm: hit.DistanceKm})
+		}
 	}
+	return results, total, nil
+}
 
-	// Execute the query
-	if err := query.Find(&medicines).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch medicines: %w", err)
+func (r *MedicineRepository) SuggestNames(ctx context.Context, prefix string, limit int) ([]string, error) {
+	names, err := suggestNames(r.searchMedicines(ctx, ""), "medicines.name", prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest medicines: %w", err)
 	}
+	return names, nil
+}
 
+func (r *MedicineRepository) ListLowStock(ctx context.Context, pharmacyID *uuid.UUID) ([]*entity.Medicine, error) {
+	var medicines []*entity.Medicine
+
+	query := r.db.WithContext(ctx).
+		Preload("Pharmacy").
+		Where("is_active AND reorder_level > 0 AND quantity <= reorder_level")
+	if pharmacyID != nil {
+		query = query.Where("pharmacy_id = ?", *pharmacyID)
+	}
+	if err := query.Order("quantity ASC, name ASC").Find(&medicines).Error; err != nil {
+		return nil, fmt.Errorf("failed to list low stock medicines: %w", err)
+	}
 	return medicines, nil
 }
 
 func (r *MedicineRepository) AddMedicine(ctx context.Context, userId uuid.UUID, medicine *entity.Medicine) (*entity.Medicine, error) {
-	// Insert into database
-	if err := r.db.WithContext(ctx).Create(medicine).Error; err != nil {
+	// Insert the medicine with its opening stock as the first batch
+	medicine.IndexComposition()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(medicine).Error; err != nil {
+			return err
+		}
+		if medicine.Quantity == 0 {
+			return nil
+		}
+
+		batchNumber := entity.DefaultBatchNumber
+		if medicine.BatchNumber != nil && *medicine.BatchNumber != "" {
+			batchNumber = *medicine.BatchNumber
+		}
+		if err := tx.Create(&entity.MedicineBatch{
+			MedicineID:  medicine.ID,
+			BatchNumber: batchNumber,
+			ExpiryDate:  medicine.ExpiryDate,
+			Quantity:    medicine.Quantity,
+			ReceivedAt:  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return syncMedicineStock(tx, medicine.ID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -111,6 +496,7 @@ func (r *MedicineRepository) GetMedicineByID(ctx context.Context, medicineID uui
 
 	if err := r.db.WithContext(ctx).
 		Preload("Pharmacy").
+		Preload("Drug").
 		First(&medicine, "id = ?", medicineID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -131,14 +517,293 @@ func (r *MedicineRepository) DeleteMedicine(ctx context.Context, medicineID uuid
 	return nil
 }
 func (r *MedicineRepository) UpdateMedicine(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, updatedMedicine *entity.Medicine) error {
-	result := r.db.WithContext(ctx).Model(&entity.Medicine{}).
-		Where("id = ? AND pharmacy_id IN (SELECT id FROM pharmacies WHERE user_id = ?)", medicineID, userID).
-		Updates(updatedMedicine)
-	if result.Error != nil {
-		return result.Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Stock lives on the batches; the medicine's copy is derived from them.
+		// The master drug is linked through its own endpoint.
+		result := tx.Model(&entity.Medicine{}).
+			Where("id = ? AND pharmacy_id IN (SELECT id FROM pharmacies WHERE user_id = ?)", medicineID, userID).
+			Omit("quantity", "batch_number", "expiry_date", "drug_id", "composition_key").
+			Updates(updatedMedicine)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("medicine not found or unauthorized to update")
+		}
+
+		// The composition key is read from the name as well as the content,
+		// so either may have changed it
+		if updatedMedicine.Name != "" || updatedMedicine.Content != nil {
+			var medicine entity.Medicine
+			if err := tx.Select("id", "name", "content").First(&medicine, "id = ?", medicineID).Error; err != nil {
+				return err
+			}
+			medicine.IndexComposition()
+			if err := tx.Model(&medicine).UpdateColumn("composition_key", *medicine.CompositionKey).Error; err != nil {
+				return err
+			}
+		}
+
+		if updatedMedicine.Quantity == 0 && updatedMedicine.BatchNumber == nil && updatedMedicine.ExpiryDate == nil {
+			return nil
+		}
+		return updateStockBatch(tx, medicineID, updatedMedicine)
+	})
+}
+
+// updateStockBatch applies the stock fields of a medicine update to the named
+// batch, or to the batch sold next when no batch number is given. A batch
+// number the medicine does not have yet is received as a new batch.
+func updateStockBatch(tx *gorm.DB, medicineID uuid.UUID, updatedMedicine *entity.Medicine) error {
+	var batch entity.MedicineBatch
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("medicine_id = ?", medicineID)
+	if updatedMedicine.BatchNumber != nil && *updatedMedicine.BatchNumber != "" {
+		query = query.Where("batch_number = ?", *updatedMedicine.BatchNumber)
+	} else {
+		query = query.Order(fefoOrder)
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("medicine not found or unauthorized to update")
+
+	err := query.First(&batch).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		batch = entity.MedicineBatch{
+			MedicineID:  medicineID,
+			BatchNumber: entity.DefaultBatchNumber,
+			ExpiryDate:  updatedMedicine.ExpiryDate,
+			Quantity:    updatedMedicine.Quantity,
+			ReceivedAt:  time.Now(),
+		}
+		if updatedMedicine.BatchNumber != nil && *updatedMedicine.BatchNumber != "" {
+			batch.BatchNumber = *updatedMedicine.BatchNumber
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		updates := map[string]interface{}{}
+		if updatedMedicine.Quantity != 0 {
+			updates["quantity"] = updatedMedicine.Quantity
+		}
+		if updatedMedicine.ExpiryDate != nil {
+			updates["expiry_date"] = updatedMedicine.ExpiryDate
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&batch).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
 	}
+	return syncMedicineStock(tx, medicineID)
+}
+
+var (
+	// errCatalogueDryRun rolls back a dry run import
+	errCatalogueDryRun = errors.New("catalogue dry run")
+	// errCatalogueRejected rolls back an import with rows found invalid
+	// against the stored catalogue
+	errCatalogueRejected = errors.New("catalogue rejected")
+	// errCataloguePrescriptionOnly marks a row clearing the prescription
+	// requirement of a medicine whose linked drug requires one
+	errCataloguePrescriptionOnly = errors.New("linked drug is prescription only")
+)
+
+func (r *MedicineRepository) ImportCatalogue(ctx context.Context, pharmacyID uuid.UUID, rows []types.CatalogueRow, result *types.CatalogueImportResult) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touched := make(map[uuid.UUID]bool)
+		for _, row := range rows {
+			medicineID, created, err := upsertCatalogueMedicine(tx, pharmacyID, row)
+			if errors.Is(err, errCataloguePrescriptionOnly) {
+				result.Errors = append(result.Errors, types.CatalogueRowError{
+					Line:   row.Line,
+					Column: "prescription_required",
+					Error:  "must be yes, as the medicine's drug is prescription only",
+				})
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			switch {
+			case created:
+				result.MedicinesCreated++
+			case !touched[medicineID]:
+				result.MedicinesUpdated++
+			}
+			touched[medicineID] = true
+
+			if row.BatchNumber == "" && row.Quantity == 0 {
+				continue
+			}
+			if err := upsertCatalogueBatch(tx, medicineID, row, result); err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+		}
+
+		if len(result.Errors) > 0 {
+			return errCatalogueRejected
+		}
+		for medicineID := range touched {
+			if err := syncMedicineStock(tx, medicineID); err != nil {
+				return err
+			}
+		}
+		if result.DryRun {
+			return errCatalogueDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errCatalogueRejected) {
+		result.MedicinesCreated, result.MedicinesUpdated = 0, 0
+		result.BatchesCreated, result.BatchesUpdated = 0, 0
+		return nil
+	}
+	if errors.Is(err, errCatalogueDryRun) {
+		return nil
+	}
+	return err
+}
+
+// upsertCatalogueMedicine finds the pharmacy's medicine with the row's name,
+// ignoring case, and updates it from the row, or creates it
+func upsertCatalogueMedicine(tx *gorm.DB, pharmacyID uuid.UUID, row types.CatalogueRow) (uuid.UUID, bool, error) {
+	var medicine entity.Medicine
+	err := tx.Where("pharmacy_id = ? AND LOWER(name) = LOWER(?)", pharmacyID, row.Name).
+		Order("created_at ASC").
+		First(&medicine).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		medicine = entity.Medicine{
+			Name:         row.Name,
+			Content:      row.Content,
+			Description:  row.Description,
+			Manufacturer: row.Manufacturer,
+			Price:        row.Price,
+			PharmacyID:   pharmacyID,
+			IsActive:     true,
+		}
+		if row.PrescriptionRequired != nil {
+			medicine.PrescriptionRequired = *row.PrescriptionRequired
+		}
+		if row.HSNCode != nil {
+			medicine.HSNCode = *row.HSNCode
+		}
+		if row.GSTRate != nil {
+			medicine.GSTRate = *row.GSTRate
+		}
+		if row.ReorderLevel != nil {
+			medicine.ReorderLevel = *row.ReorderLevel
+		}
+		medicine.IndexComposition()
+		if err := tx.Omit("Batches").Create(&medicine).Error; err != nil {
+			return uuid.Nil, false, err
+		}
+		return medicine.ID, true, nil
+	}
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+
+	updates := map[string]interface{}{
+		"price": row.Price,
+	}
+	if row.Content != nil {
+		medicine.Content = row.Content
+		medicine.IndexComposition()
+		updates["content"] = *row.Content
+		updates["composition_key"] = *medicine.CompositionKey
+	}
+	if row.Description != nil {
+		updates["description"] = *row.Description
+	}
+	if row.Manufacturer != nil {
+		updates["manufacturer"] = *row.Manufacturer
+	}
+	if row.PrescriptionRequired != nil {
+		if !*row.PrescriptionRequired && medicine.DrugID != nil {
+			var drug entity.Drug
+			if err := tx.First(&drug, "id = ?", *medicine.DrugID).Error; err != nil {
+				return uuid.Nil, false, err
+			}
+			if drug.RequiresPrescription() {
+				return uuid.Nil, false, errCataloguePrescriptionOnly
+			}
+		}
+		updates["prescription_required"] = *row.PrescriptionRequired
+	}
+	if row.HSNCode != nil {
+		updates["hsn_code"] = *row.HSNCode
+	}
+	if row.GSTRate != nil {
+		updates["gst_rate"] = *row.GSTRate
+	}
+	if row.ReorderLevel != nil {
+		updates["reorder_level"] = *row.ReorderLevel
+	}
+	if err := tx.Model(&medicine).Updates(updates).Error; err != nil {
+		return uuid.Nil, false, err
+	}
+	return medicine.ID, false, nil
+}
+
+// upsertCatalogueBatch sets the stock of the row's batch to the row's
+// quantity, receiving the batch if the medicine does not have it yet
+func upsertCatalogueBatch(tx *gorm.DB, medicineID uuid.UUID, row types.CatalogueRow, result *types.CatalogueImportResult) error {
+	batchNumber := row.BatchNumber
+	if batchNumber == "" {
+		batchNumber = entity.DefaultBatchNumber
+	}
+
+	var batch entity.MedicineBatch
+	err := tx.Where("medicine_id = ? AND batch_number = ?", medicineID, batchNumber).First(&batch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		batch = entity.MedicineBatch{
+			MedicineID:  medicineID,
+			BatchNumber: batchNumber,
+			ExpiryDate:  row.ExpiryDate,
+			Quantity:    row.Quantity,
+			ReceivedAt:  time.Now(),
+		}
+		if row.CostPrice != nil {
+			batch.CostPrice = *row.CostPrice
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		result.BatchesCreated++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"quantity": row.Quantity,
+	}
+	if row.ExpiryDate != nil {
+		updates["expiry_date"] = row.ExpiryDate
+	}
+	if row.CostPrice != nil {
+		updates["cost_price"] = *row.CostPrice
+	}
+	if err := tx.Model(&batch).Updates(updates).Error; err != nil {
+		return err
+	}
+	result.BatchesUpdated++
 	return nil
 }
+
+func (r *MedicineRepository) ListCatalogue(ctx context.Context, pharmacyID uuid.UUID) ([]*entity.Medicine, error) {
+	var medicines []*entity.Medicine
+	err := r.db.WithContext(ctx).
+		Preload("Batches", func(db *gorm.DB) *gorm.DB {
+			return db.Order(fefoOrder)
+		}).
+		Where("pharmacy_id = ?", pharmacyID).
+		Order("name ASC").
+		Find(&medicines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list catalogue: %w", err)
+	}
+	return medicines, nil
+}
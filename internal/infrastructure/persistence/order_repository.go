@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
 	"github.com/skryfon/collex/internal/domain/repository"
 	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/shared"
 	"gorm.io/gorm"
 )
 
@@ -70,7 +72,24 @@ func (r *OrderRepository) AddToCart(ctx context.Context, cart *entity.Cart) erro
 }
 
 func (r *OrderRepository) CreateOrder(ctx context.Context, order *entity.Order) error {
-	return r.db.WithContext(ctx).Create(order).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return tx.Create(placedHistory(order)).Error
+	})
+}
+
+// placedHistory is the first timeline entry of a new order
+func placedHistory(order *entity.Order) *entity.OrderStatusHistory {
+	userID := order.UserID
+	return &entity.OrderStatusHistory{
+		OrderID:   order.ID,
+		ToStatus:  order.Status,
+		ActorID:   &userID,
+		ActorRole: entity.OrderActorCustomer,
+		Note:      "Order placed",
+	}
 }
 
 func (r *OrderRepository) CreateOrderItem(ctx context.Context, orderItems *entity.OrderItem) error {
@@ -80,6 +99,8 @@ func (r *OrderRepository) GetCartByUserID(ctx context.Context, userID uuid.UUID)
 	var cart entity.Cart
 	err := r.db.WithContext(ctx).
 		Preload("Medicines.Medicine").
+		Preload("Medicines.PrescriptionItem").
+		Preload("Coupon").
 		Where("user_id = ?", userID).
 		First(&cart).Error
 
@@ -171,6 +192,68 @@ func (r *OrderRepository) UpdateCart(ctx context.Context, userID uuid.UUID, medi
 	return r.GetCartByUserID(ctx, userID)
 }
 
+func (r *OrderRepository) FillCartFromPrescription(ctx context.Context, userID uuid.UUID, prescriptionID uuid.UUID, medicines []entity.CartMedicine) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cart entity.Cart
+		err := tx.Where("user_id = ?", userID).First(&cart).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			cart = entity.Cart{UserID: userID}
+			err = tx.Omit("User", "Coupon", "Medicines").Create(&cart).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&cart).Update("prescription_id", prescriptionID).Error; err != nil {
+			return err
+		}
+
+		// Lines added for an earlier e-prescription are not covered by this one
+		if err := tx.Model(&entity.CartMedicine{}).
+			Where("cart_id = ? AND prescription_item_id IS NOT NULL", cart.ID).
+			Update("prescription_item_id", nil).Error; err != nil {
+			return err
+		}
+
+		for _, medicine := range medicines {
+			var existing entity.CartMedicine
+			err := tx.Where("cart_id = ? AND medicine_id = ?", cart.ID, medicine.MedicineID).
+				First(&existing).Error
+
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				medicine.CartID = cart.ID
+				if err := tx.Omit("Medicine", "PrescriptionItem").Create(&medicine).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// Already in the cart: make sure the prescribed quantity is there
+			// without adding to what the patient picked themselves
+			if medicine.Quantity > existing.Quantity {
+				existing.Quantity = medicine.Quantity
+			}
+			existing.PrescriptionItemID = medicine.PrescriptionItemID
+			if err := tx.Omit("Medicine", "PrescriptionItem").Save(&existing).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var cart entity.Cart
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		return err
+	}
+	return r.recalculateTotal(ctx, cart.ID)
+}
+
 // recalculateTotal recalculates the total amount for a cart
 func (r *OrderRepository) recalculateTotal(ctx context.Context, cartID uuid.UUID) error {
 	var cartMedicines []entity.CartMedicine
@@ -193,49 +276,108 @@ func (r *OrderRepository) recalculateTotal(ctx context.Context, cartID uuid.UUID
 		Where("id = ?", cartID).
 		Update("total_amount", total).Error
 }
+
+// CreateOrderFromCart splits the cart into one order per pharmacy under a
+// single checkout and returns the first of them.
 func (r *OrderRepository) CreateOrderFromCart(ctx context.Context, cart *entity.Cart, paymentID uuid.UUID, deliveryAddress string) (*entity.Order, error) {
-	return nil, r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Generate order number
-		orderNumber := fmt.Sprintf("ORD-%s", uuid.New().String()[:8])
-
-		// Create order
-		order := &entity.Order{
-			OrderNumber:     orderNumber,
-			UserID:          cart.UserID,
-			PaymentID:       paymentID,
-			TotalAmount:     cart.TotalAmount,
-			Status:          "confirmed",
-			DeliveryAddress: deliveryAddress,
+	checkoutNumber := fmt.Sprintf("ORD-%s", uuid.New().String()[:8])
+	checkout := &entity.Checkout{
+		CheckoutNumber: checkoutNumber,
+		UserID:         cart.UserID,
+		PaymentID:      paymentID,
+	}
+
+	// Group cart medicines by pharmacy, keeping the cart order
+	byPharmacy := make(map[uuid.UUID]int)
+	for _, cartMedicine := range cart.Medicines {
+		pharmacyID := cartMedicine.Medicine.PharmacyID
+		idx, ok := byPharmacy[pharmacyID]
+		if !ok {
+			idx = len(checkout.Orders)
+			byPharmacy[pharmacyID] = idx
+			checkout.Orders = append(checkout.Orders, entity.Order{
+				UserID:          cart.UserID,
+				PaymentID:       paymentID,
+				PharmacyID:      pharmacyID,
+				Status:          "confirmed",
+				DeliveryAddress: deliveryAddress,
+			})
 		}
 
-		if err := tx.Create(order).Error; err != nil {
+		subtotal := float64(cartMedicine.Quantity) * cartMedicine.Medicine.Price
+		order := &checkout.Orders[idx]
+		order.OrderItems = append(order.OrderItems, entity.OrderItem{
+			MedicineID: cartMedicine.MedicineID,
+			PharmacyID: pharmacyID,
+			Quantity:   cartMedicine.Quantity,
+			Price:      cartMedicine.Medicine.Price,
+			Subtotal:   subtotal,
+			HSNCode:    cartMedicine.Medicine.HSNCode,
+			GSTRate:    cartMedicine.Medicine.GSTRate,
+		})
+		order.TotalAmount += subtotal
+		checkout.TotalAmount += subtotal
+	}
+
+	checkout.NumberOrders()
+
+	if err := r.CreateCheckout(ctx, checkout); err != nil {
+		return nil, err
+	}
+	if len(checkout.Orders) == 0 {
+		return nil, nil
+	}
+	return &checkout.Orders[0], nil
+}
+
+func (r *OrderRepository) CreateCheckout(ctx context.Context, checkout *entity.Checkout) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createCheckout(tx, checkout)
+	})
+}
+
+// createCheckout saves a checkout with its orders and their first timeline
+// entries within tx
+func createCheckout(tx *gorm.DB, checkout *entity.Checkout) error {
+	if err := dispensePrescriptionItems(tx, checkout); err != nil {
+		return err
+	}
+	if err := tx.Create(checkout).Error; err != nil {
+		return err
+	}
+	for i := range checkout.Orders {
+		if err := tx.Create(placedHistory(&checkout.Orders[i])).Error; err != nil {
 			return err
 		}
+	}
+	return linkBatchAllocations(tx, checkout.CheckoutNumber, checkout.Orders)
+}
 
-		// Create order items from cart medicines
-		for _, cartMedicine := range cart.Medicines {
-			orderItem := &entity.OrderItem{
-				OrderID:    order.ID,
-				MedicineID: cartMedicine.MedicineID,
-				Quantity:   cartMedicine.Quantity,
-				Price:      cartMedicine.Medicine.Price,
-				Subtotal:   float64(cartMedicine.Quantity) * cartMedicine.Medicine.Price,
+// dispensePrescriptionItems records the units of each order item against the
+// e-prescription item it was verified by. An item whose prescription has been
+// used up since sends its order to the pharmacy for prescription review.
+func dispensePrescriptionItems(tx *gorm.DB, checkout *entity.Checkout) error {
+	for i := range checkout.Orders {
+		order := &checkout.Orders[i]
+		for j := range order.OrderItems {
+			item := &order.OrderItems[j]
+			if item.PrescriptionItemID == nil {
+				continue
 			}
 
-			if err := tx.Create(orderItem).Error; err != nil {
-				return err
+			result := tx.Model(&entity.PrescriptionItem{}).
+				Where("id = ? AND dispensed_quantity + ? <= quantity", *item.PrescriptionItemID, item.Quantity).
+				UpdateColumn("dispensed_quantity", gorm.Expr("dispensed_quantity + ?", item.Quantity))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				item.PrescriptionItemID = nil
+				order.PrescriptionStatus = entity.PrescriptionStatusPending
 			}
 		}
-
-		// Reload with relationships
-		if err := tx.Preload("OrderItems.Medicine").
-			Preload("User").
-			First(order, order.ID).Error; err != nil {
-			return err
-		}
-
-		return nil
-	})
+	}
+	return nil
 }
 
 // ClearCart clears all items from user's cart
@@ -255,8 +397,12 @@ func (r *OrderRepository) ClearCart(ctx context.Context, userID uuid.UUID) error
 			return err
 		}
 
-		// Update cart total to 0
-		return tx.Model(&cart).Update("total_amount", 0).Error
+		// Reset the total and drop the coupon and prescription used by the checkout
+		return tx.Model(&cart).Updates(map[string]interface{}{
+			"total_amount":    0,
+			"coupon_id":       nil,
+			"prescription_id": nil,
+		}).Error
 	})
 }
 
@@ -265,7 +411,10 @@ func (r *OrderRepository) GetOrderByID(ctx context.Context, orderID uuid.UUID) (
 	var order entity.Order
 	err := r.db.WithContext(ctx).
 		Preload("Payment").
+		Preload("Pharmacy").
+		Preload("Prescription").
 		Preload("OrderItems.Medicine.Pharmacy").
+		Preload("OrderItems.Batches.Batch").
 		First(&order, "id = ?", orderID).Error
 
 	if err != nil {
@@ -277,6 +426,16 @@ func (r *OrderRepository) GetOrderByID(ctx context.Context, orderID uuid.UUID) (
 	return &order, nil
 }
 
+// GetOrdersByPaymentID returns the orders paid for by a payment
+func (r *OrderRepository) GetOrdersByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*entity.Order, error) {
+	var orders []*entity.Order
+	err := r.db.WithContext(ctx).
+		Where("payment_id = ?", paymentID).
+		Order("order_number ASC").
+		Find(&orders).Error
+	return orders, err
+}
+
 // GetUserOrders retrieves all orders for a user with pagination
 func (r *OrderRepository) GetUserOrders(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Order, int64, error) {
 	var orders []*entity.Order
@@ -300,13 +459,20 @@ func (r *OrderRepository) GetUserOrders(ctx context.Context, userID uuid.UUID, p
 }
 
 func (r *OrderRepository) GetTotalRevenue(ctx context.Context, pharmacyID uuid.UUID) (float64, error) {
+	itemTotals := r.db.Table("order_items").
+		Select("order_id, SUM(subtotal - discount) AS total").
+		Group("order_id")
+
+	// Refunds are taken off what the order was paid
 	var totalRevenue float64
 	err := r.db.WithContext(ctx).
-		Table("order_items").
-		Joins("JOIN medicines ON medicines.id = order_items.medicine_id").
-		Joins("JOIN orders ON orders.id = order_items.order_id").
-		Where("medicines.pharmacy_id = ? AND orders.status IN ?", pharmacyID, []string{"delivered", "confirmed"}).
-		Select("COALESCE(SUM(order_items.subtotal), 0)").
+		Table("orders").
+		Joins("JOIN (?) AS items ON items.order_id = orders.id", itemTotals).
+		Joins("JOIN payments ON payments.id = orders.payment_id").
+		Where("orders.pharmacy_id = ? AND orders.status IN ?", pharmacyID, []string{"delivered", "confirmed"}).
+		// Cash on delivery only counts once the order's cash is collected
+		Where("NOT (payments.payment_method = ? AND orders.cash_collected_at IS NULL AND payments.collected_at IS NULL)", string(shared.PaymentMethodCash)).
+		Select("COALESCE(SUM(items.total - orders.refunded_amount), 0)").
 		Scan(&totalRevenue).Error
 	return totalRevenue, err
 }
@@ -318,10 +484,110 @@ func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID uuid.UU
 		Where("id = ?", orderID).
 		Update("status", status).Error
 }
+func (r *OrderRepository) HasActiveDelivery(ctx context.Context, orderID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&entity.Delivery{}).
+		Where("order_id = ? AND status IN ?", orderID, activeDeliveryStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *OrderRepository) TransitionOrderStatus(ctx context.Context, history *entity.OrderStatusHistory) (bool, error) {
+	updated := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		updated, err = transitionOrderStatus(tx, history)
+		return err
+	})
+	return updated, err
+}
+
+// transitionOrderStatus moves the order within tx and records the change,
+// reporting false when the order was not in history.FromStatus
+func transitionOrderStatus(tx *gorm.DB, history *entity.OrderStatusHistory) (bool, error) {
+	// An order out with a delivery partner is shipped and delivered by the
+	// delivery, not by the pharmacy
+	if history.ActorRole == entity.OrderActorPharmacy &&
+		(history.ToStatus == entity.OrderStatusShipped || history.ToStatus == entity.OrderStatusDelivered) {
+		active, err := orderHasActiveDelivery(tx, history.OrderID)
+		if err != nil || active {
+			return false, err
+		}
+	}
+
+	updates := map[string]interface{}{
+		"status": history.ToStatus,
+	}
+	if history.ToStatus == entity.OrderStatusCancelled {
+		updates["cancellation_reason"] = history.Note
+		updates["cancelled_at"] = time.Now()
+	}
+
+	result := tx.Model(&entity.Order{}).
+		Where("id = ? AND status = ?", history.OrderID, history.FromStatus).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	return true, tx.Create(history).Error
+}
+
+func (r *OrderRepository) CompleteCancellation(ctx context.Context, history *entity.OrderStatusHistory) (bool, error) {
+	updated := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Moving the order first keeps a concurrent cancellation from
+		// restocking it twice
+		var err error
+		updated, err = transitionOrderStatus(tx, history)
+		if err != nil || !updated {
+			return err
+		}
+
+		var items []entity.OrderItem
+		if err := tx.Where("order_id = ?", history.OrderID).Find(&items).Error; err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if item.RefundedQuantity < item.Quantity {
+				if err := restockBatches(tx, item.ID, item.MedicineID, item.Quantity-item.RefundedQuantity); err != nil {
+					return err
+				}
+			}
+
+			// Nothing was handed over, so the prescription can be filled again
+			if item.PrescriptionItemID != nil {
+				if err := tx.Model(&entity.PrescriptionItem{}).
+					Where("id = ?", *item.PrescriptionItemID).
+					UpdateColumn("dispensed_quantity", gorm.Expr("GREATEST(dispensed_quantity - ?, 0)", item.Quantity)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return updated, err
+}
+
+func (r *OrderRepository) GetOrderStatusHistory(ctx context.Context, orderID uuid.UUID) ([]*entity.OrderStatusHistory, error) {
+	var history []*entity.OrderStatusHistory
+	err := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("created_at ASC").
+		Find(&history).Error
+	return history, err
+}
+
 func (r *OrderRepository) GetCartByID(ctx context.Context, cartID uuid.UUID) (*entity.Cart, error) {
 	var cart entity.Cart
 	err := r.db.WithContext(ctx).
 		Preload("Medicines.Medicine").
+		Preload("Medicines.PrescriptionItem").
+		Preload("Coupon").
 		First(&cart, "id = ?", cartID).Error
 
 	if err != nil {
@@ -382,11 +648,13 @@ func (r *OrderRepository) GetPharmacyOrders(ctx context.Context, pharmacyID uuid
 		return nil, 0, err
 	}
 
-	// Calculate total amount from order items
+	// Calculate total amount from the pharmacy's own order items
 	for _, order := range orders {
 		var totalAmount float64
 		for _, item := range order.OrderItems {
-			totalAmount += item.Subtotal
+			if item.SoldBy(pharmacyID) {
+				totalAmount += item.Subtotal - item.Discount
+			}
 		}
 		order.TotalAmount = totalAmount
 	}
@@ -3,10 +3,14 @@ package persistence
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/shared"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRepository struct {
@@ -55,6 +59,21 @@ func (r *PaymentRepository) GetByRazorpayOrderID(ctx context.Context, razorpayOr
 	return &payment, nil
 }
 
+func (r *PaymentRepository) GetByRazorpayPaymentID(ctx context.Context, razorpayPaymentID string) (*entity.Payment, error) {
+	var payment entity.Payment
+	err := r.db.WithContext(ctx).
+		Where("razorpay_payment_id = ?", razorpayPaymentID).
+		First(&payment).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
+
 func (r *PaymentRepository) UpdateStatus(ctx context.Context, orderID string, status string, razorpayPaymentID, razorpaySignature, paymentMethod, failureReason string) error {
 	updates := map[string]interface{}{
 		"status": status,
@@ -79,6 +98,160 @@ func (r *PaymentRepository) UpdateStatus(ctx context.Context, orderID string, st
 		Updates(updates).Error
 }
 
+// UpdateStatusFrom moves a payment to status only if it is currently in one of
+// fromStatuses, so concurrent verify and webhook calls cannot both win.
+func (r *PaymentRepository) UpdateStatusFrom(ctx context.Context, orderID string, fromStatuses []string, status string, razorpayPaymentID, razorpaySignature, paymentMethod, failureReason string) (bool, error) {
+	return updateStatusFrom(r.db.WithContext(ctx), orderID, fromStatuses, status, razorpayPaymentID, razorpaySignature, paymentMethod, failureReason)
+}
+
+// CompletePayment marks a payment successful and, in the same transaction,
+// commits its held stock, redeems its coupon and creates its checkout when
+// one is given. A failure in any of them leaves the payment as it was, so the
+// next verify call, webhook delivery or reconciliation completes it again.
+func (r *PaymentRepository) CompletePayment(ctx context.Context, orderID string, fromStatuses []string, razorpayPaymentID, razorpaySignature, paymentMethod string, checkout *entity.Checkout) (bool, error) {
+	completed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updated, err := updateStatusFrom(tx, orderID, fromStatuses, "success", razorpayPaymentID, razorpaySignature, paymentMethod, "")
+		if err != nil {
+			return fmt.Errorf("failed to update payment status: %w", err)
+		}
+		if !updated {
+			return nil
+		}
+
+		if err := commitReservations(tx, orderID); err != nil {
+			return fmt.Errorf("failed to commit stock reservation: %w", err)
+		}
+		if err := redeemCoupon(tx, orderID); err != nil {
+			return fmt.Errorf("failed to redeem coupon: %w", err)
+		}
+		if checkout != nil {
+			if err := createCheckout(tx, checkout); err != nil {
+				return fmt.Errorf("failed to create order: %w", err)
+			}
+		}
+		completed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return completed, nil
+}
+
+func updateStatusFrom(db *gorm.DB, orderID string, fromStatuses []string, status string, razorpayPaymentID, razorpaySignature, paymentMethod, failureReason string) (bool, error) {
+	updates := map[string]interface{}{
+		"status": status,
+	}
+
+	if razorpayPaymentID != "" {
+		updates["razorpay_payment_id"] = razorpayPaymentID
+	}
+	if razorpaySignature != "" {
+		updates["razorpay_signature"] = razorpaySignature
+	}
+	if paymentMethod != "" {
+		updates["payment_method"] = paymentMethod
+	}
+	if failureReason != "" {
+		updates["failure_reason"] = failureReason
+	}
+
+	result := db.Model(&entity.Payment{}).
+		Where("order_id = ? AND status IN ?", orderID, fromStatuses).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *PaymentRepository) GetStalePendingPayments(ctx context.Context, olderThan time.Time, limit int) ([]*entity.Payment, error) {
+	var payments []*entity.Payment
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND razorpay_order_id <> '' AND created_at < ?", "pending", olderThan).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&payments).Error
+	return payments, err
+}
+
+func (r *PaymentRepository) GetGatewayPaymentsCreatedBetween(ctx context.Context, from, to time.Time) ([]*entity.Payment, error) {
+	var payments []*entity.Payment
+	err := r.db.WithContext(ctx).
+		Where("razorpay_order_id <> '' AND created_at >= ? AND created_at < ?", from, to).
+		Order("created_at ASC").
+		Find(&payments).Error
+	return payments, err
+}
+
+func (r *PaymentRepository) GetByRazorpayOrderIDs(ctx context.Context, razorpayOrderIDs []string) ([]*entity.Payment, error) {
+	var payments []*entity.Payment
+	if len(razorpayOrderIDs) == 0 {
+		return payments, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("razorpay_order_id IN ?", razorpayOrderIDs).
+		Find(&payments).Error
+	return payments, err
+}
+
+func (r *PaymentRepository) MarkCashCollected(ctx context.Context, orderID uuid.UUID, collectedBy uuid.UUID) (bool, error) {
+	collected := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order entity.Order
+		if err := tx.Select("id", "payment_id").First(&order, "id = ?", orderID).Error; err != nil {
+			return err
+		}
+
+		// Lock the payment so the last two orders collected at once cannot
+		// both leave it pending
+		var payment entity.Payment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND payment_method = ? AND status = ?", order.PaymentID, string(shared.PaymentMethodCash), "pending").
+			First(&payment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&entity.Order{}).
+			Where("id = ? AND cash_collected_at IS NULL", orderID).
+			Updates(map[string]interface{}{
+				"cash_collected_at": now,
+				"cash_collected_by": collectedBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		collected = true
+
+		var owing int64
+		if err := tx.Model(&entity.Order{}).
+			Where("payment_id = ? AND cash_collected_at IS NULL AND status NOT IN ?", payment.ID,
+				[]string{entity.OrderStatusCancellationPending, entity.OrderStatusCancelled, entity.OrderStatusRefunded}).
+			Count(&owing).Error; err != nil {
+			return err
+		}
+		if owing > 0 {
+			return nil
+		}
+
+		return tx.Model(&payment).Updates(map[string]interface{}{
+			"status":       "success",
+			"collected_at": now,
+			"collected_by": collectedBy,
+		}).Error
+	})
+	return collected, err
+}
+
 func (r *PaymentRepository) GetUserPayments(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Payment, int64, error) {
 	var payments []*entity.Payment
 	var total int64
@@ -99,4 +272,46 @@ func (r *PaymentRepository) GetUserPayments(ctx context.Context, userID uuid.UUI
 	return payments, total, err
 }
 
+// CreateWebhookEvent stores a webhook delivery and reports whether it was new.
+// A delivery whose event ID has already been stored is left untouched.
+func (r *PaymentRepository) CreateWebhookEvent(ctx context.Context, event *entity.PaymentWebhookEvent) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).
+		Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *PaymentRepository) GetWebhookEvent(ctx context.Context, eventID string) (*entity.PaymentWebhookEvent, error) {
+	var event entity.PaymentWebhookEvent
+	err := r.db.WithContext(ctx).
+		Where("event_id = ?", eventID).
+		First(&event).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *PaymentRepository) UpdateWebhookEventStatus(ctx context.Context, eventID string, status string, errMsg string) error {
+	updates := map[string]interface{}{
+		"status": status,
+		"error":  errMsg,
+	}
+	if status == "processed" {
+		updates["processed_at"] = time.Now()
+	}
+
+	return r.db.WithContext(ctx).
+		Model(&entity.PaymentWebhookEvent{}).
+		Where("event_id = ?", eventID).
+		Updates(updates).Error
+}
+
 // GetPhar\
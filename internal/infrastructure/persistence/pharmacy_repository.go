@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"gorm.io/gorm"
+)
+
+// pharmacyDistanceSQL is the haversine distance in km from the point bound to
+// its placeholders (latitude, latitude, longitude) to a pharmacy
+const pharmacyDistanceSQL = `2 * 6371 * ASIN(LEAST(1, SQRT(
+	POWER(SIN(RADIANS(pharmacies.latitude - ?) / 2), 2) +
+	COS(RADIANS(?)) * COS(RADIANS(pharmacies.latitude)) * POWER(SIN(RADIANS(pharmacies.longitude - ?) / 2), 2))))`
+
+// nearbyHit is a row found by a nearby search before it is loaded
+type nearbyHit struct {
+	ID         uuid.UUID
+	DistanceKm float64
+}
+
+type PharmacyRepository struct {
+	db *gorm.DB
+}
+
+// NewPharmacyRepository creates a new pharmacy repository.
+func NewPharmacyRepository(db *gorm.DB) repository.PharmacyRepository {
+	return &PharmacyRepository{
+		db: db,
+	}
+}
+
+func (r *PharmacyRepository) FindNearby(ctx context.Context, origin entity.GeoLocation, req types.NearbyPharmaciesRequest) ([]types.NearbyPharmacy, int64, error) {
+	inner := withinBoundingBox(r.db.Model(&entity.Pharmacy{}), origin, req.RadiusKm).
+		Select("pharmacies.id, "+pharmacyDistanceSQL+" AS distance_km", origin.Latitude, origin.Latitude, origin.Longitude).
+		Where("pharmacies.is_active")
+	nearby := func() *gorm.DB {
+		return r.db.WithContext(ctx).Table("(?) AS nearby", inner).Where("distance_km <= ?", req.RadiusKm)
+	}
+
+	var total int64
+	if err := nearby().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count nearby pharmacies: %w", err)
+	}
+
+	var hits []nearbyHit
+	if err := nearby().
+		Select("id, distance_km").
+		Order("distance_km ASC").
+		Offset((req.Page - 1) * req.Limit).
+		Limit(req.Limit).
+		Scan(&hits).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to find nearby pharmacies: %w", err)
+	}
+
+	var pharmacies []*entity.Pharmacy
+	if err := r.db.WithContext(ctx).Where("id IN ?", hitIDs(hits)).Find(&pharmacies).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load nearby pharmacies: %w", err)
+	}
+	byID := make(map[uuid.UUID]*entity.Pharmacy, len(pharmacies))
+	for _, pharmacy := range pharmacies {
+		byID[pharmacy.ID] = pharmacy
+	}
+
+	results := make([]types.NearbyPharmacy, 0, len(hits))
+	for _, hit := range hits {
+		if pharmacy, ok := byID[hit.ID]; ok {
+			results = append(results, types.NearbyPharmacy{Pharmacy: pharmacy, DistanceKm: hit.DistanceKm})
+		}
+	}
+	return results, total, nil
+}
+
+func (r *PharmacyRepository) ListUserIDs(ctx context.Context, pharmacyIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(pharmacyIDs) == 0 {
+		return nil, nil
+	}
+
+	var userIDs []uuid.UUID
+	if err := r.db.WithContext(ctx).
+		Model(&entity.Pharmacy{}).
+		Where("id IN ?", pharmacyIDs).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pharmacy users: %w", err)
+	}
+	return userIDs, nil
+}
+
+// withinBoundingBox scopes a query joined to pharmacies to the geocoded ones
+// in the box around origin, which holds every point within radiusKm of it, so
+// the exact distance is only worked out for those
+func withinBoundingBox(query *gorm.DB, origin entity.GeoLocation, radiusKm float64) *gorm.DB {
+	minLat, maxLat, minLng, maxLng := origin.BoundingBox(radiusKm)
+	return query.
+		Where("pharmacies.latitude BETWEEN ? AND ? AND pharmacies.longitude BETWEEN ? AND ?", minLat, maxLat, minLng, maxLng).
+		Where("NOT (pharmacies.latitude = 0 AND pharmacies.longitude = 0)")
+}
+
+// hitIDs returns the IDs of nearby search hits in order
+func hitIDs(hits []nearbyHit) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
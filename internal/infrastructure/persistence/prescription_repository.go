@@ -0,0 +1,128 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"gorm.io/gorm"
+)
+
+type PrescriptionRepository struct {
+	db *gorm.DB
+}
+
+// NewPrescriptionRepository creates a new prescription repository.
+func NewPrescriptionRepository(db *gorm.DB) repository.PrescriptionRepository {
+	return &PrescriptionRepository{
+		db: db,
+	}
+}
+
+func (r *PrescriptionRepository) Create(ctx context.Context, prescription *entity.Prescription) error {
+	return r.db.WithContext(ctx).Omit("OpChart").Create(prescription).Error
+}
+
+func (r *PrescriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Prescription, error) {
+	var prescription entity.Prescription
+	err := r.db.WithContext(ctx).
+		Preload("OpChart").
+		Where("id = ?", id).
+		First(&prescription).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+func (r *PrescriptionRepository) GetByOpChartID(ctx context.Context, userID uuid.UUID, opChartID uuid.UUID) (*entity.Prescription, error) {
+	var prescription entity.Prescription
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND op_chart_id = ?", userID, opChartID).
+		Order("created_at ASC").
+		First(&prescription).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+func (r *PrescriptionRepository) ListByUser(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Prescription, int64, error) {
+	var prescriptions []*entity.Prescription
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.Prescription{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err := query.Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Preload("OpChart").
+		Find(&prescriptions).Error
+
+	return prescriptions, total, err
+}
+
+func (r *PrescriptionRepository) ListReviews(ctx context.Context, filter types.ListPrescriptionReviewsFilter) ([]*entity.Order, int64, error) {
+	var orders []*entity.Order
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.Order{}).
+		Where("pharmacy_id = ? AND prescription_status = ?", filter.PharmacyID, filter.Status)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.Limit
+	err := query.Order("created_at ASC").
+		Offset(offset).
+		Limit(filter.Limit).
+		Preload("User").
+		Preload("OrderItems.Medicine").
+		Preload("Prescription.OpChart").
+		Find(&orders).Error
+
+	return orders, total, err
+}
+
+func (r *PrescriptionRepository) ReviewOrder(ctx context.Context, orderID uuid.UUID, status string, reviewerID uuid.UUID, note string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("id = ? AND prescription_status = ?", orderID, entity.PrescriptionStatusPending).
+		Updates(map[string]interface{}{
+			"prescription_status":      status,
+			"prescription_note":        note,
+			"prescription_reviewed_by": reviewerID,
+			"prescription_reviewed_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *PrescriptionRepository) ResubmitOrder(ctx context.Context, orderID uuid.UUID, prescriptionID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("id = ? AND prescription_status IN ?", orderID, []string{entity.PrescriptionStatusPending, entity.PrescriptionStatusRejected}).
+		Updates(map[string]interface{}{
+			"prescription_id":          prescriptionID,
+			"prescription_status":      entity.PrescriptionStatusPending,
+			"prescription_note":        "",
+			"prescription_reviewed_by": nil,
+			"prescription_reviewed_at": nil,
+		})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"gorm.io/gorm"
+)
+
+type ReconciliationRepository struct {
+	db *gorm.DB
+}
+
+// NewReconciliationRepository creates a new reconciliation report repository.
+func NewReconciliationRepository(db *gorm.DB) repository.ReconciliationRepository {
+	return &ReconciliationRepository{
+		db: db,
+	}
+}
+
+func (r *ReconciliationRepository) SaveReport(ctx context.Context, report *entity.ReconciliationReport) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing entity.ReconciliationReport
+		err := tx.Where("report_date = ?", report.ReportDate).First(&existing).Error
+		switch {
+		case err == nil:
+			if err := tx.Unscoped().Where("report_id = ?", existing.ID).Delete(&entity.ReconciliationMismatch{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&existing).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		return tx.Create(report).Error
+	})
+}
+
+func (r *ReconciliationRepository) GetReportByDate(ctx context.Context, reportDate string) (*entity.ReconciliationReport, error) {
+	var report entity.ReconciliationReport
+	err := r.db.WithContext(ctx).
+		Preload("Mismatches").
+		Where("report_date = ?", reportDate).
+		First(&report).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *ReconciliationRepository) ListReports(ctx context.Context, page, limit int) ([]*entity.ReconciliationReport, int64, error) {
+	var reports []*entity.ReconciliationReport
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.ReconciliationReport{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Order("report_date DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&reports).Error
+	return reports, total, err
+}
@@ -0,0 +1,231 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundRepository struct {
+	db *gorm.DB
+}
+
+// NewRefundRepository creates a new refund repository.
+func NewRefundRepository(db *gorm.DB) repository.RefundRepository {
+	return &RefundRepository{
+		db: db,
+	}
+}
+
+// errRefundTaken rolls back a refund reservation another refund got to first
+var errRefundTaken = errors.New("refund items already refunded")
+
+func (r *RefundRepository) ReserveRefund(ctx context.Context, refund *entity.Refund) (bool, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+
+		// The guard keeps concurrent refunds from taking the same units
+		for _, item := range refund.Items {
+			result := tx.Model(&entity.OrderItem{}).
+				Where("id = ? AND refunded_quantity + ? <= quantity", item.OrderItemID, item.Quantity).
+				UpdateColumn("refunded_quantity", gorm.Expr("refunded_quantity + ?", item.Quantity))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errRefundTaken
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errRefundTaken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve refund: %w", err)
+	}
+	return true, nil
+}
+
+func (r *RefundRepository) CompleteRefund(ctx context.Context, refund *entity.Refund) (bool, error) {
+	orderRefunded := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.Refund{}).
+			Where("id = ?", refund.ID).
+			Updates(map[string]interface{}{
+				"razorpay_refund_id": refund.RazorpayRefundID,
+				"status":             refund.Status,
+				"processed_at":       refund.ProcessedAt,
+			}).Error; err != nil {
+			return err
+		}
+
+		// Put the refunded units back on the shelf
+		for _, item := range refund.Items {
+			if err := restockBatches(tx, item.OrderItemID, item.MedicineID, item.Quantity); err != nil {
+				return err
+			}
+		}
+
+		var order entity.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status").
+			First(&order, "id = ?", refund.OrderID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&order).
+			UpdateColumn("refunded_amount", gorm.Expr("refunded_amount + ?", refund.Amount)).Error; err != nil {
+			return err
+		}
+
+		// The order is refunded once none of its items has units left and no
+		// other refund of it is still waiting on the gateway
+		var remaining, waiting int64
+		if err := tx.Model(&entity.OrderItem{}).
+			Where("order_id = ? AND refunded_quantity < quantity", refund.OrderID).
+			Count(&remaining).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.Refund{}).
+			Where("order_id = ? AND id <> ? AND status = ?", refund.OrderID, refund.ID, entity.RefundStatusInitiated).
+			Count(&waiting).Error; err != nil {
+			return err
+		}
+		if remaining == 0 && waiting == 0 && entity.CanTransitionOrder(order.Status, entity.OrderStatusRefunded, entity.OrderActorSystem) {
+			initiatedBy := refund.InitiatedBy
+			moved, err := transitionOrderStatus(tx, &entity.OrderStatusHistory{
+				OrderID:    order.ID,
+				FromStatus: order.Status,
+				ToStatus:   entity.OrderStatusRefunded,
+				ActorID:    &initiatedBy,
+				ActorRole:  entity.OrderActorSystem,
+				Note:       refund.Reason,
+			})
+			if err != nil {
+				return err
+			}
+			orderRefunded = moved
+		}
+
+		// A payment can span several orders, so compare against all its refunds
+		var payment entity.Payment
+		if err := tx.First(&payment, "id = ?", refund.PaymentID).Error; err != nil {
+			return err
+		}
+
+		var refunded float64
+		if err := tx.Model(&entity.Refund{}).
+			Where("payment_id = ? AND status NOT IN ?", refund.PaymentID, []string{entity.RefundStatusInitiated, entity.RefundStatusFailed}).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&refunded).Error; err != nil {
+			return err
+		}
+
+		paymentStatus := "partially_refunded"
+		if refunded >= payment.Amount-0.005 {
+			paymentStatus = "refunded"
+		}
+
+		return tx.Model(&payment).Update("status", paymentStatus).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to complete refund: %w", err)
+	}
+	return orderRefunded, nil
+}
+
+func (r *RefundRepository) ReleaseRefund(ctx context.Context, refund *entity.Refund, failureReason string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Refund{}).
+			Where("id = ? AND status = ?", refund.ID, entity.RefundStatusInitiated).
+			Updates(map[string]interface{}{
+				"status":         entity.RefundStatusFailed,
+				"failure_reason": failureReason,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		for _, item := range refund.Items {
+			if err := tx.Model(&entity.OrderItem{}).
+				Where("id = ?", item.OrderItemID).
+				UpdateColumn("refunded_quantity", gorm.Expr("refunded_quantity - ?", item.Quantity)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *RefundRepository) GetByRazorpayRefundID(ctx context.Context, razorpayRefundID string) (*entity.Refund, error) {
+	var refund entity.Refund
+	err := r.db.WithContext(ctx).
+		Where("razorpay_refund_id = ?", razorpayRefundID).
+		First(&refund).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *RefundRepository) UpdateStatus(ctx context.Context, refundID uuid.UUID, status string, failureReason string) error {
+	updates := map[string]interface{}{
+		"status": status,
+	}
+	if status == "processed" {
+		updates["processed_at"] = time.Now()
+	}
+	if failureReason != "" {
+		updates["failure_reason"] = failureReason
+	}
+
+	return r.db.WithContext(ctx).
+		Model(&entity.Refund{}).
+		Where("id = ?", refundID).
+		Updates(updates).Error
+}
+
+func (r *RefundRepository) ListRefunds(ctx context.Context, filter types.ListRefundsFilter) ([]*entity.Refund, int64, error) {
+	var refunds []*entity.Refund
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.Refund{})
+
+	if filter.PharmacyID != nil {
+		query = query.Where("pharmacy_id = ?", *filter.PharmacyID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.Limit
+	err := query.Order("created_at DESC").
+		Offset(offset).
+		Limit(filter.Limit).
+		Preload("Items.OrderItem.Medicine").
+		Preload("Order").
+		Find(&refunds).Error
+
+	return refunds, total, err
+}
@@ -0,0 +1,150 @@
+package persistence
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockReservationRepository struct {
+	db *gorm.DB
+}
+
+// NewStockReservationRepository creates a new stock reservation repository.
+func NewStockReservationRepository(db *gorm.DB) repository.StockReservationRepository {
+	return &StockReservationRepository{
+		db: db,
+	}
+}
+
+func (r *StockReservationRepository) Reserve(ctx context.Context, paymentOrderID string, items []entity.PaymentLineItem, expiresAt time.Time) (bool, error) {
+	wanted := make(map[uuid.UUID]int)
+	medicineIDs := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		if _, ok := wanted[item.MedicineID]; !ok {
+			medicineIDs = append(medicineIDs, item.MedicineID)
+		}
+		wanted[item.MedicineID] += item.Quantity
+	}
+
+	// Lock medicine rows in a fixed order so checkouts sharing medicines
+	// cannot deadlock each other.
+	sort.Slice(medicineIDs, func(i, j int) bool {
+		return medicineIDs[i].String() < medicineIDs[j].String()
+	})
+
+	reserved := true
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		for _, medicineID := range medicineIDs {
+			var medicine entity.Medicine
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id").
+				First(&medicine, "id = ?", medicineID).Error; err != nil {
+				return err
+			}
+
+			available, err := sellableQuantity(tx, medicineID, now)
+			if err != nil {
+				return err
+			}
+
+			var held int64
+			if err := tx.Model(&entity.StockReservation{}).
+				Where("medicine_id = ? AND status = ? AND expires_at > ?", medicineID, "active", now).
+				Select("COALESCE(SUM(quantity), 0)").
+				Scan(&held).Error; err != nil {
+				return err
+			}
+
+			if available-held < int64(wanted[medicineID]) {
+				reserved = false
+				return nil
+			}
+		}
+
+		reservations := make([]entity.StockReservation, 0, len(medicineIDs))
+		for _, medicineID := range medicineIDs {
+			reservations = append(reservations, entity.StockReservation{
+				PaymentOrderID: paymentOrderID,
+				MedicineID:     medicineID,
+				Quantity:       wanted[medicineID],
+				Status:         "active",
+				ExpiresAt:      expiresAt,
+			})
+		}
+		return tx.Create(&reservations).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return reserved, nil
+}
+
+// Commit decrements stock for every reservation of the payment that has not
+// been committed yet, taking the units from the batches that expire first.
+// Reservations released by expiry or a failed attempt are committed as well,
+// since the payment has been captured by then.
+func (r *StockReservationRepository) Commit(ctx context.Context, paymentOrderID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return commitReservations(tx, paymentOrderID)
+	})
+}
+
+// commitReservations takes the stock held for a payment out of its batches
+// within tx
+func commitReservations(tx *gorm.DB, paymentOrderID string) error {
+	var reservations []entity.StockReservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("payment_order_id = ? AND status <> ?", paymentOrderID, "committed").
+		Order("medicine_id").
+		Find(&reservations).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, reservation := range reservations {
+		if err := allocateBatches(tx, paymentOrderID, reservation.MedicineID, reservation.Quantity); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&entity.StockReservation{}).
+			Where("id = ?", reservation.ID).
+			Updates(map[string]interface{}{
+				"status":       "committed",
+				"committed_at": now,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *StockReservationRepository) Release(ctx context.Context, paymentOrderID string) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.StockReservation{}).
+		Where("payment_order_id = ? AND status = ?", paymentOrderID, "active").
+		Updates(map[string]interface{}{
+			"status":      "released",
+			"released_at": time.Now(),
+		}).Error
+}
+
+func (r *StockReservationRepository) ReleaseExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.StockReservation{}).
+		Where("status = ? AND expires_at <= ?", "active", now).
+		Updates(map[string]interface{}{
+			"status":      "released",
+			"released_at": now,
+		})
+	return result.RowsAffected, result.Error
+}
@@ -68,6 +68,14 @@ func (s *Server) SetupRoutes() {
 func (s *Server) Start() error {
 	s.SetupRoutes()
 
+	if s.container != nil && s.container.Scheduler != nil {
+		s.container.Scheduler.Start()
+		defer s.container.Scheduler.Stop()
+	}
+	if s.container != nil && s.container.EventBus != nil {
+		defer s.container.EventBus.Close()
+	}
+
 	address := fmt.Sprintf(":%s", s.port)
 	log.Printf("Server starting on %s", address)
 
@@ -0,0 +1,83 @@
+// internal/infrastructure/spreadsheet/codec.go
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+type codec struct{}
+
+// NewCodec returns a codec for CSV and XLSX files
+func NewCodec() service.SpreadsheetCodec {
+	return codec{}
+}
+
+func (codec) Decode(format string, r io.Reader, maxRows int) ([][]string, error) {
+	switch format {
+	case service.SpreadsheetCSV:
+		return readCSV(r, maxRows)
+	case service.SpreadsheetXLSX:
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return readXLSX(content, maxRows)
+	default:
+		return nil, service.ErrUnsupportedSpreadsheet
+	}
+}
+
+func readCSV(r io.Reader, maxRows int) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows [][]string
+	filled := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !blankRow(row) {
+			if filled++; filled > maxRows {
+				return nil, service.ErrSpreadsheetTooLarge
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// blankRow reports whether every cell of the row is empty
+func blankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (codec) Encode(format string, rows [][]string) ([]byte, error) {
+	switch format {
+	case service.SpreadsheetCSV:
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		if err := writer.WriteAll(rows); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case service.SpreadsheetXLSX:
+		return writeXLSX(rows)
+	default:
+		return nil, service.ErrUnsupportedSpreadsheet
+	}
+}
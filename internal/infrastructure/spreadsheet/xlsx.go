@@ -0,0 +1,326 @@
+// internal/infrastructure/spreadsheet/xlsx.go
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+var errInvalidWorkbook = errors.New("invalid xlsx workbook")
+
+const (
+	// maxPartSize is the most XML read from one part of a workbook, as a
+	// small upload may unpack to far more
+	maxPartSize = 50 << 20
+	// maxColumns is the number of columns Excel allows, A to XFD
+	maxColumns = 16384
+)
+
+// Parts of an xlsx package needed to read the cell text of the first sheet
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxRow struct {
+	Cells []struct {
+		Ref    string        `xml:"r,attr"`
+		Type   string        `xml:"t,attr"`
+		Value  string        `xml:"v"`
+		Inline *xlsxRichText `xml:"is"`
+	} `xml:"c"`
+}
+
+// readXLSX returns the cell text of the first sheet of a workbook. Rows are
+// padded so cells keep their column position; numbers, including dates, are
+// returned as Excel stores them. Reading stops with ErrSpreadsheetTooLarge
+// once more than maxRows rows that are not blank are found.
+func readXLSX(content []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, errInvalidWorkbook
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXMLFile(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	file, ok := files[sheetPath]
+	if !ok {
+		return nil, errInvalidWorkbook
+	}
+	return readSheetRows(file, shared, maxRows)
+}
+
+// readSheetRows decodes the sheet one row at a time so that reading can stop
+// as soon as the sheet holds too many rows
+func readSheetRows(file *zip.File, shared xlsxSharedStrings, maxRows int) ([][]string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoder := xml.NewDecoder(io.LimitReader(reader, maxPartSize))
+	var rows [][]string
+	filled := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, errInvalidWorkbook
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return nil, errInvalidWorkbook
+		}
+		cells, err := rowCells(row, shared)
+		if err != nil {
+			return nil, err
+		}
+		if !blankRow(cells) {
+			if filled++; filled > maxRows {
+				return nil, service.ErrSpreadsheetTooLarge
+			}
+		}
+		rows = append(rows, cells)
+	}
+}
+
+// rowCells returns the text of a row's cells at their column positions
+func rowCells(row xlsxRow, shared xlsxSharedStrings) ([]string, error) {
+	var cells []string
+	for i, cell := range row.Cells {
+		column := i
+		if cell.Ref != "" {
+			var ok bool
+			if column, ok = columnIndex(cell.Ref); !ok {
+				return nil, errInvalidWorkbook
+			}
+		}
+		if column >= maxColumns {
+			return nil, errInvalidWorkbook
+		}
+		for len(cells) <= column {
+			cells = append(cells, "")
+		}
+
+		switch cell.Type {
+		case "s":
+			var index int
+			if _, err := fmt.Sscan(cell.Value, &index); err != nil || index < 0 || index >= len(shared.Items) {
+				return nil, errInvalidWorkbook
+			}
+			cells[column] = shared.Items[index].String()
+		case "inlineStr":
+			if cell.Inline != nil {
+				cells[column] = cell.Inline.String()
+			}
+		case "b":
+			cells[column] = map[string]string{"1": "true", "0": "false"}[cell.Value]
+		default:
+			cells[column] = cell.Value
+		}
+	}
+	return cells, nil
+}
+
+// firstSheetPath resolves the part holding the first sheet of the workbook
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	workbookFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errInvalidWorkbook
+	}
+	var workbook xlsxWorkbook
+	if err := decodeXMLFile(workbookFile, &workbook); err != nil {
+		return "", err
+	}
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if len(workbook.Sheets) == 0 || !ok {
+		return fallback, nil
+	}
+	var rels xlsxRelationships
+	if err := decodeXMLFile(relsFile, &rels); err != nil {
+		return "", err
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RelID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+func decodeXMLFile(file *zip.File, v interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(reader, maxPartSize)).Decode(v); err != nil && err != io.EOF {
+		return errInvalidWorkbook
+	}
+	return nil
+}
+
+// columnIndex returns the zero based column of a cell reference such as
+// "AB12". ok is false when the reference names no column or one past XFD.
+func columnIndex(ref string) (column int, ok bool) {
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		if column > maxColumns {
+			return 0, false
+		}
+	}
+	return column - 1, column > 0
+}
+
+// columnName returns the letters of a zero based column
+func columnName(column int) string {
+	name := ""
+	for column >= 0 {
+		name = string(rune('A'+column%26)) + name
+		column = column/26 - 1
+	}
+	return name
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+)
+
+// writeXLSX builds a single sheet workbook with every cell stored as text,
+// so codes such as batch numbers keep their leading zeros
+func writeXLSX(rows [][]string) ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+		for c, value := range row {
+			if value == "" {
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(c), r+1)
+			if err := xml.EscapeText(&sheet, []byte(value)); err != nil {
+				return nil, err
+			}
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	parts := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRootRels)},
+		{"xl/workbook.xml", []byte(xlsxWorkbookXML)},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRels)},
+		{"xl/worksheets/sheet1.xml", sheet.Bytes()},
+	}
+	for _, part := range parts {
+		w, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,56 @@
+// internal/infrastructure/storage/local_store.go
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// LocalStore keeps documents on the local filesystem under a root directory
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a document store rooted at root
+func NewLocalStore(root string) service.DocumentStore {
+	return &LocalStore{root: root}
+}
+
+func (s *LocalStore) Save(ctx context.Context, path string, content []byte) error {
+	full, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+		return fmt.Errorf("failed to create document directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial document
+	tmp := full + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o640); err != nil {
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	return os.Rename(tmp, full)
+}
+
+func (s *LocalStore) Load(ctx context.Context, path string) ([]byte, error) {
+	full, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(full)
+}
+
+// resolve maps a document key into the root, rejecting keys that escape it
+func (s *LocalStore) resolve(path string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid document path: %s", path)
+	}
+	return filepath.Join(s.root, clean), nil
+}
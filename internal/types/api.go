@@ -318,8 +318,48 @@ type UpdateProfileRequest struct {
 	Address     *AddressRequest `json:"address,omitempty"`
 	ContactInfo *ContactRequest `json:"contactInfo,omitempty"`
 }
+
+// MedicineRequest searches the medicines patients can buy. Filters are sent
+// as query parameters on GET and in the body on POST; prices from minPrice up
+// to but excluding maxPrice match.
 type MedicineRequest struct {
-	SearchQuery string `json:"searchQuery"`
+	SearchQuery          string   `json:"searchQuery" form:"q"`
+	Manufacturer         string   `json:"manufacturer" form:"manufacturer"`
+	PrescriptionRequired *bool    `json:"prescriptionRequired" form:"prescriptionRequired"`
+	MinPrice             *float64 `json:"minPrice" form:"minPrice" binding:"omitempty,gte=0"`
+	MaxPrice             *float64 `json:"maxPrice" form:"maxPrice" binding:"omitempty,gte=0"`
+	Page                 int      `json:"page" form:"page"`
+	Limit                int      `json:"limit" form:"limit"`
+}
+
+// MedicineSearchResponse is a page of ranked search results with the facets
+// of everything the search matched
+type MedicineSearchResponse struct {
+	Medicines []*entity.Medicine    `json:"medicines"`
+	Facets    *MedicineSearchFacets `json:"facets"`
+}
+
+// MedicineSearchFacets counts the matching medicines by the values they can
+// be filtered on. The counts ignore the facet filters of the request.
+type MedicineSearchFacets struct {
+	Manufacturers        []FacetCount     `json:"manufacturers"`
+	PrescriptionRequired []FacetCount     `json:"prescriptionRequired"` // "true" or "false"
+	PriceBands           []PriceBandCount `json:"priceBands"`
+}
+
+// FacetCount is how many results have a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// PriceBandCount is how many results are priced in a band; the band's bounds
+// can be passed back as minPrice and maxPrice
+type PriceBandCount struct {
+	Label    string   `json:"label"`
+	MinPrice float64  `json:"minPrice"`
+	MaxPrice *float64 `json:"maxPrice,omitempty"` // open-ended when nil
+	Count    int64    `json:"count"`
 }
 type DoctorRequest struct {
 	Query string `json:"query"`
@@ -349,7 +389,241 @@ type MedicineAddRequest struct {
 	PharmacyID           uuid.UUID  `form:"pharmacy_id" json:"pharmacy_id"`
 	PrescriptionRequired bool       `form:"prescriptionRequired" json:"prescriptionRequired"`
 	ExpiryDate           *time.Time `form:"expiryDate" json:"expiryDate" time_format:"2006-01-02"`
+	BatchNumber          string     `form:"batchNumber" json:"batchNumber" binding:"omitempty,max=100"`
+	ReorderLevel         int        `form:"reorderLevel" json:"reorderLevel" binding:"gte=0"`
 	ImageURL             *string    `form:"imageURL" json:"imageURL"`
+	HSNCode              string     `form:"hsnCode" json:"hsnCode" binding:"omitempty,numeric,min=4,max=8"`
+	GSTRate              *float64   `form:"gstRate" json:"gstRate" binding:"omitempty,gte=0,lte=28"`
+}
+
+// MedicineBatchRequest receives a new batch of a medicine
+type MedicineBatchRequest struct {
+	BatchNumber string  `json:"batchNumber" binding:"required,max=100"`
+	ExpiryDate  string  `json:"expiryDate" binding:"omitempty,datetime=2006-01-02"`
+	Quantity    int     `json:"quantity" binding:"gte=0"`
+	CostPrice   float64 `json:"costPrice" binding:"gte=0"`
+}
+
+// UpdateMedicineBatchRequest corrects a batch after a stock count; omitted
+// fields are left as they are
+type UpdateMedicineBatchRequest struct {
+	ExpiryDate *string  `json:"expiryDate" binding:"omitempty,datetime=2006-01-02"`
+	Quantity   *int     `json:"quantity" binding:"omitempty,gte=0"`
+	CostPrice  *float64 `json:"costPrice" binding:"omitempty,gte=0"`
+}
+
+// DrugRequest creates or updates an entry of the master drug catalogue
+type DrugRequest struct {
+	GenericName  string `json:"genericName" binding:"required,max=200"`
+	BrandName    string `json:"brandName" binding:"max=200"`
+	Strength     string `json:"strength" binding:"required,max=100"`
+	Form         string `json:"form" binding:"required,oneof=tablet capsule syrup suspension injection cream ointment gel drops inhaler powder other"`
+	Schedule     string `json:"schedule" binding:"omitempty,oneof=OTC G H H1 X"`
+	Manufacturer string `json:"manufacturer" binding:"max=200"`
+	Composition  string `json:"composition"`
+	IsActive     *bool  `json:"isActive"`
+}
+
+// ListDrugsFilter filters the master drug catalogue
+type ListDrugsFilter struct {
+	Search   string `form:"q"`
+	Form     string `form:"form"`
+	Schedule string `form:"schedule"`
+	Active   *bool  `form:"active"`
+	Page     int    `form:"page"`
+	Limit    int    `form:"limit"`
+}
+
+// LinkDrugRequest links a pharmacy medicine to a master drug; a null drugId
+// unlinks it
+type LinkDrugRequest struct {
+	DrugID *uuid.UUID `json:"drugId"`
+}
+
+// DrugOffer is one pharmacy's listing of a drug
+type DrugOffer struct {
+	MedicineID   uuid.UUID  `json:"medicineId"`
+	Name         string     `json:"name"` // the pharmacy's own name for the listing
+	PharmacyID   uuid.UUID  `json:"pharmacyId"`
+	PharmacyName string     `json:"pharmacyName"`
+	Price        float64    `json:"price"`
+	Quantity     int        `json:"quantity"`
+	InStock      bool       `json:"inStock"`
+	ExpiryDate   *time.Time `json:"expiryDate,omitempty"`
+}
+
+// DrugSearchResult is a master drug with the pharmacies offering it,
+// cheapest first
+type DrugSearchResult struct {
+	Drug        *entity.Drug `json:"drug"`
+	Offers      []DrugOffer  `json:"offers"`
+	LowestPrice *float64     `json:"lowestPrice,omitempty"` // among offers in stock
+	InStock     int          `json:"inStock"`               // number of offers in stock
+}
+
+// CompareMedicinesRequest searches the listings of every pharmacy to compare
+// them. Distances are measured from the given point, or from the patient's
+// address when it is left out.
+type CompareMedicinesRequest struct {
+	Search    string   `form:"q" binding:"required,min=2"`
+	Latitude  *float64 `form:"lat" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `form:"lng" binding:"omitempty,gte=-180,lte=180"`
+	Sort      string   `form:"sort" binding:"omitempty,oneof=price distance"` // defaults to price
+	InStock   bool     `form:"inStock"`
+	Page      int      `form:"page"`
+	Limit     int      `form:"limit"`
+}
+
+// NearbyPharmaciesRequest searches pharmacies around the given point, or
+// around the patient's address when it is left out
+type NearbyPharmaciesRequest struct {
+	Latitude  *float64 `form:"lat" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `form:"lng" binding:"omitempty,gte=-180,lte=180"`
+	RadiusKm  float64  `form:"radiusKm" binding:"omitempty,gt=0,lte=50"` // defaults to 5
+	Page      int      `form:"page"`
+	Limit     int      `form:"limit"`
+}
+
+// NearbyMedicinesRequest searches the medicines of pharmacies around the
+// given point, or around the patient's address when it is left out
+type NearbyMedicinesRequest struct {
+	Search    string   `form:"q" binding:"required,min=2"`
+	Latitude  *float64 `form:"lat" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `form:"lng" binding:"omitempty,gte=-180,lte=180"`
+	RadiusKm  float64  `form:"radiusKm" binding:"omitempty,gt=0,lte=50"` // defaults to 5
+	InStock   bool     `form:"inStock"`
+	Page      int      `form:"page"`
+	Limit     int      `form:"limit"`
+}
+
+// NearbyPharmacy is a pharmacy found by a nearby search
+type NearbyPharmacy struct {
+	Pharmacy   *entity.Pharmacy `json:"pharmacy"`
+	DistanceKm float64          `json:"distanceKm"`
+}
+
+// NearbyMedicine is a medicine found by a nearby search, with the distance
+// to its pharmacy
+type NearbyMedicine struct {
+	Medicine   *entity.Medicine `json:"medicine"`
+	DistanceKm float64          `json:"distanceKm"`
+}
+
+// SearchSuggestRequest asks for completions of what a user is typing
+type SearchSuggestRequest struct {
+	Query string `form:"q" binding:"required,max=100"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=20"` // per group; defaults to 5
+}
+
+// SearchSuggestions are names starting with, or with a word starting with,
+// the typed text; those starting with it come first
+type SearchSuggestions struct {
+	Medicines       []string           `json:"medicines"`
+	Drugs           []string           `json:"drugs"` // generic names from the master catalogue
+	Doctors         []DoctorSuggestion `json:"doctors"`
+	Specializations []string           `json:"specializations"`
+}
+
+// DoctorSuggestion is a doctor whose name matches the typed text
+type DoctorSuggestion struct {
+	ID   uuid.UUID `json:"id"` // the doctor's user ID
+	Name string    `json:"name"`
+}
+
+// ComparisonOffer is one pharmacy's listing within a medicine comparison
+type ComparisonOffer struct {
+	MedicineID   uuid.UUID `json:"medicineId"`
+	Name         string    `json:"name"` // the pharmacy's own name for the listing
+	PharmacyID   uuid.UUID `json:"pharmacyId"`
+	PharmacyName string    `json:"pharmacyName"`
+	Price        float64   `json:"price"`
+	Quantity     int       `json:"quantity"`
+	InStock      bool      `json:"inStock"`
+	DistanceKm   *float64  `json:"distanceKm,omitempty"` // unknown when either end has no coordinates
+}
+
+// ListingGroup is the listings of one medicine found by a comparison search
+type ListingGroup struct {
+	Key      string
+	Listings []*entity.Medicine
+}
+
+// MedicineComparison groups equivalent listings: those linked to the same
+// master drug, else those with the same name and composition
+type MedicineComparison struct {
+	Key          string            `json:"key"`
+	Name         string            `json:"name"`
+	Content      *string           `json:"content,omitempty"`
+	Drug         *entity.Drug      `json:"drug,omitempty"`
+	Offers       []ComparisonOffer `json:"offers"`
+	LowestPrice  float64           `json:"lowestPrice"`
+	HighestPrice float64           `json:"highestPrice"`
+}
+
+// CatalogueRow is one validated row of a catalogue import. Optional columns
+// left blank are nil and keep the existing value of a medicine.
+type CatalogueRow struct {
+	Line                 int
+	Name                 string
+	Content              *string
+	Description          *string
+	Manufacturer         *string
+	Price                float64
+	PrescriptionRequired *bool
+	HSNCode              *string
+	GSTRate              *float64
+	ReorderLevel         *int
+	BatchNumber          string
+	ExpiryDate           *time.Time
+	Quantity             int
+	CostPrice            *float64
+}
+
+// CatalogueRowError explains why a row of an import was rejected
+type CatalogueRowError struct {
+	Line   int    `json:"line"` // line of the file, the header being line 1
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// CatalogueImportResult summarises a catalogue import. Nothing is saved when
+// the import is a dry run or any row has an error.
+type CatalogueImportResult struct {
+	DryRun           bool                `json:"dryRun"`
+	Applied          bool                `json:"applied"`
+	Rows             int                 `json:"rows"`
+	MedicinesCreated int                 `json:"medicinesCreated"`
+	MedicinesUpdated int                 `json:"medicinesUpdated"`
+	BatchesCreated   int                 `json:"batchesCreated"`
+	BatchesUpdated   int                 `json:"batchesUpdated"`
+	Errors           []CatalogueRowError `json:"errors"`
+}
+
+// ExpiryAlert is a batch that has expired or expires within the alert window
+type ExpiryAlert struct {
+	MedicineID   uuid.UUID `json:"medicineId"`
+	MedicineName string    `json:"medicineName"`
+	BatchID      uuid.UUID `json:"batchId"`
+	BatchNumber  string    `json:"batchNumber"`
+	ExpiryDate   time.Time `json:"expiryDate"`
+	Quantity     int       `json:"quantity"`
+	DaysLeft     int       `json:"daysLeft"` // 0 or less once expired
+}
+
+// LowStockAlert is a medicine at or below its reorder level
+type LowStockAlert struct {
+	MedicineID   uuid.UUID `json:"medicineId"`
+	MedicineName string    `json:"medicineName"`
+	Quantity     int       `json:"quantity"`
+	ReorderLevel int       `json:"reorderLevel"`
+}
+
+// StockAlertsResponse lists the stock a pharmacy should act on
+type StockAlertsResponse struct {
+	WindowDays int             `json:"windowDays"`
+	Expired    []ExpiryAlert   `json:"expired"`
+	Expiring   []ExpiryAlert   `json:"expiring"`
+	LowStock   []LowStockAlert `json:"lowStock"`
 }
 type MedicineResponse struct {
 	ID                   uuid.UUID  `json:"id"`
@@ -362,6 +636,8 @@ type MedicineResponse struct {
 	Price                float64    `json:"price"`
 	Quantity             int        `json:"quantity"`
 	PrescriptionRequired bool       `json:"prescriptionRequired"`
+	HSNCode              string     `json:"hsnCode"`
+	GSTRate              float64    `json:"gstRate"`
 	PharmacyID           uuid.UUID  `json:"pharmacyId"`
 	IsActive             bool       `json:"isActive"`
 	CreatedAt            time.Time  `json:"createdAt"`
@@ -385,6 +661,8 @@ type CreateOrderRequest struct {
 	Quantity        *int64                 `json:"quantity" binding:"omitempty,gt=0"`
 	Description     string                 `json:"description"`
 	CartID          *string                `json:"cartId"`
+	CouponCode      string                 `json:"couponCode"`     // defaults to the coupon applied to the cart
+	PrescriptionID  *uuid.UUID             `json:"prescriptionId"` // required when buying prescription-only medicines
 	DeliveryAddress string                 `json:"deliveryAddress"`
 	Notes           map[string]interface{} `json:"notes"`
 }
@@ -416,6 +694,125 @@ type PaymentStatusResponse struct {
 	Currency          string  `json:"currency"`
 	PaymentMethod     string  `json:"paymentMethod"`
 }
+
+// RefundItemRequest selects a quantity of one order item to refund
+type RefundItemRequest struct {
+	OrderItemID uuid.UUID `json:"orderItemId" binding:"required"`
+	Quantity    int       `json:"quantity" binding:"required,gt=0"`
+}
+
+// RefundRequest starts a refund; with no items the whole remaining order is refunded
+type RefundRequest struct {
+	Reason string              `json:"reason" binding:"required"`
+	Items  []RefundItemRequest `json:"items" binding:"omitempty,dive"`
+}
+
+type ListCouponsFilter struct {
+	PharmacyID   *uuid.UUID `form:"-"`
+	PlatformOnly bool       `form:"platformOnly"`
+	Active       *bool      `form:"active"`
+	Page         int        `form:"page"`
+	Limit        int        `form:"limit"`
+}
+
+// CouponRequest creates or updates a coupon. PharmacyID is only honoured for
+// admins; pharmacy coupons are always scoped to the caller's pharmacy.
+type CouponRequest struct {
+	Code          string     `json:"code" binding:"required,alphanum,min=3,max=40"`
+	Description   string     `json:"description" binding:"max=255"`
+	DiscountType  string     `json:"discountType" binding:"required,oneof=percentage flat"`
+	DiscountValue float64    `json:"discountValue" binding:"required,gt=0"`
+	MaxDiscount   *float64   `json:"maxDiscount" binding:"omitempty,gt=0"`
+	PharmacyID    *uuid.UUID `json:"pharmacyId"`
+	MinCartValue  float64    `json:"minCartValue" binding:"gte=0"`
+	PerUserLimit  int        `json:"perUserLimit" binding:"gte=0"`
+	UsageLimit    int        `json:"usageLimit" binding:"gte=0"`
+	ValidFrom     *time.Time `json:"validFrom"`
+	ValidUntil    *time.Time `json:"validUntil"`
+	IsActive      *bool      `json:"isActive"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// LinkPrescriptionRequest uses the prescription written in one of the
+// patient's consultations
+type LinkPrescriptionRequest struct {
+	AppointmentID uuid.UUID `json:"appointmentId" binding:"required"`
+}
+
+type ListPrescriptionReviewsFilter struct {
+	PharmacyID uuid.UUID `form:"-"`
+	Status     string    `form:"status" binding:"omitempty,oneof=pending approved rejected"` // defaults to pending
+	Page       int       `form:"page"`
+	Limit      int       `form:"limit"`
+}
+
+// ReviewPrescriptionRequest approves or rejects the prescription of an order.
+// A note is required when rejecting so the patient knows what to fix.
+type ReviewPrescriptionRequest struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+	Note   string `json:"note" binding:"required_if=Status rejected,max=1000"`
+}
+
+// ResubmitPrescriptionRequest replaces the prescription of an order
+type ResubmitPrescriptionRequest struct {
+	PrescriptionID uuid.UUID `json:"prescriptionId" binding:"required"`
+}
+
+type ListRefundsFilter struct {
+	PharmacyID *uuid.UUID `form:"-"`
+	Status     string     `form:"status"`
+	Page       int        `form:"page"`
+	Limit      int        `form:"limit"`
+}
+
+// RazorpayWebhookEvent is the envelope Razorpay posts to the payment webhook
+type RazorpayWebhookEvent struct {
+	Event     string                 `json:"event"`
+	Contains  []string               `json:"contains"`
+	CreatedAt int64                  `json:"created_at"`
+	Payload   RazorpayWebhookPayload `json:"payload"`
+}
+
+type RazorpayWebhookPayload struct {
+	Payment *struct {
+		Entity RazorpayPaymentEntity `json:"entity"`
+	} `json:"payment,omitempty"`
+	Order *struct {
+		Entity RazorpayOrderEntity `json:"entity"`
+	} `json:"order,omitempty"`
+	Refund *struct {
+		Entity RazorpayRefundEntity `json:"entity"`
+	} `json:"refund,omitempty"`
+}
+
+type RazorpayPaymentEntity struct {
+	ID               string `json:"id"`
+	OrderID          string `json:"order_id"`
+	Amount           int64  `json:"amount"`
+	Currency         string `json:"currency"`
+	Status           string `json:"status"`
+	Method           string `json:"method"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type RazorpayOrderEntity struct {
+	ID         string `json:"id"`
+	Receipt    string `json:"receipt"`
+	Amount     int64  `json:"amount"`
+	AmountPaid int64  `json:"amount_paid"`
+	Status     string `json:"status"`
+}
+
+type RazorpayRefundEntity struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+}
 type AppointmentRequest struct {
 	PatientID     uuid.UUID                `json:"patientId" `
 	DoctorID      uuid.UUID                `json:"doctorId" binding:"required"`
@@ -469,12 +866,13 @@ type UpdateAppointmentStatusRequest struct {
 }
 
 type OpChartResponse struct {
-	ID           uuid.UUID `json:"id"`
-	Diagnosis    string    `json:"diagnosis"`
-	Prescription string    `json:"prescription"`
-	DoctorNotes  string    `json:"doctorNotes"`
-	Date         string    `json:"date"`
-	Time         string    `json:"time"`
+	ID                uuid.UUID                 `json:"id"`
+	Diagnosis         string                    `json:"diagnosis"`
+	Prescription      string                    `json:"prescription"`
+	PrescriptionItems []entity.PrescriptionItem `json:"prescriptionItems,omitempty"`
+	DoctorNotes       string                    `json:"doctorNotes"`
+	Date              string                    `json:"date"`
+	Time              string                    `json:"time"`
 }
 
 type ConsultationResponse struct {
@@ -509,6 +907,84 @@ type ListPharmacyOrders struct {
 	Page  int `json:"page"`
 	Limit int `json:"limit"`
 }
+
+// UpdateOrderStatusRequest moves an order to a new status
+type UpdateOrderStatusRequest struct {
+	Status        string `json:"status" binding:"required"`
+	Note          string `json:"note"`
+	CashCollected bool   `json:"cashCollected"` // records the order's cash on delivery as collected
+}
+
+// CancelOrderRequest cancels one of the customer's orders
+type CancelOrderRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// AssignDeliveryRequest hands an order to a delivery partner
+type AssignDeliveryRequest struct {
+	PartnerID uuid.UUID `json:"partnerId" binding:"required"`
+}
+
+// ListDeliveryPartnersRequest lists the active delivery partners a pharmacy
+// can assign orders to
+type ListDeliveryPartnersRequest struct {
+	Search string `form:"search"`
+	Page   int    `form:"page"`
+	Limit  int    `form:"limit"`
+}
+
+// ListDeliveriesRequest lists a delivery partner's deliveries, newest first.
+// Active limits it to the ones still under way.
+type ListDeliveriesRequest struct {
+	Status string `form:"status"`
+	Active bool   `form:"active"`
+	Page   int    `form:"page"`
+	Limit  int    `form:"limit"`
+}
+
+// UpdateDeliveryStatusRequest moves a delivery to picked_up, in_transit or
+// failed. Reason is required when it failed.
+type UpdateDeliveryStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=picked_up in_transit failed"`
+	Reason string `json:"reason" binding:"required_if=Status failed,max=500"`
+}
+
+// DeliveryPingRequest is a GPS position reported by a delivery partner
+type DeliveryPingRequest struct {
+	Latitude   *float64   `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude  *float64   `json:"longitude" binding:"required,min=-180,max=180"`
+	Accuracy   *float64   `json:"accuracy" binding:"omitempty,min=0"`
+	RecordedAt *time.Time `json:"recordedAt"` // when the device took the fix, now when left out
+}
+
+// ConfirmDeliveryRequest completes a delivery with the OTP the patient gives
+// the partner. CashCollected records the order's cash on delivery as collected.
+type ConfirmDeliveryRequest struct {
+	OTP           string `json:"otp" binding:"required,numeric"`
+	CashCollected bool   `json:"cashCollected"`
+}
+
+// DeliveryAssignment is a delivery as its partner sees it. The patient's
+// name, phone number and address are left out once it is no longer under way.
+type DeliveryAssignment struct {
+	*entity.Delivery
+	OrderNumber  string `json:"orderNumber"`
+	PatientName  string `json:"patientName,omitempty"`
+	PatientPhone string `json:"patientPhone,omitempty"`
+}
+
+// DeliveryTracking is where a delivery is and when it should arrive. The
+// distance and ETA are left out when the partner's position or the
+// destination is not known, and the OTP is only shown to the patient.
+type DeliveryTracking struct {
+	Delivery         *entity.Delivery       `json:"delivery"`
+	OrderStatus      string                 `json:"orderStatus"`
+	OTP              string                 `json:"otp,omitempty"`
+	DistanceKm       *float64               `json:"distanceKm,omitempty"`
+	ETAMinutes       *int                   `json:"etaMinutes,omitempty"`
+	EstimatedArrival *time.Time             `json:"estimatedArrival,omitempty"`
+	Route            []*entity.DeliveryPing `json:"route"` // latest positions, oldest first
+}
 type ConfirmedSlotResponse struct {
 	AppointmentDate *string `json:"date"`
 	AppointmentTime *string `json:"time"`
@@ -521,8 +997,59 @@ type CompleteConsultationRequest struct {
 	SlotID        uuid.UUID `json:"slotId"`
 
 	Diagnosis    string `json:"diagnosis" binding:"required"`
-	Prescription string `json:"prescription" binding:"required"`
+	Prescription string `json:"prescription" binding:"required_without=PrescriptionItems"` // written from the items when left empty
 	DoctorNotes  string `json:"doctorNotes"`
+
+	PrescriptionItems []PrescriptionItemRequest `json:"prescriptionItems" binding:"omitempty,dive"`
+}
+
+// PrescriptionItemRequest is one medicine of a structured e-prescription
+type PrescriptionItemRequest struct {
+	MedicineName string `json:"medicineName" binding:"required,max=200"`
+	Dose         string `json:"dose" binding:"max=100"`
+	Frequency    string `json:"frequency" binding:"max=100"`
+	Duration     string `json:"duration" binding:"max=100"`
+	Quantity     int    `json:"quantity" binding:"required,gt=0"`
+	Instructions string `json:"instructions" binding:"max=500"`
+}
+
+// EPrescriptionResponse is the structured prescription of a consultation
+type EPrescriptionResponse struct {
+	AppointmentID uuid.UUID                 `json:"appointmentId"`
+	OpChartID     uuid.UUID                 `json:"opChartId"`
+	DoctorName    string                    `json:"doctorName"`
+	PatientName   string                    `json:"patientName"`
+	Date          string                    `json:"date"`
+	Diagnosis     string                    `json:"diagnosis"`
+	Prescription  string                    `json:"prescription"`
+	Items         []entity.PrescriptionItem `json:"items"`
+}
+
+// PrescriptionToCartRequest fills the cart from an e-prescription with
+// medicines from pharmacies near the given point, or near the patient's
+// address when it is left out
+type PrescriptionToCartRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,gte=-180,lte=180"`
+	RadiusKm  float64  `json:"radiusKm" binding:"omitempty,gt=0,lte=100"` // defaults to 10
+}
+
+// PrescriptionMatch is the medicine picked for an e-prescription item
+type PrescriptionMatch struct {
+	Item       entity.PrescriptionItem `json:"item"`
+	Medicine   *entity.Medicine        `json:"medicine"`
+	DistanceKm *float64                `json:"distanceKm,omitempty"`
+}
+
+// PrescriptionToCartResponse is the cart filled from an e-prescription. Items
+// no nearby pharmacy stocks are listed as unmatched, and items already
+// dispensed in full as dispensed.
+type PrescriptionToCartResponse struct {
+	Cart         *entity.Cart              `json:"cart"`
+	Prescription *entity.Prescription      `json:"prescription"`
+	Matched      []PrescriptionMatch       `json:"matched"`
+	Unmatched    []entity.PrescriptionItem `json:"unmatched"`
+	Dispensed    []entity.PrescriptionItem `json:"dispensed"`
 }
 
 // tygo:emit
@@ -534,3 +1061,28 @@ type DashboardStatsResponse struct {
 	InactivePharmacies int64 `json:"inactivePharmacies"`
 	TotalUsers         int64 `json:"totalUsers"`
 }
+
+// OrderEvent is pushed to the patient and the pharmacy when an order is
+// placed or changes status
+type OrderEvent struct {
+	OrderID     uuid.UUID `json:"orderId"`
+	OrderNumber string    `json:"orderNumber"`
+	PharmacyID  uuid.UUID `json:"pharmacyId,omitempty"`
+	FromStatus  string    `json:"fromStatus,omitempty"`
+	Status      string    `json:"status"`
+	TotalAmount float64   `json:"totalAmount"`
+}
+
+// AppointmentEvent is pushed to the patient and the doctor when an
+// appointment is confirmed or cancelled
+type AppointmentEvent struct {
+	AppointmentID   uuid.UUID `json:"appointmentId"`
+	DoctorID        uuid.UUID `json:"doctorId"`
+	DoctorName      string    `json:"doctorName,omitempty"`
+	PatientID       uuid.UUID `json:"patientId"`
+	Status          string    `json:"status"`
+	AppointmentDate string    `json:"appointmentDate,omitempty"`
+	AppointmentTime string    `json:"appointmentTime,omitempty"`
+	Mode            string    `json:"mode,omitempty"`
+	Reason          string    `json:"reason,omitempty"` // why it was cancelled
+}
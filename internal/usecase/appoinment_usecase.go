@@ -33,14 +33,16 @@ type AppoinmentUseCase interface {
 type appoinmentUseCase struct {
 	appoinmentRepo repository.AppoinmentRepository
 	doctorRepo     repository.DoctorRepository
+	events         EventStreamUseCase
 	//medicineRepo repository.MedicineRepository
 }
 
 // NewMedicineUseCase creates a new instance of medicineUseCase
-func NewAppoinmentUseCase(appoinmentRepo repository.AppoinmentRepository, doctorRepo repository.DoctorRepository) AppoinmentUseCase {
+func NewAppoinmentUseCase(appoinmentRepo repository.AppoinmentRepository, doctorRepo repository.DoctorRepository, events EventStreamUseCase) AppoinmentUseCase {
 	return &appoinmentUseCase{
 		appoinmentRepo: appoinmentRepo,
 		doctorRepo:     doctorRepo,
+		events:         events,
 	}
 }
 func (u *appoinmentUseCase) BookAppointment(ctx context.Context, req *types.AppointmentRequest) (*entity.Appointment, error) {
@@ -273,12 +275,13 @@ func (u *appoinmentUseCase) FetchConsultations(ctx context.Context, doctorID uui
 			var opChartResp *types.OpChartResponse
 
 			opChartResp = &types.OpChartResponse{
-				ID:           appt.OpChart.ID,
-				Diagnosis:    appt.OpChart.Diagnosis,
-				Prescription: appt.OpChart.Prescription,
-				DoctorNotes:  appt.OpChart.DoctorNotes,
-				Date:         strings.Split(appt.OpChart.Date, "T")[0],
-				Time:         appt.OpChart.Time,
+				ID:                appt.OpChart.ID,
+				Diagnosis:         appt.OpChart.Diagnosis,
+				Prescription:      appt.OpChart.Prescription,
+				PrescriptionItems: appt.OpChart.PrescriptionItems,
+				DoctorNotes:       appt.OpChart.DoctorNotes,
+				Date:              strings.Split(appt.OpChart.Date, "T")[0],
+				Time:              appt.OpChart.Time,
 			}
 
 			history = append(history, types.ConsultationResponse{
@@ -339,6 +342,7 @@ func (u *appoinmentUseCase) CancelAppointment(ctx context.Context, appointmentID
 	if err != nil {
 		return errors.NewDomainError("UPDATE_FAILED", "Failed to cancel appointment", err)
 	}
+	u.events.AppointmentCancelled(ctx, appointment, reason)
 
 	return nil
 }
@@ -414,6 +418,7 @@ func (u *appoinmentUseCase) ScheduleAppointment(ctx context.Context, req *types.
 	if err := u.appoinmentRepo.Update(ctx, appointment); err != nil {
 		return errors.NewDomainError("UPDATE_FAILED", "Failed to confirm appointment", err)
 	}
+	u.events.AppointmentConfirmed(ctx, appointment, targetSlot)
 
 	// 6. Delete other pending slots for this appointment.
 	err = u.appoinmentRepo.DeletePendingSlots(ctx, appointment.ID)
@@ -478,12 +483,13 @@ func (u *appoinmentUseCase) FetchPatientConsultations(ctx context.Context, patie
 			var opChartResp *types.OpChartResponse
 
 			opChartResp = &types.OpChartResponse{
-				ID:           appt.OpChart.ID,
-				Diagnosis:    appt.OpChart.Diagnosis,
-				Prescription: appt.OpChart.Prescription,
-				DoctorNotes:  appt.OpChart.DoctorNotes,
-				Date:         strings.Split(appt.OpChart.Date, "T")[0],
-				Time:         appt.OpChart.Time,
+				ID:                appt.OpChart.ID,
+				Diagnosis:         appt.OpChart.Diagnosis,
+				Prescription:      appt.OpChart.Prescription,
+				PrescriptionItems: appt.OpChart.PrescriptionItems,
+				DoctorNotes:       appt.OpChart.DoctorNotes,
+				Date:              strings.Split(appt.OpChart.Date, "T")[0],
+				Time:              appt.OpChart.Time,
 			}
 
 			history = append(history, types.ConsultationResponse{
@@ -560,6 +566,19 @@ func (u *appoinmentUseCase) CompleteConsultation(ctx context.Context, req *types
 		Prescription:  req.Prescription,
 		DoctorNotes:   req.DoctorNotes,
 	}
+	for _, item := range req.PrescriptionItems {
+		opChart.PrescriptionItems = append(opChart.PrescriptionItems, entity.PrescriptionItem{
+			MedicineName: strings.TrimSpace(item.MedicineName),
+			Dose:         item.Dose,
+			Frequency:    item.Frequency,
+			Duration:     item.Duration,
+			Quantity:     item.Quantity,
+			Instructions: item.Instructions,
+		})
+	}
+	if opChart.Prescription == "" {
+		opChart.Prescription = opChart.PrescriptionText()
+	}
 	if err := u.appoinmentRepo.CreateOpChart(ctx, opChart); err != nil {
 		return errors.NewDomainError("OP_CHART_FAILED", "Failed to create OP chart", err)
 	}
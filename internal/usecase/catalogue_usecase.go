@@ -0,0 +1,350 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/internal/types"
+)
+
+// Limits on an uploaded catalogue
+const (
+	MaxCatalogueSize = 10 << 20
+	MaxCatalogueRows = 5000
+)
+
+var ErrInvalidCatalogue = errors.New("invalid catalogue file")
+
+// catalogueColumns are the columns of an exported catalogue, in order. Imports
+// may use any order and leave out optional columns.
+var catalogueColumns = []string{
+	"name", "content", "description", "manufacturer", "price", "prescription_required",
+	"hsn_code", "gst_rate", "reorder_level", "batch_number", "expiry_date", "quantity", "cost_price",
+}
+
+// excelEpoch is day zero of Excel's date serial numbers
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// CatalogueUseCase imports and exports a pharmacy's medicines in bulk as CSV
+// or XLSX, one row per batch
+type CatalogueUseCase interface {
+	ImportCatalogue(ctx context.Context, pharmacyID uuid.UUID, format string, file io.Reader, dryRun bool) (*types.CatalogueImportResult, error)
+	ExportCatalogue(ctx context.Context, pharmacyID uuid.UUID, format string) ([]byte, error)
+}
+
+type catalogueUseCase struct {
+	medicineRepo repository.MedicineRepository
+	codec        service.SpreadsheetCodec
+	suggestions  SearchSuggestUseCase
+}
+
+// NewCatalogueUseCase creates a new instance of catalogueUseCase
+func NewCatalogueUseCase(medicineRepo repository.MedicineRepository, codec service.SpreadsheetCodec, suggestions SearchSuggestUseCase) CatalogueUseCase {
+	return &catalogueUseCase{
+		medicineRepo: medicineRepo,
+		codec:        codec,
+		suggestions:  suggestions,
+	}
+}
+
+// ImportCatalogue validates every row of the file and, when all of them are
+// valid and this is not a dry run, upserts them by medicine name and batch
+func (uc *catalogueUseCase) ImportCatalogue(ctx context.Context, pharmacyID uuid.UUID, format string, file io.Reader, dryRun bool) (*types.CatalogueImportResult, error) {
+	// one row more than the limit for the header
+	table, err := uc.codec.Decode(format, file, MaxCatalogueRows+1)
+	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedSpreadsheet) {
+			return nil, err
+		}
+		if errors.Is(err, service.ErrSpreadsheetTooLarge) {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidCatalogue, MaxCatalogueRows)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCatalogue, err)
+	}
+	if len(table) == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidCatalogue)
+	}
+
+	columns, err := catalogueHeader(table[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.CatalogueImportResult{
+		DryRun: dryRun,
+		Errors: []types.CatalogueRowError{},
+	}
+	rows := make([]types.CatalogueRow, 0, len(table)-1)
+	seen := make(map[string]int)
+	for i, cells := range table[1:] {
+		line := i + 2
+		if blankRow(cells) {
+			continue
+		}
+		if len(rows) == MaxCatalogueRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidCatalogue, MaxCatalogueRows)
+		}
+
+		row, rowErrors := parseCatalogueRow(line, columns, cells)
+		if len(rowErrors) > 0 {
+			result.Errors = append(result.Errors, rowErrors...)
+			continue
+		}
+
+		key := strings.ToLower(row.Name) + "\x00" + row.BatchNumber
+		if first, ok := seen[key]; ok {
+			result.Errors = append(result.Errors, types.CatalogueRowError{
+				Line:  line,
+				Error: fmt.Sprintf("duplicates the medicine and batch of line %d", first),
+			})
+			continue
+		}
+		seen[key] = line
+		rows = append(rows, row)
+	}
+	result.Rows = len(rows) + len(result.Errors)
+
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err := uc.medicineRepo.ImportCatalogue(ctx, pharmacyID, rows, result); err != nil {
+		return nil, fmt.Errorf("failed to import catalogue: %w", err)
+	}
+	result.Applied = !dryRun && len(result.Errors) == 0
+	if result.Applied {
+		uc.suggestions.InvalidateSuggestions(ctx)
+	}
+	return result, nil
+}
+
+// ExportCatalogue writes the pharmacy's medicines with one row per sellable
+// batch, in the layout ImportCatalogue reads back
+func (uc *catalogueUseCase) ExportCatalogue(ctx context.Context, pharmacyID uuid.UUID, format string) ([]byte, error) {
+	medicines, err := uc.medicineRepo.ListCatalogue(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	table := [][]string{catalogueColumns}
+	for _, medicine := range medicines {
+		exported := false
+		for i := range medicine.Batches {
+			batch := &medicine.Batches[i]
+			if batch.Quantity == 0 || batch.Expired(now) {
+				continue
+			}
+			table = append(table, catalogueRecord(medicine, batch))
+			exported = true
+		}
+		if !exported {
+			table = append(table, catalogueRecord(medicine, nil))
+		}
+	}
+	return uc.codec.Encode(format, table)
+}
+
+// catalogueHeader maps each known column to its position in the header row
+func catalogueHeader(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(catalogueColumns))
+	for _, column := range catalogueColumns {
+		known[column] = true
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, cell := range header {
+		name := strings.ToLower(strings.Join(strings.Fields(cell), "_"))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidCatalogue, cell)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidCatalogue, cell)
+		}
+		columns[name] = i
+	}
+
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidCatalogue, required)
+		}
+	}
+	return columns, nil
+}
+
+func blankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCatalogueRow validates one row, returning every problem found in it
+func parseCatalogueRow(line int, columns map[string]int, cells []string) (types.CatalogueRow, []types.CatalogueRowError) {
+	row := types.CatalogueRow{Line: line}
+	var rowErrors []types.CatalogueRowError
+	fail := func(column, message string) {
+		rowErrors = append(rowErrors, types.CatalogueRowError{Line: line, Column: column, Error: message})
+	}
+	cell := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(cells) {
+			return ""
+		}
+		return strings.TrimSpace(cells[i])
+	}
+	optional := func(column string) *string {
+		if value := cell(column); value != "" {
+			return &value
+		}
+		return nil
+	}
+
+	row.Name = cell("name")
+	switch {
+	case row.Name == "":
+		fail("name", "is required")
+	case len(row.Name) > 200:
+		fail("name", "must be at most 200 characters")
+	}
+
+	if price, err := strconv.ParseFloat(cell("price"), 64); err != nil || price <= 0 {
+		fail("price", "must be a number greater than 0")
+	} else {
+		row.Price = math.Round(price*100) / 100
+	}
+
+	row.Content = optional("content")
+	row.Description = optional("description")
+	row.Manufacturer = optional("manufacturer")
+	if row.Manufacturer != nil && len(*row.Manufacturer) > 200 {
+		fail("manufacturer", "must be at most 200 characters")
+	}
+
+	if value := cell("prescription_required"); value != "" {
+		switch strings.ToLower(value) {
+		case "true", "yes", "y", "1":
+			required := true
+			row.PrescriptionRequired = &required
+		case "false", "no", "n", "0":
+			required := false
+			row.PrescriptionRequired = &required
+		default:
+			fail("prescription_required", "must be yes or no")
+		}
+	}
+
+	if row.HSNCode = optional("hsn_code"); row.HSNCode != nil {
+		if _, err := strconv.ParseUint(*row.HSNCode, 10, 64); err != nil || len(*row.HSNCode) < 4 || len(*row.HSNCode) > 8 {
+			fail("hsn_code", "must be 4 to 8 digits")
+		}
+	}
+
+	if value := cell("gst_rate"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err != nil || rate < 0 || rate > 28 {
+			fail("gst_rate", "must be a number from 0 to 28")
+		} else {
+			row.GSTRate = &rate
+		}
+	}
+
+	if value := cell("reorder_level"); value != "" {
+		if level, err := strconv.Atoi(value); err != nil || level < 0 {
+			fail("reorder_level", "must be a whole number of 0 or more")
+		} else {
+			row.ReorderLevel = &level
+		}
+	}
+
+	row.BatchNumber = cell("batch_number")
+	if len(row.BatchNumber) > 100 {
+		fail("batch_number", "must be at most 100 characters")
+	}
+
+	if value := cell("expiry_date"); value != "" {
+		if expiryDate, err := parseCatalogueDate(value); err != nil {
+			fail("expiry_date", "must be a date in YYYY-MM-DD format")
+		} else if expiryDate.Before(time.Now()) {
+			fail("expiry_date", "has already passed")
+		} else {
+			row.ExpiryDate = &expiryDate
+		}
+	}
+
+	if value := cell("quantity"); value != "" {
+		if quantity, err := strconv.Atoi(value); err != nil || quantity < 0 {
+			fail("quantity", "must be a whole number of 0 or more")
+		} else {
+			row.Quantity = quantity
+		}
+	}
+
+	if value := cell("cost_price"); value != "" {
+		if cost, err := strconv.ParseFloat(value, 64); err != nil || cost < 0 {
+			fail("cost_price", "must be a number of 0 or more")
+		} else {
+			cost = math.Round(cost*100) / 100
+			row.CostPrice = &cost
+		}
+	}
+
+	return row, rowErrors
+}
+
+// parseCatalogueDate reads a YYYY-MM-DD date, or the serial number a
+// spreadsheet stores for a date cell
+func parseCatalogueDate(value string) (time.Time, error) {
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		return excelEpoch.AddDate(0, 0, int(serial)), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// catalogueRecord formats a medicine and one of its batches as an export row
+func catalogueRecord(medicine *entity.Medicine, batch *entity.MedicineBatch) []string {
+	text := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	number := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	record := []string{
+		medicine.Name,
+		text(medicine.Content),
+		text(medicine.Description),
+		text(medicine.Manufacturer),
+		number(medicine.Price),
+		strconv.FormatBool(medicine.PrescriptionRequired),
+		medicine.HSNCode,
+		number(medicine.GSTRate),
+		strconv.Itoa(medicine.ReorderLevel),
+		"", "", "0", "",
+	}
+	if batch != nil {
+		record[9] = batch.BatchNumber
+		if batch.ExpiryDate != nil {
+			record[10] = batch.ExpiryDate.Format("2006-01-02")
+		}
+		record[11] = strconv.Itoa(batch.Quantity)
+		record[12] = number(batch.CostPrice)
+	}
+	return record
+}
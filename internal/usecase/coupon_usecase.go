@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponNotApplicable = errors.New("coupon is not applicable")
+	ErrCouponLimitReached  = errors.New("coupon usage limit reached")
+	ErrCouponCodeTaken     = errors.New("coupon code already exists")
+	ErrInvalidCoupon       = errors.New("invalid coupon")
+)
+
+// CouponUseCase manages discount coupons and their use on carts. Methods that
+// take a pharmacyID scope act for that pharmacy only; admins pass nil.
+type CouponUseCase interface {
+	CreateCoupon(ctx context.Context, createdBy uuid.UUID, pharmacyID *uuid.UUID, req types.CouponRequest) (*entity.Coupon, error)
+	UpdateCoupon(ctx context.Context, couponID uuid.UUID, pharmacyID *uuid.UUID, req types.CouponRequest) (*entity.Coupon, error)
+	DeactivateCoupon(ctx context.Context, couponID uuid.UUID, pharmacyID *uuid.UUID) error
+	ListCoupons(ctx context.Context, filter types.ListCouponsFilter) ([]*entity.Coupon, int64, error)
+
+	ApplyCouponToCart(ctx context.Context, userID uuid.UUID, code string) (*entity.Cart, error)
+	RemoveCouponFromCart(ctx context.Context, userID uuid.UUID) (*entity.Cart, error)
+}
+
+type couponUseCase struct {
+	couponRepo repository.CouponRepository
+	orderRepo  repository.OrderRepository
+}
+
+// NewCouponUseCase creates a new instance of couponUseCase
+func NewCouponUseCase(couponRepo repository.CouponRepository, orderRepo repository.OrderRepository) CouponUseCase {
+	return &couponUseCase{
+		couponRepo: couponRepo,
+		orderRepo:  orderRepo,
+	}
+}
+
+func (uc *couponUseCase) CreateCoupon(ctx context.Context, createdBy uuid.UUID, pharmacyID *uuid.UUID, req types.CouponRequest) (*entity.Coupon, error) {
+	coupon := &entity.Coupon{
+		CreatedBy: createdBy,
+		IsActive:  true,
+	}
+	if err := applyCouponRequest(coupon, pharmacyID, req); err != nil {
+		return nil, err
+	}
+
+	existing, err := uc.couponRepo.GetByCode(ctx, coupon.Code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check coupon code: %w", err)
+	}
+	if existing != nil {
+		return nil, ErrCouponCodeTaken
+	}
+
+	if err := uc.couponRepo.Create(ctx, coupon); err != nil {
+		return nil, fmt.Errorf("failed to create coupon: %w", err)
+	}
+	return coupon, nil
+}
+
+func (uc *couponUseCase) UpdateCoupon(ctx context.Context, couponID uuid.UUID, pharmacyID *uuid.UUID, req types.CouponRequest) (*entity.Coupon, error) {
+	coupon, err := uc.getOwnedCoupon(ctx, couponID, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldCode := coupon.Code
+	if err := applyCouponRequest(coupon, pharmacyID, req); err != nil {
+		return nil, err
+	}
+	if coupon.Code != oldCode {
+		existing, err := uc.couponRepo.GetByCode(ctx, coupon.Code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check coupon code: %w", err)
+		}
+		if existing != nil {
+			return nil, ErrCouponCodeTaken
+		}
+	}
+
+	if err := uc.couponRepo.Update(ctx, coupon); err != nil {
+		return nil, fmt.Errorf("failed to update coupon: %w", err)
+	}
+	return coupon, nil
+}
+
+func (uc *couponUseCase) DeactivateCoupon(ctx context.Context, couponID uuid.UUID, pharmacyID *uuid.UUID) error {
+	coupon, err := uc.getOwnedCoupon(ctx, couponID, pharmacyID)
+	if err != nil {
+		return err
+	}
+
+	coupon.IsActive = false
+	return uc.couponRepo.Update(ctx, coupon)
+}
+
+func (uc *couponUseCase) ListCoupons(ctx context.Context, filter types.ListCouponsFilter) ([]*entity.Coupon, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+	return uc.couponRepo.List(ctx, filter)
+}
+
+func (uc *couponUseCase) ApplyCouponToCart(ctx context.Context, userID uuid.UUID, code string) (*entity.Cart, error) {
+	cart, err := uc.orderRepo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cart not found", ErrInvalidCart)
+	}
+	if len(cart.Medicines) == 0 {
+		return nil, fmt.Errorf("%w: cart is empty", ErrInvalidCart)
+	}
+
+	coupon, err := uc.couponRepo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	// Only coupons that discount the cart as it is now can be applied
+	if _, err := applyCoupon(ctx, uc.couponRepo, coupon, userID, cartLineItems(cart)); err != nil {
+		return nil, err
+	}
+
+	if err := uc.couponRepo.SetCartCoupon(ctx, cart.ID, &coupon.ID); err != nil {
+		return nil, fmt.Errorf("failed to apply coupon: %w", err)
+	}
+	cart.CouponID = &coupon.ID
+	cart.Coupon = coupon
+
+	return cart, priceCart(ctx, uc.couponRepo, cart)
+}
+
+func (uc *couponUseCase) RemoveCouponFromCart(ctx context.Context, userID uuid.UUID) (*entity.Cart, error) {
+	cart, err := uc.orderRepo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cart not found", ErrInvalidCart)
+	}
+
+	if cart.CouponID != nil {
+		if err := uc.couponRepo.SetCartCoupon(ctx, cart.ID, nil); err != nil {
+			return nil, fmt.Errorf("failed to remove coupon: %w", err)
+		}
+		cart.CouponID = nil
+		cart.Coupon = nil
+	}
+
+	return cart, priceCart(ctx, uc.couponRepo, cart)
+}
+
+// getOwnedCoupon loads a coupon the caller may manage
+func (uc *couponUseCase) getOwnedCoupon(ctx context.Context, couponID uuid.UUID, pharmacyID *uuid.UUID) (*entity.Coupon, error) {
+	coupon, err := uc.couponRepo.GetByID(ctx, couponID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+	if pharmacyID != nil && (coupon.PharmacyID == nil || *coupon.PharmacyID != *pharmacyID) {
+		// Pharmacies cannot see other pharmacies' or platform coupons
+		return nil, ErrCouponNotFound
+	}
+	return coupon, nil
+}
+
+// applyCouponRequest copies a create or update request onto the coupon
+func applyCouponRequest(coupon *entity.Coupon, pharmacyID *uuid.UUID, req types.CouponRequest) error {
+	if req.DiscountType == entity.CouponDiscountPercentage && req.DiscountValue > 100 {
+		return fmt.Errorf("%w: percentage discount cannot exceed 100", ErrInvalidCoupon)
+	}
+	if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+		return fmt.Errorf("%w: validUntil must be after validFrom", ErrInvalidCoupon)
+	}
+
+	coupon.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	coupon.Description = req.Description
+	coupon.DiscountType = req.DiscountType
+	coupon.DiscountValue = req.DiscountValue
+	coupon.MaxDiscount = req.MaxDiscount
+	coupon.MinCartValue = req.MinCartValue
+	coupon.PerUserLimit = req.PerUserLimit
+	coupon.UsageLimit = req.UsageLimit
+	coupon.ValidFrom = req.ValidFrom
+	coupon.ValidUntil = req.ValidUntil
+	if req.IsActive != nil {
+		coupon.IsActive = *req.IsActive
+	}
+
+	// Pharmacies can only issue coupons for their own items
+	if pharmacyID != nil {
+		coupon.PharmacyID = pharmacyID
+	} else {
+		coupon.PharmacyID = req.PharmacyID
+	}
+	return nil
+}
+
+// applyCoupon checks that the user may use the coupon now and sets its
+// discount on the lines, returning the total discount.
+func applyCoupon(ctx context.Context, couponRepo repository.CouponRepository, coupon *entity.Coupon, userID uuid.UUID, lines entity.PaymentLineItems) (float64, error) {
+	if err := coupon.CheckValidity(time.Now()); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrCouponNotApplicable, err)
+	}
+
+	if coupon.PerUserLimit > 0 {
+		used, err := couponRepo.CountRedemptions(ctx, coupon.ID, &userID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count coupon uses: %w", err)
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return 0, ErrCouponLimitReached
+		}
+	}
+	if coupon.UsageLimit > 0 {
+		used, err := couponRepo.CountRedemptions(ctx, coupon.ID, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count coupon uses: %w", err)
+		}
+		if used >= int64(coupon.UsageLimit) {
+			return 0, ErrCouponLimitReached
+		}
+	}
+
+	discount, err := coupon.ApplyDiscount(lines)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrCouponNotApplicable, err)
+	}
+	return discount, nil
+}
+
+// priceCart works out the discount of the coupon applied to the cart and
+// flags carts that will need a prescription at checkout. A coupon that no
+// longer applies stays on the cart with CouponError set, so the customer can
+// see why and remove it.
+func priceCart(ctx context.Context, couponRepo repository.CouponRepository, cart *entity.Cart) error {
+	cart.PrescriptionRequired = cart.RequiresPrescription()
+	cart.DiscountAmount = 0
+	cart.CouponError = ""
+	cart.PayableAmount = cart.TotalAmount
+	if cart.Coupon == nil {
+		return nil
+	}
+
+	discount, err := applyCoupon(ctx, couponRepo, cart.Coupon, cart.UserID, cartLineItems(cart))
+	switch {
+	case errors.Is(err, ErrCouponNotApplicable), errors.Is(err, ErrCouponLimitReached):
+		cart.CouponError = err.Error()
+		return nil
+	case err != nil:
+		return err
+	}
+
+	cart.DiscountAmount = discount
+	cart.PayableAmount = math.Round((cart.TotalAmount-discount)*100) / 100
+	return nil
+}
+
+// cartLineItems prices the cart at current medicine prices
+func cartLineItems(cart *entity.Cart) entity.PaymentLineItems {
+	lines := make(entity.PaymentLineItems, 0, len(cart.Medicines))
+	for i := range cart.Medicines {
+		lines = append(lines, newLineItem(&cart.Medicines[i].Medicine, cart.Medicines[i].Quantity))
+	}
+	return lines
+}
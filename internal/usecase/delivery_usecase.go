@@ -0,0 +1,468 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/shared"
+)
+
+var (
+	ErrDeliveryNotFound          = errors.New("delivery not found")
+	ErrNotDeliveryPartner        = errors.New("user is not an active delivery partner")
+	ErrOrderNotDeliverable       = errors.New("order is not ready for delivery")
+	ErrInvalidDeliveryTransition = errors.New("invalid delivery status transition")
+	ErrDeliveryNotActive         = errors.New("delivery is no longer under way")
+	ErrInvalidDeliveryOTP        = errors.New("invalid delivery OTP")
+	ErrDeliveryOTPLocked         = errors.New("too many invalid OTPs, the pharmacy has to reassign the delivery")
+)
+
+const (
+	// deliveryOTPDigits is the length of the code confirming a hand-over
+	deliveryOTPDigits = 4
+	// maxDeliveryOTPAttempts is how many wrong codes lock a delivery
+	maxDeliveryOTPAttempts = 5
+	// deliverySpeedKmh is the average speed ETAs are worked out with
+	deliverySpeedKmh = 20
+	// deliveryRouteLength is how many of the latest positions tracking shows
+	deliveryRouteLength = 50
+)
+
+// DeliveryUseCase hands orders to delivery partners and tracks them to the
+// patient
+type DeliveryUseCase interface {
+	// AssignDelivery hands one of the pharmacy's orders that is being prepared
+	// or shipped to a delivery partner, replacing any partner assigned before.
+	AssignDelivery(ctx context.Context, pharmacyID uuid.UUID, userID uuid.UUID, orderID uuid.UUID, req types.AssignDeliveryRequest) (*entity.Delivery, error)
+	ListDeliveryPartners(ctx context.Context, req types.ListDeliveryPartnersRequest) ([]*entity.User, int64, error)
+	GetPharmacyDelivery(ctx context.Context, pharmacyID uuid.UUID, orderID uuid.UUID) (*types.DeliveryTracking, error)
+
+	// ListAssignments returns the partner's deliveries, showing who the
+	// patient is and where they are only while a delivery is under way.
+	ListAssignments(ctx context.Context, partnerID uuid.UUID, req types.ListDeliveriesRequest) ([]types.DeliveryAssignment, int64, error)
+	// UpdateDeliveryStatus moves one of the partner's deliveries along. Picking
+	// it up ships the order.
+	UpdateDeliveryStatus(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID, req types.UpdateDeliveryStatusRequest) (*entity.Delivery, error)
+	RecordPing(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID, req types.DeliveryPingRequest) error
+	// ConfirmDelivery completes one of the partner's deliveries with the
+	// patient's OTP and marks the order delivered.
+	ConfirmDelivery(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID, req types.ConfirmDeliveryRequest) (*entity.Delivery, error)
+
+	// TrackOrder returns the delivery of one of the user's orders with its ETA
+	// and the OTP to give the partner.
+	TrackOrder(ctx context.Context, userID uuid.UUID, orderID uuid.UUID) (*types.DeliveryTracking, error)
+}
+
+type deliveryUseCase struct {
+	deliveryRepo   repository.DeliveryRepository
+	orderRepo      repository.OrderRepository
+	userRepo       repository.UserRepository
+	paymentRepo    repository.PaymentRepository
+	invoiceUseCase InvoiceUseCase
+	events         EventStreamUseCase
+}
+
+// NewDeliveryUseCase creates a new instance of deliveryUseCase
+func NewDeliveryUseCase(deliveryRepo repository.DeliveryRepository, orderRepo repository.OrderRepository, userRepo repository.UserRepository, paymentRepo repository.PaymentRepository, invoiceUseCase InvoiceUseCase, events EventStreamUseCase) DeliveryUseCase {
+	return &deliveryUseCase{
+		deliveryRepo:   deliveryRepo,
+		orderRepo:      orderRepo,
+		userRepo:       userRepo,
+		paymentRepo:    paymentRepo,
+		invoiceUseCase: invoiceUseCase,
+		events:         events,
+	}
+}
+
+func (uc *deliveryUseCase) AssignDelivery(ctx context.Context, pharmacyID uuid.UUID, userID uuid.UUID, orderID uuid.UUID, req types.AssignDeliveryRequest) (*entity.Delivery, error) {
+	order, err := uc.getPharmacyOrder(ctx, pharmacyID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != entity.OrderStatusProcessing && order.Status != entity.OrderStatusShipped {
+		return nil, ErrOrderNotDeliverable
+	}
+
+	partner, err := uc.userRepo.GetByID(ctx, req.PartnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery partner: %w", err)
+	}
+	if partner == nil || !isDeliveryPartner(partner) {
+		return nil, ErrNotDeliveryPartner
+	}
+
+	patient, err := uc.userRepo.GetByID(ctx, order.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	var destination entity.GeoLocation
+	if patient != nil {
+		destination = patient.Address
+	}
+	if order.DeliveryAddress != "" {
+		destination.Address = order.DeliveryAddress
+	}
+
+	otp, err := newDeliveryOTP()
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &entity.Delivery{
+		OrderID:     order.ID,
+		PharmacyID:  pharmacyID,
+		PartnerID:   partner.ID,
+		AssignedBy:  userID,
+		Status:      entity.DeliveryStatusAssigned,
+		Destination: destination,
+		OTP:         otp,
+	}
+	assigned, err := uc.deliveryRepo.Assign(ctx, delivery)
+	if err != nil {
+		return nil, err
+	}
+	if !assigned {
+		// The order moved on since it was read
+		return nil, ErrOrderNotDeliverable
+	}
+	delivery.Partner = partner
+	return delivery, nil
+}
+
+func (uc *deliveryUseCase) ListDeliveryPartners(ctx context.Context, req types.ListDeliveryPartnersRequest) ([]*entity.User, int64, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 10
+	}
+
+	filters := types.UserListFilters{
+		Role:   string(shared.UserRoleDriver),
+		Status: "active",
+		Search: req.Search,
+	}
+	return uc.userRepo.ListWithFilters(ctx, filters, req.Limit, (req.Page-1)*req.Limit, "first_name", "ASC")
+}
+
+func (uc *deliveryUseCase) GetPharmacyDelivery(ctx context.Context, pharmacyID uuid.UUID, orderID uuid.UUID) (*types.DeliveryTracking, error) {
+	order, err := uc.getPharmacyOrder(ctx, pharmacyID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.trackOrder(ctx, order, false)
+}
+
+func (uc *deliveryUseCase) ListAssignments(ctx context.Context, partnerID uuid.UUID, req types.ListDeliveriesRequest) ([]types.DeliveryAssignment, int64, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 10
+	}
+
+	deliveries, total, err := uc.deliveryRepo.ListForPartner(ctx, partnerID, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	assignments := make([]types.DeliveryAssignment, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		assignments = append(assignments, deliveryAssignment(delivery))
+	}
+	return assignments, total, nil
+}
+
+func (uc *deliveryUseCase) UpdateDeliveryStatus(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID, req types.UpdateDeliveryStatusRequest) (*entity.Delivery, error) {
+	delivery, err := uc.getPartnerDelivery(ctx, partnerID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if !entity.CanTransitionDelivery(delivery.Status, req.Status) {
+		return nil, ErrInvalidDeliveryTransition
+	}
+
+	fromStatus := delivery.Status
+	now := time.Now()
+	var history *entity.OrderStatusHistory
+
+	switch req.Status {
+	case entity.DeliveryStatusPickedUp:
+		switch delivery.Order.Status {
+		case entity.OrderStatusProcessing:
+			history = &entity.OrderStatusHistory{
+				OrderID:    delivery.OrderID,
+				FromStatus: entity.OrderStatusProcessing,
+				ToStatus:   entity.OrderStatusShipped,
+				ActorID:    &partnerID,
+				ActorRole:  entity.OrderActorDelivery,
+				Note:       "Picked up for delivery",
+			}
+		case entity.OrderStatusShipped:
+			// The pharmacy marked it shipped already
+		default:
+			return nil, ErrOrderNotDeliverable
+		}
+		delivery.PickedUpAt = &now
+	case entity.DeliveryStatusInTransit:
+		if delivery.Order.Status != entity.OrderStatusShipped {
+			return nil, ErrOrderNotDeliverable
+		}
+	case entity.DeliveryStatusFailed:
+		delivery.FailedAt = &now
+		delivery.FailureReason = req.Reason
+	}
+	delivery.Status = req.Status
+
+	updated, err := uc.deliveryRepo.Transition(ctx, delivery, fromStatus, history)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		// The delivery was reassigned or the order moved since it was read
+		return nil, ErrInvalidDeliveryTransition
+	}
+	if history != nil {
+		delivery.Order.Status = history.ToStatus
+		uc.events.OrderStatusChanged(ctx, delivery.Order, history.FromStatus, history.ToStatus)
+	}
+	return delivery, nil
+}
+
+func (uc *deliveryUseCase) RecordPing(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID, req types.DeliveryPingRequest) error {
+	delivery, err := uc.getPartnerDelivery(ctx, partnerID, deliveryID)
+	if err != nil {
+		return err
+	}
+	if !delivery.IsActive() {
+		return ErrDeliveryNotActive
+	}
+
+	// Device clocks running ahead cannot put a ping in the future
+	recordedAt := time.Now()
+	if req.RecordedAt != nil && req.RecordedAt.Before(recordedAt) {
+		recordedAt = *req.RecordedAt
+	}
+
+	return uc.deliveryRepo.RecordPing(ctx, &entity.DeliveryPing{
+		DeliveryID: delivery.ID,
+		Latitude:   *req.Latitude,
+		Longitude:  *req.Longitude,
+		Accuracy:   req.Accuracy,
+		RecordedAt: recordedAt,
+	})
+}
+
+// ConfirmDelivery records the order's cash on delivery as collected when
+// CashCollected is set. Failing to do so does not undo the delivery; the pharmacy can still
+// record the cash on the delivered order.
+func (uc *deliveryUseCase) ConfirmDelivery(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID, req types.ConfirmDeliveryRequest) (*entity.Delivery, error) {
+	delivery, err := uc.getPartnerDelivery(ctx, partnerID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != entity.DeliveryStatusPickedUp && delivery.Status != entity.DeliveryStatusInTransit {
+		return nil, ErrInvalidDeliveryTransition
+	}
+	if delivery.Order.Status != entity.OrderStatusShipped {
+		return nil, ErrOrderNotDeliverable
+	}
+
+	// Every code entered counts, before it is checked, so concurrent guesses
+	// cannot get past the limit
+	claimed, err := uc.deliveryRepo.ClaimOTPAttempt(ctx, delivery.ID, maxDeliveryOTPAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrDeliveryOTPLocked
+	}
+	if subtle.ConstantTimeCompare([]byte(req.OTP), []byte(delivery.OTP)) != 1 {
+		return nil, ErrInvalidDeliveryOTP
+	}
+
+	fromStatus := delivery.Status
+	now := time.Now()
+	delivery.Status = entity.DeliveryStatusDelivered
+	delivery.DeliveredAt = &now
+
+	updated, err := uc.deliveryRepo.Transition(ctx, delivery, fromStatus, &entity.OrderStatusHistory{
+		OrderID:    delivery.OrderID,
+		FromStatus: entity.OrderStatusShipped,
+		ToStatus:   entity.OrderStatusDelivered,
+		ActorID:    &partnerID,
+		ActorRole:  entity.OrderActorDelivery,
+		Note:       "Delivered, confirmed with the patient's OTP",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrInvalidDeliveryTransition
+	}
+	delivery.Order.Status = entity.OrderStatusDelivered
+	uc.events.OrderStatusChanged(ctx, delivery.Order, entity.OrderStatusShipped, entity.OrderStatusDelivered)
+
+	if req.CashCollected {
+		collected, err := uc.paymentRepo.MarkCashCollected(ctx, delivery.OrderID, partnerID)
+		if err != nil {
+			log.Printf("Failed to record cash collected for order %s: %v", delivery.Order.OrderNumber, err)
+		} else if collected {
+			if _, err := uc.invoiceUseCase.IssueInvoice(ctx, delivery.OrderID); err != nil {
+				log.Printf("Failed to issue invoices for order %s: %v", delivery.Order.OrderNumber, err)
+			}
+		}
+	}
+	return delivery, nil
+}
+
+func (uc *deliveryUseCase) TrackOrder(ctx context.Context, userID uuid.UUID, orderID uuid.UUID) (*types.DeliveryTracking, error) {
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if order.UserID != userID {
+		return nil, ErrNotOrderOwner
+	}
+	return uc.trackOrder(ctx, order, true)
+}
+
+// trackOrder returns where the order's latest delivery is, with the OTP when
+// it is for the patient and the delivery is under way
+func (uc *deliveryUseCase) trackOrder(ctx context.Context, order *entity.Order, forPatient bool) (*types.DeliveryTracking, error) {
+	delivery, err := uc.deliveryRepo.GetLatestForOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	route, err := uc.deliveryRepo.ListRecentPings(ctx, delivery.ID, deliveryRouteLength)
+	if err != nil {
+		return nil, err
+	}
+
+	tracking := &types.DeliveryTracking{
+		Delivery:    delivery,
+		OrderStatus: order.Status,
+		Route:       route,
+	}
+	if !delivery.IsActive() {
+		return tracking, nil
+	}
+	if forPatient {
+		tracking.OTP = delivery.OTP
+	}
+	if distance, ok := remainingDeliveryKm(delivery); ok {
+		minutes := int(math.Ceil(distance / deliverySpeedKmh * 60))
+		arrival := time.Now().Add(time.Duration(minutes) * time.Minute)
+		tracking.DistanceKm = &distance
+		tracking.ETAMinutes = &minutes
+		tracking.EstimatedArrival = &arrival
+	}
+	return tracking, nil
+}
+
+// getPharmacyOrder returns an order the pharmacy fulfils
+func (uc *deliveryUseCase) getPharmacyOrder(ctx context.Context, pharmacyID uuid.UUID, orderID uuid.UUID) (*entity.Order, error) {
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil || !order.BelongsToPharmacy(pharmacyID) {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// getPartnerDelivery returns a delivery assigned to the partner with its order
+func (uc *deliveryUseCase) getPartnerDelivery(ctx context.Context, partnerID uuid.UUID, deliveryID uuid.UUID) (*entity.Delivery, error) {
+	delivery, err := uc.deliveryRepo.GetByID(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil || delivery.PartnerID != partnerID || delivery.Order == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// deliveryAssignment is the delivery as its partner sees it
+func deliveryAssignment(delivery *entity.Delivery) types.DeliveryAssignment {
+	order := delivery.Order
+	delivery.Order = nil
+
+	assignment := types.DeliveryAssignment{Delivery: delivery}
+	if order != nil {
+		assignment.OrderNumber = order.OrderNumber
+	}
+	if !delivery.IsActive() {
+		delivery.Destination = entity.GeoLocation{}
+		return assignment
+	}
+	if order != nil && order.User != nil {
+		assignment.PatientName = strings.TrimSpace(order.User.FirstName + " " + order.User.LastName)
+		assignment.PatientPhone = order.User.PhoneNumber
+	}
+	return assignment
+}
+
+// isDeliveryPartner reports whether orders can be assigned to the user
+func isDeliveryPartner(user *entity.User) bool {
+	return user.IsActive && user.Status == "active" && user.RoleID == string(shared.UserRoleDriver)
+}
+
+// remainingDeliveryKm returns how far the partner still has to go: through
+// the pharmacy when the order has not been picked up, from the last reported
+// position, or from the pharmacy when no position was reported yet
+func remainingDeliveryKm(delivery *entity.Delivery) (float64, bool) {
+	destination := delivery.Destination
+	if !destination.HasCoordinates() {
+		return 0, false
+	}
+	pharmacy := delivery.Pharmacy
+	hasPharmacy := pharmacy != nil && pharmacy.HasCoordinates()
+
+	if delivery.Status == entity.DeliveryStatusAssigned {
+		if !hasPharmacy {
+			return 0, false
+		}
+		distance := entity.DistanceKm(pharmacy.Latitude, pharmacy.Longitude, destination.Latitude, destination.Longitude)
+		if delivery.HasPosition() {
+			distance += entity.DistanceKm(*delivery.Latitude, *delivery.Longitude, pharmacy.Latitude, pharmacy.Longitude)
+		}
+		return distance, true
+	}
+
+	switch {
+	case delivery.HasPosition():
+		return entity.DistanceKm(*delivery.Latitude, *delivery.Longitude, destination.Latitude, destination.Longitude), true
+	case hasPharmacy:
+		return entity.DistanceKm(pharmacy.Latitude, pharmacy.Longitude, destination.Latitude, destination.Longitude), true
+	}
+	return 0, false
+}
+
+// newDeliveryOTP returns a random code of deliveryOTPDigits digits
+func newDeliveryOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(math.Pow10(deliveryOTPDigits))))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate delivery OTP: %w", err)
+	}
+	return fmt.Sprintf("%0*d", deliveryOTPDigits, n.Int64()), nil
+}
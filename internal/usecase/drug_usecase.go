@@ -0,0 +1,258 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+)
+
+var (
+	ErrDrugNotFound     = errors.New("drug not found")
+	ErrDrugExists       = errors.New("drug already exists")
+	ErrDrugInactive     = errors.New("drug is not active")
+	ErrMedicineNotFound = errors.New("medicine not found")
+)
+
+// DrugUseCase manages the platform's master drug catalogue and the links from
+// pharmacy medicines to it
+type DrugUseCase interface {
+	CreateDrug(ctx context.Context, req types.DrugRequest) (*entity.Drug, error)
+	UpdateDrug(ctx context.Context, drugID uuid.UUID, req types.DrugRequest) (*entity.Drug, error)
+	DeactivateDrug(ctx context.Context, drugID uuid.UUID) error
+	ListDrugs(ctx context.Context, filter types.ListDrugsFilter) ([]*entity.Drug, int64, error)
+
+	// SearchDrugs returns active drugs with the pharmacies offering them.
+	SearchDrugs(ctx context.Context, filter types.ListDrugsFilter) ([]types.DrugSearchResult, int64, error)
+	GetDrugOffers(ctx context.Context, drugID uuid.UUID) (*types.DrugSearchResult, error)
+
+	// LinkMedicine links one of the pharmacy's medicines to a drug, or
+	// unlinks it when drugID is nil.
+	LinkMedicine(ctx context.Context, pharmacyID uuid.UUID, medicineID uuid.UUID, drugID *uuid.UUID) (*entity.Medicine, error)
+}
+
+type drugUseCase struct {
+	drugRepo     repository.DrugRepository
+	medicineRepo repository.MedicineRepository
+	suggestions  SearchSuggestUseCase
+}
+
+// NewDrugUseCase creates a new instance of drugUseCase
+func NewDrugUseCase(drugRepo repository.DrugRepository, medicineRepo repository.MedicineRepository, suggestions SearchSuggestUseCase) DrugUseCase {
+	return &drugUseCase{
+		drugRepo:     drugRepo,
+		medicineRepo: medicineRepo,
+		suggestions:  suggestions,
+	}
+}
+
+func (uc *drugUseCase) CreateDrug(ctx context.Context, req types.DrugRequest) (*entity.Drug, error) {
+	drug := &entity.Drug{IsActive: true}
+	applyDrugRequest(drug, req)
+
+	if err := uc.checkUnique(ctx, drug); err != nil {
+		return nil, err
+	}
+	if err := uc.drugRepo.Create(ctx, drug); err != nil {
+		return nil, fmt.Errorf("failed to create drug: %w", err)
+	}
+	uc.suggestions.InvalidateSuggestions(ctx)
+	return drug, nil
+}
+
+func (uc *drugUseCase) UpdateDrug(ctx context.Context, drugID uuid.UUID, req types.DrugRequest) (*entity.Drug, error) {
+	drug, err := uc.getDrug(ctx, drugID)
+	if err != nil {
+		return nil, err
+	}
+	applyDrugRequest(drug, req)
+
+	if err := uc.checkUnique(ctx, drug); err != nil {
+		return nil, err
+	}
+	if err := uc.drugRepo.Update(ctx, drug); err != nil {
+		return nil, fmt.Errorf("failed to update drug: %w", err)
+	}
+	uc.suggestions.InvalidateSuggestions(ctx)
+	return drug, nil
+}
+
+func (uc *drugUseCase) DeactivateDrug(ctx context.Context, drugID uuid.UUID) error {
+	drug, err := uc.getDrug(ctx, drugID)
+	if err != nil {
+		return err
+	}
+	drug.IsActive = false
+	if err := uc.drugRepo.Update(ctx, drug); err != nil {
+		return fmt.Errorf("failed to deactivate drug: %w", err)
+	}
+	uc.suggestions.InvalidateSuggestions(ctx)
+	return nil
+}
+
+func (uc *drugUseCase) ListDrugs(ctx context.Context, filter types.ListDrugsFilter) ([]*entity.Drug, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+	return uc.drugRepo.List(ctx, filter)
+}
+
+func (uc *drugUseCase) SearchDrugs(ctx context.Context, filter types.ListDrugsFilter) ([]types.DrugSearchResult, int64, error) {
+	active := true
+	filter.Active = &active
+
+	drugs, total, err := uc.ListDrugs(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	drugIDs := make([]uuid.UUID, 0, len(drugs))
+	for _, drug := range drugs {
+		drugIDs = append(drugIDs, drug.ID)
+	}
+	medicines, err := uc.drugRepo.ListOffers(ctx, drugIDs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list drug offers: %w", err)
+	}
+
+	results := make([]types.DrugSearchResult, 0, len(drugs))
+	for _, drug := range drugs {
+		results = append(results, drugSearchResult(drug, medicines))
+	}
+	return results, total, nil
+}
+
+func (uc *drugUseCase) GetDrugOffers(ctx context.Context, drugID uuid.UUID) (*types.DrugSearchResult, error) {
+	drug, err := uc.getDrug(ctx, drugID)
+	if err != nil {
+		return nil, err
+	}
+	if !drug.IsActive {
+		return nil, ErrDrugNotFound
+	}
+
+	medicines, err := uc.drugRepo.ListOffers(ctx, []uuid.UUID{drug.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drug offers: %w", err)
+	}
+	result := drugSearchResult(drug, medicines)
+	return &result, nil
+}
+
+func (uc *drugUseCase) LinkMedicine(ctx context.Context, pharmacyID uuid.UUID, medicineID uuid.UUID, drugID *uuid.UUID) (*entity.Medicine, error) {
+	medicine, err := uc.medicineRepo.GetMedicineByID(ctx, medicineID)
+	if err != nil {
+		return nil, err
+	}
+	if medicine == nil || medicine.PharmacyID != pharmacyID {
+		return nil, ErrMedicineNotFound
+	}
+
+	requiresPrescription := false
+	if drugID != nil {
+		drug, err := uc.getDrug(ctx, *drugID)
+		if err != nil {
+			return nil, err
+		}
+		if !drug.IsActive {
+			return nil, ErrDrugInactive
+		}
+		requiresPrescription = drug.RequiresPrescription()
+	}
+
+	if err := uc.drugRepo.LinkMedicine(ctx, medicineID, drugID, requiresPrescription); err != nil {
+		return nil, fmt.Errorf("failed to link medicine: %w", err)
+	}
+	return uc.medicineRepo.GetMedicineByID(ctx, medicineID)
+}
+
+func (uc *drugUseCase) getDrug(ctx context.Context, drugID uuid.UUID) (*entity.Drug, error) {
+	drug, err := uc.drugRepo.GetByID(ctx, drugID)
+	if err != nil {
+		return nil, err
+	}
+	if drug == nil {
+		return nil, ErrDrugNotFound
+	}
+	return drug, nil
+}
+
+// checkUnique rejects a drug that duplicates another product in the catalogue
+func (uc *drugUseCase) checkUnique(ctx context.Context, drug *entity.Drug) error {
+	existing, err := uc.drugRepo.GetByProduct(ctx, drug)
+	if err != nil {
+		return fmt.Errorf("failed to check drug: %w", err)
+	}
+	if existing != nil && existing.ID != drug.ID {
+		return ErrDrugExists
+	}
+	return nil
+}
+
+func applyDrugRequest(drug *entity.Drug, req types.DrugRequest) {
+	optional := func(value string) *string {
+		if value = strings.TrimSpace(value); value != "" {
+			return &value
+		}
+		return nil
+	}
+
+	drug.GenericName = strings.TrimSpace(req.GenericName)
+	drug.BrandName = optional(req.BrandName)
+	drug.Strength = strings.Join(strings.Fields(req.Strength), "")
+	drug.Form = req.Form
+	drug.Schedule = entity.DrugScheduleOTC
+	if req.Schedule != "" {
+		drug.Schedule = req.Schedule
+	}
+	drug.Manufacturer = optional(req.Manufacturer)
+	drug.Composition = optional(req.Composition)
+	if req.IsActive != nil {
+		drug.IsActive = *req.IsActive
+	}
+}
+
+// drugSearchResult collects the offers for a drug from medicines listed
+// cheapest first
+func drugSearchResult(drug *entity.Drug, medicines []*entity.Medicine) types.DrugSearchResult {
+	result := types.DrugSearchResult{
+		Drug:   drug,
+		Offers: []types.DrugOffer{},
+	}
+	for _, medicine := range medicines {
+		if medicine.DrugID == nil || *medicine.DrugID != drug.ID {
+			continue
+		}
+
+		offer := types.DrugOffer{
+			MedicineID: medicine.ID,
+			Name:       medicine.Name,
+			PharmacyID: medicine.PharmacyID,
+			Price:      medicine.Price,
+			Quantity:   medicine.Quantity,
+			InStock:    medicine.Quantity > 0,
+			ExpiryDate: medicine.ExpiryDate,
+		}
+		if medicine.Pharmacy != nil {
+			offer.PharmacyName = medicine.Pharmacy.Name
+		}
+		result.Offers = append(result.Offers, offer)
+
+		if offer.InStock {
+			if result.LowestPrice == nil {
+				price := offer.Price
+				result.LowestPrice = &price
+			}
+			result.InStock++
+		}
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/internal/types"
+)
+
+// Event types pushed on a user's live event stream
+const (
+	EventOrderPlaced          = "order.placed"
+	EventOrderStatusChanged   = "order.status_changed"
+	EventAppointmentConfirmed = "appointment.confirmed"
+	EventAppointmentCancelled = "appointment.cancelled"
+)
+
+// EventStreamUseCase pushes order and appointment changes to the users they
+// concern, so patients and pharmacies need not poll for them
+type EventStreamUseCase interface {
+	// Subscribe returns the user's events until ctx is done
+	Subscribe(ctx context.Context, userID uuid.UUID) <-chan service.Event
+
+	// The methods below are called once a change is saved and never fail the
+	// change itself; publishing errors are logged.
+
+	// OrdersPlaced tells the patient and the pharmacies about new orders
+	OrdersPlaced(ctx context.Context, orders []*entity.Order)
+	// OrderStatusChanged tells the patient and the pharmacies that an order
+	// moved from one status to another
+	OrderStatusChanged(ctx context.Context, order *entity.Order, fromStatus, toStatus string)
+	// AppointmentConfirmed tells the patient and the doctor that a slot of
+	// the appointment was confirmed
+	AppointmentConfirmed(ctx context.Context, appointment *entity.Appointment, slot *entity.BookedSlot)
+	// AppointmentCancelled tells the patient and the doctor that the
+	// appointment was cancelled
+	AppointmentCancelled(ctx context.Context, appointment *entity.Appointment, reason string)
+}
+
+type eventStreamUseCase struct {
+	bus          service.EventBus
+	orderRepo    repository.OrderRepository
+	pharmacyRepo repository.PharmacyRepository
+}
+
+// NewEventStreamUseCase creates a new instance of eventStreamUseCase
+func NewEventStreamUseCase(bus service.EventBus, orderRepo repository.OrderRepository, pharmacyRepo repository.PharmacyRepository) EventStreamUseCase {
+	return &eventStreamUseCase{
+		bus:          bus,
+		orderRepo:    orderRepo,
+		pharmacyRepo: pharmacyRepo,
+	}
+}
+
+func (uc *eventStreamUseCase) Subscribe(ctx context.Context, userID uuid.UUID) <-chan service.Event {
+	return uc.bus.Subscribe(ctx, userID)
+}
+
+func (uc *eventStreamUseCase) OrdersPlaced(ctx context.Context, orders []*entity.Order) {
+	for _, order := range orders {
+		recipients := append(uc.pharmacyUsers(ctx, order), order.UserID)
+		uc.publish(ctx, EventOrderPlaced, types.OrderEvent{
+			OrderID:     order.ID,
+			OrderNumber: order.OrderNumber,
+			PharmacyID:  order.PharmacyID,
+			Status:      order.Status,
+			TotalAmount: order.TotalAmount,
+		}, recipients)
+	}
+}
+
+func (uc *eventStreamUseCase) OrderStatusChanged(ctx context.Context, order *entity.Order, fromStatus, toStatus string) {
+	if fromStatus == toStatus {
+		return
+	}
+
+	recipients := append(uc.pharmacyUsers(ctx, order), order.UserID)
+	uc.publish(ctx, EventOrderStatusChanged, types.OrderEvent{
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		PharmacyID:  order.PharmacyID,
+		FromStatus:  fromStatus,
+		Status:      toStatus,
+		TotalAmount: order.TotalAmount,
+	}, recipients)
+}
+
+func (uc *eventStreamUseCase) AppointmentConfirmed(ctx context.Context, appointment *entity.Appointment, slot *entity.BookedSlot) {
+	event := appointmentEvent(appointment, string(entity.AppointmentStatusConfirmed))
+	if slot != nil {
+		event.AppointmentDate = slot.AppointmentDate
+		event.AppointmentTime = slot.AppointmentTime
+	}
+	uc.publish(ctx, EventAppointmentConfirmed, event, appointmentUsers(appointment))
+}
+
+func (uc *eventStreamUseCase) AppointmentCancelled(ctx context.Context, appointment *entity.Appointment, reason string) {
+	event := appointmentEvent(appointment, string(entity.AppointmentStatusCancelled))
+	event.Reason = reason
+	uc.publish(ctx, EventAppointmentCancelled, event, appointmentUsers(appointment))
+}
+
+// publish sends the event to each recipient once
+func (uc *eventStreamUseCase) publish(ctx context.Context, eventType string, payload interface{}, recipients []uuid.UUID) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	seen := make(map[uuid.UUID]bool, len(recipients))
+	for _, userID := range recipients {
+		if userID == uuid.Nil || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		event := service.Event{
+			ID:        uuid.New().String(),
+			Type:      eventType,
+			UserID:    userID,
+			Data:      data,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := uc.bus.Publish(ctx, event); err != nil {
+			log.Printf("Failed to publish %s event for user %s: %v", eventType, userID, err)
+		}
+	}
+}
+
+// pharmacyUsers returns the users running the pharmacies of the order,
+// loading its items when they are needed to tell which pharmacies those are
+func (uc *eventStreamUseCase) pharmacyUsers(ctx context.Context, order *entity.Order) []uuid.UUID {
+	pharmacyIDs := order.PharmacyIDs()
+	if len(pharmacyIDs) == 0 {
+		loaded, err := uc.orderRepo.GetOrderByID(ctx, order.ID)
+		if err != nil {
+			log.Printf("Failed to load order %s for its events: %v", order.OrderNumber, err)
+			return nil
+		}
+		if loaded != nil {
+			pharmacyIDs = loaded.PharmacyIDs()
+		}
+	}
+
+	userIDs, err := uc.pharmacyRepo.ListUserIDs(ctx, pharmacyIDs)
+	if err != nil {
+		log.Printf("Failed to find the pharmacies of order %s for its events: %v", order.OrderNumber, err)
+		return nil
+	}
+	return userIDs
+}
+
+// appointmentUsers returns the patient and the doctor. Appointments hold the
+// doctor's user ID, as booking looks doctors up by it.
+func appointmentUsers(appointment *entity.Appointment) []uuid.UUID {
+	return []uuid.UUID{appointment.PatientID, appointment.DoctorID}
+}
+
+func appointmentEvent(appointment *entity.Appointment, status string) types.AppointmentEvent {
+	return types.AppointmentEvent{
+		AppointmentID: appointment.ID,
+		DoctorID:      appointment.DoctorID,
+		DoctorName:    appointment.DoctorName,
+		PatientID:     appointment.PatientID,
+		Status:        status,
+		Mode:          string(appointment.Mode),
+	}
+}
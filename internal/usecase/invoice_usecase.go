@@ -0,0 +1,253 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// ErrInvoiceNotAvailable is returned for orders that have not been paid for
+var ErrInvoiceNotAvailable = errors.New("invoice is not available until the order is paid")
+
+// InvoiceUseCase issues GST tax invoices for paid orders
+type InvoiceUseCase interface {
+	// IssueInvoice renders, stores and emails the invoice for an order. An
+	// order keeps the first invoice issued for it.
+	IssueInvoice(ctx context.Context, orderID uuid.UUID) (*entity.Invoice, error)
+	// IssueInvoicesForPayment issues invoices for every order paid for by a payment
+	IssueInvoicesForPayment(ctx context.Context, paymentID uuid.UUID) error
+	// GetInvoicePDF returns one of the user's invoices with its PDF, issuing it if needed
+	GetInvoicePDF(ctx context.Context, orderID uuid.UUID, userID uuid.UUID) (*entity.Invoice, []byte, error)
+}
+
+type invoiceUseCase struct {
+	invoiceRepo  repository.InvoiceRepository
+	orderRepo    repository.OrderRepository
+	userRepo     repository.UserRepository
+	renderer     service.InvoiceRenderer
+	store        service.DocumentStore
+	emailService service.EmailService
+}
+
+// NewInvoiceUseCase creates a new instance of invoiceUseCase
+func NewInvoiceUseCase(
+	invoiceRepo repository.InvoiceRepository,
+	orderRepo repository.OrderRepository,
+	userRepo repository.UserRepository,
+	renderer service.InvoiceRenderer,
+	store service.DocumentStore,
+	emailService service.EmailService,
+) InvoiceUseCase {
+	return &invoiceUseCase{
+		invoiceRepo:  invoiceRepo,
+		orderRepo:    orderRepo,
+		userRepo:     userRepo,
+		renderer:     renderer,
+		store:        store,
+		emailService: emailService,
+	}
+}
+
+func (uc *invoiceUseCase) IssueInvoice(ctx context.Context, orderID uuid.UUID) (*entity.Invoice, error) {
+	existing, err := uc.invoiceRepo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	invoice, pdf, err := uc.createInvoice(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.emailInvoice(ctx, order, invoice, pdf)
+	return invoice, nil
+}
+
+func (uc *invoiceUseCase) IssueInvoicesForPayment(ctx context.Context, paymentID uuid.UUID) error {
+	orders, err := uc.orderRepo.GetOrdersByPaymentID(ctx, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+
+	var errs []error
+	for _, order := range orders {
+		if _, err := uc.IssueInvoice(ctx, order.ID); err != nil {
+			errs = append(errs, fmt.Errorf("order %s: %w", order.OrderNumber, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (uc *invoiceUseCase) GetInvoicePDF(ctx context.Context, orderID uuid.UUID, userID uuid.UUID) (*entity.Invoice, []byte, error) {
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, nil, ErrOrderNotFound
+	}
+	if order.UserID != userID {
+		return nil, nil, ErrNotOrderOwner
+	}
+
+	invoice, err := uc.invoiceRepo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+	if invoice == nil {
+		// Issuing normally follows payment; catch up if that step failed
+		invoice, pdf, err := uc.createInvoice(ctx, order)
+		if err != nil {
+			return nil, nil, err
+		}
+		uc.emailInvoice(ctx, order, invoice, pdf)
+		return invoice, pdf, nil
+	}
+
+	pdf, err := uc.store.Load(ctx, invoice.FilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load invoice: %w", err)
+	}
+	return invoice, pdf, nil
+}
+
+// createInvoice renders and stores the invoice for a paid order
+func (uc *invoiceUseCase) createInvoice(ctx context.Context, order *entity.Order) (*entity.Invoice, []byte, error) {
+	if !isInvoiceable(order) {
+		return nil, nil, ErrInvoiceNotAvailable
+	}
+
+	pharmacy := order.Pharmacy
+	if pharmacy == nil {
+		// Orders placed before carts were split by pharmacy
+		for _, item := range order.OrderItems {
+			if item.Medicine != nil && item.Medicine.Pharmacy != nil {
+				pharmacy = item.Medicine.Pharmacy
+				break
+			}
+		}
+	}
+	if pharmacy == nil {
+		return nil, nil, errors.New("pharmacy not found for order")
+	}
+
+	customer, err := uc.userRepo.GetByID(ctx, order.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	// The place of supply is where the patient has the medicines delivered
+	invoice := &entity.Invoice{
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		PharmacyID: pharmacy.ID,
+		IssuedAt:   time.Now(),
+	}
+	if customer != nil {
+		invoice.PlaceOfSupply = customer.Address.State
+	}
+	invoice.Interstate = entity.IsInterstateSupply(pharmacy.State, invoice.PlaceOfSupply)
+
+	lines := entity.NewInvoiceLines(order, invoice.Interstate)
+	invoice.ApplyTotals(lines)
+
+	var pdf []byte
+	err = uc.invoiceRepo.CreateNumbered(ctx, invoice, func(invoice *entity.Invoice) error {
+		invoice.FilePath = fmt.Sprintf("invoices/%s/%s.pdf", invoice.PharmacyID, invoice.InvoiceNumber)
+
+		var err error
+		pdf, err = uc.renderer.Render(&service.InvoiceDocument{
+			Invoice:  invoice,
+			Order:    order,
+			Pharmacy: pharmacy,
+			Customer: customer,
+			Lines:    lines,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render invoice: %w", err)
+		}
+		if err := uc.store.Save(ctx, invoice.FilePath, pdf); err != nil {
+			return fmt.Errorf("failed to store invoice: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// Another request may have issued it first
+		if existing, getErr := uc.invoiceRepo.GetByOrderID(ctx, order.ID); getErr == nil && existing != nil {
+			stored, loadErr := uc.store.Load(ctx, existing.FilePath)
+			if loadErr != nil {
+				return nil, nil, fmt.Errorf("failed to load invoice: %w", loadErr)
+			}
+			return existing, stored, nil
+		}
+		return nil, nil, fmt.Errorf("failed to save invoice: %w", err)
+	}
+	return invoice, pdf, nil
+}
+
+// emailInvoice sends the invoice to the customer. Failures are logged; the
+// invoice stays downloadable.
+func (uc *invoiceUseCase) emailInvoice(ctx context.Context, order *entity.Order, invoice *entity.Invoice, pdf []byte) {
+	if invoice.EmailedAt != nil {
+		return
+	}
+
+	customer, err := uc.userRepo.GetByID(ctx, order.UserID)
+	if err != nil || customer == nil || customer.Email == nil || *customer.Email == "" {
+		log.Printf("No email for customer of order %s; invoice %s not emailed", order.OrderNumber, invoice.InvoiceNumber)
+		return
+	}
+
+	data := map[string]interface{}{
+		"UserName":      customer.GetFullName(),
+		"OrderNumber":   order.OrderNumber,
+		"InvoiceNumber": invoice.InvoiceNumber,
+		"TotalAmount":   fmt.Sprintf("%.2f", invoice.TotalAmount),
+	}
+	attachments := []entity.EmailAttachment{{
+		Filename:    invoice.InvoiceNumber + ".pdf",
+		Content:     pdf,
+		ContentType: "application/pdf",
+	}}
+	if err := uc.emailService.SendWithAttachments(ctx, []string{*customer.Email}, entity.EmailTypeInvoice, data, attachments); err != nil {
+		log.Printf("Failed to email invoice %s: %v", invoice.InvoiceNumber, err)
+		return
+	}
+
+	now := time.Now()
+	if err := uc.invoiceRepo.MarkEmailed(ctx, invoice.ID, now); err != nil {
+		log.Printf("Failed to mark invoice %s emailed: %v", invoice.InvoiceNumber, err)
+		return
+	}
+	invoice.EmailedAt = &now
+}
+
+// isInvoiceable reports whether the order has been paid for: online payments
+// once successful, cash on delivery once the cash is collected.
+func isInvoiceable(order *entity.Order) bool {
+	if order.Status == entity.OrderStatusCancelled || order.Status == entity.OrderStatusCancellationPending || order.Payment == nil {
+		return false
+	}
+	payment := order.Payment
+	if payment.PaymentMethod == "cash" {
+		return order.CashCollectedAt != nil || payment.CollectedAt != nil
+	}
+	return payment.IsSettled()
+}
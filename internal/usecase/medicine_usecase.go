@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,31 +16,59 @@ import (
 type MedicineUseCase interface {
 	// Medicine management methods
 
-	GetMedicines(ctx context.Context, searchQuery string) ([]*entity.Medicine, error)
+	GetMedicines(ctx context.Context, req types.MedicineRequest) (*types.MedicineSearchResponse, int64, error)
 	AddMedicine(ctx context.Context, userId uuid.UUID, medicine *entity.Medicine) (*entity.Medicine, error)
 	ListMedicines(ctx context.Context, filters types.MedicineFilters) ([]*entity.Medicine, int64, error)
 	GetMedicineByID(ctx context.Context, medicineID uuid.UUID) (*entity.Medicine, error)
 	DeleteMedicine(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) (string, error)
 	UpdateMedicine(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, updatedMedicine *entity.Medicine) (*entity.Medicine, error)
+
+	// Batch management methods
+	ListBatches(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) ([]*entity.MedicineBatch, error)
+	AddBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, req *types.MedicineBatchRequest) (*entity.MedicineBatch, error)
+	UpdateBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, batchID uuid.UUID, req *types.UpdateMedicineBatchRequest) (*entity.MedicineBatch, error)
+	TraceBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, batchID uuid.UUID) ([]*entity.OrderItemBatch, error)
 }
 
 // medicineUseCase implements the MedicineUseCase interface
 type medicineUseCase struct {
 	medicineRepo repository.MedicineRepository
+	batchRepo    repository.MedicineBatchRepository
 	userRepo     repository.UserRepository
+	suggestions  SearchSuggestUseCase
 }
 
 // NewMedicineUseCase creates a new instance of medicineUseCase
-func NewMedicineUseCase(medicineRepo repository.MedicineRepository, userRepo repository.UserRepository) MedicineUseCase {
+func NewMedicineUseCase(medicineRepo repository.MedicineRepository, batchRepo repository.MedicineBatchRepository, userRepo repository.UserRepository, suggestions SearchSuggestUseCase) MedicineUseCase {
 	return &medicineUseCase{
 		userRepo:     userRepo,
 		medicineRepo: medicineRepo,
+		batchRepo:    batchRepo,
+		suggestions:  suggestions,
 	}
 }
 
 // GetMedicines implements the MedicineUseCase interface
-func (u *medicineUseCase) GetMedicines(ctx context.Context, searchQuery string) ([]*entity.Medicine, error) {
-	return u.medicineRepo.GetMedicines(ctx, searchQuery)
+func (u *medicineUseCase) GetMedicines(ctx context.Context, req types.MedicineRequest) (*types.MedicineSearchResponse, int64, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 10
+	}
+
+	medicines, total, err := u.medicineRepo.GetMedicines(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	facets, err := u.medicineRepo.GetMedicineFacets(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &types.MedicineSearchResponse{
+		Medicines: medicines,
+		Facets:    facets,
+	}, total, nil
 }
 
 // AddMedicine implements the MedicineUseCase interface
@@ -51,7 +80,12 @@ func (u *medicineUseCase) AddMedicine(ctx context.Context, userId uuid.UUID, med
 	}
 
 	// Call repository
-	return u.medicineRepo.AddMedicine(ctx, userId, medicine)
+	added, err := u.medicineRepo.AddMedicine(ctx, userId, medicine)
+	if err != nil {
+		return nil, err
+	}
+	u.suggestions.InvalidateSuggestions(ctx)
+	return added, nil
 }
 func (u *medicineUseCase) GetMedicineByID(ctx context.Context, medicineID uuid.UUID) (*entity.Medicine, error) {
 	medicine, err := u.medicineRepo.GetMedicineByID(ctx, medicineID)
@@ -99,6 +133,7 @@ func (u *medicineUseCase) DeleteMedicine(ctx context.Context, userID uuid.UUID,
 	if err := u.medicineRepo.DeleteMedicine(ctx, medicineID); err != nil {
 		return "", err
 	}
+	u.suggestions.InvalidateSuggestions(ctx)
 
 	return imageURL, nil
 }
@@ -130,9 +165,132 @@ func (u *medicineUseCase) UpdateMedicine(ctx context.Context, userID uuid.UUID,
 	if err := u.medicineRepo.UpdateMedicine(ctx, userID, medicineID, updatedMedicine); err != nil {
 		return nil, err
 	}
+	u.suggestions.InvalidateSuggestions(ctx)
 	updatedMedicineData, err := u.medicineRepo.GetMedicineByID(ctx, medicineID)
 	if err != nil {
 		return nil, err
 	}
 	return updatedMedicineData, nil
 }
+
+// ListBatches returns the batches of one of the pharmacy's medicines, the one
+// sold next first
+func (u *medicineUseCase) ListBatches(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) ([]*entity.MedicineBatch, error) {
+	if _, err := u.getPharmacyMedicine(ctx, userID, medicineID); err != nil {
+		return nil, err
+	}
+	return u.batchRepo.ListBatches(ctx, medicineID)
+}
+
+// AddBatch receives a new batch of one of the pharmacy's medicines
+func (u *medicineUseCase) AddBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, req *types.MedicineBatchRequest) (*entity.MedicineBatch, error) {
+	if _, err := u.getPharmacyMedicine(ctx, userID, medicineID); err != nil {
+		return nil, err
+	}
+
+	batch := &entity.MedicineBatch{
+		MedicineID:  medicineID,
+		BatchNumber: strings.TrimSpace(req.BatchNumber),
+		Quantity:    req.Quantity,
+		CostPrice:   req.CostPrice,
+		ReceivedAt:  time.Now(),
+	}
+	if req.ExpiryDate != "" {
+		expiryDate, err := parseExpiryDate(req.ExpiryDate)
+		if err != nil {
+			return nil, err
+		}
+		batch.ExpiryDate = expiryDate
+	}
+
+	existing, err := u.batchRepo.GetBatchByNumber(ctx, medicineID, batch.BatchNumber)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.New("batch already exists")
+	}
+
+	if err := u.batchRepo.CreateBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// UpdateBatch corrects the quantity, expiry or cost of a batch
+func (u *medicineUseCase) UpdateBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, batchID uuid.UUID, req *types.UpdateMedicineBatchRequest) (*entity.MedicineBatch, error) {
+	batch, err := u.getPharmacyBatch(ctx, userID, medicineID, batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ExpiryDate != nil {
+		expiryDate, err := parseExpiryDate(*req.ExpiryDate)
+		if err != nil {
+			return nil, err
+		}
+		batch.ExpiryDate = expiryDate
+	}
+	if req.Quantity != nil {
+		batch.Quantity = *req.Quantity
+	}
+	if req.CostPrice != nil {
+		batch.CostPrice = *req.CostPrice
+	}
+
+	if err := u.batchRepo.UpdateBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// TraceBatch lists the order items a batch was sold in, for recalls
+func (u *medicineUseCase) TraceBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, batchID uuid.UUID) ([]*entity.OrderItemBatch, error) {
+	if _, err := u.getPharmacyBatch(ctx, userID, medicineID, batchID); err != nil {
+		return nil, err
+	}
+	return u.batchRepo.ListAllocations(ctx, batchID)
+}
+
+func (u *medicineUseCase) getPharmacyMedicine(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) (*entity.Medicine, error) {
+	medicine, err := u.medicineRepo.GetMedicineByID(ctx, medicineID)
+	if err != nil {
+		return nil, err
+	}
+	if medicine == nil {
+		return nil, errors.New("medicine not found")
+	}
+
+	pharmacyID := u.userRepo.GetPharmacyByUserID(ctx, userID)
+	if pharmacyID == uuid.Nil || medicine.PharmacyID != pharmacyID {
+		return nil, errors.New("unauthorized to manage this medicine")
+	}
+	return medicine, nil
+}
+
+func (u *medicineUseCase) getPharmacyBatch(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, batchID uuid.UUID) (*entity.MedicineBatch, error) {
+	if _, err := u.getPharmacyMedicine(ctx, userID, medicineID); err != nil {
+		return nil, err
+	}
+
+	batch, err := u.batchRepo.GetBatchByID(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch == nil || batch.MedicineID != medicineID {
+		return nil, errors.New("batch not found")
+	}
+	return batch, nil
+}
+
+// parseExpiryDate parses a batch expiry and rejects dates already past
+func parseExpiryDate(value string) (*time.Time, error) {
+	expiryDate, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if expiryDate.Before(time.Now()) {
+		return nil, errors.New("medicine has already expired")
+	}
+	return &expiryDate, nil
+}
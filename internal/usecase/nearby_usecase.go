@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+)
+
+var ErrLocationRequired = errors.New("a location is required: pass lat and lng or save an address with coordinates")
+
+// defaultNearbyRadiusKm is how far around the patient nearby searches look
+// when no radius is given
+const defaultNearbyRadiusKm = 5
+
+// NearbyUseCase finds pharmacies and medicines around a patient, nearest first
+type NearbyUseCase interface {
+	FindNearbyPharmacies(ctx context.Context, userID uuid.UUID, req types.NearbyPharmaciesRequest) ([]types.NearbyPharmacy, int64, error)
+	FindNearbyMedicines(ctx context.Context, userID uuid.UUID, req types.NearbyMedicinesRequest) ([]types.NearbyMedicine, int64, error)
+}
+
+type nearbyUseCase struct {
+	pharmacyRepo repository.PharmacyRepository
+	medicineRepo repository.MedicineRepository
+	userRepo     repository.UserRepository
+}
+
+// NewNearbyUseCase creates a new instance of nearbyUseCase
+func NewNearbyUseCase(pharmacyRepo repository.PharmacyRepository, medicineRepo repository.MedicineRepository, userRepo repository.UserRepository) NearbyUseCase {
+	return &nearbyUseCase{
+		pharmacyRepo: pharmacyRepo,
+		medicineRepo: medicineRepo,
+		userRepo:     userRepo,
+	}
+}
+
+func (uc *nearbyUseCase) FindNearbyPharmacies(ctx context.Context, userID uuid.UUID, req types.NearbyPharmaciesRequest) ([]types.NearbyPharmacy, int64, error) {
+	origin, err := searchOrigin(ctx, uc.userRepo, userID, req.Latitude, req.Longitude)
+	if err != nil {
+		return nil, 0, err
+	}
+	if origin == nil {
+		return nil, 0, ErrLocationRequired
+	}
+
+	req.Page, req.Limit, req.RadiusKm = nearbyPaging(req.Page, req.Limit, req.RadiusKm)
+	return uc.pharmacyRepo.FindNearby(ctx, *origin, req)
+}
+
+func (uc *nearbyUseCase) FindNearbyMedicines(ctx context.Context, userID uuid.UUID, req types.NearbyMedicinesRequest) ([]types.NearbyMedicine, int64, error) {
+	origin, err := searchOrigin(ctx, uc.userRepo, userID, req.Latitude, req.Longitude)
+	if err != nil {
+		return nil, 0, err
+	}
+	if origin == nil {
+		return nil, 0, ErrLocationRequired
+	}
+
+	req.Page, req.Limit, req.RadiusKm = nearbyPaging(req.Page, req.Limit, req.RadiusKm)
+	return uc.medicineRepo.FindNearby(ctx, *origin, req)
+}
+
+// nearbyPaging applies the defaults of a nearby search
+func nearbyPaging(page, limit int, radiusKm float64) (int, int, float64) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	if radiusKm <= 0 {
+		radiusKm = defaultNearbyRadiusKm
+	}
+	return page, limit, radiusKm
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 
 	"github.com/google/uuid"
 	"github.com/skryfon/collex/internal/domain/entity"
@@ -20,7 +21,8 @@ type OrderUseCase interface {
 	RemoveFromCart(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) error
 	UpdateCart(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, quantity int) (*entity.Cart, error)
 	GetPharmacyByUserID(ctx context.Context, userID uuid.UUID) (*entity.Pharmacy, error)
-	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string, userID uuid.UUID) error
+	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, req types.UpdateOrderStatusRequest) error
+	GetOrderTimeline(ctx context.Context, orderID uuid.UUID, userID uuid.UUID) ([]*entity.OrderStatusHistory, error)
 	GetPharmacyOrders(ctx context.Context, pharmacyID uuid.UUID, filter types.ListPharmacyOrders) ([]*entity.Order, int64, error)
 
 	//Order Managem	enet Methods
@@ -29,15 +31,25 @@ type OrderUseCase interface {
 
 // orderUseCase implements the OrderUseCase interface
 type orderUseCase struct {
-	orderRepo    repository.OrderRepository
-	medicineRepo repository.MedicineRepository
+	orderRepo      repository.OrderRepository
+	medicineRepo   repository.MedicineRepository
+	paymentRepo    repository.PaymentRepository
+	couponRepo     repository.CouponRepository
+	invoiceUseCase InvoiceUseCase
+	substitutes    SubstituteUseCase
+	events         EventStreamUseCase
 }
 
 // NewMedicineUseCase creates a new instance of medicineUseCase
-func NewOrderUseCase(orderRepo repository.OrderRepository, medicineRepo repository.MedicineRepository) OrderUseCase {
+func NewOrderUseCase(orderRepo repository.OrderRepository, medicineRepo repository.MedicineRepository, paymentRepo repository.PaymentRepository, couponRepo repository.CouponRepository, invoiceUseCase InvoiceUseCase, substitutes SubstituteUseCase, events EventStreamUseCase) OrderUseCase {
 	return &orderUseCase{
-		orderRepo:    orderRepo,
-		medicineRepo: medicineRepo,
+		orderRepo:      orderRepo,
+		medicineRepo:   medicineRepo,
+		paymentRepo:    paymentRepo,
+		couponRepo:     couponRepo,
+		invoiceUseCase: invoiceUseCase,
+		substitutes:    substitutes,
+		events:         events,
 	}
 }
 
@@ -45,7 +57,14 @@ func (uc *orderUseCase) AddToCart(ctx context.Context, order *entity.Cart) error
 	return uc.orderRepo.AddToCart(ctx, order)
 }
 func (uc *orderUseCase) GetCart(ctx context.Context, userID uuid.UUID) (*entity.Cart, error) {
-	return uc.orderRepo.GetCartByUserID(ctx, userID)
+	cart, err := uc.orderRepo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.substitutes.SuggestCartSubstitutes(ctx, cart); err != nil {
+		return nil, err
+	}
+	return cart, priceCart(ctx, uc.couponRepo, cart)
 }
 func (uc *orderUseCase) RemoveFromCart(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID) error {
 	return uc.orderRepo.RemoveFromCart(ctx, userID, medicineID)
@@ -58,7 +77,7 @@ func (uc *orderUseCase) UpdateCart(ctx context.Context, userID uuid.UUID, medici
 
 	// If quantity is 0, just remove from cart (no need to check medicine)
 	if quantity == 0 {
-		return uc.orderRepo.UpdateCart(ctx, userID, medicineID, quantity)
+		return uc.updateCart(ctx, userID, medicineID, quantity)
 	}
 
 	// Get medicine to check availability and active status
@@ -79,7 +98,19 @@ func (uc *orderUseCase) UpdateCart(ctx context.Context, userID uuid.UUID, medici
 	}
 
 	// Update cart item
-	return uc.orderRepo.UpdateCart(ctx, userID, medicineID, quantity)
+	return uc.updateCart(ctx, userID, medicineID, quantity)
+}
+
+// updateCart changes a cart line and returns the cart with its coupon priced
+func (uc *orderUseCase) updateCart(ctx context.Context, userID uuid.UUID, medicineID uuid.UUID, quantity int) (*entity.Cart, error) {
+	cart, err := uc.orderRepo.UpdateCart(ctx, userID, medicineID, quantity)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.substitutes.SuggestCartSubstitutes(ctx, cart); err != nil {
+		return nil, err
+	}
+	return cart, priceCart(ctx, uc.couponRepo, cart)
 }
 func (uc *orderUseCase) GetPharmacyByUserID(ctx context.Context, userID uuid.UUID) (*entity.Pharmacy, error) {
 	pharmacy, err := uc.orderRepo.GetPharmacyByUserID(ctx, userID)
@@ -99,7 +130,10 @@ func (u *orderUseCase) GetPharmacyOrders(ctx context.Context, pharmacyID uuid.UU
 	return u.orderRepo.GetPharmacyOrders(ctx, pharmacyID, filter)
 }
 
-func (uc *orderUseCase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string, userID uuid.UUID) error {
+// UpdateOrderStatus moves a pharmacy's order to a new status following the
+// order state machine. CashCollected records the order's cash on delivery as
+// collected and is only accepted with "delivered", also for an order that is already delivered.
+func (uc *orderUseCase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, req types.UpdateOrderStatusRequest) error {
 	// Get pharmacy associated with the user
 	pharmacy, err := uc.orderRepo.GetPharmacyByUserID(ctx, userID)
 	if err != nil {
@@ -116,16 +150,94 @@ func (uc *orderUseCase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID
 	}
 
 	// Verify that the order belongs to the user's pharmacy
+	if order == nil {
+		return errors.New("order not found")
+	}
 	if len(order.OrderItems) == 0 {
 		return errors.New("order has no items")
 	}
 
-	if order.OrderItems[0].Medicine.PharmacyID != pharmacy.ID {
+	if !order.BelongsToPharmacy(pharmacy.ID) {
 		return errors.New("unauthorized")
 	}
 
-	// Update the order status
-	return uc.orderRepo.UpdateOrderStatus(ctx, orderID, status)
+	if !entity.IsValidOrderStatus(req.Status) {
+		return errors.New("invalid status")
+	}
+	// Cancelling also refunds or restocks the order, which the cancel
+	// endpoint takes care of
+	if req.Status == entity.OrderStatusCancelled || req.Status == entity.OrderStatusCancellationPending {
+		return errors.New("use the cancel endpoint to cancel an order")
+	}
+	if req.CashCollected && req.Status != entity.OrderStatusDelivered {
+		return errors.New("cash can only be collected on delivery")
+	}
+
+	// Collecting cash for an order delivered earlier needs no transition
+	if order.Status != req.Status || !req.CashCollected {
+		if !entity.CanTransitionOrder(order.Status, req.Status, entity.OrderActorPharmacy) {
+			return errors.New("invalid status transition")
+		}
+		if order.HeldForPrescription(req.Status) {
+			return ErrPrescriptionNotApproved
+		}
+		// A delivery under way ships and delivers the order itself
+		if req.Status == entity.OrderStatusShipped || req.Status == entity.OrderStatusDelivered {
+			active, err := uc.orderRepo.HasActiveDelivery(ctx, orderID)
+			if err != nil {
+				return err
+			}
+			if active {
+				return errors.New("order is out with a delivery partner")
+			}
+		}
+
+		updated, err := uc.orderRepo.TransitionOrderStatus(ctx, &entity.OrderStatusHistory{
+			OrderID:    orderID,
+			FromStatus: order.Status,
+			ToStatus:   req.Status,
+			ActorID:    &userID,
+			ActorRole:  entity.OrderActorPharmacy,
+			Note:       req.Note,
+		})
+		if err != nil {
+			return err
+		}
+		if !updated {
+			// Someone else moved the order since it was read
+			return errors.New("invalid status transition")
+		}
+		uc.events.OrderStatusChanged(ctx, order, order.Status, req.Status)
+	}
+
+	if req.CashCollected {
+		collected, err := uc.paymentRepo.MarkCashCollected(ctx, order.ID, userID)
+		if err != nil {
+			return err
+		}
+		if collected {
+			if _, err := uc.invoiceUseCase.IssueInvoice(ctx, order.ID); err != nil {
+				log.Printf("Failed to issue invoices for order %s: %v", order.OrderNumber, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetOrderTimeline returns the status changes of one of the user's orders, oldest first
+func (uc *orderUseCase) GetOrderTimeline(ctx context.Context, orderID uuid.UUID, userID uuid.UUID) ([]*entity.OrderStatusHistory, error) {
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, errors.New("order not found")
+	}
+	if order.UserID != userID {
+		return nil, errors.New("unauthorized")
+	}
+
+	return uc.orderRepo.GetOrderStatusHistory(ctx, orderID)
 }
 
 func (uc *orderUseCase) GetTotalRevenue(ctx context.Context, pharmacyID uuid.UUID) (float64, error) {
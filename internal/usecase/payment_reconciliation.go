@@ -0,0 +1,236 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/service"
+)
+
+// reconcileBatchSize caps how many stale payments one reconciler run checks
+const reconcileBatchSize = 100
+
+// ReconcilePendingPayments settles payments left pending because neither the
+// client verify call nor the webhook reached us. Each stale payment is looked
+// up on the gateway by its order: a captured attempt completes it as if it had
+// been verified, and failed or long-abandoned checkouts are marked failed and
+// their stock released. Authorized attempts are left for the gateway to
+// capture or void.
+func (u *PaymentUseCase) ReconcilePendingPayments(ctx context.Context) error {
+	now := time.Now()
+	payments, err := u.paymentRepo.GetStalePendingPayments(ctx, now.Add(-u.staleAfter), reconcileBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get stale payments: %w", err)
+	}
+
+	var completed, failed int
+	for _, payment := range payments {
+		attempts, err := u.gateway.FetchOrderPayments(ctx, payment.RazorpayOrderID)
+		if err != nil {
+			log.Printf("Reconciler: failed to fetch payments for %s: %v", payment.RazorpayOrderID, err)
+			continue
+		}
+
+		captured, inFlight := classifyAttempts(attempts)
+		switch {
+		case captured != nil:
+			if err := u.fulfilPayment(ctx, payment, captured.ID, "", captured.Method); err != nil {
+				log.Printf("Reconciler: failed to complete payment %s: %v", payment.OrderID, err)
+				continue
+			}
+			completed++
+
+		case inFlight:
+			// The customer may still be paying, or the gateway has yet to capture.
+
+		case len(attempts) > 0 || payment.CreatedAt.Before(now.Add(-u.abandonAfter)):
+			reason := "checkout abandoned"
+			if len(attempts) > 0 {
+				reason = "all payment attempts failed"
+			}
+			ok, err := u.paymentRepo.UpdateStatusFrom(ctx, payment.OrderID, []string{"pending"}, "failed", "", "", "", reason)
+			if err != nil {
+				log.Printf("Reconciler: failed to fail payment %s: %v", payment.OrderID, err)
+				continue
+			}
+			if ok {
+				if err := u.releaseCheckout(ctx, payment.OrderID); err != nil {
+					log.Printf("Reconciler: failed to release reservation for %s: %v", payment.OrderID, err)
+				}
+				failed++
+			}
+		}
+	}
+
+	if completed > 0 || failed > 0 {
+		log.Printf("Reconciled pending payments: %d completed, %d failed", completed, failed)
+	}
+	return nil
+}
+
+// classifyAttempts returns the captured attempt, if any, and whether another
+// attempt is still in flight
+func classifyAttempts(attempts []*service.GatewayPayment) (*service.GatewayPayment, bool) {
+	inFlight := false
+	for _, attempt := range attempts {
+		switch attempt.Status {
+		case "captured", "refunded":
+			return attempt, false
+		case "created", "authorized":
+			inFlight = true
+		}
+	}
+	return nil, inFlight
+}
+
+// GenerateDailyReconciliationReport builds the report for the previous day
+// unless it already exists. It runs hourly so a missed run is caught up.
+func (u *PaymentUseCase) GenerateDailyReconciliationReport(ctx context.Context) error {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	existing, err := u.reconRepo.GetReportByDate(ctx, yesterday.Format(time.DateOnly))
+	if err != nil {
+		return fmt.Errorf("failed to get reconciliation report: %w", err)
+	}
+	if existing != nil {
+		return nil
+	}
+
+	report, err := u.GenerateReconciliationReport(ctx, yesterday)
+	if err != nil {
+		return err
+	}
+	if report.MismatchCount > 0 {
+		log.Printf("Reconciliation report %s: %d mismatches", report.ReportDate, report.MismatchCount)
+	}
+	return nil
+}
+
+// GenerateReconciliationReport compares the payments captured on the gateway
+// during day with the payments table and stores the differences, replacing
+// any earlier report for that day.
+func (u *PaymentUseCase) GenerateReconciliationReport(ctx context.Context, day time.Time) (*entity.ReconciliationReport, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	gatewayPayments, err := u.gateway.ListPayments(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateway payments: %w", err)
+	}
+
+	// Money was taken for these; keyed by gateway order
+	captured := make(map[string]*service.GatewayPayment)
+	var orderIDs []string
+	for _, p := range gatewayPayments {
+		if p.OrderID == "" || (p.Status != "captured" && p.Status != "refunded") {
+			continue
+		}
+		if _, ok := captured[p.OrderID]; !ok {
+			orderIDs = append(orderIDs, p.OrderID)
+		}
+		captured[p.OrderID] = p
+	}
+
+	// Gateway payments can belong to checkouts started the day before
+	matched, err := u.paymentRepo.GetByRazorpayOrderIDs(ctx, orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	local := make(map[string]*entity.Payment, len(matched))
+	for _, p := range matched {
+		local[p.RazorpayOrderID] = p
+	}
+
+	report := &entity.ReconciliationReport{
+		ReportDate:   start.Format(time.DateOnly),
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		GatewayCount: len(captured),
+	}
+
+	for _, orderID := range orderIDs {
+		gp := captured[orderID]
+		payment, ok := local[orderID]
+		if !ok {
+			report.Mismatches = append(report.Mismatches, entity.ReconciliationMismatch{
+				Type:              entity.MismatchMissingLocally,
+				RazorpayOrderID:   orderID,
+				RazorpayPaymentID: gp.ID,
+				GatewayStatus:     gp.Status,
+				GatewayAmount:     paiseToRupees(gp.Amount),
+			})
+			continue
+		}
+		report.LocalCount++
+
+		if !payment.IsSettled() {
+			report.Mismatches = append(report.Mismatches, newMismatch(entity.MismatchStatus, payment, gp))
+		}
+		if math.Abs(payment.Amount-paiseToRupees(gp.Amount)) > 0.01 {
+			report.Mismatches = append(report.Mismatches, newMismatch(entity.MismatchAmount, payment, gp))
+		}
+	}
+
+	// Successful payments recorded locally that the gateway has no capture for
+	created, err := u.paymentRepo.GetGatewayPaymentsCreatedBetween(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	for _, payment := range created {
+		if !payment.IsSettled() {
+			continue
+		}
+		if _, ok := captured[payment.RazorpayOrderID]; ok {
+			continue
+		}
+
+		// The capture may have landed after midnight
+		attempts, err := u.gateway.FetchOrderPayments(ctx, payment.RazorpayOrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch payments for %s: %w", payment.RazorpayOrderID, err)
+		}
+		if gp, _ := classifyAttempts(attempts); gp == nil {
+			report.Mismatches = append(report.Mismatches, newMismatch(entity.MismatchMissingOnGateway, payment, nil))
+		}
+	}
+
+	report.MismatchCount = len(report.Mismatches)
+	if err := u.reconRepo.SaveReport(ctx, report); err != nil {
+		return nil, fmt.Errorf("failed to save reconciliation report: %w", err)
+	}
+	return report, nil
+}
+
+// GetReconciliationReport returns the report for a YYYY-MM-DD date with its mismatches
+func (u *PaymentUseCase) GetReconciliationReport(ctx context.Context, reportDate string) (*entity.ReconciliationReport, error) {
+	return u.reconRepo.GetReportByDate(ctx, reportDate)
+}
+
+// ListReconciliationReports returns report summaries, newest first
+func (u *PaymentUseCase) ListReconciliationReports(ctx context.Context, page, limit int) ([]*entity.ReconciliationReport, int64, error) {
+	return u.reconRepo.ListReports(ctx, page, limit)
+}
+
+func newMismatch(kind string, payment *entity.Payment, gp *service.GatewayPayment) entity.ReconciliationMismatch {
+	mismatch := entity.ReconciliationMismatch{
+		Type:              kind,
+		PaymentOrderID:    payment.OrderID,
+		RazorpayOrderID:   payment.RazorpayOrderID,
+		RazorpayPaymentID: payment.RazorpayPaymentID,
+		LocalStatus:       payment.Status,
+		LocalAmount:       payment.Amount,
+	}
+	if gp != nil {
+		mismatch.RazorpayPaymentID = gp.ID
+		mismatch.GatewayStatus = gp.Status
+		mismatch.GatewayAmount = paiseToRupees(gp.Amount)
+	}
+	return mismatch
+}
+
+func paiseToRupees(paise int64) float64 {
+	return float64(paise) / 100
+}
@@ -2,101 +2,145 @@ package usecase
 
 import (
 	"context"
-	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/razorpay/razorpay-go"
 	"github.com/skryfon/collex/internal/domain/entity"
 	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
 	"github.com/skryfon/collex/internal/types"
+	"github.com/skryfon/collex/pkg/config"
+	"github.com/skryfon/collex/shared"
+)
+
+var (
+	// ErrInvalidWebhookSignature is returned when a webhook body does not match its signature
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+	ErrAmountMismatch      = errors.New("amount does not match current prices")
+	ErrMedicineUnavailable = errors.New("medicine is not available")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidCart         = errors.New("invalid cart")
+
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrOrderNotRefundable = errors.New("order is not refundable")
+	ErrInvalidRefundItems = errors.New("invalid refund items")
+
+	ErrOrderNotCancellable = errors.New("order cannot be cancelled")
+	ErrNotOrderOwner       = errors.New("order does not belong to user")
 )
 
 type PaymentUseCase struct {
-	paymentRepo    repository.PaymentRepository
-	orderRepo      repository.OrderRepository
-	medicineRepo   repository.MedicineRepository
-	razorpayKey    string
-	razorpaySecret string
-	client         *razorpay.Client
+	paymentRepo      repository.PaymentRepository
+	orderRepo        repository.OrderRepository
+	medicineRepo     repository.MedicineRepository
+	refundRepo       repository.RefundRepository
+	reservationRepo  repository.StockReservationRepository
+	reconRepo        repository.ReconciliationRepository
+	couponRepo       repository.CouponRepository
+	prescriptionRepo repository.PrescriptionRepository
+	reservationTTL   time.Duration
+	staleAfter       time.Duration
+	abandonAfter     time.Duration
+	gateway          service.PaymentGateway
+	emailService     service.EmailService
+	invoiceUseCase   InvoiceUseCase
+	events           EventStreamUseCase
 }
 
 func NewPaymentUseCase(
 	paymentRepo repository.PaymentRepository,
 	orderRepo repository.OrderRepository,
 	medicineRepo repository.MedicineRepository,
-	razorpayKey string,
-	razorpaySecret string,
+	refundRepo repository.RefundRepository,
+	reservationRepo repository.StockReservationRepository,
+	reconRepo repository.ReconciliationRepository,
+	couponRepo repository.CouponRepository,
+	prescriptionRepo repository.PrescriptionRepository,
+	gateway service.PaymentGateway,
+	emailService service.EmailService,
+	invoiceUseCase InvoiceUseCase,
+	events EventStreamUseCase,
+	cfg config.Payment,
 ) *PaymentUseCase {
-	client := razorpay.NewClient(razorpayKey, razorpaySecret)
 	return &PaymentUseCase{
-		paymentRepo:    paymentRepo,
-		orderRepo:      orderRepo,
-		medicineRepo:   medicineRepo,
-		razorpayKey:    razorpayKey,
-		razorpaySecret: razorpaySecret,
-		client:         client,
+		paymentRepo:      paymentRepo,
+		orderRepo:        orderRepo,
+		medicineRepo:     medicineRepo,
+		refundRepo:       refundRepo,
+		reservationRepo:  reservationRepo,
+		reconRepo:        reconRepo,
+		couponRepo:       couponRepo,
+		prescriptionRepo: prescriptionRepo,
+		reservationTTL:   cfg.ReservationTTL,
+		staleAfter:       cfg.StaleAfter,
+		abandonAfter:     cfg.AbandonAfter,
+		gateway:          gateway,
+		emailService:     emailService,
+		invoiceUseCase:   invoiceUseCase,
+		events:           events,
 	}
 }
 
-func (u *PaymentUseCase) CreateOrder(ctx context.Context, userID uuid.UUID, req types.CreateOrderRequest) (*types.OrderResponse, error) {
-	// Generate unique order ID (max 40 chars for Razorpay receipt)
+// newPaymentOrderID generates a unique order ID (max 40 chars for Razorpay receipt)
+func newPaymentOrderID(prefix string) string {
 	timestamp := time.Now().Unix()
 	shortUUID := uuid.New().String()[:8]
-	orderID := fmt.Sprintf("ORD%d%s", timestamp, shortUUID)
+	orderID := fmt.Sprintf("%s%d%s", prefix, timestamp, shortUUID)
 
 	if len(orderID) > 40 {
 		orderID = orderID[:40]
 	}
+	return orderID
+}
 
-	// Validate MedicineID and Quantity if CartID is not provided
-	if req.CartID == nil || *req.CartID == "" {
-		if req.MedicineID == nil {
-			return nil, errors.New("medicineId is required when cartId is not provided")
-		}
-		if req.Quantity == nil || *req.Quantity <= 0 {
-			return nil, errors.New("quantity is required and must be greater than 0 when cartId is not provided")
-		}
+func (u *PaymentUseCase) CreateOrder(ctx context.Context, userID uuid.UUID, req types.CreateOrderRequest) (*types.OrderResponse, error) {
+	orderID := newPaymentOrderID("ORD")
 
-		// You can fetch medicine details from the database here using req.MedicineID
-		// and perform any necessary stock validation or price calculation.
+	// Price the checkout from our own records; the client amount is only
+	// accepted when it matches.
+	quote, err := u.quoteCheckout(ctx, userID, req)
+	if err != nil {
+		return nil, err
 	}
+	cartID, lineItems := quote.cartID, quote.lineItems
 
-	// Convert amount to paise
-	amountInPaise := int(req.Amount * 100)
-
-	// Prepare Razorpay order data
-	data := map[string]interface{}{
-		"amount":   amountInPaise,
-		"currency": req.Currency,
-		"receipt":  orderID,
+	amount := lineItems.Total()
+	if math.Abs(amount-req.Amount) > 0.01 {
+		return nil, fmt.Errorf("%w: expected %.2f, got %.2f", ErrAmountMismatch, amount, req.Amount)
 	}
 
-	if req.Notes != nil {
-		data["notes"] = req.Notes
+	// Hold the stock until the payment is verified, fails or the hold expires
+	reserved, err := u.reservationRepo.Reserve(ctx, orderID, lineItems, time.Now().Add(u.reservationTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	if !reserved {
+		return nil, fmt.Errorf("%w: stock is held by other checkouts", ErrInsufficientStock)
+	}
+	if err := u.holdCoupon(ctx, orderID, userID, quote); err != nil {
+		u.releaseCheckout(ctx, orderID)
+		return nil, err
 	}
 
-	// Create order in Razorpay
-	body, err := u.client.Order.Create(data, nil)
+	// Convert amount to paise
+	amountInPaise := int64(math.Round(amount * 100))
+
+	// Create order on the gateway
+	gatewayOrder, err := u.gateway.CreateOrder(ctx, amountInPaise, req.Currency, orderID, req.Notes)
 	if err != nil {
+		u.releaseCheckout(ctx, orderID)
 		return nil, fmt.Errorf("failed to create razorpay order: %w", err)
 	}
 
-	razorpayOrderID := body["id"].(string)
-
-	// Parse cart ID if provided
-	var cartID *uuid.UUID
-	if req.CartID != nil && *req.CartID != "" {
-		cid, err := uuid.Parse(*req.CartID)
-		if err == nil {
-			cartID = &cid
-		}
-	}
+	razorpayOrderID := gatewayOrder.ID
 
 	// Convert notes to JSON string
 	notesJSON := ""
@@ -114,7 +158,7 @@ func (u *PaymentUseCase) CreateOrder(ctx context.Context, userID uuid.UUID, req
 	// Save payment record in database
 	payment := &entity.Payment{
 		OrderID:         orderID,
-		Amount:          req.Amount,
+		Amount:          amount,
 		Currency:        req.Currency,
 		UserID:          userID,
 		CartID:          cartID,
@@ -125,9 +169,14 @@ func (u *PaymentUseCase) CreateOrder(ctx context.Context, userID uuid.UUID, req
 		Description:     req.Description,
 		Notes:           notesJSON,
 		DeliveryAddress: req.DeliveryAddress,
+		LineItems:       lineItems,
+		CouponCode:      quote.couponCode(),
+		DiscountAmount:  lineItems.Discount(),
+		PrescriptionID:  quote.prescriptionID,
 	}
 
 	if err := u.paymentRepo.Create(ctx, payment); err != nil {
+		u.releaseCheckout(ctx, orderID)
 		return nil, fmt.Errorf("failed to save payment: %w", err)
 	}
 
@@ -142,13 +191,281 @@ func (u *PaymentUseCase) CreateOrder(ctx context.Context, userID uuid.UUID, req
 		RazorpayOrderID: razorpayOrderID,
 		MedicineID:      payment.MedicineID,
 		Quantity:        responseQuantity,
-		Amount:          req.Amount,
+		Amount:          amount,
 		Currency:        req.Currency,
-		RazorpayKeyID:   u.razorpayKey,
+		RazorpayKeyID:   u.gateway.KeyID(),
 		Notes:           req.Notes,
 	}, nil
 }
 
+// CreateCODOrder places a cash on delivery order. The order is created right
+// away with a pending cash payment that the pharmacy marks as collected when
+// it delivers.
+func (u *PaymentUseCase) CreateCODOrder(ctx context.Context, userID uuid.UUID, req types.CreateOrderRequest) (*entity.Checkout, error) {
+	orderID := newPaymentOrderID("COD")
+
+	quote, err := u.quoteCheckout(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	cartID, lineItems := quote.cartID, quote.lineItems
+
+	amount := lineItems.Total()
+	if math.Abs(amount-req.Amount) > 0.01 {
+		return nil, fmt.Errorf("%w: expected %.2f, got %.2f", ErrAmountMismatch, amount, req.Amount)
+	}
+
+	// Nothing is paid up front, so the stock is taken as soon as it is reserved
+	reserved, err := u.reservationRepo.Reserve(ctx, orderID, lineItems, time.Now().Add(u.reservationTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	if !reserved {
+		return nil, fmt.Errorf("%w: stock is held by other checkouts", ErrInsufficientStock)
+	}
+	if err := u.holdCoupon(ctx, orderID, userID, quote); err != nil {
+		u.releaseCheckout(ctx, orderID)
+		return nil, err
+	}
+
+	notesJSON := ""
+	if req.Notes != nil {
+		notesBytes, _ := json.Marshal(req.Notes)
+		notesJSON = string(notesBytes)
+	}
+
+	var paymentQuantity *int
+	if req.Quantity != nil {
+		q := int(*req.Quantity)
+		paymentQuantity = &q
+	}
+
+	payment := &entity.Payment{
+		OrderID:         orderID,
+		Amount:          amount,
+		Currency:        req.Currency,
+		UserID:          userID,
+		CartID:          cartID,
+		MedicineID:      req.MedicineID,
+		Quantity:        paymentQuantity,
+		Status:          "pending",
+		PaymentMethod:   string(shared.PaymentMethodCash),
+		Description:     req.Description,
+		Notes:           notesJSON,
+		DeliveryAddress: req.DeliveryAddress,
+		LineItems:       lineItems,
+		CouponCode:      quote.couponCode(),
+		DiscountAmount:  lineItems.Discount(),
+		PrescriptionID:  quote.prescriptionID,
+	}
+
+	if err := u.paymentRepo.Create(ctx, payment); err != nil {
+		u.releaseCheckout(ctx, orderID)
+		return nil, fmt.Errorf("failed to save payment: %w", err)
+	}
+
+	if err := u.reservationRepo.Commit(ctx, orderID); err != nil {
+		return nil, fmt.Errorf("failed to commit stock reservation: %w", err)
+	}
+	if err := u.couponRepo.Redeem(ctx, orderID); err != nil {
+		return nil, fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+
+	checkout := checkoutFromLineItems(payment)
+	if err := u.orderRepo.CreateCheckout(ctx, checkout); err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	if cartID != nil {
+		u.ClearCart(ctx, userID)
+	}
+	u.events.OrdersPlaced(ctx, checkoutOrders(checkout))
+
+	return checkout, nil
+}
+
+// checkoutQuote is a priced checkout with the coupon applied to it, if any,
+// and the prescription for its prescription-only medicines
+type checkoutQuote struct {
+	cartID         *uuid.UUID
+	lineItems      entity.PaymentLineItems
+	coupon         *entity.Coupon
+	prescriptionID *uuid.UUID
+}
+
+func (q *checkoutQuote) couponCode() string {
+	if q.coupon == nil {
+		return ""
+	}
+	return q.coupon.Code
+}
+
+// quoteCheckout prices a checkout and applies the coupon from the request or,
+// failing that, the one applied to the cart. The coupon is checked again here
+// as it may have expired or been used up since it was applied. Checkouts with
+// prescription-only medicines need one of the user's prescriptions, by default
+// the e-prescription the cart was filled from.
+func (u *PaymentUseCase) quoteCheckout(ctx context.Context, userID uuid.UUID, req types.CreateOrderRequest) (*checkoutQuote, error) {
+	quote, err := u.priceCheckout(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.PrescriptionID != nil && (quote.prescriptionID == nil || *req.PrescriptionID != *quote.prescriptionID) {
+		// Only the cart's e-prescription vouches for the items added from it
+		quote.prescriptionID = req.PrescriptionID
+		for i := range quote.lineItems {
+			quote.lineItems[i].PrescriptionVerified = false
+			quote.lineItems[i].PrescriptionItemID = nil
+		}
+	}
+	if err := checkPrescription(ctx, u.prescriptionRepo, userID, quote.prescriptionID, quote.lineItems); err != nil {
+		return nil, err
+	}
+	if !quote.lineItems.RequiresPrescription() {
+		quote.prescriptionID = nil
+	}
+
+	if req.CouponCode != "" {
+		coupon, err := u.couponRepo.GetByCode(ctx, req.CouponCode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get coupon: %w", err)
+		}
+		if coupon == nil {
+			return nil, ErrCouponNotFound
+		}
+		quote.coupon = coupon
+	}
+
+	if quote.coupon != nil {
+		if _, err := applyCoupon(ctx, u.couponRepo, quote.coupon, userID, quote.lineItems); err != nil {
+			return nil, err
+		}
+	}
+	return quote, nil
+}
+
+// holdCoupon records the use of the quote's coupon by a checkout
+func (u *PaymentUseCase) holdCoupon(ctx context.Context, orderID string, userID uuid.UUID, quote *checkoutQuote) error {
+	if quote.coupon == nil {
+		return nil
+	}
+
+	reserved, err := u.couponRepo.Reserve(ctx, &entity.CouponRedemption{
+		CouponID:       quote.coupon.ID,
+		UserID:         userID,
+		PaymentOrderID: orderID,
+		DiscountAmount: quote.lineItems.Discount(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reserve coupon: %w", err)
+	}
+	if !reserved {
+		return ErrCouponLimitReached
+	}
+	return nil
+}
+
+// releaseCheckout gives back the stock and coupon use held by an unpaid checkout
+func (u *PaymentUseCase) releaseCheckout(ctx context.Context, orderID string) error {
+	if err := u.reservationRepo.Release(ctx, orderID); err != nil {
+		return err
+	}
+	return u.couponRepo.Release(ctx, orderID)
+}
+
+// priceCheckout prices a checkout from the cart or the single medicine in the
+// request, checking that every medicine is on sale and in stock.
+func (u *PaymentUseCase) priceCheckout(ctx context.Context, userID uuid.UUID, req types.CreateOrderRequest) (*checkoutQuote, error) {
+	if req.CartID != nil && *req.CartID != "" {
+		cartID, err := uuid.Parse(*req.CartID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cartId", ErrInvalidCart)
+		}
+
+		cart, err := u.orderRepo.GetCartByID(ctx, cartID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cart: %w", err)
+		}
+		if cart == nil || cart.UserID != userID {
+			return nil, fmt.Errorf("%w: cart not found", ErrInvalidCart)
+		}
+		if len(cart.Medicines) == 0 {
+			return nil, fmt.Errorf("%w: cart is empty", ErrInvalidCart)
+		}
+
+		lineItems := make(entity.PaymentLineItems, 0, len(cart.Medicines))
+		for _, cartMedicine := range cart.Medicines {
+			medicine := cartMedicine.Medicine
+			if err := checkMedicineForSale(&medicine, cartMedicine.Quantity); err != nil {
+				return nil, err
+			}
+			line := newLineItem(&medicine, cartMedicine.Quantity)
+			line.PrescriptionVerified = line.PrescriptionRequired && cartMedicine.Prescribed()
+			if line.PrescriptionVerified {
+				line.PrescriptionItemID = cartMedicine.PrescriptionItemID
+			}
+			lineItems = append(lineItems, line)
+		}
+		return &checkoutQuote{
+			cartID:         &cartID,
+			lineItems:      lineItems,
+			coupon:         cart.Coupon,
+			prescriptionID: cart.PrescriptionID,
+		}, nil
+	}
+
+	// Validate MedicineID and Quantity if CartID is not provided
+	if req.MedicineID == nil {
+		return nil, errors.New("medicineId is required when cartId is not provided")
+	}
+	if req.Quantity == nil || *req.Quantity <= 0 {
+		return nil, errors.New("quantity is required and must be greater than 0 when cartId is not provided")
+	}
+
+	medicine, err := u.medicineRepo.GetMedicineByID(ctx, *req.MedicineID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get medicine details: %w", err)
+	}
+	if medicine == nil {
+		return nil, fmt.Errorf("%w: medicine not found", ErrMedicineUnavailable)
+	}
+
+	quantity := int(*req.Quantity)
+	if err := checkMedicineForSale(medicine, quantity); err != nil {
+		return nil, err
+	}
+	return &checkoutQuote{lineItems: entity.PaymentLineItems{newLineItem(medicine, quantity)}}, nil
+}
+
+// checkMedicineForSale rejects inactive, expired or understocked medicines
+func checkMedicineForSale(medicine *entity.Medicine, quantity int) error {
+	if medicine.ID == uuid.Nil || !medicine.IsActive {
+		return fmt.Errorf("%w: %s", ErrMedicineUnavailable, medicine.Name)
+	}
+	if medicine.ExpiryDate != nil && medicine.ExpiryDate.Before(time.Now()) {
+		return fmt.Errorf("%w: %s has expired", ErrMedicineUnavailable, medicine.Name)
+	}
+	if quantity > medicine.Quantity {
+		return fmt.Errorf("%w: only %d units of %s available", ErrInsufficientStock, medicine.Quantity, medicine.Name)
+	}
+	return nil
+}
+
+func newLineItem(medicine *entity.Medicine, quantity int) entity.PaymentLineItem {
+	return entity.PaymentLineItem{
+		MedicineID: medicine.ID,
+		PharmacyID: medicine.PharmacyID,
+		Name:       medicine.Name,
+		Quantity:   quantity,
+		UnitPrice:  medicine.Price,
+		Subtotal:   medicine.Price * float64(quantity),
+		HSNCode:    medicine.HSNCode,
+		GSTRate:    medicine.GSTRate,
+
+		PrescriptionRequired: medicine.PrescriptionRequired,
+	}
+}
+
 func (u *PaymentUseCase) VerifyPayment(ctx context.Context, req types.VerifyPaymentRequest) (*types.PaymentStatusResponse, error) {
 	// Get payment from database
 	payment, err := u.paymentRepo.GetByOrderID(ctx, req.OrderID)
@@ -160,71 +477,124 @@ func (u *PaymentUseCase) VerifyPayment(ctx context.Context, req types.VerifyPaym
 	}
 
 	// Verify signature
-	message := req.RazorpayOrderID + "|" + req.RazorpayPaymentID
-	if !u.verifySignature(message, req.RazorpaySignature) {
-		u.paymentRepo.UpdateStatus(ctx, req.OrderID, "failed", req.RazorpayPaymentID, "", "", "Invalid signature")
+	if !u.gateway.VerifyPaymentSignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature) {
+		if failed, _ := u.paymentRepo.UpdateStatusFrom(ctx, req.OrderID, []string{"pending"}, "failed", req.RazorpayPaymentID, "", "", "Invalid signature"); failed {
+			u.releaseCheckout(ctx, req.OrderID)
+		}
 		return nil, errors.New("invalid payment signature")
 	}
 
 	// Fetch payment details from Razorpay
-	paymentData, err := u.client.Payment.Fetch(req.RazorpayPaymentID, nil, nil)
+	gatewayPayment, err := u.gateway.FetchPayment(ctx, req.RazorpayPaymentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch payment from razorpay: %w", err)
 	}
+	paymentMethod := gatewayPayment.Method
 
-	paymentMethod := ""
-	if method, ok := paymentData["method"].(string); ok {
-		paymentMethod = method
+	if err := u.fulfilPayment(ctx, payment, req.RazorpayPaymentID, req.RazorpaySignature, paymentMethod); err != nil {
+		return nil, err
 	}
 
-	// Update payment status to success
-	err = u.paymentRepo.UpdateStatus(
+	return &types.PaymentStatusResponse{
+		OrderID:           req.OrderID,
+		RazorpayOrderID:   req.RazorpayOrderID,
+		RazorpayPaymentID: req.RazorpayPaymentID,
+		Status:            "success",
+		Amount:            payment.Amount,
+		Currency:          payment.Currency,
+		PaymentMethod:     paymentMethod,
+	}, nil
+}
+
+// fulfilPayment marks a payment as successful and creates its order. It is the
+// single completion path for the client verify call, the gateway webhook and
+// reconciliation; whichever arrives second finds the payment already
+// successful and does nothing. The status change, stock, coupon and checkout
+// are saved together, so a failure leaves the payment pending for the next
+// attempt rather than successful without an order.
+func (u *PaymentUseCase) fulfilPayment(ctx context.Context, payment *entity.Payment, razorpayPaymentID, razorpaySignature, paymentMethod string) error {
+	var checkout *entity.Checkout
+	if len(payment.LineItems) > 0 {
+		checkout = checkoutFromLineItems(payment)
+	}
+
+	updated, err := u.paymentRepo.CompletePayment(
 		ctx,
-		req.OrderID,
-		"success",
-		req.RazorpayPaymentID,
-		req.RazorpaySignature,
+		payment.OrderID,
+		[]string{"pending", "failed"},
+		razorpayPaymentID,
+		razorpaySignature,
 		paymentMethod,
-		"",
+		checkout,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update payment status: %w", err)
+		return fmt.Errorf("failed to complete payment: %w", err)
+	}
+	if !updated {
+		return nil
+	}
+
+	if checkout != nil {
+		if payment.CartID != nil {
+			u.ClearCart(ctx, payment.UserID)
+		}
+		u.events.OrdersPlaced(ctx, checkoutOrders(checkout))
+	} else if err := u.createLegacyOrder(ctx, payment); err != nil {
+		return err
 	}
 
+	// The invoice can be issued again on download, so a failure here does
+	// not fail the payment.
+	if err := u.invoiceUseCase.IssueInvoicesForPayment(ctx, payment.ID); err != nil {
+		log.Printf("Failed to issue invoices for payment %s: %v", payment.OrderID, err)
+	}
+	return nil
+}
+
+// createLegacyOrder creates the order for a successful payment raised before
+// quotes were stored on payments, from the cart or the single medicine bought
+// directly
+func (u *PaymentUseCase) createLegacyOrder(ctx context.Context, payment *entity.Payment) error {
 	// If payment has a cart, create order from cart
 	if payment.CartID != nil {
 		cart, err := u.orderRepo.GetCartByID(ctx, *payment.CartID)
-		if err == nil && cart != nil {
-			// Get payment ID from database
-			paymentEntity, _ := u.paymentRepo.GetByOrderID(ctx, req.OrderID)
-			if paymentEntity != nil && paymentEntity.ID != uuid.Nil {
-				_, err = u.CreateOrderFromCart(ctx, cart, paymentEntity.ID, payment.DeliveryAddress)
-				if err == nil {
-					// Clear cart after successful order creation
-					u.ClearCart(ctx, payment.UserID)
-				}
-			}
+		if err != nil {
+			return fmt.Errorf("failed to get cart: %w", err)
+		}
+		if cart == nil {
+			return errors.New("cart not found")
 		}
+		order, err := u.CreateOrderFromCart(ctx, cart, payment.ID, payment.DeliveryAddress)
+		if err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+		// Clear cart after successful order creation
+		u.ClearCart(ctx, payment.UserID)
+		u.events.OrdersPlaced(ctx, []*entity.Order{order})
 	}
 
 	// If payment has medicineId and no cartId, create order and order item
 	if payment.CartID == nil && payment.MedicineID != nil {
 		medicine, err := u.medicineRepo.GetMedicineByID(ctx, *payment.MedicineID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get medicine details: %w", err)
+			return fmt.Errorf("failed to get medicine details: %w", err)
+		}
+		if medicine == nil {
+			return errors.New("medicine not found")
 		}
 
 		// Create order
 		order := &entity.Order{
 			UserID:          payment.UserID,
 			PaymentID:       payment.ID,
+			PharmacyID:      medicine.PharmacyID,
 			DeliveryAddress: payment.DeliveryAddress,
 			Status:          "confirmed",
 			OrderNumber:     payment.OrderID,
 		}
 
 		if err := u.orderRepo.CreateOrder(ctx, order); err != nil {
-			return nil, fmt.Errorf("failed to create order: %w", err)
+			return fmt.Errorf("failed to create order: %w", err)
 		}
 
 		subTotal := medicine.Price * float64(*payment.Quantity)
@@ -233,24 +603,239 @@ func (u *PaymentUseCase) VerifyPayment(ctx context.Context, req types.VerifyPaym
 		orderItem := &entity.OrderItem{
 			OrderID:    order.ID,
 			MedicineID: *payment.MedicineID,
+			PharmacyID: medicine.PharmacyID,
 			Quantity:   *payment.Quantity,
 			Price:      medicine.Price,
 			Subtotal:   subTotal,
+			HSNCode:    medicine.HSNCode,
+			GSTRate:    medicine.GSTRate,
 		}
 		if err := u.orderRepo.CreateOrderItem(ctx, orderItem); err != nil {
-			return nil, fmt.Errorf("failed to create order item: %w", err)
+			return fmt.Errorf("failed to create order item: %w", err)
 		}
+		u.events.OrdersPlaced(ctx, []*entity.Order{order})
 	}
 
-	return &types.PaymentStatusResponse{
-		OrderID:           req.OrderID,
-		RazorpayOrderID:   req.RazorpayOrderID,
-		RazorpayPaymentID: req.RazorpayPaymentID,
-		Status:            "success",
-		Amount:            payment.Amount,
-		Currency:          payment.Currency,
-		PaymentMethod:     paymentMethod,
-	}, nil
+	return nil
+}
+
+// checkoutOrders returns the orders a checkout was split into
+func checkoutOrders(checkout *entity.Checkout) []*entity.Order {
+	orders := make([]*entity.Order, 0, len(checkout.Orders))
+	for i := range checkout.Orders {
+		orders = append(orders, &checkout.Orders[i])
+	}
+	return orders
+}
+
+// checkoutFromLineItems builds the checkout for the quote stored on a payment,
+// with one confirmed order per pharmacy
+func checkoutFromLineItems(payment *entity.Payment) *entity.Checkout {
+	checkout := &entity.Checkout{
+		CheckoutNumber: payment.OrderID,
+		UserID:         payment.UserID,
+		PaymentID:      payment.ID,
+		TotalAmount:    payment.LineItems.Total(),
+	}
+
+	byPharmacy := make(map[uuid.UUID]int)
+	for _, line := range payment.LineItems {
+		idx, ok := byPharmacy[line.PharmacyID]
+		if !ok {
+			idx = len(checkout.Orders)
+			byPharmacy[line.PharmacyID] = idx
+			checkout.Orders = append(checkout.Orders, entity.Order{
+				UserID:          payment.UserID,
+				PaymentID:       payment.ID,
+				PharmacyID:      line.PharmacyID,
+				Status:          "confirmed",
+				DeliveryAddress: payment.DeliveryAddress,
+			})
+		}
+
+		order := &checkout.Orders[idx]
+		order.OrderItems = append(order.OrderItems, entity.OrderItem{
+			MedicineID: line.MedicineID,
+			PharmacyID: line.PharmacyID,
+			Quantity:   line.Quantity,
+			Price:      line.UnitPrice,
+			Subtotal:   line.Subtotal,
+			Discount:   line.Discount,
+			HSNCode:    line.HSNCode,
+			GSTRate:    line.GSTRate,
+
+			PrescriptionItemID: line.PrescriptionItemID,
+		})
+		order.TotalAmount += line.Subtotal - line.Discount
+		if line.Discount > 0 {
+			order.DiscountAmount += line.Discount
+			order.CouponCode = payment.CouponCode
+		}
+		if line.PrescriptionRequired {
+			// Held at confirmed until the pharmacy approves the prescription,
+			// unless every such item was prescribed in a consultation
+			order.PrescriptionID = payment.PrescriptionID
+			if !line.PrescriptionVerified {
+				order.PrescriptionStatus = entity.PrescriptionStatusPending
+			} else if order.PrescriptionStatus == "" {
+				order.PrescriptionStatus = entity.PrescriptionStatusApproved
+			}
+		}
+	}
+
+	for i := range checkout.Orders {
+		checkout.Orders[i].TotalAmount = math.Round(checkout.Orders[i].TotalAmount*100) / 100
+		checkout.Orders[i].DiscountAmount = math.Round(checkout.Orders[i].DiscountAmount*100) / 100
+	}
+	checkout.NumberOrders()
+	return checkout
+}
+
+// HandleWebhook verifies and processes a Razorpay webhook delivery. Each event
+// is stored by its ID first, so a redelivery of an already processed event is
+// acknowledged without being applied twice.
+func (u *PaymentUseCase) HandleWebhook(ctx context.Context, body []byte, signature string, eventID string) error {
+	if !u.gateway.VerifyWebhookSignature(body, signature) {
+		return ErrInvalidWebhookSignature
+	}
+
+	var event types.RazorpayWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	// Razorpay always sends X-Razorpay-Event-Id; fall back to the body hash so a
+	// missing header still deduplicates identical deliveries.
+	if eventID == "" {
+		sum := sha256.Sum256(body)
+		eventID = hex.EncodeToString(sum[:])
+	}
+
+	record := &entity.PaymentWebhookEvent{
+		EventID:   eventID,
+		EventType: event.Event,
+		Payload:   string(body),
+		Status:    "received",
+	}
+	created, err := u.paymentRepo.CreateWebhookEvent(ctx, record)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook event: %w", err)
+	}
+	if !created {
+		existing, err := u.paymentRepo.GetWebhookEvent(ctx, eventID)
+		if err != nil {
+			return fmt.Errorf("failed to get webhook event: %w", err)
+		}
+		if existing != nil && existing.Status == "processed" {
+			return nil
+		}
+	}
+
+	if err := u.processWebhookEvent(ctx, &event); err != nil {
+		u.paymentRepo.UpdateWebhookEventStatus(ctx, eventID, "failed", err.Error())
+		return err
+	}
+
+	return u.paymentRepo.UpdateWebhookEventStatus(ctx, eventID, "processed", "")
+}
+
+func (u *PaymentUseCase) processWebhookEvent(ctx context.Context, event *types.RazorpayWebhookEvent) error {
+	switch event.Event {
+	case "payment.captured", "order.paid":
+		var razorpayOrderID, razorpayPaymentID, method string
+		if event.Payload.Payment != nil {
+			razorpayOrderID = event.Payload.Payment.Entity.OrderID
+			razorpayPaymentID = event.Payload.Payment.Entity.ID
+			method = event.Payload.Payment.Entity.Method
+		}
+		if razorpayOrderID == "" && event.Payload.Order != nil {
+			razorpayOrderID = event.Payload.Order.Entity.ID
+		}
+
+		payment, err := u.paymentRepo.GetByRazorpayOrderID(ctx, razorpayOrderID)
+		if err != nil {
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+		if payment == nil {
+			// Not one of ours (e.g. created from the dashboard); nothing to do.
+			return nil
+		}
+		return u.fulfilPayment(ctx, payment, razorpayPaymentID, "", method)
+
+	case "payment.failed":
+		if event.Payload.Payment == nil {
+			return nil
+		}
+		entityData := event.Payload.Payment.Entity
+		payment, err := u.paymentRepo.GetByRazorpayOrderID(ctx, entityData.OrderID)
+		if err != nil {
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+		if payment == nil {
+			return nil
+		}
+		// A failed attempt never overrides a payment that has already succeeded.
+		failed, err := u.paymentRepo.UpdateStatusFrom(
+			ctx,
+			payment.OrderID,
+			[]string{"pending"},
+			"failed",
+			entityData.ID,
+			"",
+			entityData.Method,
+			entityData.ErrorDescription,
+		)
+		if err != nil {
+			return err
+		}
+		if failed {
+			return u.releaseCheckout(ctx, payment.OrderID)
+		}
+		return nil
+
+	case "refund.processed":
+		if event.Payload.Refund == nil {
+			return nil
+		}
+		refund := event.Payload.Refund.Entity
+
+		// Refunds raised through RefundOrder already adjusted the order and payment
+		existing, err := u.refundRepo.GetByRazorpayRefundID(ctx, refund.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get refund: %w", err)
+		}
+		if existing != nil {
+			return u.refundRepo.UpdateStatus(ctx, existing.ID, "processed", "")
+		}
+
+		payment, err := u.paymentRepo.GetByRazorpayPaymentID(ctx, refund.PaymentID)
+		if err != nil {
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+		if payment == nil {
+			return nil
+		}
+		if refund.Amount < int64(payment.Amount*100) {
+			// Partial refunds leave the payment status as is.
+			return nil
+		}
+		_, err = u.paymentRepo.UpdateStatusFrom(ctx, payment.OrderID, []string{"success"}, "refunded", "", "", "", "")
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseExpiredReservations frees stock held by checkouts that were never paid
+func (u *PaymentUseCase) ReleaseExpiredReservations(ctx context.Context) error {
+	released, err := u.reservationRepo.ReleaseExpired(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to release expired reservations: %w", err)
+	}
+	if released > 0 {
+		log.Printf("Released %d expired stock reservations", released)
+	}
+	return nil
 }
 
 func (u *PaymentUseCase) GetPaymentStatus(ctx context.Context, orderID string) (*types.PaymentStatusResponse, error) {
@@ -277,11 +862,298 @@ func (u *PaymentUseCase) GetUserPayments(ctx context.Context, userID uuid.UUID,
 	return u.paymentRepo.GetUserPayments(ctx, userID, page, limit)
 }
 
-func (u *PaymentUseCase) verifySignature(message, signature string) bool {
-	mac := hmac.New(sha256.New, []byte(u.razorpaySecret))
-	mac.Write([]byte(message))
-	expectedSignature := hex.EncodeToString(mac.Sum(nil))
-	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+// RefundOrder refunds an order through the gateway, in full or for selected
+// items. When pharmacyID is set only that pharmacy's items can be refunded;
+// admins pass nil.
+func (u *PaymentUseCase) RefundOrder(ctx context.Context, orderID uuid.UUID, initiatedBy uuid.UUID, pharmacyID *uuid.UUID, req types.RefundRequest) (*entity.Refund, error) {
+	order, err := u.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	payment := order.Payment
+	if payment == nil || payment.RazorpayPaymentID == "" {
+		return nil, fmt.Errorf("%w: no captured payment", ErrOrderNotRefundable)
+	}
+	if payment.Status != "success" && payment.Status != "partially_refunded" {
+		return nil, fmt.Errorf("%w: payment is %s", ErrOrderNotRefundable, payment.Status)
+	}
+
+	if pharmacyID != nil && !order.BelongsToPharmacy(*pharmacyID) {
+		return nil, errors.New("unauthorized")
+	}
+
+	// Items the caller may refund, with the units still left on each
+	refundable := make(map[uuid.UUID]entity.OrderItem)
+	for _, item := range order.OrderItems {
+		if pharmacyID != nil && !item.SoldBy(*pharmacyID) {
+			continue
+		}
+		if item.Quantity-item.RefundedQuantity > 0 {
+			refundable[item.ID] = item
+		}
+	}
+
+	var items []entity.RefundItem
+	if len(req.Items) == 0 {
+		for _, item := range refundable {
+			qty := item.Quantity - item.RefundedQuantity
+			items = append(items, entity.RefundItem{
+				OrderItemID: item.ID,
+				MedicineID:  item.MedicineID,
+				Quantity:    qty,
+				Amount:      item.NetAmount(qty),
+			})
+		}
+	} else {
+		seen := make(map[uuid.UUID]bool)
+		for _, reqItem := range req.Items {
+			item, ok := refundable[reqItem.OrderItemID]
+			if !ok || seen[reqItem.OrderItemID] {
+				return nil, fmt.Errorf("%w: item %s cannot be refunded", ErrInvalidRefundItems, reqItem.OrderItemID)
+			}
+			if reqItem.Quantity > item.Quantity-item.RefundedQuantity {
+				return nil, fmt.Errorf("%w: only %d units of item %s left to refund", ErrInvalidRefundItems, item.Quantity-item.RefundedQuantity, item.ID)
+			}
+			seen[reqItem.OrderItemID] = true
+			items = append(items, entity.RefundItem{
+				OrderItemID: item.ID,
+				MedicineID:  item.MedicineID,
+				Quantity:    reqItem.Quantity,
+				Amount:      item.NetAmount(reqItem.Quantity),
+			})
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: nothing left to refund", ErrOrderNotRefundable)
+	}
+
+	var amount float64
+	var refundUnits, remainingUnits int
+	for _, item := range items {
+		amount += item.Amount
+		refundUnits += item.Quantity
+	}
+	for _, item := range order.OrderItems {
+		remainingUnits += item.Quantity - item.RefundedQuantity
+	}
+
+	refund := &entity.Refund{
+		PaymentID:   payment.ID,
+		OrderID:     order.ID,
+		PharmacyID:  pharmacyID,
+		Amount:      amount,
+		Currency:    payment.Currency,
+		IsPartial:   refundUnits < remainingUnits,
+		Reason:      req.Reason,
+		Status:      entity.RefundStatusInitiated,
+		InitiatedBy: initiatedBy,
+		Items:       items,
+	}
+
+	// Set the units aside before asking the gateway, so two refunds racing
+	// for the same units cannot both pay out
+	reserved, err := u.refundRepo.ReserveRefund(ctx, refund)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		return nil, fmt.Errorf("%w: items were refunded concurrently", ErrInvalidRefundItems)
+	}
+
+	gatewayRefund, err := u.gateway.Refund(ctx, payment.RazorpayPaymentID, int64(math.Round(amount*100)), map[string]interface{}{
+		"order_number": order.OrderNumber,
+		"reason":       req.Reason,
+	})
+	if err != nil {
+		if releaseErr := u.refundRepo.ReleaseRefund(ctx, refund, err.Error()); releaseErr != nil {
+			log.Printf("Failed to release refund %s of order %s: %v", refund.ID, order.OrderNumber, releaseErr)
+		}
+		return nil, fmt.Errorf("failed to create razorpay refund: %w", err)
+	}
+
+	refund.RazorpayRefundID = gatewayRefund.ID
+	refund.Status = entity.RefundStatusPending
+	if gatewayRefund.Status != "" {
+		refund.Status = gatewayRefund.Status
+	}
+	if refund.Status == entity.RefundStatusProcessed {
+		now := time.Now()
+		refund.ProcessedAt = &now
+	}
+
+	orderRefunded, err := u.refundRepo.CompleteRefund(ctx, refund)
+	if err != nil {
+		return nil, fmt.Errorf("refund %s issued but failed to save: %w", refund.RazorpayRefundID, err)
+	}
+	if orderRefunded {
+		u.events.OrderStatusChanged(ctx, order, order.Status, entity.OrderStatusRefunded)
+	}
+
+	return refund, nil
+}
+
+// CancelOrder cancels one of the customer's orders while it is still
+// cancellable. Prepaid orders are refunded through the gateway, which also
+// restocks them; cash orders are restocked directly. Each pharmacy on the
+// order is emailed.
+func (u *PaymentUseCase) CancelOrder(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, reason string) (*entity.Order, error) {
+	order, err := u.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if order.UserID != userID {
+		return nil, ErrNotOrderOwner
+	}
+	return u.cancelOrder(ctx, order, userID, entity.OrderActorCustomer, reason)
+}
+
+// PharmacyCancelOrder lets a pharmacy cancel one of its orders it cannot
+// fulfil. The order is refunded or restocked as when the customer cancels it.
+func (u *PaymentUseCase) PharmacyCancelOrder(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, reason string) (*entity.Order, error) {
+	pharmacy, err := u.orderRepo.GetPharmacyByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pharmacy: %w", err)
+	}
+
+	order, err := u.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if pharmacy == nil || !order.BelongsToPharmacy(pharmacy.ID) {
+		return nil, ErrNotOrderOwner
+	}
+	return u.cancelOrder(ctx, order, userID, entity.OrderActorPharmacy, reason)
+}
+
+// cancelOrder cancels the order on behalf of actor. The order is held at
+// cancellation_pending while prepaid orders are refunded, and only cancelled
+// once that succeeded, restocking whatever was not refunded. An order left
+// cancellation_pending by a failed refund is resumed by cancelling it again.
+func (u *PaymentUseCase) cancelOrder(ctx context.Context, order *entity.Order, actorID uuid.UUID, actor entity.OrderActor, reason string) (*entity.Order, error) {
+	fromStatus := order.Status
+	if order.Status != entity.OrderStatusCancellationPending {
+		if !entity.CanTransitionOrder(order.Status, entity.OrderStatusCancellationPending, actor) {
+			return nil, fmt.Errorf("%w: order is %s", ErrOrderNotCancellable, order.Status)
+		}
+
+		updated, err := u.orderRepo.TransitionOrderStatus(ctx, &entity.OrderStatusHistory{
+			OrderID:    order.ID,
+			FromStatus: order.Status,
+			ToStatus:   entity.OrderStatusCancellationPending,
+			ActorID:    &actorID,
+			ActorRole:  actor,
+			Note:       reason,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to cancel order: %w", err)
+		}
+		if !updated {
+			return nil, fmt.Errorf("%w: order status changed", ErrOrderNotCancellable)
+		}
+		order.Status = entity.OrderStatusCancellationPending
+	} else if !entity.CanTransitionOrder(order.Status, entity.OrderStatusCancelled, actor) {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotCancellable, order.Status)
+	}
+
+	// A payment refunded in full by an earlier attempt still marks the order
+	// prepaid; refunding it again finds nothing left
+	payment := order.Payment
+	prepaid := payment != nil && payment.RazorpayPaymentID != ""
+
+	if prepaid {
+		if _, err := u.RefundOrder(ctx, order.ID, actorID, nil, types.RefundRequest{
+			Reason: "Order cancelled: " + reason,
+		}); err != nil && !errors.Is(err, ErrOrderNotRefundable) {
+			return nil, fmt.Errorf("refund failed, cancel again to retry: %w", err)
+		}
+	}
+
+	updated, err := u.orderRepo.CompleteCancellation(ctx, &entity.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: entity.OrderStatusCancellationPending,
+		ToStatus:   entity.OrderStatusCancelled,
+		ActorID:    &actorID,
+		ActorRole:  actor,
+		Note:       reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel order: %w", err)
+	}
+	if !updated {
+		return nil, fmt.Errorf("%w: order status changed", ErrOrderNotCancellable)
+	}
+	u.events.OrderStatusChanged(ctx, order, fromStatus, entity.OrderStatusCancelled)
+
+	u.notifyPharmaciesOfCancellation(ctx, order, reason, prepaid)
+
+	cancelled, err := u.orderRepo.GetOrderByID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return cancelled, nil
+}
+
+// notifyPharmaciesOfCancellation emails every pharmacy with items on the order.
+// Failures are logged; the cancellation itself has already happened.
+func (u *PaymentUseCase) notifyPharmaciesOfCancellation(ctx context.Context, order *entity.Order, reason string, refunded bool) {
+	type cancelledItem struct {
+		Name     string
+		Quantity int
+	}
+
+	pharmacies := make(map[uuid.UUID]*entity.Pharmacy)
+	items := make(map[uuid.UUID][]cancelledItem)
+	for _, item := range order.OrderItems {
+		if item.Medicine == nil || item.Medicine.Pharmacy == nil {
+			continue
+		}
+		pharmacy := item.Medicine.Pharmacy
+		pharmacies[pharmacy.ID] = pharmacy
+		items[pharmacy.ID] = append(items[pharmacy.ID], cancelledItem{
+			Name:     item.Medicine.Name,
+			Quantity: item.Quantity - item.RefundedQuantity,
+		})
+	}
+
+	for pharmacyID, pharmacy := range pharmacies {
+		if pharmacy.Email == nil || *pharmacy.Email == "" {
+			log.Printf("Pharmacy %s has no email; skipping cancellation notice for order %s", pharmacyID, order.OrderNumber)
+			continue
+		}
+
+		data := map[string]interface{}{
+			"UserEmail":    *pharmacy.Email,
+			"PharmacyName": pharmacy.Name,
+			"OrderNumber":  order.OrderNumber,
+			"Reason":       reason,
+			"Items":        items[pharmacyID],
+			"Refunded":     refunded,
+		}
+		if err := u.emailService.Send(ctx, entity.EmailTypeOrderCancelled, data); err != nil {
+			log.Printf("Failed to send cancellation email for order %s: %v", order.OrderNumber, err)
+		}
+	}
+}
+
+func (u *PaymentUseCase) ListRefunds(ctx context.Context, filter types.ListRefundsFilter) ([]*entity.Refund, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+
+	return u.refundRepo.ListRefunds(ctx, filter)
 }
 
 // Order management methods integrated into PaymentUseCase
@@ -322,20 +1194,39 @@ func (u *PaymentUseCase) GetUserOrders(ctx context.Context, userID uuid.UUID, pa
 	return u.orderRepo.GetUserOrders(ctx, userID, page, limit)
 }
 
+// UpdateOrderStatus moves an order on behalf of the system, following the
+// order state machine and recording the change
 func (u *PaymentUseCase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error {
-	// Validate status
-	validStatuses := []string{"pending", "confirmed", "processing", "shipped", "delivered", "cancelled"}
-	isValid := false
-	for _, s := range validStatuses {
-		if s == status {
-			isValid = true
-			break
-		}
+	if !entity.IsValidOrderStatus(status) {
+		return errors.New("invalid order status")
 	}
 
-	if !isValid {
-		return errors.New("invalid order status")
+	order, err := u.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return ErrOrderNotFound
+	}
+	if !entity.CanTransitionOrder(order.Status, status, entity.OrderActorSystem) {
+		return fmt.Errorf("cannot move order from %s to %s", order.Status, status)
+	}
+	if order.HeldForPrescription(status) {
+		return ErrPrescriptionNotApproved
 	}
 
-	return u.orderRepo.UpdateOrderStatus(ctx, orderID, status)
+	updated, err := u.orderRepo.TransitionOrderStatus(ctx, &entity.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ActorRole:  entity.OrderActorSystem,
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("order %s changed status concurrently", orderID)
+	}
+	u.events.OrderStatusChanged(ctx, order, order.Status, status)
+	return nil
 }
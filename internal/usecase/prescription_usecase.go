@@ -0,0 +1,522 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/internal/types"
+)
+
+var (
+	ErrPrescriptionRequired    = errors.New("a prescription is required for prescription-only medicines")
+	ErrPrescriptionNotFound    = errors.New("prescription not found")
+	ErrInvalidPrescription     = errors.New("invalid prescription")
+	ErrPrescriptionNotPending  = errors.New("prescription is not awaiting review")
+	ErrPrescriptionNotApproved = errors.New("prescription not approved")
+)
+
+// MaxPrescriptionSize is the largest prescription file accepted
+const MaxPrescriptionSize = 10 << 20
+
+// defaultPrescriptionRadiusKm is how far from the patient pharmacies are
+// searched when filling a cart from an e-prescription
+const defaultPrescriptionRadiusKm = 10
+
+// prescriptionExtensions maps the accepted file types to the extension they
+// are stored with
+var prescriptionExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+}
+
+// PrescriptionUseCase handles the prescriptions patients supply for
+// prescription-only medicines and their review by pharmacies
+type PrescriptionUseCase interface {
+	// UploadPrescription stores a scan or photo of a prescription
+	UploadPrescription(ctx context.Context, userID uuid.UUID, fileName string, content []byte) (*entity.Prescription, error)
+	// LinkConsultation uses the prescription written in one of the user's consultations
+	LinkConsultation(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID) (*entity.Prescription, error)
+	ListPrescriptions(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Prescription, int64, error)
+	GetPrescriptionFile(ctx context.Context, prescriptionID uuid.UUID, userID uuid.UUID) (*entity.Prescription, []byte, error)
+	// ResubmitPrescription replaces the prescription of one of the user's
+	// orders that has not been approved and puts it up for review again
+	ResubmitPrescription(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, prescriptionID uuid.UUID) (*entity.Order, error)
+	// GetEPrescription returns the structured prescription of one of the user's consultations
+	GetEPrescription(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID) (*types.EPrescriptionResponse, error)
+	// AddEPrescriptionToCart fills the user's cart with nearby medicines
+	// matching an e-prescription. The prescription counts as verified for the
+	// medicines added.
+	AddEPrescriptionToCart(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID, req types.PrescriptionToCartRequest) (*types.PrescriptionToCartResponse, error)
+
+	// ListReviews returns the pharmacy's review queue
+	ListReviews(ctx context.Context, filter types.ListPrescriptionReviewsFilter) ([]*entity.Order, int64, error)
+	GetOrderPrescriptionFile(ctx context.Context, orderID uuid.UUID, pharmacyID uuid.UUID) (*entity.Prescription, []byte, error)
+	// ReviewPrescription approves or rejects the pending prescription of one
+	// of the pharmacy's orders
+	ReviewPrescription(ctx context.Context, orderID uuid.UUID, pharmacyID uuid.UUID, reviewerID uuid.UUID, req types.ReviewPrescriptionRequest) (*entity.Order, error)
+}
+
+type prescriptionUseCase struct {
+	prescriptionRepo repository.PrescriptionRepository
+	orderRepo        repository.OrderRepository
+	appoinmentRepo   repository.AppoinmentRepository
+	medicineRepo     repository.MedicineRepository
+	couponRepo       repository.CouponRepository
+	userRepo         repository.UserRepository
+	store            service.DocumentStore
+}
+
+// NewPrescriptionUseCase creates a new instance of prescriptionUseCase
+func NewPrescriptionUseCase(
+	prescriptionRepo repository.PrescriptionRepository,
+	orderRepo repository.OrderRepository,
+	appoinmentRepo repository.AppoinmentRepository,
+	medicineRepo repository.MedicineRepository,
+	couponRepo repository.CouponRepository,
+	userRepo repository.UserRepository,
+	store service.DocumentStore,
+) PrescriptionUseCase {
+	return &prescriptionUseCase{
+		prescriptionRepo: prescriptionRepo,
+		orderRepo:        orderRepo,
+		appoinmentRepo:   appoinmentRepo,
+		medicineRepo:     medicineRepo,
+		couponRepo:       couponRepo,
+		userRepo:         userRepo,
+		store:            store,
+	}
+}
+
+func (uc *prescriptionUseCase) UploadPrescription(ctx context.Context, userID uuid.UUID, fileName string, content []byte) (*entity.Prescription, error) {
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidPrescription)
+	}
+	if len(content) > MaxPrescriptionSize {
+		return nil, fmt.Errorf("%w: file is larger than %d MB", ErrInvalidPrescription, MaxPrescriptionSize>>20)
+	}
+
+	// Go by the content rather than the name or header the client sent
+	contentType := http.DetectContentType(content)
+	ext, ok := prescriptionExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: only PDF, JPEG, PNG and WEBP files are accepted", ErrInvalidPrescription)
+	}
+
+	prescription := &entity.Prescription{
+		BaseModel:   entity.BaseModel{ID: uuid.New()},
+		UserID:      userID,
+		Source:      entity.PrescriptionSourceUpload,
+		FileName:    filepath.Base(strings.TrimSpace(fileName)),
+		ContentType: contentType,
+		FileSize:    int64(len(content)),
+	}
+	prescription.FilePath = fmt.Sprintf("prescriptions/%s/%s%s", userID, prescription.ID, ext)
+
+	if err := uc.store.Save(ctx, prescription.FilePath, content); err != nil {
+		return nil, fmt.Errorf("failed to store prescription: %w", err)
+	}
+	if err := uc.prescriptionRepo.Create(ctx, prescription); err != nil {
+		return nil, fmt.Errorf("failed to save prescription: %w", err)
+	}
+	return prescription, nil
+}
+
+func (uc *prescriptionUseCase) LinkConsultation(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID) (*entity.Prescription, error) {
+	appointment, err := uc.getConsultation(ctx, userID, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(appointment.OpChart.Prescription) == "" && len(appointment.OpChart.PrescriptionItems) == 0 {
+		return nil, fmt.Errorf("%w: no prescription was written in this consultation", ErrInvalidPrescription)
+	}
+
+	prescription, err := uc.consultationPrescription(ctx, userID, appointment.OpChart)
+	if err != nil {
+		return nil, err
+	}
+	prescription.OpChart = appointment.OpChart
+	return prescription, nil
+}
+
+func (uc *prescriptionUseCase) ListPrescriptions(ctx context.Context, userID uuid.UUID, page, limit int) ([]*entity.Prescription, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return uc.prescriptionRepo.ListByUser(ctx, userID, page, limit)
+}
+
+func (uc *prescriptionUseCase) GetPrescriptionFile(ctx context.Context, prescriptionID uuid.UUID, userID uuid.UUID) (*entity.Prescription, []byte, error) {
+	prescription, err := getOwnedPrescription(ctx, uc.prescriptionRepo, prescriptionID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return uc.loadFile(ctx, prescription)
+}
+
+func (uc *prescriptionUseCase) ResubmitPrescription(ctx context.Context, orderID uuid.UUID, userID uuid.UUID, prescriptionID uuid.UUID) (*entity.Order, error) {
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if order.UserID != userID {
+		return nil, ErrNotOrderOwner
+	}
+	if !order.AwaitingPrescription() {
+		return nil, ErrPrescriptionNotPending
+	}
+
+	if _, err := getOwnedPrescription(ctx, uc.prescriptionRepo, prescriptionID, userID); err != nil {
+		return nil, err
+	}
+
+	resubmitted, err := uc.prescriptionRepo.ResubmitOrder(ctx, orderID, prescriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resubmit prescription: %w", err)
+	}
+	if !resubmitted {
+		// Approved since the order was read
+		return nil, ErrPrescriptionNotPending
+	}
+	return uc.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+func (uc *prescriptionUseCase) GetEPrescription(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID) (*types.EPrescriptionResponse, error) {
+	appointment, err := uc.getConsultation(ctx, userID, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	opChart := appointment.OpChart
+	resp := &types.EPrescriptionResponse{
+		AppointmentID: appointment.ID,
+		OpChartID:     opChart.ID,
+		DoctorName:    opChart.DoctorName,
+		PatientName:   opChart.PatientName,
+		Date:          strings.Split(opChart.Date, "T")[0],
+		Diagnosis:     opChart.Diagnosis,
+		Prescription:  opChart.Prescription,
+		Items:         opChart.PrescriptionItems,
+	}
+	if resp.PatientName == "" && appointment.Patient != nil {
+		resp.PatientName = strings.TrimSpace(appointment.Patient.FirstName + " " + appointment.Patient.LastName)
+	}
+	if resp.Items == nil {
+		resp.Items = []entity.PrescriptionItem{}
+	}
+	return resp, nil
+}
+
+func (uc *prescriptionUseCase) AddEPrescriptionToCart(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID, req types.PrescriptionToCartRequest) (*types.PrescriptionToCartResponse, error) {
+	appointment, err := uc.getConsultation(ctx, userID, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	items := appointment.OpChart.PrescriptionItems
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: the consultation has no structured prescription", ErrInvalidPrescription)
+	}
+
+	origin, err := searchOrigin(ctx, uc.userRepo, userID, req.Latitude, req.Longitude)
+	if err != nil {
+		return nil, err
+	}
+	radiusKm := req.RadiusKm
+	if radiusKm == 0 {
+		radiusKm = defaultPrescriptionRadiusKm
+	}
+
+	resp := &types.PrescriptionToCartResponse{
+		Matched:   []types.PrescriptionMatch{},
+		Unmatched: []entity.PrescriptionItem{},
+		Dispensed: []entity.PrescriptionItem{},
+	}
+
+	// Only what is left of each item can be ordered again
+	var refillable []entity.PrescriptionItem
+	for _, item := range items {
+		if item.Remaining() == 0 {
+			resp.Dispensed = append(resp.Dispensed, item)
+			continue
+		}
+		refillable = append(refillable, item)
+	}
+	items = refillable
+
+	matches, err := uc.matchPrescriptionItems(ctx, items, origin, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+
+	cartMedicines := make([]entity.CartMedicine, 0, len(items))
+	for i := range items {
+		match := matches[i]
+		if match == nil {
+			resp.Unmatched = append(resp.Unmatched, items[i])
+			continue
+		}
+		resp.Matched = append(resp.Matched, types.PrescriptionMatch{
+			Item:       items[i],
+			Medicine:   match.medicine,
+			DistanceKm: match.distanceKm,
+		})
+		cartMedicines = append(cartMedicines, entity.CartMedicine{
+			MedicineID:         match.medicine.ID,
+			Quantity:           items[i].Remaining(),
+			PrescriptionItemID: &items[i].ID,
+		})
+	}
+
+	if len(cartMedicines) > 0 {
+		prescription, err := uc.consultationPrescription(ctx, userID, appointment.OpChart)
+		if err != nil {
+			return nil, err
+		}
+		resp.Prescription = prescription
+
+		if err := uc.orderRepo.FillCartFromPrescription(ctx, userID, prescription.ID, cartMedicines); err != nil {
+			return nil, fmt.Errorf("failed to fill cart: %w", err)
+		}
+		cart, err := uc.orderRepo.GetCartByUserID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cart: %w", err)
+		}
+		if err := priceCart(ctx, uc.couponRepo, cart); err != nil {
+			return nil, err
+		}
+		resp.Cart = cart
+	}
+	return resp, nil
+}
+
+// prescriptionCandidate is a medicine that could fill a prescription item
+type prescriptionCandidate struct {
+	medicine   *entity.Medicine
+	distanceKm *float64
+}
+
+// matchPrescriptionItems picks an in-stock medicine for every item it can,
+// searching pharmacies within radiusKm of origin when it is set. Pharmacies
+// stocking more of the items are preferred so the prescription is split
+// across as few orders as possible, then the nearest, then the cheapest.
+func (uc *prescriptionUseCase) matchPrescriptionItems(ctx context.Context, items []entity.PrescriptionItem, origin *entity.GeoLocation, radiusKm float64) ([]*prescriptionCandidate, error) {
+	candidates := make([][]prescriptionCandidate, len(items))
+	coverage := make(map[uuid.UUID]int)
+
+	for i, item := range items {
+		medicines, err := uc.medicineRepo.FindInStock(ctx, item.MedicineName, 50)
+		if err != nil {
+			return nil, err
+		}
+
+		stocked := make(map[uuid.UUID]bool)
+		for _, medicine := range medicines {
+			if medicine.Pharmacy == nil || medicine.Quantity < item.Remaining() {
+				continue
+			}
+
+			candidate := prescriptionCandidate{medicine: medicine}
+			if origin != nil {
+				if !medicine.Pharmacy.HasCoordinates() {
+					continue
+				}
+				distance := entity.DistanceKm(origin.Latitude, origin.Longitude, medicine.Pharmacy.Latitude, medicine.Pharmacy.Longitude)
+				if distance > radiusKm {
+					continue
+				}
+				candidate.distanceKm = &distance
+			}
+
+			candidates[i] = append(candidates[i], candidate)
+			if !stocked[medicine.PharmacyID] {
+				stocked[medicine.PharmacyID] = true
+				coverage[medicine.PharmacyID]++
+			}
+		}
+	}
+
+	matches := make([]*prescriptionCandidate, len(items))
+	for i := range candidates {
+		options := candidates[i]
+		if len(options) == 0 {
+			continue
+		}
+		sort.SliceStable(options, func(a, b int) bool {
+			ca, cb := coverage[options[a].medicine.PharmacyID], coverage[options[b].medicine.PharmacyID]
+			if ca != cb {
+				return ca > cb
+			}
+			if options[a].distanceKm != nil && options[b].distanceKm != nil && *options[a].distanceKm != *options[b].distanceKm {
+				return *options[a].distanceKm < *options[b].distanceKm
+			}
+			return options[a].medicine.Price < options[b].medicine.Price
+		})
+		matches[i] = &options[0]
+	}
+	return matches, nil
+}
+
+// searchOrigin is the point to search pharmacies around: the one in the
+// request, else the user's address. Nil means search everywhere.
+func searchOrigin(ctx context.Context, userRepo repository.UserRepository, userID uuid.UUID, latitude, longitude *float64) (*entity.GeoLocation, error) {
+	if latitude != nil && longitude != nil {
+		return &entity.GeoLocation{Latitude: *latitude, Longitude: *longitude}, nil
+	}
+
+	user, err := userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || !user.Address.HasCoordinates() {
+		return nil, nil
+	}
+	return &user.Address, nil
+}
+
+// consultationPrescription returns the user's prescription record for an op
+// chart, creating it the first time
+func (uc *prescriptionUseCase) consultationPrescription(ctx context.Context, userID uuid.UUID, opChart *entity.OpChart) (*entity.Prescription, error) {
+	prescription, err := uc.prescriptionRepo.GetByOpChartID(ctx, userID, opChart.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription != nil {
+		return prescription, nil
+	}
+
+	prescription = &entity.Prescription{
+		UserID:    userID,
+		Source:    entity.PrescriptionSourceConsultation,
+		OpChartID: &opChart.ID,
+	}
+	if err := uc.prescriptionRepo.Create(ctx, prescription); err != nil {
+		return nil, fmt.Errorf("failed to save prescription: %w", err)
+	}
+	return prescription, nil
+}
+
+// getConsultation loads one of the user's consultations that has an op chart
+func (uc *prescriptionUseCase) getConsultation(ctx context.Context, userID uuid.UUID, appointmentID uuid.UUID) (*entity.Appointment, error) {
+	appointment, err := uc.appoinmentRepo.GetByID(ctx, appointmentID)
+	if err != nil || appointment.PatientID != userID || appointment.OpChart == nil {
+		return nil, fmt.Errorf("%w: consultation not found", ErrPrescriptionNotFound)
+	}
+	return appointment, nil
+}
+
+func (uc *prescriptionUseCase) ListReviews(ctx context.Context, filter types.ListPrescriptionReviewsFilter) ([]*entity.Order, int64, error) {
+	if filter.Status == "" {
+		filter.Status = entity.PrescriptionStatusPending
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+	return uc.prescriptionRepo.ListReviews(ctx, filter)
+}
+
+func (uc *prescriptionUseCase) GetOrderPrescriptionFile(ctx context.Context, orderID uuid.UUID, pharmacyID uuid.UUID) (*entity.Prescription, []byte, error) {
+	order, err := uc.getPharmacyOrder(ctx, orderID, pharmacyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.PrescriptionID == nil {
+		return nil, nil, ErrPrescriptionNotFound
+	}
+
+	prescription, err := uc.prescriptionRepo.GetByID(ctx, *order.PrescriptionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription == nil {
+		return nil, nil, ErrPrescriptionNotFound
+	}
+	return uc.loadFile(ctx, prescription)
+}
+
+func (uc *prescriptionUseCase) ReviewPrescription(ctx context.Context, orderID uuid.UUID, pharmacyID uuid.UUID, reviewerID uuid.UUID, req types.ReviewPrescriptionRequest) (*entity.Order, error) {
+	order, err := uc.getPharmacyOrder(ctx, orderID, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	if order.PrescriptionStatus != entity.PrescriptionStatusPending {
+		return nil, ErrPrescriptionNotPending
+	}
+
+	reviewed, err := uc.prescriptionRepo.ReviewOrder(ctx, orderID, req.Status, reviewerID, strings.TrimSpace(req.Note))
+	if err != nil {
+		return nil, fmt.Errorf("failed to review prescription: %w", err)
+	}
+	if !reviewed {
+		// Reviewed or resubmitted since the order was read
+		return nil, ErrPrescriptionNotPending
+	}
+	return uc.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+// getPharmacyOrder loads an order the pharmacy fulfils
+func (uc *prescriptionUseCase) getPharmacyOrder(ctx context.Context, orderID uuid.UUID, pharmacyID uuid.UUID) (*entity.Order, error) {
+	order, err := uc.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if order == nil || !order.BelongsToPharmacy(pharmacyID) {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// loadFile reads an uploaded prescription from the document store
+func (uc *prescriptionUseCase) loadFile(ctx context.Context, prescription *entity.Prescription) (*entity.Prescription, []byte, error) {
+	if !prescription.HasFile() {
+		return nil, nil, fmt.Errorf("%w: prescription has no file", ErrPrescriptionNotFound)
+	}
+	content, err := uc.store.Load(ctx, prescription.FilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load prescription: %w", err)
+	}
+	return prescription, content, nil
+}
+
+// getOwnedPrescription loads one of the user's prescriptions
+func getOwnedPrescription(ctx context.Context, prescriptionRepo repository.PrescriptionRepository, prescriptionID uuid.UUID, userID uuid.UUID) (*entity.Prescription, error) {
+	prescription, err := prescriptionRepo.GetByID(ctx, prescriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription == nil || prescription.UserID != userID {
+		return nil, ErrPrescriptionNotFound
+	}
+	return prescription, nil
+}
+
+// checkPrescription makes sure a checkout with prescription-only medicines
+// comes with one of the user's prescriptions
+func checkPrescription(ctx context.Context, prescriptionRepo repository.PrescriptionRepository, userID uuid.UUID, prescriptionID *uuid.UUID, lines entity.PaymentLineItems) error {
+	if !lines.RequiresPrescription() {
+		return nil
+	}
+	if prescriptionID == nil {
+		return ErrPrescriptionRequired
+	}
+	_, err := getOwnedPrescription(ctx, prescriptionRepo, *prescriptionID, userID)
+	return err
+}
@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/types"
+)
+
+// PriceComparisonUseCase compares what pharmacies charge for the same medicine
+type PriceComparisonUseCase interface {
+	// CompareMedicines groups the listings matching the search into
+	// equivalent medicines, each with its offers sorted by price or distance.
+	CompareMedicines(ctx context.Context, userID uuid.UUID, req types.CompareMedicinesRequest) ([]types.MedicineComparison, int64, error)
+}
+
+type priceComparisonUseCase struct {
+	medicineRepo repository.MedicineRepository
+	userRepo     repository.UserRepository
+}
+
+// NewPriceComparisonUseCase creates a new instance of priceComparisonUseCase
+func NewPriceComparisonUseCase(medicineRepo repository.MedicineRepository, userRepo repository.UserRepository) PriceComparisonUseCase {
+	return &priceComparisonUseCase{
+		medicineRepo: medicineRepo,
+		userRepo:     userRepo,
+	}
+}
+
+func (uc *priceComparisonUseCase) CompareMedicines(ctx context.Context, userID uuid.UUID, req types.CompareMedicinesRequest) ([]types.MedicineComparison, int64, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 10
+	}
+
+	origin, err := searchOrigin(ctx, uc.userRepo, userID, req.Latitude, req.Longitude)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	groups, total, err := uc.medicineRepo.CompareListings(ctx, req, origin)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	byDistance := req.Sort == "distance"
+	comparisons := make([]types.MedicineComparison, 0, len(groups))
+	for _, group := range groups {
+		comparison := newComparison(group, origin)
+		if len(comparison.Offers) == 0 {
+			continue
+		}
+		sortComparisonOffers(comparison.Offers, byDistance)
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons, total, nil
+}
+
+// newComparison builds the comparison of a group of listings, measuring the
+// distance to each pharmacy from origin when it is known
+func newComparison(group types.ListingGroup, origin *entity.GeoLocation) types.MedicineComparison {
+	comparison := types.MedicineComparison{
+		Key:    group.Key,
+		Offers: []types.ComparisonOffer{},
+	}
+
+	for _, medicine := range group.Listings {
+		if medicine.Pharmacy == nil {
+			continue
+		}
+		if len(comparison.Offers) == 0 {
+			comparison.Name = medicine.Name
+			comparison.Content = medicine.Content
+			if medicine.Drug != nil {
+				comparison.Name = medicine.Drug.DisplayName()
+				comparison.Content = medicine.Drug.Composition
+				comparison.Drug = medicine.Drug
+			}
+		}
+
+		offer := types.ComparisonOffer{
+			MedicineID:   medicine.ID,
+			Name:         medicine.Name,
+			PharmacyID:   medicine.PharmacyID,
+			PharmacyName: medicine.Pharmacy.Name,
+			Price:        medicine.Price,
+			Quantity:     medicine.Quantity,
+			InStock:      medicine.Quantity > 0,
+		}
+		if origin != nil && medicine.Pharmacy.HasCoordinates() {
+			distance := entity.DistanceKm(origin.Latitude, origin.Longitude, medicine.Pharmacy.Latitude, medicine.Pharmacy.Longitude)
+			offer.DistanceKm = &distance
+		}
+
+		if len(comparison.Offers) == 0 || offer.Price < comparison.LowestPrice {
+			comparison.LowestPrice = offer.Price
+		}
+		if offer.Price > comparison.HighestPrice {
+			comparison.HighestPrice = offer.Price
+		}
+		comparison.Offers = append(comparison.Offers, offer)
+	}
+	return comparison
+}
+
+// sortComparisonOffers puts in-stock offers first, then orders them by price
+// or by distance
+func sortComparisonOffers(offers []types.ComparisonOffer, byDistance bool) {
+	sort.SliceStable(offers, func(a, b int) bool {
+		return comparisonOfferLess(offers[a], offers[b], byDistance)
+	})
+}
+
+// comparisonOfferLess orders offers in stock first, then by distance (unknown
+// distances last) when byDistance is set, then by price
+func comparisonOfferLess(a, b types.ComparisonOffer, byDistance bool) bool {
+	if a.InStock != b.InStock {
+		return a.InStock
+	}
+	if byDistance {
+		switch {
+		case a.DistanceKm != nil && b.DistanceKm == nil:
+			return true
+		case a.DistanceKm == nil && b.DistanceKm != nil:
+			return false
+		case a.DistanceKm != nil && *a.DistanceKm != *b.DistanceKm:
+			return *a.DistanceKm < *b.DistanceKm
+		}
+	}
+	return a.Price < b.Price
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/infrastructure/cache"
+	"github.com/skryfon/collex/internal/types"
+)
+
+const (
+	// defaultSuggestLimit is how many suggestions each group returns
+	defaultSuggestLimit = 5
+	// suggestCacheTTL bounds how stale stock-dependent suggestions can get
+	suggestCacheTTL = 5 * time.Minute
+	// suggestVersionKey holds the generation of cached suggestions; changing
+	// it invalidates every suggestion cached under the previous one
+	suggestVersionKey = "search:suggest:version"
+	suggestVersionTTL = 24 * time.Hour
+)
+
+// SearchSuggestUseCase completes what a user types in the search box from
+// medicine names, drug generics, doctor names and specializations
+type SearchSuggestUseCase interface {
+	Suggest(ctx context.Context, req types.SearchSuggestRequest) (*types.SearchSuggestions, error)
+	// InvalidateSuggestions drops the cached suggestions. It is called when
+	// medicines, drugs or doctors change and never fails the change itself.
+	InvalidateSuggestions(ctx context.Context)
+}
+
+type searchSuggestUseCase struct {
+	medicineRepo repository.MedicineRepository
+	drugRepo     repository.DrugRepository
+	doctorRepo   repository.DoctorRepository
+	cache        cache.Cache
+}
+
+// NewSearchSuggestUseCase creates a new instance of searchSuggestUseCase
+func NewSearchSuggestUseCase(medicineRepo repository.MedicineRepository, drugRepo repository.DrugRepository, doctorRepo repository.DoctorRepository, cache cache.Cache) SearchSuggestUseCase {
+	return &searchSuggestUseCase{
+		medicineRepo: medicineRepo,
+		drugRepo:     drugRepo,
+		doctorRepo:   doctorRepo,
+		cache:        cache,
+	}
+}
+
+func (uc *searchSuggestUseCase) Suggest(ctx context.Context, req types.SearchSuggestRequest) (*types.SearchSuggestions, error) {
+	prefix := strings.Join(strings.Fields(strings.ToLower(req.Query)), " ")
+	limit := req.Limit
+	if limit < 1 {
+		limit = defaultSuggestLimit
+	}
+
+	key := cache.CacheKey("search:suggest", uc.cacheVersion(ctx), limit, prefix)
+	if cached, err := uc.cache.Get(ctx, key); err == nil {
+		var suggestions types.SearchSuggestions
+		if err := json.Unmarshal(cached, &suggestions); err == nil {
+			return &suggestions, nil
+		}
+	}
+
+	suggestions := &types.SearchSuggestions{
+		Medicines:       []string{},
+		Drugs:           []string{},
+		Doctors:         []types.DoctorSuggestion{},
+		Specializations: []string{},
+	}
+	if prefix == "" {
+		return suggestions, nil
+	}
+
+	var err error
+	if suggestions.Medicines, err = uc.medicineRepo.SuggestNames(ctx, prefix, limit); err != nil {
+		return nil, err
+	}
+	if suggestions.Drugs, err = uc.drugRepo.SuggestGenericNames(ctx, prefix, limit); err != nil {
+		return nil, err
+	}
+	if suggestions.Doctors, err = uc.doctorRepo.SuggestDoctors(ctx, prefix, limit); err != nil {
+		return nil, err
+	}
+	if suggestions.Specializations, err = uc.doctorRepo.SuggestSpecializations(ctx, prefix, limit); err != nil {
+		return nil, err
+	}
+
+	if err := uc.cache.Set(ctx, key, suggestions, suggestCacheTTL); err != nil {
+		log.Printf("failed to cache suggestions for %q: %v", prefix, err)
+	}
+	return suggestions, nil
+}
+
+func (uc *searchSuggestUseCase) InvalidateSuggestions(ctx context.Context) {
+	if err := uc.cache.Set(ctx, suggestVersionKey, newSuggestVersion(), suggestVersionTTL); err != nil {
+		log.Printf("failed to invalidate search suggestions: %v", err)
+	}
+}
+
+// cacheVersion returns the current generation of cached suggestions,
+// starting a new one when there is none
+func (uc *searchSuggestUseCase) cacheVersion(ctx context.Context) string {
+	if version, err := uc.cache.Get(ctx, suggestVersionKey); err == nil {
+		return string(version)
+	}
+
+	version := newSuggestVersion()
+	if err := uc.cache.Set(ctx, suggestVersionKey, version, suggestVersionTTL); err != nil {
+		log.Printf("failed to start search suggestion cache: %v", err)
+	}
+	return version
+}
+
+// newSuggestVersion returns a generation that differs from earlier ones
+func newSuggestVersion() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
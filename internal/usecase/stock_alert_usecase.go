@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+	"github.com/skryfon/collex/internal/domain/service"
+	"github.com/skryfon/collex/internal/types"
+)
+
+// StockAlertUseCase warns pharmacies about stock that is expiring, expired or
+// below its reorder level
+type StockAlertUseCase interface {
+	GetStockAlerts(ctx context.Context, pharmacyID uuid.UUID) (*types.StockAlertsResponse, error)
+	// SendStockAlertDigests emails every pharmacy with something to act on a
+	// digest of its alerts.
+	SendStockAlertDigests(ctx context.Context) error
+	// ExpireStock takes expired batches out of the medicines' sellable stock.
+	ExpireStock(ctx context.Context) error
+}
+
+type stockAlertUseCase struct {
+	medicineRepo repository.MedicineRepository
+	batchRepo    repository.MedicineBatchRepository
+	emailService service.EmailService
+	expiryWindow time.Duration
+}
+
+// NewStockAlertUseCase creates a new instance of stockAlertUseCase
+func NewStockAlertUseCase(
+	medicineRepo repository.MedicineRepository,
+	batchRepo repository.MedicineBatchRepository,
+	emailService service.EmailService,
+	expiryWindow time.Duration,
+) StockAlertUseCase {
+	return &stockAlertUseCase{
+		medicineRepo: medicineRepo,
+		batchRepo:    batchRepo,
+		emailService: emailService,
+		expiryWindow: expiryWindow,
+	}
+}
+
+func (uc *stockAlertUseCase) GetStockAlerts(ctx context.Context, pharmacyID uuid.UUID) (*types.StockAlertsResponse, error) {
+	alerts, err := uc.collectAlerts(ctx, &pharmacyID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if report, ok := alerts[pharmacyID]; ok {
+		return report.alerts, nil
+	}
+	return uc.emptyAlerts(), nil
+}
+
+func (uc *stockAlertUseCase) SendStockAlertDigests(ctx context.Context) error {
+	alerts, err := uc.collectAlerts(ctx, nil, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for pharmacyID, report := range alerts {
+		pharmacy := report.pharmacy
+		if pharmacy == nil || pharmacy.Email == nil || *pharmacy.Email == "" {
+			log.Printf("Pharmacy %s has no email; skipping stock alert digest", pharmacyID)
+			continue
+		}
+
+		data := map[string]interface{}{
+			"UserEmail":    *pharmacy.Email,
+			"PharmacyName": pharmacy.Name,
+			"WindowDays":   report.alerts.WindowDays,
+			"Expired":      report.alerts.Expired,
+			"Expiring":     report.alerts.Expiring,
+			"LowStock":     report.alerts.LowStock,
+		}
+		if err := uc.emailService.Send(ctx, entity.EmailTypeStockAlert, data); err != nil {
+			log.Printf("Failed to send stock alert digest to pharmacy %s: %v", pharmacyID, err)
+		}
+	}
+	return nil
+}
+
+func (uc *stockAlertUseCase) ExpireStock(ctx context.Context) error {
+	synced, err := uc.batchRepo.SyncExpired(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to expire stock: %w", err)
+	}
+	if synced > 0 {
+		log.Printf("Refreshed stock of %d medicines with expired batches", synced)
+	}
+	return nil
+}
+
+// pharmacyAlerts is the digest of one pharmacy
+type pharmacyAlerts struct {
+	pharmacy *entity.Pharmacy
+	alerts   *types.StockAlertsResponse
+}
+
+// collectAlerts gathers the alerts of one pharmacy, or of every pharmacy when
+// pharmacyID is nil, keyed by pharmacy. Pharmacies with nothing to report are
+// left out.
+func (uc *stockAlertUseCase) collectAlerts(ctx context.Context, pharmacyID *uuid.UUID, now time.Time) (map[uuid.UUID]*pharmacyAlerts, error) {
+	batches, err := uc.batchRepo.ListExpiringBatches(ctx, pharmacyID, now.Add(uc.expiryWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expiring batches: %w", err)
+	}
+	lowStock, err := uc.medicineRepo.ListLowStock(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[uuid.UUID]*pharmacyAlerts)
+	reportFor := func(medicine *entity.Medicine) *types.StockAlertsResponse {
+		report, ok := reports[medicine.PharmacyID]
+		if !ok {
+			report = &pharmacyAlerts{
+				pharmacy: medicine.Pharmacy,
+				alerts:   uc.emptyAlerts(),
+			}
+			reports[medicine.PharmacyID] = report
+		}
+		return report.alerts
+	}
+
+	for _, batch := range batches {
+		if batch.Medicine == nil || batch.ExpiryDate == nil {
+			continue
+		}
+		alert := types.ExpiryAlert{
+			MedicineID:   batch.MedicineID,
+			MedicineName: batch.Medicine.Name,
+			BatchID:      batch.ID,
+			BatchNumber:  batch.BatchNumber,
+			ExpiryDate:   *batch.ExpiryDate,
+			Quantity:     batch.Quantity,
+			DaysLeft:     int(math.Ceil(batch.ExpiryDate.Sub(now).Hours() / 24)),
+		}
+
+		report := reportFor(batch.Medicine)
+		if batch.Expired(now) {
+			report.Expired = append(report.Expired, alert)
+		} else {
+			report.Expiring = append(report.Expiring, alert)
+		}
+	}
+
+	for _, medicine := range lowStock {
+		report := reportFor(medicine)
+		report.LowStock = append(report.LowStock, types.LowStockAlert{
+			MedicineID:   medicine.ID,
+			MedicineName: medicine.Name,
+			Quantity:     medicine.Quantity,
+			ReorderLevel: medicine.ReorderLevel,
+		})
+	}
+
+	return reports, nil
+}
+
+func (uc *stockAlertUseCase) emptyAlerts() *types.StockAlertsResponse {
+	return &types.StockAlertsResponse{
+		WindowDays: int(uc.expiryWindow.Hours() / 24),
+		Expired:    []types.ExpiryAlert{},
+		Expiring:   []types.ExpiryAlert{},
+		LowStock:   []types.LowStockAlert{},
+	}
+}
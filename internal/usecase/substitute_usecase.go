@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/skryfon/collex/internal/domain/entity"
+	"github.com/skryfon/collex/internal/domain/repository"
+)
+
+// maxSubstitutes is how many cheaper equivalents are suggested per medicine
+const maxSubstitutes = 5
+
+// SubstituteUseCase suggests cheaper medicines with the same salt combination,
+// at the same or other pharmacies
+type SubstituteUseCase interface {
+	// GetMedicineDetail returns an active medicine with its substitutes.
+	GetMedicineDetail(ctx context.Context, medicineID uuid.UUID) (*entity.Medicine, error)
+	ListSubstitutes(ctx context.Context, medicineID uuid.UUID) ([]*entity.Medicine, error)
+	// SuggestCartSubstitutes sets the substitutes of every medicine in the cart.
+	SuggestCartSubstitutes(ctx context.Context, cart *entity.Cart) error
+}
+
+type substituteUseCase struct {
+	medicineRepo repository.MedicineRepository
+}
+
+// NewSubstituteUseCase creates a new instance of substituteUseCase
+func NewSubstituteUseCase(medicineRepo repository.MedicineRepository) SubstituteUseCase {
+	return &substituteUseCase{
+		medicineRepo: medicineRepo,
+	}
+}
+
+func (uc *substituteUseCase) GetMedicineDetail(ctx context.Context, medicineID uuid.UUID) (*entity.Medicine, error) {
+	medicine, err := uc.getActiveMedicine(ctx, medicineID)
+	if err != nil {
+		return nil, err
+	}
+
+	medicine.Substitutes, err = uc.medicineRepo.FindSubstitutes(ctx, medicine, maxSubstitutes)
+	if err != nil {
+		return nil, err
+	}
+	return medicine, nil
+}
+
+func (uc *substituteUseCase) ListSubstitutes(ctx context.Context, medicineID uuid.UUID) ([]*entity.Medicine, error) {
+	medicine, err := uc.getActiveMedicine(ctx, medicineID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.medicineRepo.FindSubstitutes(ctx, medicine, maxSubstitutes)
+}
+
+func (uc *substituteUseCase) SuggestCartSubstitutes(ctx context.Context, cart *entity.Cart) error {
+	if cart == nil {
+		return nil
+	}
+
+	for i := range cart.Medicines {
+		medicine := &cart.Medicines[i].Medicine
+		substitutes, err := uc.medicineRepo.FindSubstitutes(ctx, medicine, maxSubstitutes)
+		if err != nil {
+			return err
+		}
+		medicine.Substitutes = substitutes
+	}
+	return nil
+}
+
+// getActiveMedicine returns a medicine patients can see
+func (uc *substituteUseCase) getActiveMedicine(ctx context.Context, medicineID uuid.UUID) (*entity.Medicine, error) {
+	medicine, err := uc.medicineRepo.GetMedicineByID(ctx, medicineID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get medicine: %w", err)
+	}
+	if medicine == nil || !medicine.IsActive {
+		return nil, ErrMedicineNotFound
+	}
+	return medicine, nil
+}
@@ -36,13 +36,15 @@ type UserUseCase interface {
 type userUseCase struct {
 	userRepo     repository.UserRepository
 	emailService service.EmailService
+	suggestions  SearchSuggestUseCase
 }
 
 // NewUserUseCase creates a new instance of userUseCase
-func NewUserUseCase(userRepo repository.UserRepository, emailService service.EmailService) UserUseCase {
+func NewUserUseCase(userRepo repository.UserRepository, emailService service.EmailService, suggestions SearchSuggestUseCase) UserUseCase {
 	return &userUseCase{
 		userRepo:     userRepo,
 		emailService: emailService,
+		suggestions:  suggestions,
 	}
 }
 
@@ -245,6 +247,7 @@ func (u *userUseCase) UpdateUser(ctx context.Context, id uuid.UUID, user *entity
 			Message: "Failed to update user",
 		}
 	}
+	u.suggestions.InvalidateSuggestions(ctx)
 
 	return existingUser, nil
 }
@@ -315,6 +318,7 @@ func (u *userUseCase) UpdateUserStatus(ctx context.Context, id uuid.UUID, status
 			Message: "Failed to update user status",
 		}
 	}
+	u.suggestions.InvalidateSuggestions(ctx)
 
 	return nil
 }
@@ -560,10 +564,19 @@ func (u *userUseCase) GetRoleByID(ctx context.Context, id uuid.UUID) ([]*entity.
 	return roles, nil
 }
 func (u *userUseCase) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	return u.userRepo.DeleteUser(ctx, id)
+	if err := u.userRepo.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	u.suggestions.InvalidateSuggestions(ctx)
+	return nil
 }
 func (u *userUseCase) CreateDoctor(ctx context.Context, user *entity.Doctor) (*entity.Doctor, error) {
-	return u.userRepo.CreateDoctor(ctx, user)
+	doctor, err := u.userRepo.CreateDoctor(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	u.suggestions.InvalidateSuggestions(ctx)
+	return doctor, nil
 }
 
 func (u *userUseCase) CreatePharmacy(ctx context.Context, pharmacy *entity.Pharmacy) (*entity.Pharmacy, error) {
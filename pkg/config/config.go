@@ -13,13 +13,16 @@ import (
 
 // Config holds all application configuration
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	App      AppConfig
-	CORS     Cors        // Added CORS configuration
-	Email    EmailConfig // ✅ add this
-	Payment  Payment
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	App       AppConfig
+	CORS      Cors        // Added CORS configuration
+	Email     EmailConfig // ✅ add this
+	Payment   Payment
+	Storage   StorageConfig
+	Inventory InventoryConfig
+	Events    EventsConfig
 }
 
 type Cors struct {
@@ -91,9 +94,45 @@ type EmailConfig struct {
 	TemplatePath     string        // Path to template files
 	DevBaseUrl       string
 }
+
+// StorageConfig holds where generated documents such as invoices are kept
+type StorageConfig struct {
+	DocumentPath string // Root directory for generated documents; not served publicly
+}
+
+// InventoryConfig holds when pharmacies are warned about their stock
+type InventoryConfig struct {
+	ExpiryAlertWindow time.Duration // Batches expiring within this window are reported
+	AlertInterval     time.Duration // How often the stock alert digest is emailed
+}
+
+// EventsConfig holds how live events reach the API replicas
+type EventsConfig struct {
+	Backend         string        // memory or postgres
+	StreamKeepAlive time.Duration // How often an idle event stream is pinged
+}
+
+// Event bus backends selectable through EVENT_BUS
+const (
+	EventBusMemory   = "memory"   // in-process, for a single replica
+	EventBusPostgres = "postgres" // LISTEN/NOTIFY, keeps replicas in sync
+)
+
+// Payment gateways selectable through PAYMENT_GATEWAY
+const (
+	PaymentGatewayRazorpay = "razorpay"
+	PaymentGatewayFake     = "fake" // deterministic in-memory gateway for offline use
+)
+
 type Payment struct {
-	RazorpayKey    string
-	RazorpaySecret string
+	Gateway               string // razorpay or fake
+	RazorpayKey           string
+	RazorpaySecret        string
+	RazorpayWebhookSecret string        // Secret configured for the webhook in the Razorpay dashboard
+	ReservationTTL        time.Duration // How long stock is held for an unpaid checkout
+	ReconcileInterval     time.Duration // How often stale pending payments are checked with the gateway
+	StaleAfter            time.Duration // Age after which a pending payment is checked with the gateway
+	AbandonAfter          time.Duration // Age after which a pending payment with no attempts is failed
 }
 
 // LoadConfig loads configuration from environment variables and .env files
@@ -163,8 +202,26 @@ func LoadConfig() *Config {
 			ExposedHeaders:   getStringSliceEnv("CORS_EXPOSED_HEADERS", []string{"Content-Length", "Content-Type", "Authorization"}),
 		},
 		Payment: Payment{
+			Gateway:        getEnv("PAYMENT_GATEWAY", PaymentGatewayRazorpay),
 			RazorpayKey:    getEnv("RAZORPAY_KEY", "rzp_test_RVStDFGuG7R1H7"),
 			RazorpaySecret: getEnv("RAZORPAY_SECRET", "Sc12luS2VZkhXgEg85GyGhO0"),
+
+			RazorpayWebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
+			ReservationTTL:        getDurationEnv("STOCK_RESERVATION_TTL", 15*time.Minute),
+			ReconcileInterval:     getDurationEnv("PAYMENT_RECONCILE_INTERVAL", 5*time.Minute),
+			StaleAfter:            getDurationEnv("PAYMENT_STALE_AFTER", 15*time.Minute),
+			AbandonAfter:          getDurationEnv("PAYMENT_ABANDON_AFTER", time.Hour),
+		},
+		Storage: StorageConfig{
+			DocumentPath: getEnv("DOCUMENT_STORAGE_PATH", "./storage"),
+		},
+		Inventory: InventoryConfig{
+			ExpiryAlertWindow: getDurationEnv("EXPIRY_ALERT_WINDOW", 30*24*time.Hour),
+			AlertInterval:     getDurationEnv("STOCK_ALERT_INTERVAL", 24*time.Hour),
+		},
+		Events: EventsConfig{
+			Backend:         getEnv("EVENT_BUS", EventBusMemory),
+			StreamKeepAlive: getDurationEnv("EVENT_STREAM_KEEPALIVE", 25*time.Second),
 		},
 	}
 }